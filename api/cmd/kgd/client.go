@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// ClientTimeout is how long a private API request may take
+const ClientTimeout time.Duration = 30 * time.Second
+
+// APIError is an error returned by the private API
+type APIError struct {
+	// Status is the HTTP status code of the response
+	Status int
+
+	// Message is the error field of the response
+	Message string
+}
+
+// Error implements error
+func (e APIError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.Status)
+}
+
+// Client makes requests to the private API
+type Client struct {
+	// baseURL is the URL of the private API
+	baseURL string
+
+	// token is the GitHub auth token sent in the Authorization header.
+	// Not sent if empty.
+	token string
+
+	// httpClient makes HTTP requests
+	httpClient *http.Client
+}
+
+// NewClient creates a new Client
+func NewClient(baseURL, token string) Client {
+	return Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout: ClientTimeout,
+		},
+	}
+}
+
+// apiResponse holds the fields in every private API response
+type apiResponse struct {
+	// OK indicates the request succeeded
+	OK bool `json:"ok"`
+
+	// Error describes why the request failed
+	Error string `json:"error"`
+}
+
+// do makes a request. path may include a query. If body is not nil it is
+// sent with the contentType. The response is JSON decoded into out.
+func (c Client) do(method, path string, body io.Reader,
+	contentType string, out interface{}) error {
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err.Error())
+	}
+
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %s", err.Error())
+	}
+
+	var apiResp apiResponse
+
+	err = json.Unmarshal(data, &apiResp)
+	if err != nil {
+		return fmt.Errorf("error decoding response, HTTP status: %d, "+
+			"error: %s", resp.StatusCode, err.Error())
+	}
+
+	if !apiResp.OK {
+		return APIError{
+			Status:  resp.StatusCode,
+			Message: apiResp.Error,
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("error decoding response: %s", err.Error())
+	}
+
+	return nil
+}
+
+// doJSON makes a request with a JSON encoded body
+func (c Client) doJSON(method, path string, body interface{},
+	out interface{}) error {
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %s", err.Error())
+	}
+
+	return c.do(method, path, bytes.NewReader(data), "application/json",
+		out)
+}
+
+// repoPath returns the private API path of a repository
+func repoPath(repoID models.RepositoryID) string {
+	return fmt.Sprintf("/api/v0/github/repositories/%s/%s",
+		url.PathEscape(repoID.Owner), url.PathEscape(repoID.Name))
+}
+
+// jobPath returns the private API path of a job
+func jobPath(jobID models.JobID) string {
+	return fmt.Sprintf("%s/jobs/%d", repoPath(jobID.RepositoryID),
+		jobID.ID)
+}
+
+// ClientID returns the ID of the GitHub app the API authenticates with
+func (c Client) ClientID() (string, error) {
+	var resp struct {
+		ClientID string `json:"client_id"`
+	}
+
+	err := c.do(http.MethodGet, "/api/v0/github/login_url", nil, "",
+		&resp)
+
+	return resp.ClientID, err
+}
+
+// TrackedRepositories returns the tracked repositories
+func (c Client) TrackedRepositories() ([]models.Repository, error) {
+	var resp struct {
+		Repositories []models.Repository `json:"repositories"`
+	}
+
+	err := c.do(http.MethodGet, "/api/v0/github/repositories/tracked", nil,
+		"", &resp)
+
+	return resp.Repositories, err
+}
+
+// Track starts tracking a repository
+func (c Client) Track(repoID models.RepositoryID) error {
+	return c.do(http.MethodPost, repoPath(repoID), nil, "", nil)
+}
+
+// Untrack stops tracking a repository
+func (c Client) Untrack(repoID models.RepositoryID) error {
+	return c.do(http.MethodDelete, repoPath(repoID), nil, "", nil)
+}
+
+// Jobs returns a repository's newest jobs, newest first. A limit less than 1
+// returns all jobs.
+func (c Client) Jobs(repoID models.RepositoryID,
+	limit int) ([]models.Job, error) {
+
+	path := repoPath(repoID) + "/jobs"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+
+	var resp struct {
+		Jobs []models.Job `json:"jobs"`
+	}
+
+	err := c.do(http.MethodGet, path, nil, "", &resp)
+
+	return resp.Jobs, err
+}
+
+// Job returns a job, and the names of its actions in the order they run
+func (c Client) Job(jobID models.JobID) (models.Job, []string, error) {
+	var resp struct {
+		Job     models.Job `json:"job"`
+		Actions []string   `json:"actions"`
+	}
+
+	err := c.do(http.MethodGet, jobPath(jobID), nil, "", &resp)
+
+	return resp.Job, resp.Actions, err
+}
+
+// JobLogs returns at most limit lines of an action's output starting at
+// offset, and the total number of lines in the log
+func (c Client) JobLogs(jobID models.JobID, action string, offset,
+	limit int) ([]models.ActionOutput, int, error) {
+
+	query := url.Values{}
+	query.Set("action", action)
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var resp struct {
+		Lines []models.ActionOutput `json:"lines"`
+		Total int                   `json:"total"`
+	}
+
+	err := c.do(http.MethodGet, jobPath(jobID)+"/logs?"+query.Encode(),
+		nil, "", &resp)
+
+	return resp.Lines, resp.Total, err
+}
+
+// CancelJob cancels a job which has not finished
+func (c Client) CancelJob(jobID models.JobID) error {
+	return c.do(http.MethodPost, jobPath(jobID)+"/cancel", nil, "", nil)
+}
+
+// RerunJob creates a new job for the same Git event as a job. Returns the
+// new job's ID.
+func (c Client) RerunJob(jobID models.JobID) (int64, error) {
+	var resp struct {
+		JobID int64 `json:"job_id"`
+	}
+
+	err := c.do(http.MethodPost, jobPath(jobID)+"/rerun", nil, "", &resp)
+
+	return resp.JobID, err
+}
+
+// Deploy creates a job for a branch or tag. Returns the job's ID and the
+// commit the ref resolved to.
+func (c Client) Deploy(repoID models.RepositoryID,
+	ref string) (int64, models.JobTarget, error) {
+
+	var resp struct {
+		JobID  int64            `json:"job_id"`
+		Target models.JobTarget `json:"target"`
+	}
+
+	err := c.doJSON(http.MethodPost, repoPath(repoID)+"/jobs",
+		map[string]string{
+			"ref": ref,
+		}, &resp)
+
+	return resp.JobID, resp.Target, err
+}
+
+// ValidateConfig validates a job configuration file. Templates are rendered
+// with the target's empty fields set to placeholders. Returns if the file
+// has no errors, and all its problems.
+func (c Client) ValidateConfig(repoID models.RepositoryID, data []byte,
+	format models.ConfigFormat, target models.JobTarget) (bool,
+	[]models.ConfigDiagnostic, error) {
+
+	query := url.Values{}
+	query.Set("format", string(format))
+	query.Set("branch", target.Branch)
+	query.Set("tag", target.Tag)
+	query.Set("commit", target.Commit)
+
+	var resp struct {
+		Valid       bool                      `json:"valid"`
+		Diagnostics []models.ConfigDiagnostic `json:"diagnostics"`
+	}
+
+	err := c.do(http.MethodPost, repoPath(repoID)+"/config/validate?"+
+		query.Encode(), bytes.NewReader(data), "text/plain", &resp)
+
+	return resp.Valid, resp.Diagnostics, err
+}
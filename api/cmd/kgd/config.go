@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultAPIURL is the private API URL used if none is configured
+const DefaultAPIURL string = "http://localhost:5000"
+
+// EnvAPIURL is the environment variable which overrides the saved private
+// API URL
+const EnvAPIURL string = "KGD_API_URL"
+
+// EnvToken is the environment variable which overrides the saved GitHub auth
+// token
+const EnvToken string = "KGD_TOKEN"
+
+// Config is the kgd configuration, saved by the login command
+type Config struct {
+	// APIURL is the URL of the private API
+	APIURL string `json:"api_url"`
+
+	// Token is the GitHub auth token sent to the private API
+	Token string `json:"token"`
+}
+
+// ConfigPath returns the path of the kgd configuration file
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "kgd", "config.json"), nil
+}
+
+// LoadConfig reads the configuration file, if it exists, and applies the
+// environment variable overrides
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		APIURL: DefaultAPIURL,
+	}
+
+	path, err := ConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return cfg, fmt.Errorf("error reading %s: %s", path, err.Error())
+	} else if err == nil {
+		err = json.Unmarshal(data, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("error decoding %s: %s", path,
+				err.Error())
+		}
+	}
+
+	if apiURL := os.Getenv(EnvAPIURL); len(apiURL) > 0 {
+		cfg.APIURL = apiURL
+	}
+
+	if token := os.Getenv(EnvToken); len(token) > 0 {
+		cfg.Token = token
+	}
+
+	return cfg, nil
+}
+
+// Save writes the configuration file. Only readable by the current user,
+// since it holds an auth token.
+func (c Config) Save() (string, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s: %s", filepath.Dir(path),
+			err.Error())
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding configuration: %s",
+			err.Error())
+	}
+
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error writing %s: %s", path, err.Error())
+	}
+
+	return path, nil
+}
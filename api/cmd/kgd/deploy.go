@@ -0,0 +1,25 @@
+package main
+
+// runDeploy creates a job for a branch or tag
+func runDeploy(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("deploy", "REPO REF"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	jobID, target, err := cli.client.Deploy(repoID, args[1])
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"job_id": jobID,
+		"target": target,
+	}, "Deploying %s at %s in job %d", jobRef(target),
+		shortCommit(target.Commit), jobID)
+}
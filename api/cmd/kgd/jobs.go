@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// DefaultJobsLimit is the number of jobs listed if the limit flag is not
+// provided
+const DefaultJobsLimit int = 20
+
+// LogPageLines is the number of log lines requested at once
+const LogPageLines int = 500
+
+// FollowInterval is how often logs are checked for new lines when they are
+// followed
+const FollowInterval time.Duration = 2 * time.Second
+
+// parseJobArgs parses REPO and ID arguments
+func parseJobArgs(args []string) (models.JobID, error) {
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return models.JobID{}, err
+	}
+
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return models.JobID{}, fmt.Errorf("job ID must be an integer, "+
+			"was: %s", args[1])
+	}
+
+	return models.JobID{
+		RepositoryID: repoID,
+		ID:           id,
+	}, nil
+}
+
+// jobRef returns the branch or tag a job deploys
+func jobRef(target models.JobTarget) string {
+	if len(target.Tag) > 0 {
+		return target.Tag
+	}
+
+	return target.Branch
+}
+
+// shortCommit returns the abbreviated form of a Git sha
+func shortCommit(commit string) string {
+	if len(commit) > models.ShortCommitLength {
+		return commit[:models.ShortCommitLength]
+	}
+
+	return commit
+}
+
+// jobStatus summarizes a job's state
+func jobStatus(state models.JobState) string {
+	switch {
+	case state.Succeeded():
+		return "succeeded"
+	case state.Done():
+		return "failed"
+	case state.AwaitingApproval():
+		return "awaiting_approval"
+	case state.Frozen():
+		return "frozen"
+	case state.QueuePosition > 0:
+		return fmt.Sprintf("queued (%d)", state.QueuePosition)
+	case state.PrepareState != nil &&
+		state.PrepareState.Stage == models.Queued:
+		return "queued"
+	default:
+		return "running"
+	}
+}
+
+// jobOrigin describes which job a rollback or promotion came from
+func jobOrigin(job models.Job) string {
+	if job.RollbackOf != nil {
+		return fmt.Sprintf("rollback of %d", *job.RollbackOf)
+	} else if job.PromotedFrom != nil {
+		return fmt.Sprintf("promotion of %d", *job.PromotedFrom)
+	}
+
+	return ""
+}
+
+// runJobsList prints a repository's newest jobs
+func runJobsList(cli CLI, args []string) error {
+	flags := newFlagSet("jobs list", "REPO")
+
+	limit := flags.Int("limit", DefaultJobsLimit, "Maximum number of "+
+		"jobs to list, 0 lists all jobs")
+
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	jobs, err := cli.client.Jobs(repoID, *limit)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, job := range jobs {
+		rows = append(rows, []string{
+			strconv.FormatInt(job.ID.ID, 10),
+			jobRef(job.Target),
+			shortCommit(job.Target.Commit),
+			jobStatus(job.State),
+			orDash(jobOrigin(job)),
+		})
+	}
+
+	return cli.printer.Table(jobs, []string{"ID", "REF", "COMMIT",
+		"STATUS", "ORIGIN"}, rows)
+}
+
+// runJobsShow prints the state of each of a job's actions
+func runJobsShow(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("jobs show", "REPO ID"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	jobID, err := parseJobArgs(args)
+	if err != nil {
+		return err
+	}
+
+	job, actions, err := cli.client.Job(jobID)
+	if err != nil {
+		return err
+	}
+
+	if cli.printer.format == OutputTable {
+		fmt.Fprintf(cli.printer.w, "Job %d: %s at %s, %s\n\n", job.ID.ID,
+			jobRef(job.Target), shortCommit(job.Target.Commit),
+			jobStatus(job.State))
+	}
+
+	rows := [][]string{}
+	for _, name := range actions {
+		state := job.State.Action(name)
+		if state == nil {
+			continue
+		}
+
+		attempt := "-"
+		if state.Attempt > 0 {
+			attempt = fmt.Sprintf("%d/%d", state.Attempt,
+				state.MaxAttempts)
+		}
+
+		rows = append(rows, []string{
+			name,
+			string(state.Stage),
+			attempt,
+			orDash(state.LastError),
+		})
+	}
+
+	return cli.printer.Table(job, []string{"ACTION", "STAGE", "ATTEMPT",
+		"LAST ERROR"}, rows)
+}
+
+// logLine is a line of an action's output printed as JSON
+type logLine struct {
+	// Action is the name of the action which output the line
+	Action string `json:"action"`
+
+	// Text is the line
+	Text string `json:"text"`
+
+	// Error indicates if the line is error output
+	Error bool `json:"error"`
+}
+
+// printLogLine prints a line of an action's output. If prefix is true the
+// line starts with the action's name, used when many actions are printed.
+func printLogLine(p Printer, action string, line models.ActionOutput,
+	prefix bool) error {
+
+	if p.format == OutputJSON {
+		return json.NewEncoder(p.w).Encode(logLine{
+			Action: action,
+			Text:   line.Text,
+			Error:  line.Error,
+		})
+	}
+
+	if prefix {
+		_, err := fmt.Fprintf(p.w, "[%s] %s\n", action, line.Text)
+		return err
+	}
+
+	_, err := fmt.Fprintln(p.w, line.Text)
+
+	return err
+}
+
+// printNewLogLines prints the lines of an action's log after the offset, then
+// updates the offset
+func printNewLogLines(cli CLI, jobID models.JobID, action string,
+	offsets map[string]int, prefix bool) error {
+
+	for {
+		lines, total, err := cli.client.JobLogs(jobID, action,
+			offsets[action], LogPageLines)
+		if err != nil {
+			return fmt.Errorf("error retrieving %s log: %s", action,
+				err.Error())
+		}
+
+		for _, line := range lines {
+			err = printLogLine(cli.printer, action, line, prefix)
+			if err != nil {
+				return err
+			}
+		}
+
+		offsets[action] += len(lines)
+
+		if len(lines) == 0 || offsets[action] >= total {
+			return nil
+		}
+	}
+}
+
+// runJobsLogs prints a job's logs. When following, new lines are printed
+// until the job finishes or pauses.
+func runJobsLogs(cli CLI, args []string) error {
+	flags := newFlagSet("jobs logs", "REPO ID")
+
+	action := flags.String("action", "", "Only print the log of one "+
+		"action, ex: \"units/api/docker\"")
+	follow := flags.Bool("f", false, "Print new lines until the job "+
+		"finishes or pauses")
+
+	args, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	jobID, err := parseJobArgs(args)
+	if err != nil {
+		return err
+	}
+
+	offsets := map[string]int{}
+
+	for {
+		// The job is retrieved before its logs, so once it is done the
+		// logs are complete
+		job, actions, err := cli.client.Job(jobID)
+		if err != nil {
+			return err
+		}
+
+		if len(*action) > 0 {
+			actions = []string{*action}
+		}
+
+		for _, name := range actions {
+			err = printNewLogLines(cli, jobID, name, offsets,
+				len(actions) > 1)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The worker saves the job one last time while it pauses
+		stopped := job.State.Done() || (job.State.Paused() &&
+			job.State.CleanupState.Done())
+
+		if !*follow || stopped {
+			return nil
+		}
+
+		time.Sleep(FollowInterval)
+	}
+}
+
+// runJobsCancel cancels a job
+func runJobsCancel(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("jobs cancel", "REPO ID"), args, 2,
+		2)
+	if err != nil {
+		return err
+	}
+
+	jobID, err := parseJobArgs(args)
+	if err != nil {
+		return err
+	}
+
+	err = cli.client.CancelJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"job_id":   jobID.ID,
+		"canceled": true,
+	}, "Canceled job %d", jobID.ID)
+}
+
+// runJobsRerun creates a new job for the same Git event as a job
+func runJobsRerun(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("jobs rerun", "REPO ID"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	jobID, err := parseJobArgs(args)
+	if err != nil {
+		return err
+	}
+
+	newID, err := cli.client.RerunJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"job_id": newID,
+	}, "Re-running job %d as job %d", jobID.ID, newID)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GitHubDeviceCodeURL is where the GitHub device flow starts
+const GitHubDeviceCodeURL string = "https://github.com/login/device/code"
+
+// GitHubAccessTokenURL is polled for an auth token during the GitHub device
+// flow
+const GitHubAccessTokenURL string = "https://github.com/login/oauth/access_token"
+
+// DeviceGrantType is the OAuth grant type of the device flow
+const DeviceGrantType string = "urn:ietf:params:oauth:grant-type:device_code"
+
+// SlowDownInterval is added to the device flow polling interval each time
+// GitHub asks for polling to slow down. Also the interval used if GitHub does
+// not give one.
+const SlowDownInterval time.Duration = 5 * time.Second
+
+// deviceCode is GitHub's response when the device flow starts
+type deviceCode struct {
+	// DeviceCode identifies the login when polling for a token
+	DeviceCode string `json:"device_code"`
+
+	// UserCode is entered by the user on VerificationURI
+	UserCode string `json:"user_code"`
+
+	// VerificationURI is where the user approves the login
+	VerificationURI string `json:"verification_uri"`
+
+	// ExpiresIn is the number of seconds before the codes expire
+	ExpiresIn int `json:"expires_in"`
+
+	// Interval is the minimum number of seconds between polls
+	Interval int `json:"interval"`
+}
+
+// accessToken is GitHub's response when polled for an auth token
+type accessToken struct {
+	// AccessToken is the auth token. Empty until the user approves.
+	AccessToken string `json:"access_token"`
+
+	// Error indicates why no token was returned
+	Error string `json:"error"`
+
+	// ErrorDescription describes Error
+	ErrorDescription string `json:"error_description"`
+
+	// Interval is the new minimum polling interval, in seconds. Only set
+	// with the slow_down error.
+	Interval int `json:"interval"`
+}
+
+// postGitHubForm makes a GitHub OAuth request and JSON decodes the response
+func postGitHubForm(endpoint string, form url.Values,
+	out interface{}) error {
+
+	req, err := http.NewRequest(http.MethodPost, endpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %s", err.Error())
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := http.Client{
+		Timeout: ClientTimeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub responded with HTTP %d",
+			resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("error decoding response: %s", err.Error())
+	}
+
+	return nil
+}
+
+// deviceFlowLogin gets a GitHub auth token by having the user approve the
+// login in a browser
+func deviceFlowLogin(clientID string) (string, error) {
+	// Start
+	var code deviceCode
+
+	err := postGitHubForm(GitHubDeviceCodeURL, url.Values{
+		"client_id": []string{clientID},
+		"scope":     []string{"repo"},
+	}, &code)
+	if err != nil {
+		return "", fmt.Errorf("error starting GitHub device login: %s",
+			err.Error())
+	}
+
+	fmt.Fprintf(os.Stderr, "Open %s and enter the code: %s\n",
+		code.VerificationURI, code.UserCode)
+
+	// Poll until approved
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = SlowDownInterval
+	}
+
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var token accessToken
+
+		err := postGitHubForm(GitHubAccessTokenURL, url.Values{
+			"client_id":   []string{clientID},
+			"device_code": []string{code.DeviceCode},
+			"grant_type":  []string{DeviceGrantType},
+		}, &token)
+		if err != nil {
+			return "", fmt.Errorf("error retrieving GitHub auth "+
+				"token: %s", err.Error())
+		}
+
+		switch token.Error {
+		case "":
+			return token.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += SlowDownInterval
+			if token.Interval > 0 {
+				interval = time.Duration(token.Interval) * time.Second
+			}
+		default:
+			return "", fmt.Errorf("GitHub login failed: %s",
+				token.ErrorDescription)
+		}
+	}
+
+	return "", errors.New("GitHub login expired before it was approved")
+}
+
+// runLogin saves a GitHub auth token, and the private API URL, for other
+// commands. The token is read from stdin or retrieved with the GitHub device
+// flow.
+func runLogin(cli CLI, args []string) error {
+	// Parse arguments
+	flags := newFlagSet("login", "")
+
+	withToken := flags.Bool("with-token", false, "Read a GitHub auth "+
+		"token from stdin instead of logging in with a browser")
+	clientID := flags.String("client-id", "", "ID of the GitHub app "+
+		"used to log in, defaults to the app the API uses")
+
+	_, err := parseArgs(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	// Get token
+	token := ""
+
+	if *withToken {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			return fmt.Errorf("error reading token from stdin: %s",
+				err.Error())
+		}
+
+		token = strings.TrimSpace(line)
+		if len(token) == 0 {
+			return errors.New("no token provided on stdin")
+		}
+	} else {
+		if len(*clientID) == 0 {
+			*clientID, err = cli.client.ClientID()
+			if err != nil {
+				return fmt.Errorf("error retrieving GitHub app ID from "+
+					"API: %s", err.Error())
+			}
+		}
+
+		token, err = deviceFlowLogin(*clientID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Save
+	cfg := cli.cfg
+	cfg.Token = token
+
+	path, err := cfg.Save()
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"api_url": cfg.APIURL,
+		"config":  path,
+	}, "Saved credentials for %s in %s", cfg.APIURL, path)
+}
@@ -0,0 +1,182 @@
+// Command kgd is a command line client for the kube-git-deploy private API
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// usage describes the commands
+const usage string = `Usage: kgd [FLAGS] COMMAND [ARGS]
+
+Commands:
+  login                         Save a GitHub auth token for other commands
+  repos list                    List tracked repositories
+  repos track REPO              Track a repository
+  repos untrack REPO            Stop tracking a repository
+  jobs list REPO                List a repository's jobs, newest first
+  jobs show REPO ID             Show the state of a job's actions
+  jobs logs REPO ID             Print a job's logs
+  jobs cancel REPO ID           Cancel a job which has not finished
+  jobs rerun REPO ID            Run a job again
+  deploy REPO REF               Deploy a branch or tag
+  config validate REPO [FILE]   Validate a job configuration file
+
+REPO is formatted as OWNER/NAME. Run "kgd COMMAND -h" for a command's flags.
+
+Flags:
+`
+
+// errUsage indicates a command was run with the wrong arguments. The
+// command's usage has already been printed.
+var errUsage error = errors.New("wrong arguments")
+
+// newFlagSet creates the flags of a command. argsUsage describes the
+// command's positional arguments.
+func newFlagSet(name, argsUsage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: kgd %s [FLAGS] %s\n\n", name,
+			argsUsage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseArgs parses a command's flags, which must come before its positional
+// arguments. Returns errUsage if there are less than min or more than max
+// positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string, min,
+	max int) ([]string, error) {
+
+	flags.Parse(args)
+
+	if flags.NArg() < min || flags.NArg() > max {
+		flags.Usage()
+		return nil, errUsage
+	}
+
+	return flags.Args(), nil
+}
+
+// command runs a kgd command with its arguments
+type command func(cli CLI, args []string) error
+
+// commands are all the kgd commands. Keys are the words which select them.
+var commands map[string]command = map[string]command{
+	"login":           runLogin,
+	"repos list":      runReposList,
+	"repos track":     runReposTrack,
+	"repos untrack":   runReposUntrack,
+	"jobs list":       runJobsList,
+	"jobs show":       runJobsShow,
+	"jobs logs":       runJobsLogs,
+	"jobs cancel":     runJobsCancel,
+	"jobs rerun":      runJobsRerun,
+	"deploy":          runDeploy,
+	"config validate": runConfigValidate,
+}
+
+// commandGroups are the first words of commands which take two words
+var commandGroups map[string]bool = map[string]bool{
+	"repos":  true,
+	"jobs":   true,
+	"config": true,
+}
+
+// CLI holds what commands need to run
+type CLI struct {
+	// cfg is the kgd configuration, with overrides from flags and the
+	// environment applied
+	cfg Config
+
+	// client makes private API requests
+	client Client
+
+	// printer writes command output
+	printer Printer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses the global flags and runs a command. Returns the process exit
+// code.
+func run(args []string) int {
+	// Parse arguments
+	flags := flag.NewFlagSet("kgd", flag.ExitOnError)
+
+	apiURL := flags.String("api", "", "URL of the private API, "+
+		"overrides the saved URL and "+EnvAPIURL)
+	output := flags.String("o", string(OutputTable), "Output format, "+
+		"\"table\" or \"json\"")
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	name := args[0]
+	if commandGroups[name] && len(args) > 1 {
+		name = strings.Join(args[:2], " ")
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", name)
+		flags.Usage()
+		return 2
+	}
+
+	args = args[len(strings.Fields(name)):]
+
+	format := OutputFormat(*output)
+	if format != OutputTable && format != OutputJSON {
+		fmt.Fprintf(os.Stderr, "-o must be \"%s\" or \"%s\"\n",
+			OutputTable, OutputJSON)
+		return 2
+	}
+
+	// Load configuration
+	cfg, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading configuration: %s\n",
+			err.Error())
+		return 1
+	}
+
+	if len(*apiURL) > 0 {
+		cfg.APIURL = *apiURL
+	}
+
+	// Run
+	cli := CLI{
+		cfg:     cfg,
+		client:  NewClient(cfg.APIURL, cfg.Token),
+		printer: NewPrinter(os.Stdout, format),
+	}
+
+	err = cmd(cli, args)
+	if err == errUsage {
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
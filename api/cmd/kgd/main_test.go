@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// testToken is the auth token test clients send
+const testToken string = "test-token"
+
+// testRepoPath is the private API path of the owner/repo repository
+const testRepoPath string = "/api/v0/github/repositories/owner/repo"
+
+// testAPI is a private API server which responds to requests with handlers.
+// Keys of handlers are the method and path of a request, ex:
+// "GET /api/v0/github/repositories/tracked". Requests without a handler or
+// without the auth token fail the test.
+func testAPI(t *testing.T, handlers map[string]http.HandlerFunc,
+	format OutputFormat) (CLI, *bytes.Buffer, func()) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter, r *http.Request) {
+
+		auth := r.Header.Get("Authorization")
+		if auth != "token "+testToken {
+			t.Errorf("expected auth token, Authorization header: "+
+				"%s", auth)
+		}
+
+		handler, ok := handlers[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request: %s %s", r.Method,
+				r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		handler(w, r)
+	}))
+
+	out := &bytes.Buffer{}
+
+	cli := CLI{
+		cfg: Config{
+			APIURL: server.URL,
+			Token:  testToken,
+		},
+		client:  NewClient(server.URL+"/", testToken),
+		printer: NewPrinter(out, format),
+	}
+
+	return cli, out, server.Close
+}
+
+// respond writes a JSON response
+func respond(t *testing.T, w http.ResponseWriter, status int,
+	body map[string]interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		t.Errorf("error encoding response: %s", err.Error())
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	cli, out, stop := testAPI(t, map[string]http.HandlerFunc{
+		"POST " + testRepoPath + "/jobs": func(w http.ResponseWriter,
+			r *http.Request) {
+
+			var req map[string]string
+
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil || req["ref"] != "master" {
+				t.Errorf("expected ref in body, got: %v, "+
+					"error: %v", req, err)
+			}
+
+			respond(t, w, http.StatusOK, map[string]interface{}{
+				"ok":     true,
+				"job_id": 5,
+				"target": models.JobTarget{
+					Branch: "master",
+					Commit: "0123456789abcdef",
+				},
+			})
+		},
+	}, OutputTable)
+	defer stop()
+
+	err := runDeploy(cli, []string{"owner/repo", "master"})
+	if err != nil {
+		t.Fatalf("error deploying: %s", err.Error())
+	}
+
+	if out.String() != "Deploying master at 0123456 in job 5\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	cli, _, stop := testAPI(t, map[string]http.HandlerFunc{
+		"POST " + testRepoPath + "/jobs/3/cancel": func(
+			w http.ResponseWriter, r *http.Request) {
+
+			respond(t, w, http.StatusConflict,
+				map[string]interface{}{
+					"ok":    false,
+					"error": "job already finished",
+				})
+		},
+	}, OutputTable)
+	defer stop()
+
+	err := runJobsCancel(cli, []string{"owner/repo", "3"})
+
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict ||
+		apiErr.Message != "job already finished" {
+
+		t.Errorf("expected API error, got: %v", err)
+	}
+}
+
+func TestJobsListJSON(t *testing.T) {
+	cli, out, stop := testAPI(t, map[string]http.HandlerFunc{
+		"GET " + testRepoPath + "/jobs": func(w http.ResponseWriter,
+			r *http.Request) {
+
+			if limit := r.URL.Query().Get("limit"); limit != "2" {
+				t.Errorf("expected limit of 2, got: %s", limit)
+			}
+
+			respond(t, w, http.StatusOK, map[string]interface{}{
+				"ok": true,
+				"jobs": []models.Job{
+					{
+						ID: models.JobID{ID: 2},
+					},
+					{
+						ID: models.JobID{ID: 1},
+					},
+				},
+			})
+		},
+	}, OutputJSON)
+	defer stop()
+
+	err := runJobsList(cli, []string{"-limit", "2", "owner/repo"})
+	if err != nil {
+		t.Fatalf("error listing jobs: %s", err.Error())
+	}
+
+	var jobs []models.Job
+
+	err = json.Unmarshal(out.Bytes(), &jobs)
+	if err != nil {
+		t.Fatalf("error decoding output: %s, output: %s", err.Error(),
+			out.String())
+	}
+
+	if len(jobs) != 2 || jobs[0].ID.ID != 2 || jobs[1].ID.ID != 1 {
+		t.Errorf("unexpected jobs: %#v", jobs)
+	}
+}
+
+func TestJobsLogsPages(t *testing.T) {
+	logs := map[string][]string{
+		"prepare":          []string{"a", "b", "c"},
+		"units/api/docker": []string{"d"},
+	}
+
+	cli, out, stop := testAPI(t, map[string]http.HandlerFunc{
+		"GET " + testRepoPath + "/jobs/1": func(w http.ResponseWriter,
+			r *http.Request) {
+
+			respond(t, w, http.StatusOK, map[string]interface{}{
+				"ok": true,
+				"job": models.Job{
+					ID: models.JobID{ID: 1},
+				},
+				"actions": []string{"prepare",
+					"units/api/docker"},
+			})
+		},
+		"GET " + testRepoPath + "/jobs/1/logs": func(
+			w http.ResponseWriter, r *http.Request) {
+
+			query := r.URL.Query()
+			lines := logs[query.Get("action")]
+
+			offset, err := strconv.Atoi(query.Get("offset"))
+			if err != nil {
+				t.Errorf("invalid offset: %s", err.Error())
+			}
+
+			// Respond with one line at a time, so the client must
+			// request more pages
+			page := []models.ActionOutput{}
+			if offset < len(lines) {
+				page = append(page, models.ActionOutput{
+					Text: lines[offset],
+				})
+			}
+
+			respond(t, w, http.StatusOK, map[string]interface{}{
+				"ok":    true,
+				"lines": page,
+				"total": len(lines),
+			})
+		},
+	}, OutputTable)
+	defer stop()
+
+	err := runJobsLogs(cli, []string{"owner/repo", "1"})
+	if err != nil {
+		t.Fatalf("error printing logs: %s", err.Error())
+	}
+
+	expected := "[prepare] a\n[prepare] b\n[prepare] c\n" +
+		"[units/api/docker] d\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgd")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kube-git-deploy.yaml")
+
+	err = ioutil.WriteFile(path, []byte("api: {}\n"), 0666)
+	if err != nil {
+		t.Fatalf("error writing file: %s", err.Error())
+	}
+
+	cli, out, stop := testAPI(t, map[string]http.HandlerFunc{
+		"POST " + testRepoPath + "/config/validate": func(
+			w http.ResponseWriter, r *http.Request) {
+
+			query := r.URL.Query()
+			if query.Get("format") != "yaml" ||
+				query.Get("branch") != "dev" {
+
+				t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			}
+
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != "api: {}\n" {
+				t.Errorf("expected file in body, got: %q", body)
+			}
+
+			respond(t, w, http.StatusOK, map[string]interface{}{
+				"ok":    true,
+				"valid": false,
+				"diagnostics": []models.ConfigDiagnostic{
+					{
+						Path:     "api",
+						Line:     1,
+						Message:  "no actions",
+						Severity: models.SeverityError,
+					},
+				},
+			})
+		},
+	}, OutputTable)
+	defer stop()
+
+	err = runConfigValidate(cli, []string{"-branch", "dev", "owner/repo",
+		path})
+	if err == nil || !strings.HasSuffix(err.Error(), "has errors") {
+		t.Errorf("expected file with errors to fail, got: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "1     error     api   no actions") {
+		t.Errorf("expected diagnostic in output, got: %q", out.String())
+	}
+}
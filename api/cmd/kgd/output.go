@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// OutputFormat is how command output is written
+type OutputFormat string
+
+const (
+	// OutputTable indicates output is written as aligned columns
+	OutputTable OutputFormat = "table"
+
+	// OutputJSON indicates output is written as JSON, for scripts
+	OutputJSON OutputFormat = "json"
+)
+
+// Printer writes command output in an OutputFormat
+type Printer struct {
+	// w is written to
+	w io.Writer
+
+	// format is the output format
+	format OutputFormat
+}
+
+// NewPrinter creates a new Printer
+func NewPrinter(w io.Writer, format OutputFormat) Printer {
+	return Printer{
+		w:      w,
+		format: format,
+	}
+}
+
+// Table writes v as JSON, or else rows as a table with a header
+func (p Printer) Table(v interface{}, header []string,
+	rows [][]string) error {
+
+	if p.format == OutputJSON {
+		return p.json(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// Message writes v as JSON, or else a message for people
+func (p Printer) Message(v interface{}, format string,
+	args ...interface{}) error {
+
+	if p.format == OutputJSON {
+		return p.json(v)
+	}
+
+	_, err := fmt.Fprintf(p.w, format+"\n", args...)
+
+	return err
+}
+
+// json writes v as indented JSON
+func (p Printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// orDash returns s, or "-" if s is empty so table columns stay aligned
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// parseRepo parses a REPO argument, formatted as OWNER/NAME
+func parseRepo(arg string) (models.RepositoryID, error) {
+	parts := strings.Split(arg, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return models.RepositoryID{}, fmt.Errorf("repository must be "+
+			"formatted as OWNER/NAME, was: %s", arg)
+	}
+
+	return models.RepositoryID{
+		Owner: parts[0],
+		Name:  parts[1],
+	}, nil
+}
+
+// repoName formats a repository ID as OWNER/NAME
+func repoName(repoID models.RepositoryID) string {
+	return repoID.Owner + "/" + repoID.Name
+}
+
+// runReposList prints the tracked repositories
+func runReposList(cli CLI, args []string) error {
+	_, err := parseArgs(newFlagSet("repos list", ""), args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	repos, err := cli.client.TrackedRepositories()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, repo := range repos {
+		rows = append(rows, []string{
+			repoName(repo.ID),
+			string(repo.GetFetchStrategy()),
+			string(repo.GetConfigDiscovery()),
+			orDash(repo.ConfigPath),
+		})
+	}
+
+	return cli.printer.Table(repos, []string{"REPOSITORY", "FETCH",
+		"DISCOVERY", "CONFIG PATH"}, rows)
+}
+
+// runReposTrack tracks a repository
+func runReposTrack(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("repos track", "REPO"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = cli.client.Track(repoID)
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"repository": repoID,
+		"tracked":    true,
+	}, "Tracking %s", repoName(repoID))
+}
+
+// runReposUntrack stops tracking a repository
+func runReposUntrack(cli CLI, args []string) error {
+	args, err := parseArgs(newFlagSet("repos untrack", "REPO"), args, 1,
+		1)
+	if err != nil {
+		return err
+	}
+
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = cli.client.Untrack(repoID)
+	if err != nil {
+		return err
+	}
+
+	return cli.printer.Message(map[string]interface{}{
+		"repository": repoID,
+		"tracked":    false,
+	}, "Stopped tracking %s", repoName(repoID))
+}
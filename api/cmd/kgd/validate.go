@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// runConfigValidate validates a job configuration file with the private
+// API. Fails if the file has errors.
+func runConfigValidate(cli CLI, args []string) error {
+	flags := newFlagSet("config validate", "REPO [FILE]")
+
+	branch := flags.String("branch", "", "Git branch used to render "+
+		"templates")
+	tag := flags.String("tag", "", "Git tag used to render templates")
+	commit := flags.String("commit", "", "Git sha used to render "+
+		"templates")
+
+	args, err := parseArgs(flags, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	repoID, err := parseRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Read file
+	path := ""
+	if len(args) > 1 {
+		path = args[1]
+	} else {
+		path, err = models.FindJobConfigFile(".")
+		if err != nil {
+			return fmt.Errorf("error finding configuration file: %s",
+				err.Error())
+		}
+	}
+
+	format, err := models.ConfigFormatFor(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %s", path, err.Error())
+	}
+
+	// Validate
+	valid, diagnostics, err := cli.client.ValidateConfig(repoID, data,
+		format, models.JobTarget{
+			Branch: *branch,
+			Tag:    *tag,
+			Commit: *commit,
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(diagnostics) == 0 {
+		err = cli.printer.Message(diagnostics, "%s is valid", path)
+	} else {
+		rows := [][]string{}
+		for _, diagnostic := range diagnostics {
+			line := "-"
+			if diagnostic.Line > 0 {
+				line = strconv.Itoa(diagnostic.Line)
+			}
+
+			rows = append(rows, []string{
+				line,
+				string(diagnostic.Severity),
+				orDash(diagnostic.Path),
+				diagnostic.Message,
+			})
+		}
+
+		err = cli.printer.Table(diagnostics, []string{"LINE", "SEVERITY",
+			"PATH", "MESSAGE"}, rows)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return errors.New(path + " has errors")
+	}
+
+	return nil
+}
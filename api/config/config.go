@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -32,6 +33,124 @@ type Config struct {
 
 	// GitHubClientSecret is the secret value for a GitHub API app
 	GitHubClientSecret string `envconfig:"github_client_secret" required:"true"`
+
+	// LogStore is the backend job action output is stored in. Either
+	// "etcd" or "file".
+	LogStore string `envconfig:"log_store" default:"etcd"`
+
+	// LogDir is the directory job action output is stored in when
+	// LogStore is "file"
+	LogDir string `envconfig:"log_dir" default:"/var/lib/kube-git-deploy/logs"`
+
+	// JobExecutor indicates how jobs are run. Either "process" to run
+	// jobs inside the API process, or "kubernetes" to run each job as a
+	// Kubernetes Job.
+	JobExecutor string `envconfig:"job_executor" default:"process"`
+
+	// KubeConfig is the path to a kubeconfig file used to connect to
+	// Kubernetes. If empty the in cluster service account is used.
+	KubeConfig string `envconfig:"kubeconfig"`
+
+	// KubeNamespace is the namespace worker Kubernetes Jobs are
+	// created in
+	KubeNamespace string `envconfig:"kube_namespace" default:"default"`
+
+	// KubeWorkerImage is the Docker image worker Kubernetes Jobs run.
+	// Required if JobExecutor is "kubernetes".
+	KubeWorkerImage string `envconfig:"kube_worker_image"`
+
+	// KubeWorkerServiceAccount is the name of the service account
+	// worker Kubernetes Jobs run as
+	KubeWorkerServiceAccount string `envconfig:"kube_worker_service_account"`
+
+	// KubeWorkerEnvSecret is the name of a Kubernetes secret which
+	// holds the environment variables worker Kubernetes Jobs are
+	// configured with
+	KubeWorkerEnvSecret string `envconfig:"kube_worker_env_secret"`
+
+	// ApprovalTimeout is how long a job waits for a deploy to be approved
+	// before the approval expires, if the approval's configuration does
+	// not specify a timeout
+	ApprovalTimeout time.Duration `envconfig:"approval_timeout" default:"24h"`
+
+	// WorkerPoolSize is the maximum number of jobs which run at the same
+	// time. Other jobs wait in a queue until a worker is free.
+	WorkerPoolSize int `envconfig:"worker_pool_size" default:"4"`
+
+	// PrepareMaxAttempts is the maximum number of times the prepare
+	// action runs if it fails with a network or server error
+	PrepareMaxAttempts int `envconfig:"prepare_max_attempts" default:"3"`
+
+	// PrepareBackoff is the delay before the prepare action is first
+	// retried. The delay doubles each retry.
+	PrepareBackoff time.Duration `envconfig:"prepare_backoff" default:"2s"`
+
+	// PrepareMaxBackoff is the longest delay between prepare action
+	// retries
+	PrepareMaxBackoff time.Duration `envconfig:"prepare_max_backoff" default:"30s"`
+
+	// ArchiveMaxBytes is the maximum total size of files extracted from a
+	// repository tarball
+	ArchiveMaxBytes int64 `envconfig:"archive_max_bytes" default:"1073741824"`
+
+	// ArchiveMaxFiles is the maximum number of entries in a repository
+	// tarball
+	ArchiveMaxFiles int `envconfig:"archive_max_files" default:"100000"`
+
+	// ImageBuilder selects how Docker actions build images. "daemon" uses
+	// the Docker CLI and a Docker daemon, "buildkit" uses BuildKit without
+	// a daemon.
+	ImageBuilder string `envconfig:"image_builder" default:"daemon"`
+
+	// BuildKitAddr is the address of a buildkitd server used by the
+	// buildkit image builder. If empty BuildKit runs in a rootless process
+	// for each build.
+	BuildKitAddr string `envconfig:"buildkit_addr"`
+
+	// GitMirrorDir is the directory bare mirrors of repositories fetched
+	// with git are kept in
+	GitMirrorDir string `envconfig:"git_mirror_dir" default:"/var/lib/kube-git-deploy/mirrors"`
+
+	// JobTimeout is the longest a job may run before its remaining
+	// actions are stopped. Time spent paused does not count.
+	JobTimeout time.Duration `envconfig:"job_timeout" default:"2h"`
+
+	// PrepareTimeout is how long the prepare action may run, including
+	// retries
+	PrepareTimeout time.Duration `envconfig:"prepare_timeout" default:"10m"`
+
+	// DockerTimeout is how long Docker actions may run, including
+	// retries, unless the unit sets a timeout
+	DockerTimeout time.Duration `envconfig:"docker_timeout" default:"30m"`
+
+	// HelmTimeout is how long Helm actions may run, including retries,
+	// unless the unit sets a timeout
+	HelmTimeout time.Duration `envconfig:"helm_timeout" default:"15m"`
+
+	// KubernetesTimeout is how long Kubernetes actions may run, including
+	// retries, unless the unit sets a timeout
+	KubernetesTimeout time.Duration `envconfig:"kubernetes_timeout" default:"15m"`
+
+	// KustomizeTimeout is how long kustomize actions may run, including
+	// retries, unless the unit sets a timeout
+	KustomizeTimeout time.Duration `envconfig:"kustomize_timeout" default:"15m"`
+
+	// RollbackTimeout is how long rollback actions may run unless the
+	// unit sets a timeout
+	RollbackTimeout time.Duration `envconfig:"rollback_timeout" default:"15m"`
+
+	// SecretsKey is the base64 encoded 32 byte key secrets are encrypted
+	// with. If empty secrets cannot be used.
+	SecretsKey string `envconfig:"secrets_key"`
+
+	// JobHistoryLimit is the number of finished jobs kept for each
+	// repository. Older finished jobs and their output are deleted, unless
+	// they are the last successful deploy of a unit. 0 keeps all jobs.
+	JobHistoryLimit int `envconfig:"job_history_limit" default:"100"`
+
+	// RunnerID uniquely identifies the API replica's job runner. If empty
+	// the hostname and process ID are used.
+	RunnerID string `envconfig:"runner_id"`
 }
 
 // NewConfig loads configuration from the environment
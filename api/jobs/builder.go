@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// BuildRequest describes an image to build and push
+type BuildRequest struct {
+	// Dir is the build context directory, which holds the Dockerfile
+	Dir string
+
+	// Tag is the name the image is pushed as
+	Tag string
+
+	// BuildArgs are Dockerfile ARG values. Secrets are already resolved.
+	BuildArgs map[string]string
+
+	// SecretBuildArgs are the names of BuildArgs whose values hold
+	// secrets. Builders must not pass their values as program arguments.
+	SecretBuildArgs map[string]bool
+
+	// Env holds environment variables added to the builder's environment,
+	// ex: DOCKER_CONFIG
+	Env []string
+
+	// CacheRef is the image reference layers are cached in. Builders
+	// which do not cache in the registry ignore it.
+	CacheRef string
+}
+
+// ImageBuilder builds images and pushes them to registries
+type ImageBuilder interface {
+	// Name identifies the builder in output
+	Name() string
+
+	// Build builds an image and pushes it. Output is saved in state.
+	Build(ctx context.Context, state *models.ActionState,
+		req BuildRequest) error
+
+	// Exists checks if an image tag has been pushed to its registry. env
+	// holds environment variables added to the builder's environment.
+	Exists(ctx context.Context, tag string, env []string) bool
+
+	// Digest returns the digest of a pushed image tag in its registry, ex:
+	// sha256:abc. env holds environment variables added to the builder's
+	// environment.
+	Digest(ctx context.Context, tag string, env []string) (string, error)
+}
+
+// NewImageBuilder creates the ImageBuilder selected by the IMAGE_BUILDER
+// configuration value
+func NewImageBuilder(cfg *config.Config) (ImageBuilder, error) {
+	switch cfg.ImageBuilder {
+	case "daemon":
+		return DaemonBuilder{}, nil
+	case "buildkit":
+		return NewBuildKitBuilder(cfg.BuildKitAddr), nil
+	default:
+		return nil, fmt.Errorf("unknown image builder: %s",
+			cfg.ImageBuilder)
+	}
+}
+
+// sortedBuildArgNames returns the names of build arguments in alphabetical
+// order, so build commands are the same each run
+func sortedBuildArgNames(buildArgs map[string]string) []string {
+	names := []string{}
+	for name := range buildArgs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// commandSucceeds runs a program and indicates if it exited successfully.
+// Output is discarded.
+func commandSucceeds(ctx context.Context, env []string, name string,
+	args ...string) bool {
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	return cmd.Run() == nil
+}
+
+// commandOutput runs a program and returns its standard output without
+// surrounding whitespace
+func commandOutput(ctx context.Context, env []string, name string,
+	args ...string) (string, error) {
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running %s: %s", name, err.Error())
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// DaemonBuilder builds images with the Docker CLI and a Docker daemon
+type DaemonBuilder struct{}
+
+// Name implements ImageBuilder.Name
+func (b DaemonBuilder) Name() string {
+	return "docker daemon"
+}
+
+// Build implements ImageBuilder.Build. Build argument values are passed in
+// the environment so they are not in the output. The cache reference is not
+// used, the daemon caches layers locally.
+func (b DaemonBuilder) Build(ctx context.Context, state *models.ActionState,
+	req BuildRequest) error {
+
+	// Build
+	args := []string{"build", "-t", req.Tag}
+	buildEnv := append([]string{}, req.Env...)
+
+	for _, name := range sortedBuildArgNames(req.BuildArgs) {
+		args = append(args, "--build-arg", name)
+		buildEnv = append(buildEnv, fmt.Sprintf("%s=%s", name,
+			req.BuildArgs[name]))
+	}
+
+	args = append(args, ".")
+
+	err := runCommandEnv(ctx, state, req.Dir, buildEnv, "docker", args...)
+	if err != nil {
+		return err
+	}
+
+	// Push
+	return runCommandEnv(ctx, state, req.Dir, req.Env, "docker", "push",
+		req.Tag)
+}
+
+// Exists implements ImageBuilder.Exists
+func (b DaemonBuilder) Exists(ctx context.Context, tag string,
+	env []string) bool {
+
+	return commandSucceeds(ctx, env, "docker", "manifest", "inspect", tag)
+}
+
+// Digest implements ImageBuilder.Digest. Uses the digest the daemon recorded
+// when the tag was pushed to its repository.
+func (b DaemonBuilder) Digest(ctx context.Context, tag string,
+	env []string) (string, error) {
+
+	out, err := commandOutput(ctx, env, "docker", "image", "inspect",
+		"--format", "{{join .RepoDigests \"\\n\"}}", tag)
+	if err != nil {
+		return "", err
+	}
+
+	repo := models.ImageRepository(tag)
+
+	for _, repoDigest := range strings.Split(out, "\n") {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) == 2 && parts[0] == repo {
+			return parts[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("no digest recorded for repository %s", repo)
+}
+
+// BuildKitBuilder builds images with BuildKit, without a Docker daemon.
+// Images are pushed by BuildKit as they are built, layers are cached in the
+// registry. The crane CLI checks if images exist.
+type BuildKitBuilder struct {
+	// addr is the address of a buildkitd server, ex:
+	// tcp://buildkitd:1234. If empty BuildKit runs in a rootless process
+	// for each build.
+	addr string
+}
+
+// NewBuildKitBuilder creates a new BuildKitBuilder
+func NewBuildKitBuilder(addr string) BuildKitBuilder {
+	return BuildKitBuilder{
+		addr: addr,
+	}
+}
+
+// Name implements ImageBuilder.Name
+func (b BuildKitBuilder) Name() string {
+	if len(b.addr) > 0 {
+		return fmt.Sprintf("buildkit at %s", b.addr)
+	}
+
+	return "rootless buildkit"
+}
+
+// buildKitSecretEnvPrefix prefixes the names of environment variables which
+// pass secret build arguments to buildctl, so they do not replace variables
+// like PATH
+const buildKitSecretEnvPrefix string = "KGD_BUILD_SECRET_"
+
+// Build implements ImageBuilder.Build. BuildKit reads registry credentials
+// from DOCKER_CONFIG, like the Docker CLI. buildctl can only read build
+// argument values from its arguments, which are saved in output, so secret
+// build arguments are passed as BuildKit secrets read from the environment.
+// Dockerfiles mount them with RUN --mount=type=secret,id=NAME.
+func (b BuildKitBuilder) Build(ctx context.Context,
+	state *models.ActionState, req BuildRequest) error {
+
+	name := "buildctl-daemonless.sh"
+	args := []string{}
+
+	if len(b.addr) > 0 {
+		name = "buildctl"
+		args = append(args, "--addr", b.addr)
+	}
+
+	args = append(args, "build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=.",
+		"--local", "dockerfile=.",
+		"--output", fmt.Sprintf("type=image,name=%s,push=true", req.Tag))
+
+	buildEnv := append([]string{}, req.Env...)
+
+	for _, argName := range sortedBuildArgNames(req.BuildArgs) {
+		if req.SecretBuildArgs[argName] {
+			envName := buildKitSecretEnvPrefix + argName
+
+			args = append(args, "--secret",
+				fmt.Sprintf("id=%s,env=%s", argName, envName))
+			buildEnv = append(buildEnv, fmt.Sprintf("%s=%s",
+				envName, req.BuildArgs[argName]))
+
+			continue
+		}
+
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s=%s",
+			argName, req.BuildArgs[argName]))
+	}
+
+	if len(req.CacheRef) > 0 {
+		args = append(args,
+			"--import-cache", fmt.Sprintf("type=registry,ref=%s",
+				req.CacheRef),
+			"--export-cache", fmt.Sprintf("type=registry,ref=%s,"+
+				"mode=max", req.CacheRef))
+	}
+
+	return runCommandEnv(ctx, state, req.Dir, buildEnv, name, args...)
+}
+
+// Exists implements ImageBuilder.Exists
+func (b BuildKitBuilder) Exists(ctx context.Context, tag string,
+	env []string) bool {
+
+	return commandSucceeds(ctx, env, "crane", "manifest", tag)
+}
+
+// Digest implements ImageBuilder.Digest
+func (b BuildKitBuilder) Digest(ctx context.Context, tag string,
+	env []string) (string, error) {
+
+	return commandOutput(ctx, env, "crane", "digest", tag)
+}
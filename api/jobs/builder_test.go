@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+func TestBuildKitBuilderSecretBuildArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake buildctl which records its arguments and the secret's
+	// environment variable
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > args\n" +
+		"echo \"$KGD_BUILD_SECRET_NPM_TOKEN\" > env\n"
+
+	err = ioutil.WriteFile(filepath.Join(dir, "buildctl"), []byte(script),
+		0777)
+	if err != nil {
+		t.Fatalf("error writing buildctl: %s", err.Error())
+	}
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	err = NewBuildKitBuilder("tcp://buildkitd:1234").Build(
+		context.Background(), &models.ActionState{}, BuildRequest{
+			Dir: dir,
+			Tag: "registry.example.com/api:latest",
+			BuildArgs: map[string]string{
+				"NPM_TOKEN": "hunter2",
+				"VERSION":   "1.0",
+			},
+			SecretBuildArgs: map[string]bool{
+				"NPM_TOKEN": true,
+			},
+		})
+	if err != nil {
+		t.Fatalf("error building: %s", err.Error())
+	}
+
+	args := readTestFile(t, filepath.Join(dir, "args"))
+
+	if strings.Contains(args, "hunter2") {
+		t.Errorf("secret build argument passed in arguments: %s", args)
+	}
+
+	for _, expected := range []string{
+		"--secret id=NPM_TOKEN,env=KGD_BUILD_SECRET_NPM_TOKEN",
+		"--opt build-arg:VERSION=1.0",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("expected arguments to contain %q: %s",
+				expected, args)
+		}
+	}
+
+	env := readTestFile(t, filepath.Join(dir, "env"))
+	if env != "hunter2\n" {
+		t.Errorf("expected secret in environment, got: %q", env)
+	}
+}
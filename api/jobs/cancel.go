@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// CancellationPollInterval is how often a worker checks if a user canceled
+// the job it is running
+const CancellationPollInterval time.Duration = 5 * time.Second
+
+// watchCancellation cancels a running job's context once a user cancels the
+// job, and sends the cancellation on canceled. Returns when ctx is done.
+func (w *Worker) watchCancellation(ctx context.Context,
+	cancel context.CancelFunc, jobID models.JobID,
+	canceled chan<- models.JobCancellation) {
+
+	ticker := time.NewTicker(CancellationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		cancellation, err := models.GetJobCancellation(ctx, w.etcdKV,
+			jobID)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.logger.Errorf("error checking if job was canceled, "+
+					"Job.ID: %#v, error: %s", jobID, err.Error())
+			}
+
+			continue
+		}
+
+		if cancellation != nil {
+			canceled <- *cancellation
+			cancel()
+			return
+		}
+	}
+}
+
+// canceledBy returns the cancellation sent by watchCancellation. Nil if the
+// job was not canceled.
+func canceledBy(
+	canceled <-chan models.JobCancellation) *models.JobCancellation {
+
+	select {
+	case cancellation := <-canceled:
+		return &cancellation
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+)
+
+// CleanupAction removes a job's working directory
+type CleanupAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+}
+
+// NewCleanupAction creates a new CleanupAction
+func NewCleanupAction(ctx context.Context, logger golog.Logger) CleanupAction {
+	return CleanupAction{
+		ctx:    ctx,
+		logger: logger,
+	}
+}
+
+// Run executes the cleanup action
+func (a CleanupAction) Run(job *models.Job, state *models.ActionState) error {
+	state.Stage = models.Running
+
+	state.AddOutput("Removing working directory")
+
+	err := os.RemoveAll(GetJobWorkingDir(*job))
+	if err != nil {
+		return fmt.Errorf("Error removing working directory: %s",
+			err.Error())
+	}
+
+	state.Stage = models.Done
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// CollectInterval is how often the JobCollector deletes old jobs and stale
+// runner state
+const CollectInterval time.Duration = 10 * time.Minute
+
+// JobCollector deletes finished jobs past each repository's history limit,
+// queue entries of finished and deleted jobs, and claims on deleted jobs.
+// Keeps the time the leader's other duties take to check every job from
+// growing without bound. Only the leader runner should run the JobCollector.
+type JobCollector struct {
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// logStore holds job action output, which is deleted with jobs
+	logStore models.LogStore
+
+	// historyLimit is the number of finished jobs kept for each
+	// repository, see config.Config.JobHistoryLimit
+	historyLimit int
+}
+
+// NewJobCollector creates a new JobCollector
+func NewJobCollector(logger golog.Logger, etcdKV etcd.KeysAPI,
+	logStore models.LogStore, historyLimit int) JobCollector {
+
+	return JobCollector{
+		logger:       logger,
+		etcdKV:       etcdKV,
+		logStore:     logStore,
+		historyLimit: historyLimit,
+	}
+}
+
+// Run collects once, then every CollectInterval until the context is
+// canceled
+func (c JobCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(CollectInterval)
+	defer ticker.Stop()
+
+	for {
+		c.collect(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collect deletes old jobs, then stale queue entries and claims
+func (c JobCollector) collect(ctx context.Context) {
+	// Get runner state before jobs, entries and claims are only made for
+	// jobs which exist
+	entries, err := getQueueEntries(ctx, c.etcdKV)
+	if err != nil {
+		c.logger.Errorf("error retrieving job queue: %s", err.Error())
+		return
+	}
+
+	claimsResp, err := c.etcdKV.Get(ctx, KeyDirRunnerClaims,
+		&etcd.GetOptions{
+			Recursive: true,
+			Quorum:    true,
+		})
+	if err != nil && !etcd.IsKeyNotFound(err) {
+		c.logger.Errorf("error retrieving job claims: %s", err.Error())
+		return
+	}
+
+	claims := map[models.JobID]bool{}
+	if claimsResp != nil {
+		claims, err = parseClaims(claimsResp.Node)
+		if err != nil {
+			c.logger.Errorf("error parsing job claims: %s",
+				err.Error())
+			return
+		}
+	}
+
+	// Collect jobs
+	repos, err := models.GetAllRepositories(ctx, c.etcdKV)
+	if err != nil {
+		c.logger.Errorf("error retrieving repositories: %s", err.Error())
+		return
+	}
+
+	// done holds if the remaining jobs are done
+	done := map[models.JobID]bool{}
+
+	for _, repo := range repos {
+		remaining, err := c.collectJobs(ctx, repo.ID, claims)
+		if err != nil {
+			c.logger.Errorf("error deleting old jobs, repository: %#v, "+
+				"error: %s", repo.ID, err.Error())
+			return
+		}
+
+		for _, job := range remaining {
+			done[job.ID] = job.State.Done()
+		}
+	}
+
+	// Collect runner state
+	for _, entry := range entries {
+		if isDone, ok := done[entry.jobID]; ok && !isDone {
+			continue
+		}
+
+		_, err := c.etcdKV.Delete(ctx, entry.key, nil)
+		if err != nil && !etcd.IsKeyNotFound(err) {
+			c.logger.Errorf("error removing stale job from queue, "+
+				"Job.ID: %#v, error: %s", entry.jobID, err.Error())
+		}
+	}
+
+	if claimsResp != nil {
+		c.collectClaims(ctx, claimsResp.Node, done)
+	}
+}
+
+// collectJobs deletes a repository's finished jobs past the history limit.
+// Jobs which are claimed, are a unit's last successful deploy, or which
+// unfinished jobs roll back or promote, are kept. The newest finished job is
+// always kept, so job IDs are not re-used. Returns the jobs which were
+// kept.
+func (c JobCollector) collectJobs(ctx context.Context,
+	repoID models.RepositoryID,
+	claims map[models.JobID]bool) ([]models.Job, error) {
+
+	repoJobs, err := models.GetAllJobs(ctx, c.etcdKV, repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.historyLimit < 1 {
+		return repoJobs, nil
+	}
+
+	// Find jobs which must be kept
+	keep := map[int64]bool{}
+
+	deploys, err := models.GetSuccessfulDeploys(ctx, c.etcdKV, repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deploy := range deploys {
+		keep[deploy.JobID] = true
+	}
+
+	for _, job := range repoJobs {
+		if job.State.Done() {
+			continue
+		}
+
+		if job.RollbackOf != nil {
+			keep[*job.RollbackOf] = true
+		}
+
+		if job.PromotedFrom != nil {
+			keep[*job.PromotedFrom] = true
+		}
+	}
+
+	// Delete, newest jobs are last
+	remaining := []models.Job{}
+	finished := 0
+
+	for i := len(repoJobs) - 1; i >= 0; i-- {
+		job := repoJobs[i]
+
+		if !job.State.Done() {
+			remaining = append(remaining, job)
+			continue
+		}
+
+		finished++
+
+		if finished <= c.historyLimit || keep[job.ID.ID] ||
+			claims[job.ID] {
+
+			remaining = append(remaining, job)
+			continue
+		}
+
+		err := job.Delete(ctx, c.etcdKV, c.logStore)
+		if err != nil {
+			c.logger.Errorf("error deleting job, Job.ID: %#v, error: %s",
+				job.ID, err.Error())
+
+			remaining = append(remaining, job)
+			continue
+		}
+
+		c.logger.Debugf("deleted job %#v", job.ID)
+	}
+
+	return remaining, nil
+}
+
+// collectClaims deletes claims on jobs which do not exist, and claim
+// directories which are empty. Claims on jobs which exist expire on their own
+// once their runner stops refreshing them. Returns true if node was deleted.
+func (c JobCollector) collectClaims(ctx context.Context, node *etcd.Node,
+	done map[models.JobID]bool) bool {
+
+	if !node.Dir {
+		var claim runnerClaim
+
+		err := json.Unmarshal([]byte(node.Value), &claim)
+		if err != nil {
+			c.logger.Errorf("error unmarshalling claim %s: %s", node.Key,
+				err.Error())
+			return false
+		}
+
+		if _, ok := done[claim.JobID]; ok {
+			return false
+		}
+
+		_, err = c.etcdKV.Delete(ctx, node.Key, nil)
+		if err != nil && !etcd.IsKeyNotFound(err) {
+			c.logger.Errorf("error removing claim on deleted job, "+
+				"Job.ID: %#v, error: %s", claim.JobID, err.Error())
+			return false
+		}
+
+		return true
+	}
+
+	remaining := 0
+
+	for _, child := range node.Nodes {
+		if !c.collectClaims(ctx, child, done) {
+			remaining++
+		}
+	}
+
+	if remaining > 0 || node.Key == KeyDirRunnerClaims {
+		return false
+	}
+
+	// Fails if a claim was made in the directory since it was retrieved
+	_, err := c.etcdKV.Delete(ctx, node.Key, &etcd.DeleteOptions{
+		Dir: true,
+	})
+	if etcdErr, ok := err.(etcd.Error); ok &&
+		etcdErr.Code == etcd.ErrorCodeDirNotEmpty {
+
+		return false
+	} else if err != nil && !etcd.IsKeyNotFound(err) {
+		c.logger.Errorf("error removing empty claim directory %s: %s",
+			node.Key, err.Error())
+		return false
+	}
+
+	return true
+}
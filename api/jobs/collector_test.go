@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// finishTestJob marks every action of a job as done and saves it
+func finishTestJob(t *testing.T, etcdKV etcd.KeysAPI, job *models.Job) {
+	job.State.PrepareState.Stage = models.Done
+	job.State.CleanupState.Stage = models.Done
+
+	err := job.Set(context.Background(), etcdKV)
+	if err != nil {
+		t.Fatalf("error saving job: %s", err.Error())
+	}
+}
+
+// queueTestJob adds a job to the runner queue without waking a runner
+func queueTestJob(t *testing.T, etcdKV etcd.KeysAPI, id models.JobID) {
+	value, err := json.Marshal(id)
+	if err != nil {
+		t.Fatalf("error marshalling job ID: %s", err.Error())
+	}
+
+	_, err = etcdKV.CreateInOrder(context.Background(), KeyDirRunnerQueue,
+		string(value), nil)
+	if err != nil {
+		t.Fatalf("error queueing job: %s", err.Error())
+	}
+}
+
+// claimTestJob saves a claim on a job
+func claimTestJob(t *testing.T, etcdKV etcd.KeysAPI, id models.JobID) {
+	value, err := json.Marshal(runnerClaim{
+		RunnerID: "runner",
+		JobID:    id,
+	})
+	if err != nil {
+		t.Fatalf("error marshalling claim: %s", err.Error())
+	}
+
+	_, err = etcdKV.Set(context.Background(), claimKey(id), string(value),
+		nil)
+	if err != nil {
+		t.Fatalf("error saving claim: %s", err.Error())
+	}
+}
+
+func TestJobCollector(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+	logStore := models.NewEtcdLogStore(etcdKV)
+
+	// Jobs 0 to 6, all finished except 4
+	jobs := createTestJobs(t, etcdKV, 7)
+
+	for i, job := range jobs {
+		if i != 4 {
+			finishTestJob(t, etcdKV, job)
+		}
+
+		_, err := logStore.Append(ctx, models.LogID{
+			JobID:  job.ID,
+			Action: "prepare",
+		}, []models.ActionOutput{{Text: "output"}})
+		if err != nil {
+			t.Fatalf("error appending output: %s", err.Error())
+		}
+	}
+
+	// ... 0 is a unit's last successful deploy
+	err := models.SuccessfulDeploy{
+		RepositoryID: testRepositoryID,
+		Environment:  "production",
+		Branch:       "master",
+		UnitID:       "api",
+		JobID:        jobs[0].ID.ID,
+	}.Set(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error saving successful deploy: %s", err.Error())
+	}
+
+	// ... 4 rolls back to 1
+	rollbackOf := jobs[1].ID.ID
+	jobs[4].RollbackOf = &rollbackOf
+
+	err = jobs[4].Set(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error saving job: %s", err.Error())
+	}
+
+	// ... 2 is claimed
+	claimTestJob(t, etcdKV, jobs[2].ID)
+
+	// Runner state of jobs which are done or do not exist
+	missing := models.JobID{
+		RepositoryID: models.RepositoryID{
+			Owner: "untracked",
+			Name:  "repo",
+		},
+		ID: 3,
+	}
+
+	queueTestJob(t, etcdKV, jobs[4].ID)
+	queueTestJob(t, etcdKV, jobs[5].ID)
+	queueTestJob(t, etcdKV, jobs[6].ID)
+	queueTestJob(t, etcdKV, missing)
+	claimTestJob(t, etcdKV, missing)
+
+	// Collect, keep newest finished job
+	NewJobCollector(golog.NewStdLogger("collector"), etcdKV, logStore,
+		1).collect(ctx)
+
+	remaining, err := models.GetAllJobs(ctx, etcdKV, testRepositoryID)
+	if err != nil {
+		t.Fatalf("error retrieving jobs: %s", err.Error())
+	}
+
+	kept := map[int64]bool{}
+	for _, job := range remaining {
+		kept[job.ID.ID] = true
+	}
+
+	for i, job := range jobs {
+		expected := i != 3 && i != 5
+
+		if kept[job.ID.ID] != expected {
+			t.Errorf("expected job %d kept to be %t", i, expected)
+		}
+
+		_, lines, err := logStore.Read(ctx, models.LogID{
+			JobID:  job.ID,
+			Action: "prepare",
+		}, 0, 0)
+		if err != nil {
+			t.Fatalf("error reading output: %s", err.Error())
+		}
+
+		if (lines > 0) != expected {
+			t.Errorf("expected job %d output kept to be %t, has %d "+
+				"lines", i, expected, lines)
+		}
+	}
+
+	entries, err := getQueueEntries(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving queue: %s", err.Error())
+	}
+
+	if len(entries) != 1 || entries[0].jobID != jobs[4].ID {
+		t.Errorf("expected only job 4 to be queued, queue: %#v", entries)
+	}
+
+	claims, err := getClaims(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving claims: %s", err.Error())
+	}
+
+	if len(claims) != 1 || !claims[jobs[2].ID] {
+		t.Errorf("expected only job 2 to be claimed, claims: %#v", claims)
+	}
+
+	// Directories of removed claims are removed
+	_, err = etcdKV.Get(ctx, KeyDirRunnerClaims+"/untracked", nil)
+	if !etcd.IsKeyNotFound(err) {
+		t.Errorf("expected empty claim directory to be removed, error: "+
+			"%v", err)
+	}
+}
+
+func TestJobCollectorNoLimit(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	jobs := createTestJobs(t, etcdKV, 3)
+	for _, job := range jobs {
+		finishTestJob(t, etcdKV, job)
+	}
+
+	NewJobCollector(golog.NewStdLogger("collector"), etcdKV,
+		models.NewEtcdLogStore(etcdKV), 0).collect(ctx)
+
+	remaining, err := models.GetAllJobs(ctx, etcdKV, testRepositoryID)
+	if err != nil {
+		t.Fatalf("error retrieving jobs: %s", err.Error())
+	}
+
+	if len(remaining) != len(jobs) {
+		t.Errorf("expected all %d jobs kept, %d were", len(jobs),
+			len(remaining))
+	}
+}
@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// runCommand runs a program in a directory. The command and each line it
+// outputs are saved in state.
+func runCommand(ctx context.Context, state *models.ActionState, dir string,
+	name string, args ...string) error {
+
+	return runCommandEnv(ctx, state, dir, nil, name, args...)
+}
+
+// runCommandEnv acts like runCommand, but adds environment variables to the
+// program's environment. Environment variables are not saved in state, so
+// they can hold secrets.
+func runCommandEnv(ctx context.Context, state *models.ActionState,
+	dir string, env []string, name string, args ...string) error {
+
+	state.AddOutput(fmt.Sprintf("$ %s %s", name, strings.Join(args, " ")))
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.CombinedOutput()
+
+	lastLine := ""
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 0 {
+			state.AddOutput(line)
+			lastLine = line
+		}
+	}
+
+	if err != nil {
+		return &CommandError{
+			Name:     name,
+			Err:      err,
+			LastLine: lastLine,
+		}
+	}
+
+	return nil
+}
+
+// runCommandOutput runs a program in a directory and returns its standard
+// output. The command and each line of error output are saved in state.
+// Standard output is not saved, it is meant to be parsed.
+func runCommandOutput(ctx context.Context, state *models.ActionState,
+	dir string, name string, args ...string) ([]byte, error) {
+
+	state.AddOutput(fmt.Sprintf("$ %s %s", name, strings.Join(args, " ")))
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	lastLine := ""
+
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if len(line) > 0 {
+			state.AddOutput(line)
+			lastLine = line
+		}
+	}
+
+	if err != nil {
+		return nil, &CommandError{
+			Name:     name,
+			Err:      err,
+			LastLine: lastLine,
+		}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// commandOutputClasses match the last line a program outputs before failing
+// with the class of the failure. Programs do not report why they failed in a
+// structured way, so their output is the only indication.
+var commandOutputClasses map[models.ErrorClass]*regexp.Regexp = map[models.ErrorClass]*regexp.Regexp{
+	models.ErrorNetwork: regexp.MustCompile("(?i)connection refused|" +
+		"connection reset|broken pipe|i/o timeout|tls handshake timeout|" +
+		"no such host|unexpected eof|network is unreachable|" +
+		"timeout exceeded|deadline exceeded"),
+	models.ErrorServer: regexp.MustCompile("(?i)\\b(429|50[0-4])\\b|" +
+		"internal server error|bad gateway|service unavailable|" +
+		"gateway timeout|too many requests"),
+}
+
+// CommandError is returned when a program exits unsuccessfully
+type CommandError struct {
+	// Name is the program
+	Name string
+
+	// Err is the reason the program failed, ex: its exit status
+	Err error
+
+	// LastLine is the last line the program output, usually it explains
+	// why the program failed. Empty if the program did not output
+	// anything.
+	LastLine string
+}
+
+// Error implements error.Error
+func (e *CommandError) Error() string {
+	if len(e.LastLine) > 0 {
+		return fmt.Sprintf("Error running %s: %s: %s", e.Name,
+			e.Err.Error(), e.LastLine)
+	}
+
+	return fmt.Sprintf("Error running %s: %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the reason the program failed
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass returns the class of the failure indicated by the program's
+// last line of output. Empty if the class is not known.
+func (e *CommandError) ErrorClass() models.ErrorClass {
+	for _, class := range []models.ErrorClass{models.ErrorNetwork,
+		models.ErrorServer} {
+
+		if commandOutputClasses[class].MatchString(e.LastLine) {
+			return class
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,363 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GroupTTL is how long a job's place in a concurrency group lives unless it
+// is refreshed. Places held by workers which exit without releasing them
+// expire after this long.
+const GroupTTL time.Duration = 30 * time.Second
+
+// GroupPollInterval is how often a job's place in a concurrency group is
+// refreshed and checked
+const GroupPollInterval time.Duration = 2 * time.Second
+
+// groupCanceledSuffix is appended to the job ID in a concurrency group entry
+// when a newer job cancels the job holding the group
+const groupCanceledSuffix string = ":canceled"
+
+// ErrSuperseded indicates a job's place in a concurrency group was removed by
+// a newer job
+var ErrSuperseded error = errors.New("superseded by a newer job")
+
+// GroupLock is a job's exclusive hold on a concurrency group. Groups are
+// queues of jobs stored in an Etcd directory, the job at the front of the
+// queue holds the group. A newer job cancels the lock by marking the holder's
+// place, the holder keeps its place until it releases the lock so the newer
+// job waits for the holder's deploy to stop.
+type GroupLock struct {
+	// ctx is canceled when the lock is released or lost
+	ctx context.Context
+
+	// cancel cancels ctx
+	cancel context.CancelFunc
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// key is the job's place in the group's queue
+	key string
+
+	// released is closed when the lock is released
+	released chan struct{}
+
+	// lost is closed if a newer job cancels the lock
+	lost chan struct{}
+
+	// loseOnce ensures lost is closed once
+	loseOnce sync.Once
+}
+
+// groupEntry is a job's place in a concurrency group's queue
+type groupEntry struct {
+	// key is the Etcd key of the place
+	key string
+
+	// jobID is the ID of the job
+	jobID int64
+
+	// canceled indicates a newer job canceled the job
+	canceled bool
+}
+
+// AcquireGroupLock joins a concurrency group's queue and waits until the job
+// is at the front. The policy is applied to the jobs already in the queue
+// when joining. onWait is called with the job's position in the queue and the
+// ID of the job holding the group every GroupPollInterval while waiting.
+// Returns ErrSuperseded if a newer job removes the job from the queue or
+// cancels it, or if the policy is not PolicyQueue and a newer job is already
+// in the queue.
+func AcquireGroupLock(ctx context.Context, etcdKV etcd.KeysAPI, dir string,
+	jobID int64, policy models.ConcurrencyPolicy,
+	onWait func(position int, holderID int64)) (*GroupLock, error) {
+
+	// Join
+	resp, err := etcdKV.CreateInOrder(ctx, dir,
+		strconv.FormatInt(jobID, 10), &etcd.CreateInOrderOptions{
+			TTL: GroupTTL,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error joining concurrency group: %s",
+			err.Error())
+	}
+
+	key := resp.Node.Key
+
+	// Errors are ignored since the place expires after GroupTTL
+	leave := func() {
+		etcdKV.Delete(ctx, key, nil)
+	}
+
+	// Apply policy
+	if policy != models.PolicyQueue {
+		entries, err := getGroupEntries(ctx, etcdKV, dir)
+		if err != nil {
+			leave()
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.jobID > jobID {
+				leave()
+				return nil, ErrSuperseded
+			}
+		}
+
+		for i, entry := range entries {
+			if entry.key == key {
+				break
+			}
+
+			// The front of the queue is the in progress job. It is
+			// only canceled by the cancel policy, and removes its own
+			// place once its deploy stops.
+			if i == 0 {
+				if policy != models.PolicyCancel {
+					continue
+				}
+
+				err := cancelGroupEntry(ctx, etcdKV, entry)
+				if err != nil {
+					leave()
+					return nil, fmt.Errorf("error canceling job %d "+
+						"in concurrency group: %s", entry.jobID,
+						err.Error())
+				}
+
+				continue
+			}
+
+			_, err := etcdKV.Delete(ctx, entry.key, nil)
+			if err != nil && !etcd.IsKeyNotFound(err) {
+				leave()
+				return nil, fmt.Errorf("error removing job %d from "+
+					"concurrency group: %s", entry.jobID,
+					err.Error())
+			}
+		}
+	}
+
+	// Wait for turn
+	ticker := time.NewTicker(GroupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		entries, err := getGroupEntries(ctx, etcdKV, dir)
+		if err != nil {
+			leave()
+			return nil, err
+		}
+
+		position := -1
+		for i, entry := range entries {
+			if entry.key == key {
+				position = i
+				break
+			}
+		}
+
+		if position == -1 {
+			return nil, ErrSuperseded
+		} else if entries[position].canceled {
+			leave()
+			return nil, ErrSuperseded
+		} else if position == 0 {
+			break
+		}
+
+		onWait(position, entries[0].jobID)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			leave()
+			return nil, ctx.Err()
+		}
+
+		err = refreshGroupEntry(ctx, etcdKV, key)
+		if etcd.IsKeyNotFound(err) {
+			return nil, ErrSuperseded
+		} else if err != nil {
+			leave()
+			return nil, err
+		}
+	}
+
+	// Hold
+	lockCtx, cancel := context.WithCancel(ctx)
+
+	lock := &GroupLock{
+		ctx:      lockCtx,
+		cancel:   cancel,
+		etcdKV:   etcdKV,
+		key:      key,
+		released: make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+
+	go lock.keepAlive()
+
+	return lock, nil
+}
+
+// Context returns a context which is canceled if a newer job cancels the
+// lock. Work done while holding the lock should use it.
+func (l *GroupLock) Context() context.Context {
+	return l.ctx
+}
+
+// Lost indicates if a newer job canceled the lock
+func (l *GroupLock) Lost() bool {
+	select {
+	case <-l.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release leaves the concurrency group so the next job can hold it. Work
+// done with the lock's context must have stopped.
+func (l *GroupLock) Release() {
+	close(l.released)
+	l.cancel()
+
+	// Use a new context since the lock's context was just canceled.
+	// Errors are ignored since the place expires after GroupTTL.
+	ctx, cancel := context.WithTimeout(context.Background(),
+		GroupPollInterval)
+	defer cancel()
+
+	l.etcdKV.Delete(ctx, l.key, nil)
+}
+
+// lose cancels the lock's context
+func (l *GroupLock) lose() {
+	l.loseOnce.Do(func() {
+		close(l.lost)
+		l.cancel()
+	})
+}
+
+// keepAlive refreshes the job's place in the group until the lock is
+// released. Cancels the lock's context if a newer job cancels the lock or
+// the place is removed. The place is still refreshed after the lock is
+// canceled, so newer jobs wait until the lock is released.
+func (l *GroupLock) keepAlive() {
+	ticker := time.NewTicker(GroupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.released:
+			return
+		}
+
+		// The lock's context is canceled once the lock is lost
+		ctx, cancel := context.WithTimeout(context.Background(),
+			GroupPollInterval)
+
+		err := refreshGroupEntry(ctx, l.etcdKV, l.key)
+		if err == nil {
+			var resp *etcd.Response
+
+			resp, err = l.etcdKV.Get(ctx, l.key, &etcd.GetOptions{
+				Quorum: true,
+			})
+			if err == nil && strings.HasSuffix(resp.Node.Value,
+				groupCanceledSuffix) {
+
+				l.lose()
+			}
+		}
+
+		cancel()
+
+		if etcd.IsKeyNotFound(err) {
+			l.lose()
+			return
+		}
+	}
+}
+
+// getGroupEntries returns the jobs in a concurrency group's queue in order
+func getGroupEntries(ctx context.Context, etcdKV etcd.KeysAPI,
+	dir string) ([]groupEntry, error) {
+
+	resp, err := etcdKV.Get(ctx, dir, &etcd.GetOptions{
+		Sort:   true,
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []groupEntry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving concurrency group: %s",
+			err.Error())
+	}
+
+	entries := []groupEntry{}
+
+	for _, node := range resp.Node.Nodes {
+		value := strings.TrimSuffix(node.Value, groupCanceledSuffix)
+
+		jobID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing job ID of "+
+				"concurrency group entry %s: %s", node.Key,
+				err.Error())
+		}
+
+		entries = append(entries, groupEntry{
+			key:      node.Key,
+			jobID:    jobID,
+			canceled: value != node.Value,
+		})
+	}
+
+	return entries, nil
+}
+
+// cancelGroupEntry marks a job's place in a concurrency group as canceled.
+// Does nothing if the place was removed or already canceled.
+func cancelGroupEntry(ctx context.Context, etcdKV etcd.KeysAPI,
+	entry groupEntry) error {
+
+	jobID := strconv.FormatInt(entry.jobID, 10)
+
+	_, err := etcdKV.Set(ctx, entry.key, jobID+groupCanceledSuffix,
+		&etcd.SetOptions{
+			PrevValue: jobID,
+			TTL:       GroupTTL,
+		})
+	if etcd.IsKeyNotFound(err) || libetcd.IsCompareFailed(err) {
+		return nil
+	}
+
+	return err
+}
+
+// refreshGroupEntry resets the TTL of a job's place in a concurrency group
+func refreshGroupEntry(ctx context.Context, etcdKV etcd.KeysAPI,
+	key string) error {
+
+	_, err := etcdKV.Set(ctx, key, "", &etcd.SetOptions{
+		PrevExist: etcd.PrevExist,
+		TTL:       GroupTTL,
+		Refresh:   true,
+	})
+
+	return err
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// testGroupDir is the concurrency group tests use
+const testGroupDir string = "/concurrency/test"
+
+// ignoreWait is an AcquireGroupLock onWait callback which does nothing
+func ignoreWait(position int, holderID int64) {}
+
+func TestGroupLockCancelWaitsForHolder(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	holder, err := AcquireGroupLock(ctx, etcdKV, testGroupDir, 1,
+		models.PolicyQueue, ignoreWait)
+	if err != nil {
+		t.Fatalf("error acquiring lock: %s", err.Error())
+	}
+
+	acquired := make(chan *GroupLock, 1)
+	go func() {
+		lock, err := AcquireGroupLock(ctx, etcdKV, testGroupDir, 2,
+			models.PolicyCancel, ignoreWait)
+		if err != nil {
+			t.Errorf("error acquiring lock: %s", err.Error())
+		}
+
+		acquired <- lock
+	}()
+
+	// The holder is canceled
+	select {
+	case <-holder.Context().Done():
+	case <-time.After(3 * GroupPollInterval):
+		t.Fatal("holder's lock was not canceled")
+	}
+
+	if !holder.Lost() {
+		t.Error("expected holder's lock to be lost")
+	}
+
+	// The newer job waits while the holder stops its deploy
+	select {
+	case <-acquired:
+		t.Fatal("newer job acquired the lock before the holder " +
+			"released it")
+	case <-time.After(2 * GroupPollInterval):
+	}
+
+	holder.Release()
+
+	select {
+	case lock := <-acquired:
+		if lock != nil {
+			lock.Release()
+		}
+	case <-time.After(3 * GroupPollInterval):
+		t.Fatal("newer job did not acquire the lock after the holder " +
+			"released it")
+	}
+}
+
+func TestGroupLockCancelSupersedesWaiting(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	holder, err := AcquireGroupLock(ctx, etcdKV, testGroupDir, 1,
+		models.PolicyQueue, ignoreWait)
+	if err != nil {
+		t.Fatalf("error acquiring lock: %s", err.Error())
+	}
+	defer holder.Release()
+
+	waitingErr := make(chan error, 1)
+	go func() {
+		_, err := AcquireGroupLock(ctx, etcdKV, testGroupDir, 2,
+			models.PolicyQueue, ignoreWait)
+		waitingErr <- err
+	}()
+
+	// Wait for the second job to join
+	for {
+		entries, err := getGroupEntries(ctx, etcdKV, testGroupDir)
+		if err != nil {
+			t.Fatalf("error retrieving group: %s", err.Error())
+		}
+
+		if len(entries) == 2 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	go AcquireGroupLock(ctx, etcdKV, testGroupDir, 3, models.PolicyCancel,
+		ignoreWait)
+
+	select {
+	case err := <-waitingErr:
+		if err != ErrSuperseded {
+			t.Errorf("expected waiting job to be superseded, error: %v",
+				err)
+		}
+	case <-time.After(3 * GroupPollInterval):
+		t.Fatal("waiting job was not superseded")
+	}
+}
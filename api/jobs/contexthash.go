@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DockerIgnoreFileName is the name of the file which lists paths excluded
+// from a Docker build context
+const DockerIgnoreFileName string = ".dockerignore"
+
+// ignorePattern is one line of a .dockerignore file
+type ignorePattern struct {
+	// pattern matches slash separated paths relative to the build context
+	pattern *regexp.Regexp
+
+	// exclusion indicates the line started with "!", matching paths are
+	// included again
+	exclusion bool
+}
+
+// dockerIgnore matches paths excluded from a Docker build context. Follows
+// Docker's rules: patterns are globs where "**" matches any number of
+// directories, a pattern matching a directory excludes everything in it, and
+// the last matching pattern wins.
+type dockerIgnore struct {
+	// patterns are the lines of the .dockerignore file in order
+	patterns []ignorePattern
+}
+
+// readDockerIgnore parses the .dockerignore file in a build context. If the
+// file does not exist nothing is ignored.
+func readDockerIgnore(dir string) (dockerIgnore, error) {
+	f, err := os.Open(filepath.Join(dir, DockerIgnoreFileName))
+	if os.IsNotExist(err) {
+		return dockerIgnore{}, nil
+	} else if err != nil {
+		return dockerIgnore{}, fmt.Errorf("error opening %s: %s",
+			DockerIgnoreFileName, err.Error())
+	}
+	defer f.Close()
+
+	return parseDockerIgnore(f)
+}
+
+// parseDockerIgnore parses the contents of a .dockerignore file. Lines are
+// cleaned the way Docker cleans them: surrounding whitespace, a trailing
+// "/", and a leading "/" are removed.
+func parseDockerIgnore(r io.Reader) (dockerIgnore, error) {
+	ignore := dockerIgnore{}
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclusion := strings.HasPrefix(line, "!")
+		if exclusion {
+			line = strings.TrimSpace(line[1:])
+
+			if len(line) == 0 {
+				return ignore, fmt.Errorf("%s pattern \"!\" has no "+
+					"path", DockerIgnoreFileName)
+			}
+		}
+
+		line = filepath.ToSlash(filepath.Clean(line))
+		if len(line) > 1 {
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		pattern, err := globRegexp(line)
+		if err != nil {
+			return ignore, fmt.Errorf("error parsing %s pattern %s: %s",
+				DockerIgnoreFileName, line, err.Error())
+		}
+
+		ignore.patterns = append(ignore.patterns, ignorePattern{
+			pattern:   pattern,
+			exclusion: exclusion,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return ignore, fmt.Errorf("error reading %s: %s",
+			DockerIgnoreFileName, err.Error())
+	}
+
+	return ignore, nil
+}
+
+// globRegexp converts a .dockerignore glob to a regular expression the same
+// way Docker does. "*" and "?" do not match "/". "**" matches any number of
+// directories: at the end of a glob it matches everything, elsewhere it
+// matches zero or more whole directories, with or without a "/" after it.
+// Character classes use filepath.Match's syntax.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			i++
+
+			// ... Treat "**/" as "**"
+			if strings.HasPrefix(glob[i+1:], "/") {
+				i++
+			}
+
+			if i+1 == len(glob) {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("(.*/)?")
+			}
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.Index(glob[i:], "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+
+			expr.WriteString(glob[i : i+end+1])
+			i += end
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// Ignored indicates if a slash separated path relative to the build context
+// is excluded
+func (d dockerIgnore) Ignored(path string) bool {
+	ignored := false
+
+	for _, p := range d.patterns {
+		// A pattern matching a parent directory matches the path
+		matched := false
+		for dir := path; dir != "."; dir = filepath.ToSlash(
+			filepath.Dir(dir)) {
+
+			if p.pattern.MatchString(dir) {
+				matched = true
+				break
+			}
+		}
+
+		if matched {
+			ignored = !p.exclusion
+		}
+	}
+
+	return ignored
+}
+
+// hashBuildContext returns the hex encoded SHA256 sum of the files in a
+// Docker build context which are not excluded by its .dockerignore file,
+// and of the build arguments. The Dockerfile and .dockerignore file are
+// always included, as Docker always sends them.
+func hashBuildContext(dir string,
+	buildArgs map[string]string) (string, error) {
+
+	ignore, err := readDockerIgnore(dir)
+	if err != nil {
+		return "", err
+	}
+
+	paths := []string{}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		alwaysSent := rel == "Dockerfile" || rel == DockerIgnoreFileName
+
+		if !alwaysSent && ignore.Ignored(rel) {
+			// Exclusions can include files inside ignored
+			// directories, so only skip directories if there are
+			// none
+			if info.IsDir() && !ignore.hasExclusions() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		paths = append(paths, rel)
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing build context: %s",
+			err.Error())
+	}
+
+	sort.Strings(paths)
+
+	hash := sha256.New()
+
+	for _, rel := range paths {
+		err = hashContextPath(hash, dir, rel)
+		if err != nil {
+			return "", fmt.Errorf("error hashing %s: %s", rel,
+				err.Error())
+		}
+	}
+
+	for _, name := range sortedBuildArgNames(buildArgs) {
+		fmt.Fprintf(hash, "arg %s=%s\x00", name, buildArgs[name])
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// hasExclusions indicates if any pattern starts with "!"
+func (d dockerIgnore) hasExclusions() bool {
+	for _, p := range d.patterns {
+		if p.exclusion {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hashContextPath writes a file's path, type, permissions, and contents or
+// link target to a hash
+func hashContextPath(hash io.Writer, dir, rel string) error {
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(hash, "path %s %s\x00", rel, info.Mode())
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(hash, "link %s\x00", target)
+	case info.Mode().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(hash, "size %d\x00", info.Size())
+
+		_, err = io.Copy(hash, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
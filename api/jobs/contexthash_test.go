@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		paths map[string]bool
+	}{
+		{"*.go", map[string]bool{
+			"main.go":     true,
+			".go":         true,
+			"cmd/main.go": false,
+			"main.gox":    false,
+		}},
+		{"?.go", map[string]bool{
+			"a.go":  true,
+			"ab.go": false,
+			".go":   false,
+		}},
+		{"**", map[string]bool{
+			"a":     true,
+			"a/b/c": true,
+		}},
+		{"**/*.go", map[string]bool{
+			"main.go":       true,
+			"cmd/main.go":   true,
+			"cmd/a/main.go": true,
+			"main.js":       false,
+		}},
+		{"a/**/b", map[string]bool{
+			"a/b":     true,
+			"a/x/b":   true,
+			"a/x/y/b": true,
+			"a/xb":    false,
+			"ab":      false,
+		}},
+		{"a/**", map[string]bool{
+			"a/x":   true,
+			"a/x/y": true,
+			"a":     false,
+			"ab/x":  false,
+		}},
+
+		// "**" not followed by "/" only matches whole directories
+		{"a**b", map[string]bool{
+			"ab":   true,
+			"a/b":  true,
+			"ax/b": true,
+			"axb":  false,
+		}},
+		{"**.go", map[string]bool{
+			".go":     true,
+			"cmd/.go": true,
+			"main.go": false,
+		}},
+
+		{"[abc].txt", map[string]bool{
+			"a.txt":  true,
+			"d.txt":  false,
+			"ab.txt": false,
+		}},
+		{"[^a-c].txt", map[string]bool{
+			"d.txt": true,
+			"b.txt": false,
+		}},
+		{"\\*.txt", map[string]bool{
+			"*.txt": true,
+			"a.txt": false,
+		}},
+		{"a.b+(c)", map[string]bool{
+			"a.b+(c)": true,
+			"axbbc":   false,
+		}},
+	}
+
+	for _, test := range tests {
+		pattern, err := globRegexp(test.glob)
+		if err != nil {
+			t.Fatalf("error converting %s: %s", test.glob, err.Error())
+		}
+
+		for path, match := range test.paths {
+			if pattern.MatchString(path) != match {
+				t.Errorf("expected %s matching %s to be %t, regular "+
+					"expression: %s", test.glob, path, match,
+					pattern.String())
+			}
+		}
+	}
+}
+
+func TestDockerIgnoreIgnored(t *testing.T) {
+	tests := []struct {
+		content string
+		paths   map[string]bool
+	}{
+		{
+			content: "# Comment\n" +
+				"*.log\n" +
+				"!important.log\n" +
+				"/build/\n" +
+				"node_modules\n" +
+				"docs/**/*.md\n" +
+				"!docs/README.md\n" +
+				"  tmp  \n",
+			paths: map[string]bool{
+				"# Comment":          false,
+				"main.go":            false,
+				"app.log":            true,
+				"important.log":      false,
+				"logs/app.log":       false,
+				"build":              true,
+				"build/out/main.o":   true,
+				"src/build/main.o":   false,
+				"node_modules/a/b":   true,
+				"src/node_modules/a": false,
+				"docs/a.md":          true,
+				"docs/a/b.md":        true,
+				"docs/README.md":     false,
+				"docs/a.txt":         false,
+				"tmp":                true,
+				"tmp/a":              true,
+			},
+		},
+
+		// The last matching pattern wins
+		{
+			content: "*\n!src\nsrc/*.tmp\n",
+			paths: map[string]bool{
+				"main.go":       true,
+				"src":           false,
+				"src/main.go":   false,
+				"src/a.tmp":     true,
+				"src/pkg/a.tmp": false,
+			},
+		},
+		{
+			content: "!keep\n*\n",
+			paths: map[string]bool{
+				"keep":  true,
+				"other": true,
+			},
+		},
+
+		// Paths are cleaned
+		{
+			content: "./a/../b//c/\n",
+			paths: map[string]bool{
+				"b/c":   true,
+				"b/c/d": true,
+				"a/b/c": false,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ignore, err := parseDockerIgnore(strings.NewReader(test.content))
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", test.content, err.Error())
+		}
+
+		for path, ignored := range test.paths {
+			if ignore.Ignored(path) != ignored {
+				t.Errorf("expected %s ignored by %q to be %t", path,
+					test.content, ignored)
+			}
+		}
+	}
+
+	for _, content := range []string{"!\n", "[abc\n"} {
+		_, err := parseDockerIgnore(strings.NewReader(content))
+		if err == nil {
+			t.Errorf("expected %q to be invalid", content)
+		}
+	}
+}
+
+// writeContextFiles writes files relative to a build context directory
+func writeContextFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			t.Fatalf("error creating directory: %s", err.Error())
+		}
+
+		err = ioutil.WriteFile(path, []byte(content), 0666)
+		if err != nil {
+			t.Fatalf("error writing %s: %s", name, err.Error())
+		}
+	}
+}
+
+func TestHashBuildContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contexthash")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ignore := "*.log\nnode_modules/\n!node_modules/keep.js\n"
+
+	writeContextFiles(t, dir, map[string]string{
+		"Dockerfile":                "FROM scratch\n",
+		".dockerignore":             ignore,
+		"main.go":                   "package main\n",
+		"app.log":                   "started\n",
+		"node_modules/pkg/index.js": "module.exports = 1\n",
+		"node_modules/keep.js":      "module.exports = 1\n",
+	})
+
+	buildArgs := map[string]string{
+		"VERSION": "1.0",
+	}
+
+	hash := func() string {
+		sum, err := hashBuildContext(dir, buildArgs)
+		if err != nil {
+			t.Fatalf("error hashing build context: %s", err.Error())
+		}
+
+		return sum
+	}
+
+	previous := hash()
+
+	tests := []struct {
+		change  string
+		files   map[string]string
+		changed bool
+	}{
+		{"editing ignored file", map[string]string{
+			"app.log": "stopped\n",
+		}, false},
+		{"editing file in ignored directory", map[string]string{
+			"node_modules/pkg/index.js": "module.exports = 2\n",
+		}, false},
+		{"adding ignored file", map[string]string{
+			"debug.log": "debug\n",
+		}, false},
+		{"editing file", map[string]string{
+			"main.go": "package main\n\nfunc main() {}\n",
+		}, true},
+		{"adding file", map[string]string{
+			"lib/lib.go": "package lib\n",
+		}, true},
+		{"editing file included again", map[string]string{
+			"node_modules/keep.js": "module.exports = 2\n",
+		}, true},
+		{"editing Dockerfile", map[string]string{
+			"Dockerfile": "FROM alpine\n",
+		}, true},
+	}
+
+	for _, test := range tests {
+		writeContextFiles(t, dir, test.files)
+
+		current := hash()
+		if (current != previous) != test.changed {
+			t.Errorf("expected %s to change hash to be %t", test.change,
+				test.changed)
+		}
+
+		previous = current
+	}
+
+	// Build arguments
+	buildArgs["VERSION"] = "2.0"
+
+	if hash() == previous {
+		t.Error("expected changing build argument to change hash")
+	}
+}
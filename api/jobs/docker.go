@@ -0,0 +1,267 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// DockerAction builds and pushes a unit's Docker image with an ImageBuilder
+type DockerAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// secrets replaces references to secrets in build arguments
+	secrets SecretResolver
+
+	// registries authenticates with the registry the image is pushed to
+	registries RegistryAuth
+
+	// builder builds and pushes the image
+	builder ImageBuilder
+}
+
+// NewDockerAction creates a new DockerAction
+func NewDockerAction(ctx context.Context, logger golog.Logger,
+	etcdKV etcd.KeysAPI, secrets SecretResolver, registries RegistryAuth,
+	builder ImageBuilder) DockerAction {
+
+	return DockerAction{
+		ctx:        ctx,
+		logger:     logger,
+		etcdKV:     etcdKV,
+		secrets:    secrets,
+		registries: registries,
+		builder:    builder,
+	}
+}
+
+// Run implements UnitAction.Run
+func (a DockerAction) Run(job *models.Job, unit models.UnitConfig,
+	state *models.ActionState) error {
+
+	state.Stage = models.Running
+
+	// Authenticate with registry
+	env := []string{}
+
+	dockerConfig, registry, err := a.registries.DockerConfig(a.ctx, job,
+		unit.Docker.Tag)
+	if err != nil {
+		return err
+	}
+
+	if dockerConfig != nil {
+		state.AddOutput(fmt.Sprintf("Authenticating with registry %s "+
+			"using %s auth", registry.Host, registry.AuthType))
+
+		configDir, err := writeDockerConfigDir(dockerConfig)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(configDir)
+
+		env = append(env, fmt.Sprintf("DOCKER_CONFIG=%s", configDir))
+	}
+
+	// Promotion jobs deploy the exact image which was already deployed,
+	// never a rebuild or an image which was pushed to the same tag since
+	if job.PromotedFrom != nil {
+		image, ok := job.PromotedImages[unit.ID]
+		if !ok {
+			return fmt.Errorf("Job %d did not record the digest of the "+
+				"image it deployed, promotions do not build images",
+				*job.PromotedFrom)
+		}
+
+		if !a.builder.Exists(a.ctx, image, env) {
+			return fmt.Errorf("Image %s does not exist, promotions "+
+				"do not build images", image)
+		}
+
+		state.AddOutput(fmt.Sprintf("Promoting existing image %s",
+			image))
+
+		digest := image[strings.Index(image, "@")+1:]
+
+		setUnitImage(job, unit, image, digest)
+		state.Stage = models.Done
+
+		return nil
+	}
+
+	// Build arguments
+	buildArgs := map[string]string{}
+	secretBuildArgs := map[string]bool{}
+
+	for name, value := range unit.Docker.BuildArgs {
+		resolved, err := a.secrets.Resolve(a.ctx, job, "", value)
+		if err != nil {
+			return fmt.Errorf("Error resolving build argument %s: %s",
+				name, err.Error())
+		}
+
+		buildArgs[name] = resolved
+		secretBuildArgs[name] = len(models.SecretRefs(value)) > 0
+	}
+
+	// Re-use an image built from the same build context
+	dir := filepath.Join(job.WorkingDir, unit.Docker.Directory)
+
+	hash, err := hashBuildContext(dir, buildArgs)
+	if err != nil {
+		return fmt.Errorf("Error hashing build context: %s", err.Error())
+	}
+
+	state.AddOutput(fmt.Sprintf("Build context hash %s", hash))
+
+	built := models.BuiltImage{
+		RepositoryID: job.ID.RepositoryID,
+		UnitID:       unit.ID,
+		Hash:         hash,
+	}
+
+	cached, err := a.findCached(&built, env)
+	if err != nil {
+		return err
+	}
+
+	if cached {
+		state.AddOutput(fmt.Sprintf("Re-using image %s built by job %d "+
+			"from the same build context", built.Tag, built.JobID))
+
+		state.Cached = true
+
+		return a.recordDigest(job, unit, built.Tag, env, state)
+	}
+
+	// Rollback jobs re-deploy an image which was already pushed
+	if job.RollbackOf != nil &&
+		a.builder.Exists(a.ctx, unit.Docker.Tag, env) {
+
+		state.AddOutput(fmt.Sprintf("Image %s already exists, skipping "+
+			"build", unit.Docker.Tag))
+
+		return a.recordDigest(job, unit, unit.Docker.Tag, env, state)
+	}
+
+	// Build and push
+	state.AddOutput(fmt.Sprintf("Building with %s", a.builder.Name()))
+
+	err = a.builder.Build(a.ctx, state, BuildRequest{
+		Dir:             dir,
+		Tag:             unit.Docker.Tag,
+		BuildArgs:       buildArgs,
+		SecretBuildArgs: secretBuildArgs,
+		Env:             env,
+		CacheRef:        unit.Docker.GetCacheRef(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Record image so later jobs with the same build context re-use it.
+	// The image was pushed, so errors only prevent re-use.
+	built.Tag = unit.Docker.Tag
+	built.JobID = job.ID.ID
+
+	err = built.Set(a.ctx, a.etcdKV)
+	if err != nil {
+		state.AddOutput(fmt.Sprintf("Error recording built image, later "+
+			"jobs will rebuild it: %s", err.Error()))
+	}
+
+	return a.recordDigest(job, unit, unit.Docker.Tag, env, state)
+}
+
+// recordDigest sets the image a unit's deploy actions use to a pushed tag,
+// and records the tag's current digest so the exact image can be promoted
+func (a DockerAction) recordDigest(job *models.Job, unit models.UnitConfig,
+	tag string, env []string, state *models.ActionState) error {
+
+	digest, err := a.builder.Digest(a.ctx, tag, env)
+	if err != nil {
+		return fmt.Errorf("Error retrieving digest of image %s: %s",
+			tag, err.Error())
+	}
+
+	state.AddOutput(fmt.Sprintf("Image %s has digest %s", tag, digest))
+
+	setUnitImage(job, unit, tag, digest)
+	state.Stage = models.Done
+
+	return nil
+}
+
+// findCached retrieves the image previously built from the same build
+// context as built. Returns true if it can be re-used: it still exists and
+// its tag was not overwritten since.
+func (a DockerAction) findCached(built *models.BuiltImage,
+	env []string) (bool, error) {
+
+	err := built.Get(a.ctx, a.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Error retrieving previously built "+
+			"image: %s", err.Error())
+	}
+
+	current, err := built.TagCurrent(a.ctx, a.etcdKV)
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving previously built "+
+			"image tag: %s", err.Error())
+	}
+
+	if !current {
+		return false, nil
+	}
+
+	return a.builder.Exists(a.ctx, built.Tag, env), nil
+}
+
+// setUnitImage records the image a unit's deploy actions use, and its
+// digest if known
+func setUnitImage(job *models.Job, unit models.UnitConfig, image,
+	digest string) {
+
+	unitState := job.State.Units[unit.ID]
+	unitState.Image = image
+	unitState.Digest = digest
+	job.State.Units[unit.ID] = unitState
+}
+
+// unitImage returns the image a unit's deploy actions use: the image built,
+// re-used, or promoted by the unit's Docker action. Images with a recorded
+// digest are referenced by digest. Empty if the unit does not have a Docker
+// action.
+func unitImage(job *models.Job, unit models.UnitConfig) string {
+	if unit.Docker == nil {
+		return ""
+	}
+
+	unitState := job.State.Units[unit.ID]
+
+	if image := unitState.DigestImage(); len(image) > 0 {
+		return image
+	}
+
+	if image := unitState.Image; len(image) > 0 {
+		return image
+	}
+
+	return unit.Docker.Tag
+}
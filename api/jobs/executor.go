@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// Executor runs jobs on behalf of the JobRunner
+type Executor interface {
+	// Execute runs a job. Blocks until the job finishes.
+	Execute(job *models.Job) error
+
+	// Detached indicates if jobs keep running when the process which
+	// called Execute stops
+	Detached() bool
+}
+
+// InProcessExecutor runs jobs in the API process
+type InProcessExecutor struct {
+	// worker runs jobs
+	worker *Worker
+}
+
+// NewInProcessExecutor creates a new InProcessExecutor
+func NewInProcessExecutor(worker *Worker) InProcessExecutor {
+	return InProcessExecutor{
+		worker: worker,
+	}
+}
+
+// Execute implements Executor.Execute
+func (e InProcessExecutor) Execute(job *models.Job) error {
+	e.worker.Run(job)
+
+	return nil
+}
+
+// Detached implements Executor.Detached
+func (e InProcessExecutor) Detached() bool {
+	return false
+}
@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveExtractor extracts a gzipped tar archive into a root directory.
+// Entries which would be written outside the root are rejected, as are
+// archives larger than the extractor's budget.
+type archiveExtractor struct {
+	// root is the directory files are extracted into
+	root string
+
+	// maxBytes is the maximum total size of extracted files
+	maxBytes int64
+
+	// maxFiles is the maximum number of entries in the archive
+	maxFiles int
+
+	// links are the paths of extracted symbolic links, relative to root.
+	// Entries are never written through a link.
+	links map[string]bool
+
+	// linkPaths are the paths extracted symbolic links' targets pass
+	// through, relative to root. Symbolic links are never created at
+	// these paths, so a link's target never resolves through another link.
+	linkPaths map[string]bool
+}
+
+// newArchiveExtractor creates a new archiveExtractor
+func newArchiveExtractor(root string, maxBytes int64,
+	maxFiles int) archiveExtractor {
+
+	return archiveExtractor{
+		root:      root,
+		maxBytes:  maxBytes,
+		maxFiles:  maxFiles,
+		links:     map[string]bool{},
+		linkPaths: map[string]bool{},
+	}
+}
+
+// Extract reads a gzipped tar archive from r and writes its entries into the
+// root directory as they are read
+func (e archiveExtractor) Extract(r io.Reader) error {
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error reading gzip header: %s", err.Error())
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+
+	files := 0
+	remainingBytes := e.maxBytes
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading tar entry: %s", err.Error())
+		}
+
+		// pax_global_header entries hold metadata, not files
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		files++
+		if files > e.maxFiles {
+			return fmt.Errorf("archive contains more than %d files",
+				e.maxFiles)
+		}
+
+		relPath, err := e.entryPath(header.Name)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(e.root, relPath)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0777)
+		case tar.TypeReg, tar.TypeRegA:
+			if header.Size > remainingBytes {
+				return fmt.Errorf("archive is larger than %d bytes",
+					e.maxBytes)
+			}
+
+			var n int64
+			n, err = e.writeFile(path, tarReader, header)
+			remainingBytes -= n
+		case tar.TypeSymlink:
+			err = e.checkLinkTarget(relPath, header.Linkname)
+			if err == nil {
+				err = e.writeSymlink(path, header.Linkname)
+				e.links[relPath] = true
+			}
+		case tar.TypeLink:
+			var target string
+			target, err = e.entryPath(header.Linkname)
+			if err == nil {
+				err = os.Link(filepath.Join(e.root, target), path)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported tar entry type: %c",
+				header.Name, header.Typeflag)
+		}
+
+		if err != nil {
+			return fmt.Errorf("error extracting %s: %s", header.Name,
+				err.Error())
+		}
+	}
+}
+
+// entryPath cleans the name of an archive entry and returns its path relative
+// to the root. Returns an error if the entry would be written outside the
+// root or through a symbolic link.
+func (e archiveExtractor) entryPath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("%s: archive entry has absolute path", name)
+	}
+
+	relPath := filepath.Clean(name)
+	if relPath == ".." ||
+		strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+
+		return "", fmt.Errorf("%s: archive entry escapes working "+
+			"directory", name)
+	}
+
+	for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+		if e.links[dir] {
+			return "", fmt.Errorf("%s: archive entry is inside symbolic "+
+				"link %s", name, dir)
+		}
+	}
+
+	return relPath, nil
+}
+
+// checkLinkTarget returns an error if a symbolic link at relPath would point
+// outside the root. The target is resolved one element at a time, cleaning it
+// first would hide elements like "link/..", which the OS resolves through the
+// link. Links whose targets pass through other links are rejected, so links
+// cannot be chained to escape the root.
+func (e archiveExtractor) checkLinkTarget(relPath, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("symbolic link to absolute path %s", target)
+	}
+
+	if e.linkPaths[relPath] {
+		return fmt.Errorf("symbolic link is in the target of another " +
+			"symbolic link")
+	}
+
+	resolved := []string{}
+	if dir := filepath.Dir(relPath); dir != "." {
+		resolved = strings.Split(dir, string(filepath.Separator))
+	}
+
+	passed := []string{}
+
+	for _, element := range strings.Split(target,
+		string(filepath.Separator)) {
+
+		switch element {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return fmt.Errorf("symbolic link to %s "+
+					"escapes working directory", target)
+			}
+
+			resolved = resolved[:len(resolved)-1]
+		default:
+			resolved = append(resolved, element)
+		}
+
+		path := filepath.Join(resolved...)
+		if e.links[path] {
+			return fmt.Errorf("symbolic link to %s passes through "+
+				"symbolic link %s", target, path)
+		}
+
+		passed = append(passed, path)
+	}
+
+	for _, path := range passed {
+		e.linkPaths[path] = true
+	}
+
+	return nil
+}
+
+// writeFile copies a regular file entry to path. Returns the number of bytes
+// written.
+func (e archiveExtractor) writeFile(path string, r io.Reader,
+	header *tar.Header) (int64, error) {
+
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+		os.FileMode(header.Mode).Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	// Copy at most the size in the header, so the budget checked before
+	// writing is not exceeded
+	n, err := io.CopyN(file, r, header.Size)
+	if err != nil {
+		file.Close()
+		return n, err
+	}
+
+	return n, file.Close()
+}
+
+// writeSymlink creates a symbolic link at path
+func (e archiveExtractor) writeSymlink(path, target string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(target, path)
+}
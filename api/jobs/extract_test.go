@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry is an entry of a test archive
+type testEntry struct {
+	// name is the entry's path
+	name string
+
+	// link is the target of a symbolic link, empty for regular files
+	link string
+}
+
+// testArchive creates a gzipped tar archive of entries
+func testArchive(t *testing.T, entries []testEntry) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gzWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0666,
+			Size:     int64(len(entry.name)),
+		}
+
+		if len(entry.link) > 0 {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+			header.Size = 0
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err == nil && len(entry.link) == 0 {
+			_, err = tarWriter.Write([]byte(entry.name))
+		}
+
+		if err != nil {
+			t.Fatalf("error writing %s: %s", entry.name,
+				err.Error())
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("error closing tar: %s", err.Error())
+	}
+
+	if err := gzWriter.Close(); err != nil {
+		t.Fatalf("error closing gzip: %s", err.Error())
+	}
+
+	return buf
+}
+
+func TestArchiveExtractorLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		valid   bool
+	}{
+		{
+			name: "link inside root",
+			entries: []testEntry{
+				{name: "a/file"},
+				{name: "b/link", link: "../a/file"},
+				{name: "c", link: "a/../b"},
+			},
+			valid: true,
+		},
+		{
+			name: "link outside root",
+			entries: []testEntry{
+				{name: "a/link", link: "../../etc"},
+			},
+		},
+		{
+			name: "absolute link",
+			entries: []testEntry{
+				{name: "link", link: "/etc"},
+			},
+		},
+		{
+			name: "entry inside link",
+			entries: []testEntry{
+				{name: "link", link: "a"},
+				{name: "link/file"},
+			},
+		},
+		{
+			name: "link through earlier link",
+			entries: []testEntry{
+				{name: "a/up", link: ".."},
+				{name: "escape", link: "a/up/.."},
+			},
+		},
+		{
+			name: "link through later link",
+			entries: []testEntry{
+				{name: "escape", link: "a/up/.."},
+				{name: "a/up", link: ".."},
+			},
+		},
+		{
+			name: "link to later link",
+			entries: []testEntry{
+				{name: "escape", link: "a/up"},
+				{name: "a/up", link: "../.."},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "extract")
+		if err != nil {
+			t.Fatalf("error creating directory: %s", err.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		root := filepath.Join(dir, "root")
+
+		err = newArchiveExtractor(root, 1024, 10).Extract(
+			testArchive(t, test.entries))
+
+		if test.valid && err != nil {
+			t.Errorf("%s: expected archive to be extracted: %s",
+				test.name, err.Error())
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: expected archive to be rejected",
+				test.name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/google/go-github/github"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// Fetcher downloads a job's repository
+type Fetcher interface {
+	// Fetch downloads the repository at the job's target commit into an
+	// empty directory. Progress is saved in state. Returns the directory
+	// which holds the repository's files.
+	Fetch(ctx context.Context, job *models.Job, state *models.ActionState,
+		dir string) (string, error)
+}
+
+// DownloadErrorExcerptBytes is the number of bytes of an unsuccessful
+// download response's body shown in the action's output
+const DownloadErrorExcerptBytes int64 = 512
+
+// TarballFetcher downloads a repository as a GitHub archive tarball. The
+// tarball does not include git metadata or submodules.
+type TarballFetcher struct {
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// maxBytes is the maximum total size of files extracted from the
+	// tarball
+	maxBytes int64
+
+	// maxFiles is the maximum number of entries in the tarball
+	maxFiles int
+}
+
+// NewTarballFetcher creates a new TarballFetcher
+func NewTarballFetcher(etcdKV etcd.KeysAPI, maxBytes int64,
+	maxFiles int) TarballFetcher {
+
+	return TarballFetcher{
+		etcdKV:   etcdKV,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}
+}
+
+// Fetch implements Fetcher.Fetch
+func (f TarballFetcher) Fetch(ctx context.Context, job *models.Job,
+	state *models.ActionState, dir string) (string, error) {
+
+	// Get GitHub repository download URL
+	state.AddOutput("Initializing GitHub API")
+
+	// ... Initialize GH client
+	ghClient, err := libgh.NewClient(ctx, f.etcdKV)
+	if err == libgh.ErrNoAuth {
+		return "", errors.New("Not authenticated with GitHub")
+	} else if err != nil {
+		return "", fmt.Errorf("Error initializing GitHub API: %s", err.Error())
+	}
+
+	// ... Call API
+	state.AddOutput("Retrieving repository download URL")
+
+	dlURL, _, err := ghClient.Repositories.GetArchiveLink(ctx,
+		job.ID.RepositoryID.Owner, job.ID.RepositoryID.Name, "tarball",
+		&github.RepositoryContentGetOptions{
+			Ref: job.Target.Commit,
+		})
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving repository download "+
+			"URL: %w", err)
+	}
+
+	// Download GitHub repository contents
+	state.AddOutput("Downloading GitHub repository")
+
+	req, err := http.NewRequest(http.MethodGet, dlURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("Error creating repository download "+
+			"request: %s", err.Error())
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("Error making repository download "+
+			"request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body,
+			DownloadErrorExcerptBytes))
+
+		state.AddOutput(fmt.Sprintf("Download response body: %s",
+			strings.TrimSpace(string(excerpt))))
+
+		return "", fmt.Errorf("Error downloading repository: %w",
+			httpStatusError{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+			})
+	}
+
+	// Extract download as it is received
+	state.AddOutput("Extracting repository download")
+
+	extractor := newArchiveExtractor(dir, f.maxBytes, f.maxFiles)
+
+	err = extractor.Extract(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Error extracting repository download: %w",
+			err)
+	}
+
+	// Find extracted repository directory
+	state.AddOutput("Finding working directory")
+
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving information about "+
+			"files in working directory: %s", err.Error())
+	}
+
+	if len(fileInfos) != 1 {
+		return "", fmt.Errorf("Working directory contained an "+
+			"unexpected number of directories, count: %d",
+			len(fileInfos))
+	}
+
+	if !fileInfos[0].IsDir() {
+		return "", errors.New("Working directory does not contain the " +
+			"expected sub-directory")
+	}
+
+	return fmt.Sprintf("%s/%s", dir, fileInfos[0].Name()), nil
+}
@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GitRemote locates the git remote of a repository
+type GitRemote interface {
+	// Remote returns the URL git clones a repository from, and
+	// environment variables which authenticate git with the remote
+	Remote(ctx context.Context, repoID models.RepositoryID) (string,
+		[]string, error)
+}
+
+// GitHubRemote clones repositories from GitHub using the stored GitHub auth
+// token
+type GitHubRemote struct {
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// NewGitHubRemote creates a new GitHubRemote
+func NewGitHubRemote(etcdKV etcd.KeysAPI) GitHubRemote {
+	return GitHubRemote{
+		etcdKV: etcdKV,
+	}
+}
+
+// Remote implements GitRemote.Remote. The auth token is passed to git in an
+// HTTP header set by environment variables, so it is never saved in a
+// repository's git config or in command output.
+func (r GitHubRemote) Remote(ctx context.Context,
+	repoID models.RepositoryID) (string, []string, error) {
+
+	authToken, err := libgh.GetToken(ctx, r.etcdKV)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error retrieving GitHub auth "+
+			"token: %s", err.Error())
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(
+		"x-access-token:" + authToken))
+
+	env := []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.https://github.com/.extraheader",
+		"GIT_CONFIG_VALUE_0=Authorization: basic " + auth,
+	}
+
+	return fmt.Sprintf("https://github.com/%s/%s.git", repoID.Owner,
+		repoID.Name), env, nil
+}
+
+// mirrorLocks holds a lock for each bare mirror, so jobs in the same process
+// do not update a mirror at the same time. Keys are mirror paths.
+var mirrorLocks map[string]*sync.Mutex = map[string]*sync.Mutex{}
+
+// mirrorLocksLock guards mirrorLocks
+var mirrorLocksLock sync.Mutex
+
+// lockMirror locks a bare mirror. Returns a function which unlocks it.
+func lockMirror(path string) func() {
+	mirrorLocksLock.Lock()
+
+	lock, ok := mirrorLocks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		mirrorLocks[path] = lock
+	}
+
+	mirrorLocksLock.Unlock()
+
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+// GitFetcher clones a repository with git, including submodules. A bare
+// mirror of each repository is kept so repeat fetches only download new
+// objects, jobs clone from the mirror.
+type GitFetcher struct {
+	// remote locates repositories
+	remote GitRemote
+
+	// mirrorDir is the directory bare mirrors are kept in
+	mirrorDir string
+
+	// full indicates the full history is cloned. Otherwise only the
+	// target commit is cloned.
+	full bool
+}
+
+// NewGitFetcher creates a new GitFetcher
+func NewGitFetcher(remote GitRemote, mirrorDir string, full bool) GitFetcher {
+	return GitFetcher{
+		remote:    remote,
+		mirrorDir: mirrorDir,
+		full:      full,
+	}
+}
+
+// Fetch implements Fetcher.Fetch
+func (f GitFetcher) Fetch(ctx context.Context, job *models.Job,
+	state *models.ActionState, dir string) (string, error) {
+
+	repoID := job.ID.RepositoryID
+	commit := job.Target.Commit
+
+	remoteURL, env, err := f.remote.Remote(ctx, repoID)
+	if err != nil {
+		return "", err
+	}
+
+	// Update mirror
+	mirror, err := filepath.Abs(filepath.Join(f.mirrorDir, repoID.Owner,
+		repoID.Name+".git"))
+	if err != nil {
+		return "", fmt.Errorf("Error finding mirror path: %s", err.Error())
+	}
+
+	unlock := lockMirror(mirror)
+	defer unlock()
+
+	err = f.updateMirror(ctx, state, remoteURL, env, mirror)
+	if err != nil {
+		return "", err
+	}
+
+	// Clone from mirror
+	repoDir := filepath.Join(dir, "repo")
+
+	var cloneCmds [][]string
+
+	if f.full {
+		state.AddOutput(fmt.Sprintf("Cloning %s", commit))
+
+		cloneCmds = [][]string{
+			[]string{"clone", "--no-checkout", mirror, repoDir},
+		}
+	} else {
+		state.AddOutput(fmt.Sprintf("Shallow cloning %s", commit))
+
+		cloneCmds = [][]string{
+			[]string{"init", repoDir},
+			[]string{"-C", repoDir, "remote", "add", "origin",
+				"file://" + mirror},
+			[]string{"-C", repoDir, "fetch", "--depth", "1", "origin",
+				commit},
+		}
+	}
+
+	// Submodules with relative URLs are resolved against origin, so it
+	// is pointed at the real remote
+	cloneCmds = append(cloneCmds,
+		[]string{"-C", repoDir, "checkout", "--detach", commit},
+		[]string{"-C", repoDir, "remote", "set-url", "origin", remoteURL})
+
+	for _, args := range cloneCmds {
+		err = runCommand(ctx, state, dir, "git", args...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Submodules
+	submoduleArgs := []string{"-C", repoDir, "submodule", "update",
+		"--init", "--recursive"}
+	if !f.full {
+		submoduleArgs = append(submoduleArgs, "--depth", "1")
+	}
+
+	err = runCommandEnv(ctx, state, dir, env, "git", submoduleArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	return repoDir, nil
+}
+
+// updateMirror creates a repository's bare mirror if it does not exist,
+// otherwise fetches new objects into it
+func (f GitFetcher) updateMirror(ctx context.Context,
+	state *models.ActionState, remoteURL string, env []string,
+	mirror string) error {
+
+	_, err := os.Stat(mirror)
+	if err == nil {
+		state.AddOutput("Updating mirror")
+
+		return runCommandEnv(ctx, state, mirror, env, "git", "fetch",
+			"--prune", "origin")
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Error checking if mirror exists: %s", err.Error())
+	}
+
+	state.AddOutput("Creating mirror")
+
+	err = os.MkdirAll(filepath.Dir(mirror), 0777)
+	if err != nil {
+		return fmt.Errorf("Error creating mirror directory: %s", err.Error())
+	}
+
+	err = runCommandEnv(ctx, state, filepath.Dir(mirror), env, "git",
+		"clone", "--mirror", remoteURL, mirror)
+	if err != nil {
+		// Do not leave a partial mirror which would be fetched into
+		os.RemoveAll(mirror)
+		return err
+	}
+
+	// Allow shallow clones of any commit, not just branch tips
+	return runCommand(ctx, state, mirror, "git", "config",
+		"uploadpack.allowAnySHA1InWant", "true")
+}
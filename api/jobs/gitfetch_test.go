@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// testGitEnv holds environment variables which let tests run git without a
+// user config and clone submodules from local paths
+var testGitEnv []string = []string{
+	"GIT_AUTHOR_NAME=test",
+	"GIT_AUTHOR_EMAIL=test@example.com",
+	"GIT_COMMITTER_NAME=test",
+	"GIT_COMMITTER_EMAIL=test@example.com",
+	"GIT_CONFIG_NOSYSTEM=1",
+	"GIT_CONFIG_COUNT=1",
+	"GIT_CONFIG_KEY_0=protocol.file.allow",
+	"GIT_CONFIG_VALUE_0=always",
+}
+
+// testGitRemote is a GitRemote which clones every repository from a local
+// bare repository
+type testGitRemote struct {
+	// path is the bare repository
+	path string
+}
+
+// Remote implements GitRemote.Remote
+func (r testGitRemote) Remote(ctx context.Context,
+	repoID models.RepositoryID) (string, []string, error) {
+
+	return r.path, testGitEnv, nil
+}
+
+// runGit runs git in a directory, returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), testGitEnv...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running git %s: %s: %s",
+			strings.Join(args, " "), err.Error(), out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile writes a file in a repository and commits it, returns the commit
+func commitFile(t *testing.T, dir, name, content string) string {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content),
+		0666)
+	if err != nil {
+		t.Fatalf("error writing %s: %s", name, err.Error())
+	}
+
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-m", "Update "+name)
+
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+// newTestGitRepo creates a bare repository with a submodule, returns the
+// bare repository and a working copy which pushes to it
+func newTestGitRepo(t *testing.T, dir string) (string, string) {
+	// Submodule
+	sub := filepath.Join(dir, "sub")
+	runGit(t, dir, "init", sub)
+	commitFile(t, sub, "lib.txt", "lib")
+
+	// Repository
+	bare := filepath.Join(dir, "repo.git")
+	runGit(t, dir, "init", "--bare", bare)
+
+	work := filepath.Join(dir, "work")
+	runGit(t, dir, "clone", bare, work)
+	runGit(t, work, "submodule", "add", sub, "sub")
+
+	return bare, work
+}
+
+// readTestFile reads a file the test expects to exist
+func readTestFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading %s: %s", path, err.Error())
+	}
+
+	return string(content)
+}
+
+func TestGitFetcherShallowFetchesCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitfetch")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	bare, work := newTestGitRepo(t, dir)
+
+	// Fetch a commit which is not a branch tip
+	target := commitFile(t, work, "app.txt", "first")
+	commitFile(t, work, "app.txt", "second")
+	runGit(t, work, "push", "origin", "HEAD")
+
+	fetcher := NewGitFetcher(testGitRemote{
+		path: bare,
+	}, filepath.Join(dir, "mirrors"), false)
+
+	job := models.NewJob(testRepositoryID, models.JobTarget{
+		Branch: "master",
+		Commit: target,
+	})
+
+	jobDir := filepath.Join(dir, "job")
+	err = os.Mkdir(jobDir, 0777)
+	if err != nil {
+		t.Fatalf("error creating job directory: %s", err.Error())
+	}
+
+	repoDir, err := fetcher.Fetch(context.Background(), job,
+		&models.ActionState{}, jobDir)
+	if err != nil {
+		t.Fatalf("error fetching: %s", err.Error())
+	}
+
+	if content := readTestFile(t, filepath.Join(repoDir,
+		"app.txt")); content != "first" {
+
+		t.Errorf("expected target commit to be checked out, app.txt "+
+			"holds: %s", content)
+	}
+
+	if content := readTestFile(t, filepath.Join(repoDir, "sub",
+		"lib.txt")); content != "lib" {
+
+		t.Errorf("expected submodule to be checked out, lib.txt "+
+			"holds: %s", content)
+	}
+
+	if count := runGit(t, repoDir, "rev-list", "--count",
+		"HEAD"); count != "1" {
+
+		t.Errorf("expected shallow clone to hold 1 commit, holds %s",
+			count)
+	}
+
+	if origin := runGit(t, repoDir, "remote", "get-url",
+		"origin"); origin != bare {
+
+		t.Errorf("expected origin to be the remote, was: %s", origin)
+	}
+}
+
+func TestGitFetcherUpdatesMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitfetch")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	bare, work := newTestGitRepo(t, dir)
+
+	fetcher := NewGitFetcher(testGitRemote{
+		path: bare,
+	}, filepath.Join(dir, "mirrors"), true)
+
+	// Each fetch must see commits pushed after the mirror was created
+	for i, content := range []string{"first", "second"} {
+		commit := commitFile(t, work, "app.txt", content)
+		runGit(t, work, "push", "origin", "HEAD")
+
+		job := models.NewJob(testRepositoryID, models.JobTarget{
+			Branch: "master",
+			Commit: commit,
+		})
+
+		jobDir := filepath.Join(dir, content)
+		err = os.Mkdir(jobDir, 0777)
+		if err != nil {
+			t.Fatalf("error creating job directory: %s",
+				err.Error())
+		}
+
+		repoDir, err := fetcher.Fetch(context.Background(), job,
+			&models.ActionState{}, jobDir)
+		if err != nil {
+			t.Fatalf("error fetching %s: %s", content, err.Error())
+		}
+
+		if checkedOut := readTestFile(t, filepath.Join(repoDir,
+			"app.txt")); checkedOut != content {
+
+			t.Errorf("expected fetch %d to check out %s, app.txt "+
+				"holds: %s", i, content, checkedOut)
+		}
+
+		// Full clones hold every commit made so far
+		count := runGit(t, repoDir, "rev-list", "--count", "HEAD")
+		if expected := fmt.Sprint(i + 1); count != expected {
+			t.Errorf("expected full clone %d to hold %s commits, "+
+				"holds %s", i, expected, count)
+		}
+	}
+}
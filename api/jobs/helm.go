@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+)
+
+// HelmAction deploys a unit's Helm chart, then waits for the release's
+// workloads to roll out. The Helm release is named after the unit.
+type HelmAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// cluster holds the Kubernetes API clients for the environment's
+	// cluster
+	cluster *libkube.Cluster
+
+	// kubeConfig is the path of the kubeconfig file passed to Helm. If
+	// empty Helm's default is used.
+	kubeConfig string
+
+	// secrets replaces references to secrets in values
+	secrets SecretResolver
+
+	// registries provides credentials for the image pull secret
+	registries RegistryAuth
+
+	// save stores the job so rollout progress can be observed while the
+	// action waits
+	save func()
+}
+
+// NewHelmAction creates a new HelmAction
+func NewHelmAction(ctx context.Context, logger golog.Logger,
+	cluster *libkube.Cluster, kubeConfig string, secrets SecretResolver,
+	registries RegistryAuth, save func()) HelmAction {
+
+	return HelmAction{
+		ctx:        ctx,
+		logger:     logger,
+		cluster:    cluster,
+		kubeConfig: kubeConfig,
+		secrets:    secrets,
+		registries: registries,
+		save:       save,
+	}
+}
+
+// Run implements DeployAction.Run
+func (a HelmAction) Run(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig, state *models.ActionState) error {
+
+	state.Stage = models.Running
+
+	namespace := env.NamespaceFor(unit.Helm.Namespace)
+	kubeArgs := helmKubeArgs(a.kubeConfig, env, namespace)
+
+	// Image pull secret
+	if len(unit.Helm.ImagePullSecret) > 0 {
+		err := a.applyImagePullSecret(job, unit, namespace, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Upgrade
+	args := []string{"upgrade", "--install", unit.HelmRelease()}
+
+	if len(unit.Helm.Repository) > 0 {
+		args = append(args, unit.Helm.Chart, "--repo",
+			unit.Helm.Repository)
+	} else {
+		args = append(args, filepath.Join(job.WorkingDir,
+			unit.Helm.Chart))
+	}
+
+	args = append(args, kubeArgs...)
+
+	// ... Environment values, sorted so the command is the same each run
+	valueKeys := []string{}
+	for key := range env.Values {
+		valueKeys = append(valueKeys, key)
+	}
+
+	sort.Strings(valueKeys)
+
+	for _, key := range valueKeys {
+		value, err := a.secrets.Resolve(a.ctx, job, env.ID,
+			env.Values[key])
+		if err != nil {
+			return fmt.Errorf("Error resolving value %s: %s",
+				key, err.Error())
+		}
+
+		args = append(args, "--set", fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// ... Image built or re-used by the unit's Docker action
+	if len(unit.Helm.ImageValue) > 0 {
+		args = append(args, "--set", fmt.Sprintf("%s=%s",
+			unit.Helm.ImageValue, unitImage(job, unit)))
+	}
+
+	err := runCommand(a.ctx, state, job.WorkingDir, "helm", args...)
+	if err != nil {
+		return err
+	}
+
+	// Record release revision so it can be rolled back to
+	revision, err := helmRevision(a.ctx, state, job.WorkingDir,
+		unit.HelmRelease(), kubeArgs)
+	if err != nil {
+		return err
+	}
+
+	environmentState(job, unit, env).HelmRevision = revision
+
+	state.AddOutput(fmt.Sprintf("Deployed release revision %d", revision))
+
+	a.save()
+
+	// Wait for rollout
+	timeout := DefaultRolloutTimeout
+	if len(unit.Helm.RolloutTimeout) > 0 {
+		timeout, err = time.ParseDuration(unit.Helm.RolloutTimeout)
+		if err != nil {
+			return fmt.Errorf("Error parsing rollout timeout: %s",
+				err.Error())
+		}
+	}
+
+	manifest, err := runCommandOutput(a.ctx, state, job.WorkingDir, "helm",
+		append([]string{"get", "manifest", unit.HelmRelease()},
+			kubeArgs...)...)
+	if err != nil {
+		return fmt.Errorf("Error retrieving release manifest: %w", err)
+	}
+
+	objs, err := libkube.DecodeManifests(bytes.NewReader(manifest))
+	if err != nil {
+		return fmt.Errorf("Error decoding release manifest: %s", err.Error())
+	}
+
+	err = waitForRollout(a.ctx, a.cluster, workloads(objs, namespace),
+		timeout, state, a.save)
+	if err != nil {
+		return err
+	}
+
+	state.Stage = models.Done
+
+	return nil
+}
+
+// applyImagePullSecret creates or updates the unit's image pull secret with
+// the credentials of the registry the unit's Docker action pushes to
+func (a HelmAction) applyImagePullSecret(job *models.Job,
+	unit models.UnitConfig, namespace string,
+	state *models.ActionState) error {
+
+	// Validated when the configuration was parsed
+	tag := unit.Docker.Tag
+
+	dockerConfig, registry, err := a.registries.DockerConfig(a.ctx, job,
+		tag)
+	if err != nil {
+		return err
+	}
+
+	if dockerConfig == nil {
+		return fmt.Errorf("Registry %s is not configured, cannot create "+
+			"image pull secret", models.ImageRegistryHost(tag))
+	}
+
+	if registry.AuthType == models.AuthToken {
+		return fmt.Errorf("Registry %s uses %s auth, which Kubernetes "+
+			"cannot pull with", registry.Host, registry.AuthType)
+	}
+
+	// Only the repository label is set, so kubernetes and kustomize
+	// actions do not prune the secret
+	labels := map[string]string{
+		libkube.LabelRepository: libkube.LabelValue(fmt.Sprintf("%s.%s",
+			job.ID.RepositoryID.Owner, job.ID.RepositoryID.Name)),
+	}
+
+	err = libkube.ApplyImagePullSecret(a.ctx, a.cluster, namespace,
+		unit.Helm.ImagePullSecret, labels, dockerConfig)
+	if err != nil {
+		return fmt.Errorf("Error applying image pull secret: %w", err)
+	}
+
+	state.AddOutput(fmt.Sprintf("Applied image pull secret %s/%s for "+
+		"registry %s", namespace, unit.Helm.ImagePullSecret,
+		registry.Host))
+
+	return nil
+}
+
+// helmKubeArgs returns the Helm flags which select the cluster and namespace
+// of an environment
+func helmKubeArgs(kubeConfig string, env models.EnvironmentConfig,
+	namespace string) []string {
+
+	args := []string{"--namespace", namespace}
+
+	if len(kubeConfig) > 0 {
+		args = append(args, "--kubeconfig", kubeConfig)
+	}
+
+	if len(env.Context) > 0 {
+		args = append(args, "--kube-context", env.Context)
+	}
+
+	return args
+}
+
+// helmRevision returns the current revision of a Helm release. kubeArgs
+// are returned by helmKubeArgs. Helm's error output is saved in state.
+func helmRevision(ctx context.Context, state *models.ActionState,
+	dir string, release string, kubeArgs []string) (int, error) {
+
+	args := append([]string{"status", release, "--output", "json"},
+		kubeArgs...)
+
+	out, err := runCommandOutput(ctx, state, dir, "helm", args...)
+	if err != nil {
+		return 0, fmt.Errorf("Error retrieving release status: %w", err)
+	}
+
+	var status struct {
+		Version int `json:"version"`
+	}
+
+	err = json.Unmarshal(out, &status)
+	if err != nil {
+		return 0, fmt.Errorf("Error decoding release status: %s", err.Error())
+	}
+
+	return status.Version, nil
+}
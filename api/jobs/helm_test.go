@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// fakeHelm puts a helm program which runs script first on PATH. Returns a
+// function which restores PATH and deletes the program.
+func fakeHelm(t *testing.T, script string) func() {
+	dir, err := ioutil.TempDir("", "helm")
+	if err != nil {
+		t.Fatalf("error creating directory: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "helm"),
+		[]byte("#!/bin/sh\n"+script), 0777)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error writing helm: %s", err.Error())
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHelmRevision(t *testing.T) {
+	defer fakeHelm(t, "echo '{\"name\": \"api\", \"version\": 3}'\n"+
+		"echo 'WARNING: kubeconfig is group-readable' >&2\n")()
+
+	state := models.NewActionState()
+
+	revision, err := helmRevision(context.Background(), state, "", "api",
+		helmKubeArgs("", models.EnvironmentConfig{}, "default"))
+	if err != nil {
+		t.Fatalf("error retrieving revision: %s", err.Error())
+	}
+
+	if revision != 3 {
+		t.Errorf("expected revision 3, got %d", revision)
+	}
+
+	// Command and warning
+	if state.OutputLines != 2 {
+		t.Errorf("expected 2 lines of output, got %d",
+			state.OutputLines)
+	}
+}
+
+func TestHelmRevisionReportsErrorOutput(t *testing.T) {
+	defer fakeHelm(t, "echo 'Error: release: not found' >&2\nexit 1\n")()
+
+	state := models.NewActionState()
+
+	_, err := helmRevision(context.Background(), state, "", "api", nil)
+	if err == nil {
+		t.Fatal("expected error when helm fails")
+	}
+
+	if !strings.Contains(err.Error(), "Error: release: not found") {
+		t.Errorf("expected error to include helm's error output, "+
+			"got: %s", err.Error())
+	}
+
+	// Command and error
+	if state.OutputLines != 2 {
+		t.Errorf("expected 2 lines of output, got %d",
+			state.OutputLines)
+	}
+}
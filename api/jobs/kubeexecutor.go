@@ -0,0 +1,395 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubeJobLabelPrefix is the prefix of labels added to worker Kubernetes Jobs
+const KubeJobLabelPrefix string = "kube-git-deploy"
+
+// KubeJobDeadlineMargin is how long a worker Kubernetes Job may run after the
+// job timeout and a rollback timeout, to finish saving and cleaning up
+const KubeJobDeadlineMargin time.Duration = 5 * time.Minute
+
+// KubeJobNameHashLength is the number of characters of the repository ID
+// hash included in worker Kubernetes Job names
+const KubeJobNameHashLength int = 8
+
+// KubeJobWatchBackoff is the delay before a worker Kubernetes Job is watched
+// again after a watch ends. Doubles each time a watch ends without events.
+const KubeJobWatchBackoff time.Duration = time.Second
+
+// KubeJobWatchMaxBackoff is the longest delay before a worker Kubernetes Job
+// is watched again
+const KubeJobWatchMaxBackoff time.Duration = 30 * time.Second
+
+// KubeJobDeletePollInterval is how often a deleted worker Kubernetes Job is
+// checked until it no longer exists
+const KubeJobDeletePollInterval time.Duration = 2 * time.Second
+
+// kubeNameInvalidChars matches characters which are not allowed in
+// Kubernetes resource names
+var kubeNameInvalidChars *regexp.Regexp = regexp.MustCompile("[^a-z0-9-]+")
+
+// KubeExecutor runs each job as a Kubernetes Job. The Kubernetes Job runs the
+// API binary in worker mode, which executes the job and saves its state in
+// Etcd. The KubeExecutor only creates and watches Kubernetes Jobs.
+type KubeExecutor struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// cfg is configuration
+	cfg *config.Config
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// logStore holds job action output
+	logStore models.LogStore
+
+	// kubeClient is a Kubernetes API client
+	kubeClient kubernetes.Interface
+}
+
+// NewKubeExecutor creates a new KubeExecutor
+func NewKubeExecutor(ctx context.Context, logger golog.Logger,
+	cfg *config.Config, etcdKV etcd.KeysAPI, logStore models.LogStore,
+	kubeClient kubernetes.Interface) KubeExecutor {
+
+	return KubeExecutor{
+		ctx:        ctx,
+		logger:     logger,
+		cfg:        cfg,
+		etcdKV:     etcdKV,
+		logStore:   logStore,
+		kubeClient: kubeClient,
+	}
+}
+
+// KubeJobName returns the name of the Kubernetes Job which runs a job. The
+// repository is included to make the name readable. Since invalid characters
+// are replaced, a hash of the repository ID is also included to keep names of
+// different repositories unique.
+func KubeJobName(id models.JobID) string {
+	name := strings.ToLower(fmt.Sprintf("%s-%s", id.RepositoryID.Owner,
+		id.RepositoryID.Name))
+	name = strings.Trim(kubeNameInvalidChars.ReplaceAllString(name, "-"),
+		"-")
+
+	// GitHub users and repository names can not contain slashes
+	hash := sha256.Sum256([]byte(id.RepositoryID.Owner + "/" +
+		id.RepositoryID.Name))
+
+	suffix := fmt.Sprintf("-%s-%d",
+		hex.EncodeToString(hash[:])[:KubeJobNameHashLength], id.ID)
+
+	// Resource names can be at most 63 characters long
+	maxLen := 63 - len("kgd-") - len(suffix)
+	if len(name) > maxLen {
+		name = strings.TrimRight(name[:maxLen], "-")
+	}
+
+	return fmt.Sprintf("kgd-%s%s", name, suffix)
+}
+
+// newKubeJob builds the Kubernetes Job which runs a job
+func (e KubeExecutor) newKubeJob(job *models.Job) *batchv1.Job {
+	var backoffLimit int32 = 0
+
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by":           "kube-git-deploy",
+		KubeJobLabelPrefix + "/repository-owner": job.ID.RepositoryID.Owner,
+		KubeJobLabelPrefix + "/repository-name":  job.ID.RepositoryID.Name,
+		KubeJobLabelPrefix + "/job-id":           strconv.FormatInt(job.ID.ID, 10),
+	}
+
+	container := corev1.Container{
+		Name:  "worker",
+		Image: e.cfg.KubeWorkerImage,
+		Args: []string{
+			"worker",
+			"-owner", job.ID.RepositoryID.Owner,
+			"-repo", job.ID.RepositoryID.Name,
+			"-job", strconv.FormatInt(job.ID.ID, 10),
+		},
+	}
+
+	if len(e.cfg.KubeWorkerEnvSecret) > 0 {
+		container.EnvFrom = []corev1.EnvFromSource{
+			corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: e.cfg.KubeWorkerEnvSecret,
+					},
+				},
+			},
+		}
+	}
+
+	// The worker stops actions after the job timeout, the deadline stops
+	// workers which hang anyway. The action running when the job times out
+	// may be rolled back.
+	var activeDeadline *int64
+	if e.cfg.JobTimeout > 0 {
+		seconds := int64((e.cfg.JobTimeout + e.cfg.RollbackTimeout +
+			KubeJobDeadlineMargin).Seconds())
+		activeDeadline = &seconds
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      KubeJobName(job.ID),
+			Namespace: e.cfg.KubeNamespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			// Actions are not safe to re-run, so the worker pod is
+			// never retried
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: activeDeadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: e.cfg.KubeWorkerServiceAccount,
+					Containers:         []corev1.Container{container},
+				},
+			},
+		},
+	}
+}
+
+// Execute implements Executor.Execute
+func (e KubeExecutor) Execute(job *models.Job) error {
+	// Create Kubernetes Job
+	kubeJob := e.newKubeJob(job)
+
+	err := e.createKubeJob(kubeJob)
+	if err != nil {
+		return err
+	}
+
+	// Wait for Kubernetes Job to finish
+	failReason, err := e.waitForKubeJob(kubeJob.Name)
+	if err != nil {
+		return fmt.Errorf("error waiting for Kubernetes Job to "+
+			"finish: %s", err.Error())
+	}
+
+	// Check worker finished the job
+	err = job.Get(e.ctx, e.etcdKV)
+	if err != nil {
+		return fmt.Errorf("error retrieving job state: %s", err.Error())
+	}
+
+	if job.State.Done() {
+		return nil
+	}
+
+	// The job will be resumed by a new Kubernetes Job with the same name,
+	// so this one must be gone first
+	if job.State.Paused() {
+		err = e.deleteKubeJob(kubeJob.Name)
+		if err != nil {
+			return fmt.Errorf("error deleting paused Kubernetes Job: "+
+				"%s", err.Error())
+		}
+
+		return nil
+	}
+
+	if len(failReason) == 0 {
+		failReason = "worker exited before job finished"
+	}
+
+	job.State.Interrupt(failReason)
+
+	err = job.Save(e.ctx, e.etcdKV, e.logStore)
+	if err != nil {
+		return fmt.Errorf("error saving interrupted job: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// createKubeJob creates a worker Kubernetes Job. If a Kubernetes Job with the
+// same name is still running, ex: the runner which created it stopped, it is
+// watched instead. If one exists which already finished, it is left over from
+// an earlier run and is replaced.
+func (e KubeExecutor) createKubeJob(kubeJob *batchv1.Job) error {
+	jobsAPI := e.kubeClient.BatchV1().Jobs(e.cfg.KubeNamespace)
+
+	_, err := jobsAPI.Create(e.ctx, kubeJob, metav1.CreateOptions{})
+	if err == nil {
+		return nil
+	} else if !kerrors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating Kubernetes Job: %s",
+			err.Error())
+	}
+
+	existing, err := jobsAPI.Get(e.ctx, kubeJob.Name, metav1.GetOptions{})
+	if err == nil {
+		if finished, _ := kubeJobFinished(existing); !finished {
+			return nil
+		}
+
+		err = e.deleteKubeJob(kubeJob.Name)
+		if err != nil {
+			return fmt.Errorf("error deleting finished Kubernetes "+
+				"Job from an earlier run: %s", err.Error())
+		}
+	} else if !kerrors.IsNotFound(err) {
+		return fmt.Errorf("error retrieving existing Kubernetes Job: %s",
+			err.Error())
+	}
+
+	_, err = jobsAPI.Create(e.ctx, kubeJob, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating Kubernetes Job: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// deleteKubeJob deletes a worker Kubernetes Job and waits until it and its
+// pods no longer exist
+func (e KubeExecutor) deleteKubeJob(name string) error {
+	jobsAPI := e.kubeClient.BatchV1().Jobs(e.cfg.KubeNamespace)
+
+	// Foreground propagation keeps the Kubernetes Job until its pods are
+	// deleted
+	propagation := metav1.DeletePropagationForeground
+
+	err := jobsAPI.Delete(e.ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error deleting Kubernetes Job: %s",
+			err.Error())
+	}
+
+	ticker := time.NewTicker(KubeJobDeletePollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err = jobsAPI.Get(e.ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error checking if Kubernetes Job was "+
+				"deleted: %s", err.Error())
+		}
+
+		select {
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Detached implements Executor.Detached
+func (e KubeExecutor) Detached() bool {
+	return true
+}
+
+// kubeJobFinished checks if a Kubernetes Job completed or failed. Returns
+// the reason the Kubernetes Job failed, empty if it completed.
+func kubeJobFinished(kubeJob *batchv1.Job) (bool, string) {
+	for _, cond := range kubeJob.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		if cond.Type == batchv1.JobComplete {
+			return true, ""
+		} else if cond.Type == batchv1.JobFailed {
+			return true, fmt.Sprintf("worker Kubernetes Job failed: %s",
+				cond.Message)
+		}
+	}
+
+	return false, ""
+}
+
+// waitForKubeJob watches a Kubernetes Job until it completes or fails.
+// Returns the reason the Kubernetes Job failed, empty if it completed.
+func (e KubeExecutor) waitForKubeJob(name string) (string, error) {
+	jobsAPI := e.kubeClient.BatchV1().Jobs(e.cfg.KubeNamespace)
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+
+	backoff := KubeJobWatchBackoff
+
+	for {
+		watcher, err := jobsAPI.Watch(e.ctx, metav1.ListOptions{
+			FieldSelector: selector,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error watching Kubernetes Job: %s",
+				err.Error())
+		}
+
+		for event := range watcher.ResultChan() {
+			// Watch is working, so the next one starts quickly
+			backoff = KubeJobWatchBackoff
+
+			if event.Type == watch.Deleted {
+				watcher.Stop()
+				return "worker Kubernetes Job was deleted", nil
+			}
+
+			kubeJob, ok := event.Object.(*batchv1.Job)
+			if !ok {
+				continue
+			}
+
+			if finished, failReason := kubeJobFinished(kubeJob); finished {
+				watcher.Stop()
+				return failReason, nil
+			}
+		}
+
+		// Result channel closes when the watch times out or the API
+		// server ends it, start a new watch after a delay unless
+		// stopping
+		select {
+		case <-e.ctx.Done():
+			return "", e.ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > KubeJobWatchMaxBackoff {
+			backoff = KubeJobWatchMaxBackoff
+		}
+	}
+}
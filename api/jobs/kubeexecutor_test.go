@@ -0,0 +1,406 @@
+package jobs
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// testKubeNamespace is the namespace test worker Kubernetes Jobs are
+// created in
+const testKubeNamespace string = "kgd-test"
+
+// testExecuteTimeout is how long a test waits for Execute to return
+const testExecuteTimeout time.Duration = 30 * time.Second
+
+// kubeNameFormat matches valid Kubernetes resource names
+var kubeNameFormat *regexp.Regexp = regexp.MustCompile(
+	"^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+func TestKubeJobNameUnambiguous(t *testing.T) {
+	a := KubeJobName(models.JobID{
+		RepositoryID: models.RepositoryID{
+			Owner: "a-b",
+			Name:  "c",
+		},
+		ID: 1,
+	})
+	b := KubeJobName(models.JobID{
+		RepositoryID: models.RepositoryID{
+			Owner: "a",
+			Name:  "b-c",
+		},
+		ID: 1,
+	})
+
+	if a == b {
+		t.Fatalf("repositories a-b/c and a/b-c have the same Kubernetes "+
+			"Job name: %s", a)
+	}
+}
+
+func TestKubeJobNameValid(t *testing.T) {
+	ids := []models.JobID{
+		models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: "Noah-Huppert",
+				Name:  "kube_git.deploy",
+			},
+			ID: 12,
+		},
+		models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: strings.Repeat("owner", 20),
+				Name:  strings.Repeat("-repo-", 20),
+			},
+			ID: 123456789,
+		},
+	}
+
+	for _, id := range ids {
+		name := KubeJobName(id)
+
+		if len(name) > 63 {
+			t.Errorf("name %s is longer than 63 characters", name)
+		}
+
+		if !kubeNameFormat.MatchString(name) {
+			t.Errorf("name %s is not a valid Kubernetes name", name)
+		}
+	}
+}
+
+// kubeExecutorTest holds the dependencies of a KubeExecutor under test
+type kubeExecutorTest struct {
+	// executor is under test
+	executor KubeExecutor
+
+	// kubeClient is the fake Kubernetes API the executor uses
+	kubeClient *fake.Clientset
+
+	// watcher sends the events of Kubernetes Job watches
+	watcher *watch.FakeWatcher
+
+	// etcdKV is a client of a test Etcd server
+	etcdKV etcd.KeysAPI
+
+	// job is run by the executor
+	job *models.Job
+}
+
+// newKubeExecutorTest creates a KubeExecutor with a fake Kubernetes API which
+// holds objects. Saves a job with the state set by setState.
+func newKubeExecutorTest(t *testing.T, etcdKV etcd.KeysAPI,
+	setState func(state *models.JobState),
+	objects ...runtime.Object) kubeExecutorTest {
+
+	ctx := context.Background()
+
+	// Job
+	job := models.NewJob(models.RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}, models.JobTarget{
+		Branch: "master",
+		Commit: "abc",
+	})
+
+	err := job.Create(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error creating job: %s", err.Error())
+	}
+
+	setState(&job.State)
+
+	err = job.Set(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error saving job: %s", err.Error())
+	}
+
+	// Executor
+	kubeClient := fake.NewSimpleClientset(objects...)
+
+	watcher := watch.NewFake()
+	kubeClient.PrependWatchReactor("jobs",
+		func(action ktesting.Action) (bool, watch.Interface, error) {
+			return true, watcher, nil
+		})
+
+	cfg := &config.Config{
+		KubeNamespace:   testKubeNamespace,
+		KubeWorkerImage: "kube-git-deploy/api:test",
+	}
+
+	executor := NewKubeExecutor(ctx, golog.NewStdLogger("test"), cfg,
+		etcdKV, models.NewEtcdLogStore(etcdKV), kubeClient)
+
+	return kubeExecutorTest{
+		executor:   executor,
+		kubeClient: kubeClient,
+		watcher:    watcher,
+		etcdKV:     etcdKV,
+		job:        job,
+	}
+}
+
+// execute runs the job, sends a watch event for the Kubernetes Job with
+// condition, and waits for Execute to return
+func (e kubeExecutorTest) execute(t *testing.T,
+	condition batchv1.JobCondition) {
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- e.executor.Execute(e.job)
+	}()
+
+	finished := e.executor.newKubeJob(e.job)
+	finished.Status.Conditions = []batchv1.JobCondition{condition}
+
+	e.watcher.Modify(finished)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("error executing job: %s", err.Error())
+		}
+	case <-time.After(testExecuteTimeout):
+		t.Fatal("timed out waiting for Execute to return")
+	}
+}
+
+// countActions returns the number of Kubernetes API requests with verb made
+// for Kubernetes Jobs
+func (e kubeExecutorTest) countActions(verb string) int {
+	count := 0
+
+	for _, action := range e.kubeClient.Actions() {
+		if action.GetResource().Resource == "jobs" && action.GetVerb() == verb {
+			count++
+		}
+	}
+
+	return count
+}
+
+// completed is the condition of a Kubernetes Job which completed
+var completed batchv1.JobCondition = batchv1.JobCondition{
+	Type:   batchv1.JobComplete,
+	Status: corev1.ConditionTrue,
+}
+
+// markDone sets all actions in a job state to done
+func markDone(state *models.JobState) {
+	state.PrepareState.Stage = models.Done
+	state.CleanupState.Stage = models.Done
+}
+
+func TestKubeExecutorExecuteCompleted(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	test := newKubeExecutorTest(t, etcdKV, markDone)
+
+	test.execute(t, completed)
+
+	kubeJob, err := test.kubeClient.BatchV1().Jobs(testKubeNamespace).Get(
+		context.Background(), KubeJobName(test.job.ID),
+		metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error retrieving worker Kubernetes Job: %s",
+			err.Error())
+	}
+
+	args := strings.Join(kubeJob.Spec.Template.Spec.Containers[0].Args,
+		" ")
+	if args != "worker -owner owner -repo repo -job 0" {
+		t.Errorf("unexpected worker arguments: %s", args)
+	}
+
+	if !test.job.State.Succeeded() {
+		t.Errorf("job did not succeed, state: %#v", test.job.State)
+	}
+}
+
+func TestKubeExecutorExecuteFailed(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	test := newKubeExecutorTest(t, etcdKV, func(state *models.JobState) {
+		state.PrepareState.Stage = models.Running
+	})
+
+	test.execute(t, batchv1.JobCondition{
+		Type:    batchv1.JobFailed,
+		Status:  corev1.ConditionTrue,
+		Message: "deadline exceeded",
+	})
+
+	job := models.Job{
+		ID: test.job.ID,
+	}
+
+	err := job.Get(context.Background(), etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving job: %s", err.Error())
+	}
+
+	expected := "Interrupted: worker Kubernetes Job failed: deadline " +
+		"exceeded"
+
+	for name, state := range map[string]*models.ActionState{
+		"prepare": job.State.PrepareState,
+		"cleanup": job.State.CleanupState,
+	} {
+		if state.Stage != models.ErrDone || state.LastError != expected {
+			t.Errorf("%s action was not interrupted, state: %#v",
+				name, state)
+		}
+	}
+}
+
+func TestKubeExecutorExecutePausedWaitsForDelete(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	test := newKubeExecutorTest(t, etcdKV, func(state *models.JobState) {
+		state.PrepareState.Stage = models.Done
+		state.CleanupState.Stage = models.AwaitingApproval
+	})
+
+	// Foreground deletion keeps the Kubernetes Job around until its pods
+	// are deleted
+	var lock sync.Mutex
+	deleted := false
+	getsAfterDelete := 0
+
+	test.kubeClient.PrependReactor("delete", "jobs",
+		func(action ktesting.Action) (bool, runtime.Object, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			deleted = true
+
+			return true, nil, nil
+		})
+	test.kubeClient.PrependReactor("get", "jobs",
+		func(action ktesting.Action) (bool, runtime.Object, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if !deleted {
+				return false, nil, nil
+			}
+
+			getsAfterDelete++
+			if getsAfterDelete == 1 {
+				return true, test.executor.newKubeJob(test.job), nil
+			}
+
+			return true, nil, kerrors.NewNotFound(
+				batchv1.Resource("jobs"), KubeJobName(test.job.ID))
+		})
+
+	test.execute(t, completed)
+
+	if getsAfterDelete != 2 {
+		t.Errorf("expected Execute to check the Kubernetes Job was "+
+			"deleted until it was not found, checked %d times",
+			getsAfterDelete)
+	}
+
+	if !test.job.State.Paused() {
+		t.Errorf("expected job to stay paused, state: %#v",
+			test.job.State)
+	}
+}
+
+// testJobID is the ID of the first job created by newKubeExecutorTest
+var testJobID models.JobID = models.JobID{
+	RepositoryID: models.RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	},
+	ID: 0,
+}
+
+// existingKubeJob returns a worker Kubernetes Job which already exists for
+// testJobID
+func existingKubeJob(conditions ...batchv1.JobCondition) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      KubeJobName(testJobID),
+			Namespace: testKubeNamespace,
+		},
+		Status: batchv1.JobStatus{
+			Conditions: conditions,
+		},
+	}
+}
+
+func TestKubeExecutorExecuteReplacesFinishedJob(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	// Finished before the job paused
+	test := newKubeExecutorTest(t, etcdKV, markDone,
+		existingKubeJob(completed))
+
+	test.execute(t, completed)
+
+	if deletes := test.countActions("delete"); deletes != 1 {
+		t.Errorf("expected the finished Kubernetes Job to be deleted, "+
+			"deleted %d times", deletes)
+	}
+
+	if creates := test.countActions("create"); creates != 2 {
+		t.Errorf("expected the Kubernetes Job to be created again "+
+			"after it was deleted, created %d times", creates)
+	}
+
+	kubeJob, err := test.kubeClient.BatchV1().Jobs(testKubeNamespace).Get(
+		context.Background(), KubeJobName(testJobID),
+		metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error retrieving worker Kubernetes Job: %s",
+			err.Error())
+	}
+
+	if len(kubeJob.Status.Conditions) > 0 {
+		t.Errorf("expected finished Kubernetes Job to be replaced, "+
+			"status: %#v", kubeJob.Status)
+	}
+}
+
+func TestKubeExecutorExecuteWatchesRunningJob(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	// Created by a runner which stopped
+	test := newKubeExecutorTest(t, etcdKV, markDone, existingKubeJob())
+
+	test.execute(t, completed)
+
+	if deletes := test.countActions("delete"); deletes != 0 {
+		t.Errorf("expected the running Kubernetes Job to be watched, "+
+			"it was deleted %d times", deletes)
+	}
+}
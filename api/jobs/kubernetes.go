@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// KubernetesAction server side applies a directory of Kubernetes manifests.
+// Resources deployed by a previous job for the same unit which are no longer
+// in the directory are deleted. The applied manifest is saved so it can be
+// rolled back to, with the values of Secrets encrypted.
+type KubernetesAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// cluster holds the Kubernetes API clients
+	cluster *libkube.Cluster
+
+	// secretsBox encrypts the values of Secrets in the applied manifest
+	secretsBox libsecret.Box
+}
+
+// NewKubernetesAction creates a new KubernetesAction
+func NewKubernetesAction(ctx context.Context, logger golog.Logger,
+	etcdKV etcd.KeysAPI, cluster *libkube.Cluster,
+	secretsBox libsecret.Box) KubernetesAction {
+
+	return KubernetesAction{
+		ctx:        ctx,
+		logger:     logger,
+		etcdKV:     etcdKV,
+		cluster:    cluster,
+		secretsBox: secretsBox,
+	}
+}
+
+// UnitLabels returns the labels which identify the resources deployed by a
+// unit to an environment
+func UnitLabels(repoID models.RepositoryID, unitID,
+	envID string) map[string]string {
+
+	return map[string]string{
+		libkube.LabelRepository: libkube.LabelValue(fmt.Sprintf("%s.%s",
+			repoID.Owner, repoID.Name)),
+		libkube.LabelUnit:        libkube.LabelValue(unitID),
+		libkube.LabelEnvironment: libkube.LabelValue(envID),
+	}
+}
+
+// Run implements DeployAction.Run
+func (a KubernetesAction) Run(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig, state *models.ActionState) error {
+
+	state.Stage = models.Running
+
+	namespace := env.NamespaceFor(unit.Kubernetes.Namespace)
+
+	// Read manifests
+	state.AddOutput(fmt.Sprintf("Reading manifests in %s",
+		unit.Kubernetes.Directory))
+
+	objs, err := libkube.ReadManifestDir(filepath.Join(job.WorkingDir,
+		unit.Kubernetes.Directory))
+	if err != nil {
+		return fmt.Errorf("Error reading manifests: %s", err.Error())
+	}
+
+	err = applyResources(a.ctx, a.cluster, job, unit, env, namespace, nil,
+		objs, state)
+	if err != nil {
+		return err
+	}
+
+	// Record the manifest which was deployed so it can be rolled back to
+	err = saveRenderedManifest(a.ctx, a.etcdKV, a.secretsBox, job, unit,
+		env, objs, state)
+	if err != nil {
+		return err
+	}
+
+	state.Stage = models.Done
+
+	return nil
+}
+
+// applyResources substitutes images built by the unit's Docker action into
+// objs, then applies them and prunes resources the unit previously deployed
+// which are not in objs. Shared by the Kubernetes and kustomize actions.
+func applyResources(ctx context.Context, cluster *libkube.Cluster,
+	job *models.Job, unit models.UnitConfig, env models.EnvironmentConfig,
+	namespace string, images []string, objs []*unstructured.Unstructured,
+	state *models.ActionState) error {
+
+	// Substitute images built by the unit's Docker action
+	if unit.Docker != nil {
+		for _, obj := range objs {
+			for _, change := range libkube.SubstituteImage(obj,
+				unitImage(job, unit), images...) {
+
+				state.AddOutput(fmt.Sprintf("Set %s %s image %s",
+					obj.GetKind(), obj.GetName(), change))
+			}
+		}
+	}
+
+	// Apply
+	state.AddOutput(fmt.Sprintf("Applying %d resource(s) in namespace %s",
+		len(objs), namespace))
+
+	result, err := libkube.NewApplier(cluster).Apply(ctx, namespace,
+		UnitLabels(job.ID.RepositoryID, unit.ID, env.ID), objs)
+
+	for _, applied := range result.Applied {
+		state.AddOutput(fmt.Sprintf("Applied %s", applied))
+	}
+
+	for _, pruned := range result.Pruned {
+		state.AddOutput(fmt.Sprintf("Pruned %s", pruned))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error applying resources: %w", err)
+	}
+
+	return nil
+}
+
+// secretValueFields are the fields of a Secret which hold its values
+var secretValueFields []string = []string{"data", "stringData"}
+
+// isSecret indicates if an object is a Secret
+func isSecret(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+
+	return gvk.Group == "" && gvk.Kind == "Secret"
+}
+
+// redactSecret returns a copy of a Secret with its values replaced by
+// models.SecretRedacted. Also returns the original values, JSON encoded.
+func redactSecret(obj *unstructured.Unstructured) (*unstructured.Unstructured,
+	string, error) {
+
+	redacted := obj.DeepCopy()
+	values := map[string]interface{}{}
+
+	for _, field := range secretValueFields {
+		fieldValues, ok := obj.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		values[field] = fieldValues
+
+		redactedValues := map[string]interface{}{}
+		for key := range fieldValues {
+			redactedValues[key] = models.SecretRedacted
+		}
+
+		redacted.Object[field] = redactedValues
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding values as JSON: %s",
+			err.Error())
+	}
+
+	return redacted, string(b), nil
+}
+
+// saveRenderedManifest stores the objects a unit applied, including image
+// substitutions and labels, as a RenderedManifest. The values of Secrets are
+// redacted, and encrypted with secretsBox if it has a key. Records the
+// manifest's digest in the unit's environment state.
+func saveRenderedManifest(ctx context.Context, etcdKV etcd.KeysAPI,
+	secretsBox libsecret.Box, job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig, objs []*unstructured.Unstructured,
+	state *models.ActionState) error {
+
+	state.AddOutput("Saving rendered manifest")
+
+	manifest := models.RenderedManifest{
+		JobID:       job.ID,
+		Environment: env.ID,
+		UnitID:      unit.ID,
+	}
+
+	unsealed := []string{}
+
+	for _, obj := range objs {
+		if isSecret(obj) {
+			redacted, values, err := redactSecret(obj)
+			if err != nil {
+				return fmt.Errorf("Error redacting Secret %s: %s",
+					obj.GetName(), err.Error())
+			}
+
+			ref := models.SecretRef(obj.GetNamespace(), obj.GetName())
+
+			if secretsBox.HasKey() {
+				err = manifest.SealSecret(secretsBox, ref, values)
+				if err != nil {
+					return fmt.Errorf("Error saving Secret "+
+						"values: %s", err.Error())
+				}
+			} else {
+				unsealed = append(unsealed, ref)
+			}
+
+			obj = redacted
+		}
+
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return fmt.Errorf("Error encoding %s %s as YAML: %s",
+				obj.GetKind(), obj.GetName(), err.Error())
+		}
+
+		manifest.Manifest += "---\n" + string(b)
+	}
+
+	if len(unsealed) > 0 {
+		state.AddOutput(fmt.Sprintf("SECRETS_KEY is not configured, "+
+			"values of Secret(s) %s are not saved and will not be "+
+			"restored by rollbacks", strings.Join(unsealed, ", ")))
+	}
+
+	err := manifest.Set(ctx, etcdKV)
+	if err != nil {
+		return fmt.Errorf("Error saving rendered manifest: %s", err.Error())
+	}
+
+	environmentState(job, unit, env).ManifestDigest = manifest.Digest()
+
+	return nil
+}
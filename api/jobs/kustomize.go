@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// KustomizeAction renders a kustomization and applies the result. The
+// rendered manifest is saved so deploys can be compared. Resources deployed
+// by a previous job for the same unit which are no longer rendered are
+// deleted.
+type KustomizeAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// cluster holds the Kubernetes API clients
+	cluster *libkube.Cluster
+
+	// secretsBox encrypts the values of Secrets in the rendered manifest
+	secretsBox libsecret.Box
+}
+
+// NewKustomizeAction creates a new KustomizeAction
+func NewKustomizeAction(ctx context.Context, logger golog.Logger,
+	etcdKV etcd.KeysAPI, cluster *libkube.Cluster,
+	secretsBox libsecret.Box) KustomizeAction {
+
+	return KustomizeAction{
+		ctx:        ctx,
+		logger:     logger,
+		etcdKV:     etcdKV,
+		cluster:    cluster,
+		secretsBox: secretsBox,
+	}
+}
+
+// Run implements DeployAction.Run
+func (a KustomizeAction) Run(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig, state *models.ActionState) error {
+
+	state.Stage = models.Running
+
+	namespace := env.NamespaceFor(unit.Kustomize.Namespace)
+
+	// Render
+	state.AddOutput(fmt.Sprintf("Rendering kustomization in %s",
+		unit.Kustomize.Directory))
+
+	rendered, err := libkube.RenderKustomization(filepath.Join(
+		job.WorkingDir, unit.Kustomize.Directory))
+	if err != nil {
+		return fmt.Errorf("Error rendering kustomization: %s", err.Error())
+	}
+
+	objs, err := libkube.DecodeManifests(bytes.NewReader(rendered))
+	if err != nil {
+		return fmt.Errorf("Error decoding rendered kustomization: %s",
+			err.Error())
+	}
+
+	// Apply
+	err = applyResources(a.ctx, a.cluster, job, unit, env, namespace,
+		unit.Kustomize.Images, objs, state)
+	if err != nil {
+		return err
+	}
+
+	// Record the manifest which was deployed
+	err = saveRenderedManifest(a.ctx, a.etcdKV, a.secretsBox, job, unit,
+		env, objs, state)
+	if err != nil {
+		return err
+	}
+
+	state.Stage = models.Done
+
+	return nil
+}
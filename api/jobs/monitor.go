@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// MonitorInterval is how often the JobMonitor checks jobs
+const MonitorInterval time.Duration = 15 * time.Second
+
+// errPositionCurrent indicates a job does not need its queue position saved
+var errPositionCurrent error = errors.New("queue position is current")
+
+// JobMonitor watches the jobs of all runners. It saves the queue position of
+// queued jobs, and recovers jobs whose runner stopped before the job
+// finished. Only the leader runner should run the JobMonitor.
+type JobMonitor struct {
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// logStore holds job action output
+	logStore models.LogStore
+
+	// executor runs jobs, used to decide how orphaned jobs are recovered
+	executor Executor
+
+	// jobRunner is used to retry orphaned jobs
+	jobRunner *JobRunner
+
+	// orphans holds the jobs which were neither queued nor claimed in the
+	// last check. Jobs are only recovered if they are orphaned in two
+	// checks in a row, since jobs are not queued for a moment after they
+	// are created.
+	orphans map[models.JobID]bool
+}
+
+// NewJobMonitor creates a new JobMonitor
+func NewJobMonitor(logger golog.Logger, etcdKV etcd.KeysAPI,
+	logStore models.LogStore, executor Executor,
+	jobRunner *JobRunner) *JobMonitor {
+
+	return &JobMonitor{
+		logger:    logger,
+		etcdKV:    etcdKV,
+		logStore:  logStore,
+		executor:  executor,
+		jobRunner: jobRunner,
+		orphans:   map[models.JobID]bool{},
+	}
+}
+
+// Run checks jobs every MonitorInterval until the context is canceled
+func (m *JobMonitor) Run(ctx context.Context) {
+	m.orphans = map[models.JobID]bool{}
+
+	ticker := time.NewTicker(MonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check saves queue positions and recovers orphaned jobs
+func (m *JobMonitor) check(ctx context.Context) {
+	// Get runner state
+	entries, err := getQueueEntries(ctx, m.etcdKV)
+	if err != nil {
+		m.logger.Errorf("error retrieving job queue: %s", err.Error())
+		return
+	}
+
+	positions := map[models.JobID]int{}
+
+	for _, entry := range entries {
+		if _, ok := positions[entry.jobID]; !ok {
+			positions[entry.jobID] = len(positions) + 1
+		}
+	}
+
+	claims, err := getClaims(ctx, m.etcdKV)
+	if err != nil {
+		m.logger.Errorf("error retrieving job claims: %s", err.Error())
+		return
+	}
+
+	// Check jobs
+	repos, err := models.GetAllRepositories(ctx, m.etcdKV)
+	if err != nil {
+		m.logger.Errorf("error retrieving repositories: %s", err.Error())
+		return
+	}
+
+	orphans := map[models.JobID]bool{}
+
+	for _, repo := range repos {
+		repoJobs, err := models.GetAllJobs(ctx, m.etcdKV, repo.ID)
+		if err != nil {
+			m.logger.Errorf("error retrieving jobs, repository: %#v, "+
+				"error: %s", repo.ID, err.Error())
+			continue
+		}
+
+		for i := range repoJobs {
+			job := repoJobs[i]
+
+			if job.State.Done() || claims[job.ID] {
+				continue
+			}
+
+			if position, ok := positions[job.ID]; ok {
+				m.savePosition(ctx, &job, position)
+				continue
+			}
+
+			if job.State.Paused() {
+				continue
+			}
+
+			if !m.orphans[job.ID] {
+				orphans[job.ID] = true
+				continue
+			}
+
+			m.recover(ctx, &job)
+		}
+	}
+
+	m.orphans = orphans
+}
+
+// savePosition saves a queued job's position in the queue if it changed. The
+// job is only saved if it was not modified since it was retrieved, so a runner
+// which started the job in the meantime is not overwritten.
+func (m *JobMonitor) savePosition(ctx context.Context, job *models.Job,
+	position int) {
+
+	if job.State.QueuePosition == position {
+		return
+	}
+
+	err := job.Update(ctx, m.etcdKV, func() error {
+		if job.State.QueuePosition == position || job.State.Done() {
+			return errPositionCurrent
+		}
+
+		job.State.QueuePosition = position
+
+		return nil
+	})
+	if err == errPositionCurrent {
+		return
+	} else if err != nil {
+		m.logger.Errorf("error saving job queue position, Job.ID: %#v, "+
+			"error: %s", job.ID, err.Error())
+	}
+}
+
+// recover handles a job whose runner stopped before the job finished. If the
+// executor runs jobs outside of the runner the job may still be running, so
+// it is queued to be watched by another runner. Otherwise the job stopped
+// with its runner and is marked as interrupted.
+func (m *JobMonitor) recover(ctx context.Context, job *models.Job) {
+	if m.executor.Detached() {
+		m.logger.Infof("runner of job stopped, retrying job %#v", job.ID)
+
+		m.jobRunner.Submit(job)
+		return
+	}
+
+	m.logger.Infof("runner of job stopped, interrupting job %#v", job.ID)
+
+	job.State.Interrupt("the runner running the job stopped")
+
+	err := job.Save(ctx, m.etcdKV, m.logStore)
+	if err != nil {
+		m.logger.Errorf("error saving interrupted job, Job.ID: %#v, "+
+			"error: %s", job.ID, err.Error())
+	}
+}
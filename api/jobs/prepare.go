@@ -2,20 +2,17 @@ package jobs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
 	"github.com/Noah-Huppert/kube-git-deploy/api/models"
 
-	"github.com/BurntSushi/toml/cmd/tomlv"
 	"github.com/Noah-Huppert/golog"
-	"github.com/google/go-github/github"
-	"github.com/mholt/archiver"
 	etcd "go.etcd.io/etcd/client"
 )
 
@@ -25,7 +22,8 @@ func GetJobWorkingDir(job models.Job) string {
 		job.ID.RepositoryID.Owner, job.ID.RepositoryID.Name, job.ID.ID)
 }
 
-// PrepareAction downloads a GitHub repository and parses the configuration
+// PrepareAction downloads a GitHub repository with the repository's fetch
+// strategy and parses the configuration
 type PrepareAction struct {
 	// ctx is context
 	ctx context.Context
@@ -35,15 +33,21 @@ type PrepareAction struct {
 
 	// etcdKV is an Etcd key value API client
 	etcdKV etcd.KeysAPI
+
+	// fetchers download repositories. Keys are the strategy each fetcher
+	// implements.
+	fetchers map[models.FetchStrategy]Fetcher
 }
 
 // NewPrepareAction creates a new PrepareAction
 func NewPrepareAction(ctx context.Context, logger golog.Logger,
-	etcdKV etcd.KeysAPI) *PrepareAction {
+	etcdKV etcd.KeysAPI,
+	fetchers map[models.FetchStrategy]Fetcher) *PrepareAction {
 	return &PrepareAction{
-		ctx:    ctx,
-		logger: logger,
-		etcdKV: etcdKV,
+		ctx:      ctx,
+		logger:   logger,
+		etcdKV:   etcdKV,
+		fetchers: fetchers,
 	}
 }
 
@@ -53,132 +57,175 @@ func (a *PrepareAction) Run(job *models.Job, state *models.ActionState) error {
 	state.Stage = models.Running
 
 	// { Download repository
+	// Create job working directory
+	state.AddOutput("Setting up working directory")
 
-	// Get GitHub repository download URL
-	state.AddOutput("Initializing GitHub API")
+	wrkDir := GetJobWorkingDir(*job)
 
-	// ... Initialize GH client
-	ghClient, err := libgh.NewClient(a.ctx, a.etcdKV)
-	if err == libgh.ErrNoAuth {
-		return errors.New("Not authenticated with GitHub")
-	} else if err != nil {
-		return fmt.Errorf("Error initializing GitHub API: %s",
+	// Remove files left by a previous attempt
+	err := os.RemoveAll(wrkDir)
+	if err != nil {
+		return fmt.Errorf("Error removing old working directory: %s",
 			err.Error())
 	}
 
-	// ... Call API
-	state.AddOutput("Retrieving repository download URL")
-
-	dlURL, _, err := ghClient.Repositories.GetArchiveLink(a.ctx,
-		job.ID.RepositoryID.Owner, job.ID.RepositoryID.Name, "tarball",
-		&github.RepositoryContentGetOptions{
-			Ref: job.Target.Commit,
-		})
+	err = os.MkdirAll(wrkDir, 0777)
 	if err != nil {
-		return fmt.Errorf("Error retrieving repository download "+
-			"URL: %s", err.Error())
+		return fmt.Errorf("Error creating working directory: %s", err.Error())
 	}
 
-	// Create job working directory
-	state.AddOutput("Setting up working directory")
-
-	wrkDir := GetJobWorkingDir(*job)
+	// Get repository fetch strategy
+	repo := models.Repository{
+		ID: job.ID.RepositoryID,
+	}
 
-	err = os.MkdirAll(wrkDir, 0777)
+	err = repo.Get(a.ctx, a.etcdKV)
 	if err != nil {
-		return fmt.Errorf("Error creating working directory: %s",
-			err.Error())
+		return fmt.Errorf("Error retrieving repository: %s", err.Error())
 	}
 
-	// Download GitHub repository contents
-	state.AddOutput("Downloading GitHub repository")
-
-	// ... Create file
-	dlPath := fmt.Sprintf("%s/download.tar.gz", wrkDir)
-	dlFile, err := os.Create(dlPath)
-	if err != nil {
-		return fmt.Errorf("Error creating repository download "+
-			"file: %s", err.Error())
+	fetcher, ok := a.fetchers[repo.GetFetchStrategy()]
+	if !ok {
+		return fmt.Errorf("Unknown fetch strategy: %s",
+			repo.GetFetchStrategy())
 	}
 
-	// ... Download file
-	resp, err := http.Get(dlURL.String())
+	state.AddOutput(fmt.Sprintf("Fetching repository with %s strategy",
+		repo.GetFetchStrategy()))
+
+	job.WorkingDir, err = fetcher.Fetch(a.ctx, job, state, wrkDir)
 	if err != nil {
-		return fmt.Errorf("Error making repository download "+
-			"request: %s", err.Error())
+		return err
 	}
 
-	// ... Copy request body to file
-	_, err = io.Copy(dlFile, resp.Body)
-	if err != nil {
-		return fmt.Errorf("Error copying repository download request "+
-			"body to file: %s", err.Error())
+	// }
+
+	// { Parse configuration file
+	// Rollback, promotion, and resumed jobs re-use their stored
+	// configuration
+	if job.Config == nil {
+		err = a.parseConfig(job, repo, state)
+		if err != nil {
+			return err
+		}
+	} else {
+		state.AddOutput("Using stored configuration")
 	}
 
-	// ... Close HTTP request body
-	err = resp.Body.Close()
+	jobConfig := *job.Config
+
+	// Find environments to deploy to
+	envs, err := job.DeployEnvironments()
 	if err != nil {
-		return fmt.Errorf("Error closing repository download "+
-			"request body: %s", err.Error())
+		return fmt.Errorf("Error finding environments to deploy to: %s",
+			err.Error())
 	}
 
-	// ... Close file
-	err = dlFile.Close()
-	if err != nil {
-		return fmt.Errorf("Error closing repository download "+
-			"file: %s", err.Error())
+	envIDs := []string{}
+	for _, env := range envs {
+		envIDs = append(envIDs, env.ID)
 	}
 
-	// Extract download
-	state.AddOutput("Extracting repository download file")
+	state.AddOutput(fmt.Sprintf("Deploying to %d environment(s): %s",
+		len(envs), strings.Join(envIDs, ", ")))
 
-	// ... Unarchive tar file
-	err = archiver.DefaultTarGz.Unarchive(dlPath, wrkDir)
-	if err != nil {
-		return fmt.Errorf("Error unarchiving repository download tar "+
-			"file: %s", err.Error())
+	// Initialize unit states. Jobs resumed after an approval keep the
+	// states of the actions which already ran.
+	if len(job.State.Units) == 0 {
+		job.State.Units = map[string]models.UnitState{}
+
+		for _, id := range jobConfig.UnitIDs() {
+			job.State.Units[id] = models.NewUnitState(
+				jobConfig.Units[id], envs)
+		}
 	}
 
-	// Remove repository download file
-	state.AddOutput("Removing repository download file")
+	state.AddOutput(fmt.Sprintf("Found %d unit(s)", len(jobConfig.Units)))
 
-	err = os.Remove(dlPath)
-	if err != nil {
-		return fmt.Errorf("Error removing repository download "+
-			"file: %s", err.Error())
+	// }
+
+	// Done
+	state.Stage = models.Done
+
+	return nil
+}
+
+// parseConfig reads the repository's configuration files in the job's
+// working directory and saves the configuration in the job
+func (a *PrepareAction) parseConfig(job *models.Job, repo models.Repository,
+	state *models.ActionState) error {
+
+	// Find configuration files
+	cfgPaths, err := repo.JobConfigFiles(job.WorkingDir)
+	if err == models.ErrNoJobConfigFile {
+		return fmt.Errorf("Repository does not contain a configuration "+
+			"file, one of: %s", strings.Join(models.JobConfigFileNames,
+			", "))
+	} else if err != nil {
+		return fmt.Errorf("Error finding configuration files: %s", err.Error())
 	}
 
-	// Find extracted repository directory
-	state.AddOutput("Finding working directory")
+	vars := models.NewTemplateVars(*job, time.Now())
 
-	fileInfos, err := ioutil.ReadDir(wrkDir)
-	if err != nil {
-		return fmt.Errorf("Error retrieving information about "+
-			"files in working directory: %s", err.Error())
+	// Parse each file
+	cfgs := map[string]models.JobConfig{}
+
+	for _, cfgPath := range cfgPaths {
+		cfg, err := a.parseConfigFile(job, cfgPath, vars, state)
+		if err != nil {
+			return err
+		}
+
+		cfgs[path.Dir(cfgPath)] = cfg
 	}
 
-	if len(fileInfos) != 1 {
-		return fmt.Errorf("Working directory contained an unexpected "+
-			"number of directories, count: %d", len(fileInfos))
+	if repo.GetConfigDiscovery() != models.DiscoverSubdirectories {
+		jobConfig := cfgs[path.Dir(cfgPaths[0])]
+		job.Config = &jobConfig
+
+		return nil
 	}
 
-	if !fileInfos[0].IsDir() {
-		return errors.New("Working directory does not contain the " +
-			"expected sub-directory")
+	// Merge files from subdirectories
+	state.AddOutput(fmt.Sprintf("Merging %d configuration files",
+		len(cfgPaths)))
+
+	jobConfig, err := models.MergeJobConfigs(cfgs)
+	if err != nil {
+		return fmt.Errorf("Error merging configuration files: %s", err.Error())
 	}
 
-	job.WorkingDir = fmt.Sprintf("%s/%s", wrkDir, fileInfos[0].Name())
+	job.Config = &jobConfig
 
-	// }
+	return nil
+}
+
+// parseConfigFile reads and parses one configuration file. cfgPath is
+// relative to the job's working directory. Paths in the file are resolved
+// relative to the repository root.
+func (a *PrepareAction) parseConfigFile(job *models.Job, cfgPath string,
+	vars models.TemplateVars,
+	state *models.ActionState) (models.JobConfig, error) {
 
-	// { Parse configuration file
 	// Read configuration file
-	jobConfig := models.NewJobConfig()
+	state.AddOutput(fmt.Sprintf("Reading %s", cfgPath))
 
-	// }
+	cfgBytes, err := ioutil.ReadFile(filepath.Join(job.WorkingDir,
+		filepath.FromSlash(cfgPath)))
+	if err != nil {
+		return models.JobConfig{}, fmt.Errorf("Error reading %s: %s",
+			cfgPath, err.Error())
+	}
 
-	// Done
-	state.Stage = models.Done
+	// Parse
+	state.AddOutput(fmt.Sprintf("Parsing %s", cfgPath))
 
-	return nil
+	jobConfig, err := models.ParseJobConfigFile(cfgPath, string(cfgBytes),
+		vars)
+	if err != nil {
+		return jobConfig, fmt.Errorf("Error parsing %s: %s",
+			cfgPath, err.Error())
+	}
+
+	return jobConfig, nil
 }
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// RegistryAuth finds the credentials of the registries images are pushed to
+type RegistryAuth struct {
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// box decrypts registry credentials
+	box libsecret.Box
+}
+
+// NewRegistryAuth creates a new RegistryAuth
+func NewRegistryAuth(etcdKV etcd.KeysAPI, box libsecret.Box) RegistryAuth {
+	return RegistryAuth{
+		etcdKV: etcdKV,
+		box:    box,
+	}
+}
+
+// DockerConfig returns a Docker config.json file which authenticates with
+// the registry of an image tag. Returns nil if the registry is not
+// configured, the Docker daemon's own credentials are used for it. Returns
+// an error if the job's repository may not use the registry. The credential
+// is added to the job so it is redacted from output.
+func (a RegistryAuth) DockerConfig(ctx context.Context, job *models.Job,
+	tag string) ([]byte, *models.Registry, error) {
+
+	registry := models.Registry{
+		Host: models.ImageRegistryHost(tag),
+	}
+
+	err := registry.Get(ctx, a.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Error retrieving registry %s: %s",
+			registry.Host, err.Error())
+	}
+
+	if !registry.Allows(job.ID.RepositoryID) {
+		return nil, nil, fmt.Errorf("Repository is not allowed to use "+
+			"registry %s", registry.Host)
+	}
+
+	credential, err := registry.Credential(ctx, a.etcdKV, a.box)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error retrieving registry %s "+
+			"credential: %s", registry.Host, err.Error())
+	}
+
+	job.AddSecret(credential)
+
+	dockerConfig, err := registry.DockerConfig(credential)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating Docker config for "+
+			"registry %s: %s", registry.Host, err.Error())
+	}
+
+	return dockerConfig, &registry, nil
+}
+
+// writeDockerConfigDir writes a Docker config.json file to a new temporary
+// directory, which should be used as the DOCKER_CONFIG environment variable.
+// The caller must remove the directory.
+func writeDockerConfigDir(dockerConfig []byte) (string, error) {
+	dir, err := ioutil.TempDir("", "kube-git-deploy-docker-")
+	if err != nil {
+		return "", fmt.Errorf("Error creating Docker config directory: %s",
+			err.Error())
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.json"), dockerConfig,
+		0600)
+	if err != nil {
+		os.RemoveAll(dir)
+
+		return "", fmt.Errorf("Error writing Docker config: %s", err.Error())
+	}
+
+	return dir, nil
+}
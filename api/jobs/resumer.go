@@ -0,0 +1,190 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// ResumeInterval is how often paused jobs are checked to see if they can be
+// resumed
+const ResumeInterval time.Duration = time.Minute
+
+// JobResumer resumes paused jobs whose pending approvals have expired, so the
+// worker can fail them, and jobs held by freeze windows which have ended.
+// Expired approvals are recorded by the JobResumer, so a decision made at the
+// same time is not overwritten.
+// Only the leader runner should run the JobResumer.
+type JobResumer struct {
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to resume jobs
+	jobRunner *JobRunner
+}
+
+// NewJobResumer creates a new JobResumer
+func NewJobResumer(logger golog.Logger, etcdKV etcd.KeysAPI,
+	jobRunner *JobRunner) JobResumer {
+
+	return JobResumer{
+		logger:    logger,
+		etcdKV:    etcdKV,
+		jobRunner: jobRunner,
+	}
+}
+
+// Run checks for jobs to resume every ResumeInterval until the context is
+// canceled
+func (e JobResumer) Run(ctx context.Context) {
+	ticker := time.NewTicker(ResumeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.resume(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resume resubmits every paused job which can make progress
+func (e JobResumer) resume(ctx context.Context) {
+	repos, err := models.GetAllRepositories(ctx, e.etcdKV)
+	if err != nil {
+		e.logger.Errorf("error retrieving repositories: %s", err.Error())
+		return
+	}
+
+	windows, err := models.GetAllFreezeWindows(ctx, e.etcdKV)
+	if err != nil {
+		e.logger.Errorf("error retrieving freeze windows: %s",
+			err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	for _, repo := range repos {
+		repoJobs, err := models.GetAllJobs(ctx, e.etcdKV, repo.ID)
+		if err != nil {
+			e.logger.Errorf("error retrieving jobs, repository: %#v, "+
+				"error: %s", repo.ID, err.Error())
+			continue
+		}
+
+		for i := range repoJobs {
+			job := repoJobs[i]
+
+			if !job.State.Paused() {
+				continue
+			}
+
+			if hasExpiredApproval(job, now) {
+				expired, err := e.expireApprovals(ctx, &job, now)
+				if err != nil {
+					e.logger.Errorf("error recording expired "+
+						"approvals, Job.ID: %#v, error: %s",
+						job.ID, err.Error())
+					continue
+				}
+
+				if !expired {
+					continue
+				}
+
+				e.logger.Infof("approval expired, resuming job %#v",
+					job.ID)
+			} else if hasEndedFreeze(job, windows, now) {
+				e.logger.Infof("freeze ended, resuming job %#v",
+					job.ID)
+			} else {
+				continue
+			}
+
+			e.jobRunner.Submit(&job)
+		}
+	}
+}
+
+// expireApprovals marks a paused job's expired pending approvals as expired.
+// The job is only saved if it was not modified since it was retrieved, so
+// decisions are never overwritten. Returns false if the job no longer has
+// expired approvals, ex: a decision was made first.
+func (e JobResumer) expireApprovals(ctx context.Context, job *models.Job,
+	now time.Time) (bool, error) {
+
+	expired := false
+
+	err := job.Update(ctx, e.etcdKV, func() error {
+		expired = false
+
+		// The worker saves the job one last time while it pauses
+		if !job.State.Paused() || !job.State.CleanupState.Done() {
+			return nil
+		}
+
+		for _, unit := range job.State.Units {
+			for _, envState := range unit.Environments {
+				if envState.Approval != nil &&
+					envState.Approval.Expired(now) {
+
+					envState.Approval.Decision =
+						models.ApprovalExpired
+					expired = true
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return expired, err
+}
+
+// hasExpiredApproval indicates if any of a job's pending approvals have
+// expired
+func hasExpiredApproval(job models.Job, now time.Time) bool {
+	for _, unit := range job.State.Units {
+		for _, envState := range unit.Environments {
+			if envState.Approval != nil &&
+				envState.Approval.Expired(now) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasEndedFreeze indicates if any of a job's frozen deploys are no longer
+// blocked by a freeze window
+func hasEndedFreeze(job models.Job, windows []models.FreezeWindow,
+	now time.Time) bool {
+
+	for _, unit := range job.State.Units {
+		for envID, envState := range unit.Environments {
+			if envState.FreezeState == nil ||
+				envState.FreezeState.Stage != models.Frozen {
+				continue
+			}
+
+			active := models.ActiveFreezeWindows(windows,
+				job.ID.RepositoryID, envID, now)
+			if len(active) == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/google/go-github/github"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// httpStatusError is returned when a server responds with an unsuccessful
+// HTTP status
+type httpStatusError struct {
+	// StatusCode is the HTTP status code
+	StatusCode int
+
+	// Status is the HTTP status text, ex: "404 Not Found"
+	Status string
+}
+
+// Error implements error.Error
+func (e httpStatusError) Error() string {
+	return e.Status
+}
+
+// serverErrorStatus indicates if an HTTP status code is returned when a
+// server fails or is overloaded
+func serverErrorStatus(code int) bool {
+	return code == http.StatusTooManyRequests ||
+		(code >= http.StatusInternalServerError &&
+			code <= http.StatusGatewayTimeout)
+}
+
+// errorClass returns the retry class of an error, from the types of the
+// errors it wraps. Empty if the class is not known.
+func errorClass(err error) models.ErrorClass {
+	// Programs which failed
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.ErrorClass()
+	}
+
+	// Servers which failed
+	var kubeErr kerrors.APIStatus
+	if errors.As(err, &kubeErr) &&
+		serverErrorStatus(int(kubeErr.Status().Code)) {
+
+		return models.ErrorServer
+	}
+
+	var githubErr *github.ErrorResponse
+	if errors.As(err, &githubErr) && githubErr.Response != nil &&
+		serverErrorStatus(githubErr.Response.StatusCode) {
+
+		return models.ErrorServer
+	}
+
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) &&
+		serverErrorStatus(statusErr.StatusCode) {
+
+		return models.ErrorServer
+	}
+
+	// Connections which failed
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+
+		return models.ErrorNetwork
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return models.ErrorNetwork
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return models.ErrorNetwork
+	}
+
+	return ""
+}
+
+// runWithRetry runs an attempt of an action until it succeeds, fails with an
+// error the retry policy does not retry, or runs out of attempts. Each
+// attempt is recorded in the action's state, save is called before waiting to
+// retry so the failed attempt can be observed. Returns the last attempt's
+// error.
+func runWithRetry(ctx context.Context, policy models.RetryConfig,
+	state *models.ActionState, save func(), run func() error) error {
+
+	maxAttempts := policy.GetMaxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		state.StartAttempt(attempt, maxAttempts)
+
+		err := run()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= maxAttempts || !policy.Retries(errorClass(err)) {
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+
+		state.FailAttempt(fmt.Sprintf("Attempt %d/%d failed: %s", attempt,
+			maxAttempts, err.Error()))
+		state.AddOutput(fmt.Sprintf("Retrying in %s", delay))
+		save()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
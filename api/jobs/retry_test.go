@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/google/go-github/github"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestErrorClass(t *testing.T) {
+	deployments := schema.GroupResource{
+		Group:    "apps",
+		Resource: "deployments",
+	}
+
+	tests := []struct {
+		name  string
+		err   error
+		class models.ErrorClass
+	}{
+		{
+			name: "command network failure",
+			err: &CommandError{
+				Name:     "docker",
+				Err:      errors.New("exit status 1"),
+				LastLine: "dial tcp: connection refused",
+			},
+			class: models.ErrorNetwork,
+		},
+		{
+			name: "command server failure",
+			err: fmt.Errorf("Error pushing image: %w",
+				&CommandError{
+					Name:     "docker",
+					Err:      errors.New("exit status 1"),
+					LastLine: "unexpected HTTP status: 503",
+				}),
+			class: models.ErrorServer,
+		},
+		{
+			name: "command failure",
+			err: &CommandError{
+				Name:     "helm",
+				Err:      errors.New("exit status 1"),
+				LastLine: "chart not found",
+			},
+			class: "",
+		},
+		{
+			name: "Kubernetes server failure",
+			err: fmt.Errorf("error applying: %w",
+				kerrors.NewServiceUnavailable("unavailable")),
+			class: models.ErrorServer,
+		},
+		{
+			name:  "Kubernetes not found",
+			err:   kerrors.NewNotFound(deployments, "api"),
+			class: "",
+		},
+		{
+			name: "GitHub server failure",
+			err: &github.ErrorResponse{
+				Response: &http.Response{
+					StatusCode: http.StatusBadGateway,
+				},
+			},
+			class: models.ErrorServer,
+		},
+		{
+			name: "download server failure",
+			err: httpStatusError{
+				StatusCode: http.StatusTooManyRequests,
+				Status:     "429 Too Many Requests",
+			},
+			class: models.ErrorServer,
+		},
+		{
+			name: "download not found",
+			err: httpStatusError{
+				StatusCode: http.StatusNotFound,
+				Status:     "404 Not Found",
+			},
+			class: "",
+		},
+		{
+			name:  "connection reset",
+			err:   fmt.Errorf("error: %w", syscall.ECONNRESET),
+			class: models.ErrorNetwork,
+		},
+		{
+			name:  "deadline exceeded",
+			err:   context.DeadlineExceeded,
+			class: models.ErrorNetwork,
+		},
+		{
+			name:  "error mentioning a network problem",
+			err:   errors.New("connection refused"),
+			class: "",
+		},
+	}
+
+	for _, test := range tests {
+		if class := errorClass(test.err); class != test.class {
+			t.Errorf("%s: expected class %q, got %q", test.name,
+				test.class, class)
+		}
+	}
+}
+
+func TestCommandErrorUnwraps(t *testing.T) {
+	err := runCommand(context.Background(), &models.ActionState{}, "",
+		"false")
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expected command error to wrap its exit error, "+
+			"got: %v", err)
+	}
+}
+
+func TestRunWithRetryRetriesClasses(t *testing.T) {
+	policy := models.RetryConfig{
+		MaxAttempts: 3,
+		Backoff:     "1ms",
+		RetryOn:     []models.ErrorClass{models.ErrorNetwork},
+	}
+
+	attempts := 0
+	err := runWithRetry(context.Background(), policy,
+		&models.ActionState{}, func() {}, func() error {
+			attempts++
+			return syscall.ECONNREFUSED
+		})
+
+	if err == nil || attempts != 3 {
+		t.Errorf("expected network errors to be retried 3 times, ran "+
+			"%d times, error: %v", attempts, err)
+	}
+
+	attempts = 0
+	err = runWithRetry(context.Background(), policy,
+		&models.ActionState{}, func() {}, func() error {
+			attempts++
+			return httpStatusError{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "503 Service Unavailable",
+			}
+		})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("expected server errors to not be retried, ran %d "+
+			"times, error: %v", attempts, err)
+	}
+}
+
+func TestRetryConfigRequiresAttempt(t *testing.T) {
+	for _, maxAttempts := range []int{0, -1} {
+		err := models.RetryConfig{
+			MaxAttempts: maxAttempts,
+		}.Validate()
+		if err == nil {
+			t.Errorf("expected max_attempts of %d to be invalid",
+				maxAttempts)
+		}
+	}
+
+	err := models.RetryConfig{
+		MaxAttempts: 1,
+	}.Validate()
+	if err != nil {
+		t.Errorf("expected max_attempts of 1 to be valid: %s",
+			err.Error())
+	}
+}
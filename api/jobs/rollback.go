@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RollbackAction restores a unit in an environment to the last job which
+// successfully deployed it there. Helm releases are rolled back to the
+// recorded revision. Kubernetes and kustomize resources are restored by
+// re-applying the recorded manifest.
+type RollbackAction struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// cluster holds the Kubernetes API clients for the environment's
+	// cluster
+	cluster *libkube.Cluster
+
+	// secretsBox decrypts the values of Secrets in recorded manifests
+	secretsBox libsecret.Box
+
+	// kubeConfig is the path of the kubeconfig file passed to Helm. If
+	// empty Helm's default is used.
+	kubeConfig string
+}
+
+// NewRollbackAction creates a new RollbackAction
+func NewRollbackAction(ctx context.Context, logger golog.Logger,
+	etcdKV etcd.KeysAPI, cluster *libkube.Cluster, secretsBox libsecret.Box,
+	kubeConfig string) RollbackAction {
+
+	return RollbackAction{
+		ctx:        ctx,
+		logger:     logger,
+		etcdKV:     etcdKV,
+		cluster:    cluster,
+		secretsBox: secretsBox,
+		kubeConfig: kubeConfig,
+	}
+}
+
+// Run implements DeployAction.Run
+func (a RollbackAction) Run(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig, state *models.ActionState) error {
+
+	state.Stage = models.Running
+
+	// Find last successful deploy of the same branch or tag
+	deploy := models.SuccessfulDeploy{
+		RepositoryID: job.ID.RepositoryID,
+		Environment:  env.ID,
+		Branch:       job.Target.Branch,
+		Tag:          job.Target.Tag,
+		UnitID:       unit.ID,
+	}
+
+	found, err := deploy.Get(a.ctx, a.etcdKV)
+	if err != nil {
+		return fmt.Errorf("Error retrieving last successful deploy: %s",
+			err.Error())
+	}
+
+	if !found {
+		return fmt.Errorf("No previous successful deploy of unit %s to "+
+			"environment %s to roll back to", unit.ID, env.ID)
+	}
+
+	state.AddOutput(fmt.Sprintf("Rolling back to job %d, commit %s",
+		deploy.JobID, deploy.Commit))
+
+	// Helm
+	if unit.Helm != nil && deploy.HelmRevision == 0 {
+		return fmt.Errorf("No recorded Helm revision to roll back to, "+
+			"job %d did not record one", deploy.JobID)
+	}
+
+	if unit.Helm != nil {
+		args := append([]string{"rollback", unit.HelmRelease(),
+			strconv.Itoa(deploy.HelmRevision), "--wait"},
+			helmKubeArgs(a.kubeConfig, env,
+				env.NamespaceFor(unit.Helm.Namespace))...)
+
+		err = runCommand(a.ctx, state, "", "helm", args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Kubernetes and kustomize
+	namespace := ""
+	if unit.Kubernetes != nil {
+		namespace = unit.Kubernetes.Namespace
+	} else if unit.Kustomize != nil {
+		namespace = unit.Kustomize.Namespace
+	}
+
+	if (unit.Kubernetes != nil || unit.Kustomize != nil) &&
+		len(deploy.ManifestDigest) > 0 {
+
+		err = a.reapplyManifest(job, unit, env, deploy,
+			env.NamespaceFor(namespace), state)
+		if err != nil {
+			return err
+		}
+	}
+
+	state.Stage = models.Done
+
+	return nil
+}
+
+// reapplyManifest applies the manifest deployed by a previous job
+func (a RollbackAction) reapplyManifest(job *models.Job,
+	unit models.UnitConfig, env models.EnvironmentConfig,
+	deploy models.SuccessfulDeploy, namespace string,
+	state *models.ActionState) error {
+
+	manifest := models.RenderedManifest{
+		JobID: models.JobID{
+			RepositoryID: job.ID.RepositoryID,
+			ID:           deploy.JobID,
+		},
+		Environment: env.ID,
+		UnitID:      unit.ID,
+	}
+
+	err := manifest.Get(a.ctx, a.etcdKV)
+	if err != nil {
+		return fmt.Errorf("Error retrieving manifest deployed by job "+
+			"%d: %s", deploy.JobID, err.Error())
+	}
+
+	objs, err := libkube.DecodeManifests(strings.NewReader(
+		manifest.Manifest))
+	if err != nil {
+		return fmt.Errorf("Error decoding manifest deployed by job %d: "+
+			"%s", deploy.JobID, err.Error())
+	}
+
+	for _, obj := range objs {
+		if !isSecret(obj) {
+			continue
+		}
+
+		err = a.restoreSecret(manifest, obj, state)
+		if err != nil {
+			return fmt.Errorf("Error restoring Secret %s: %s",
+				obj.GetName(), err.Error())
+		}
+	}
+
+	// The recorded manifest already has the previous job's images
+	unit.Docker = nil
+
+	return applyResources(a.ctx, a.cluster, job, unit, env, namespace, nil,
+		objs, state)
+}
+
+// restoreSecret replaces the redacted values of a Secret from a recorded
+// manifest. The values are decrypted from the manifest. If they were not
+// recorded, the Secret's current values in the cluster are kept.
+func (a RollbackAction) restoreSecret(manifest models.RenderedManifest,
+	obj *unstructured.Unstructured, state *models.ActionState) error {
+
+	ref := models.SecretRef(obj.GetNamespace(), obj.GetName())
+
+	fields := map[string]interface{}{}
+
+	values, ok, err := manifest.OpenSecret(a.secretsBox, ref)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		err = json.Unmarshal([]byte(values), &fields)
+		if err != nil {
+			return fmt.Errorf("error decoding values: %s", err.Error())
+		}
+	} else {
+		current, err := a.cluster.Client.CoreV1().Secrets(
+			obj.GetNamespace()).Get(a.ctx, obj.GetName(),
+			metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("values were not recorded, error "+
+				"retrieving current values: %s", err.Error())
+		}
+
+		data := map[string]interface{}{}
+		for key, value := range current.Data {
+			data[key] = base64.StdEncoding.EncodeToString(value)
+		}
+
+		fields["data"] = data
+
+		state.AddOutput(fmt.Sprintf("Values of Secret %s were not "+
+			"recorded, keeping its current values", ref))
+	}
+
+	for _, field := range secretValueFields {
+		delete(obj.Object, field)
+	}
+
+	for field, value := range fields {
+		obj.Object[field] = value
+	}
+
+	return nil
+}
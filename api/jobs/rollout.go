@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultRolloutTimeout is how long to wait for workloads to roll out if a
+// unit does not specify a timeout
+const DefaultRolloutTimeout time.Duration = 5 * time.Minute
+
+// RolloutPollInterval is how often workload rollout status is checked
+const RolloutPollInterval time.Duration = 3 * time.Second
+
+// workloads returns the Deployments, StatefulSets, and DaemonSets in objs.
+// Objects without a namespace are assumed to be in namespace.
+func workloads(objs []*unstructured.Unstructured,
+	namespace string) []libkube.Workload {
+
+	found := []libkube.Workload{}
+
+	for _, obj := range objs {
+		if !libkube.RolloutKinds[obj.GetKind()] {
+			continue
+		}
+
+		workload := libkube.Workload{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		}
+
+		if len(workload.Namespace) == 0 {
+			workload.Namespace = namespace
+		}
+
+		found = append(found, workload)
+	}
+
+	return found
+}
+
+// waitForRollout polls workloads until they have all rolled out, or until
+// timeout. Rollout progress and pod problems are added to state's output.
+// save is called after new output is added. Returns an error if a rollout
+// fails or does not finish in time.
+func waitForRollout(ctx context.Context, cluster *libkube.Cluster,
+	toWatch []libkube.Workload, timeout time.Duration,
+	state *models.ActionState, save func()) error {
+
+	state.AddOutput(fmt.Sprintf("Waiting up to %s for %d workload(s) to "+
+		"roll out", timeout, len(toWatch)))
+
+	deadline := time.Now().Add(timeout)
+
+	// seen holds output lines which have already been added, so each
+	// problem is only reported once
+	seen := map[string]bool{}
+	addOutput := func(line string) bool {
+		if seen[line] {
+			return false
+		}
+
+		seen[line] = true
+		state.AddOutput(line)
+
+		return true
+	}
+
+	pending := toWatch
+
+	for {
+		stillPending := []libkube.Workload{}
+		changed := false
+
+		for _, workload := range pending {
+			status, err := libkube.GetRolloutStatus(ctx, cluster,
+				workload)
+			if err != nil {
+				return err
+			}
+
+			changed = addOutput(fmt.Sprintf("%s: %s", workload,
+				status.Message)) || changed
+
+			if status.Failed {
+				return fmt.Errorf("Rollout of %s failed: %s",
+					workload, status.Message)
+			}
+
+			if status.Done {
+				continue
+			}
+
+			stillPending = append(stillPending, workload)
+
+			// Report why pods are not ready
+			problems, err := libkube.PodProblems(ctx, cluster,
+				workload.Namespace, status.Selector)
+			if err != nil {
+				return err
+			}
+
+			for _, problem := range problems {
+				changed = addOutput(problem) || changed
+			}
+		}
+
+		if changed {
+			save()
+		}
+
+		pending = stillPending
+		if len(pending) == 0 {
+			state.AddOutput("All workloads rolled out")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Rollout did not finish within %s, %d "+
+				"workload(s) not ready", timeout, len(pending))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(RolloutPollInterval):
+		}
+	}
+}
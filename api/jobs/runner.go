@@ -2,14 +2,42 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
 
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
 	"github.com/Noah-Huppert/kube-git-deploy/api/models"
 
 	"github.com/Noah-Huppert/golog"
 	etcd "go.etcd.io/etcd/client"
 )
 
-// JobRunner is responsible for running jobs.
+// KeyDirRunnerQueue is the Etcd directory which holds in order keys for jobs
+// waiting to be claimed by a runner. Each key holds a JSON encoded JobID.
+const KeyDirRunnerQueue string = "/runners/queue"
+
+// KeyDirRunnerClaims is the Etcd directory which holds the jobs runners have
+// claimed. Each key holds a JSON encoded runnerClaim.
+const KeyDirRunnerClaims string = "/runners/claims"
+
+// KeyRunnerLeader is the Etcd key which holds the ID of the runner elected to
+// perform singleton duties
+const KeyRunnerLeader string = "/runners/leader"
+
+// ClaimTTL is how long a runner's claim on a job lives unless it is
+// refreshed. Jobs claimed by runners which stop are detected by the
+// JobMonitor after this long.
+const ClaimTTL time.Duration = 30 * time.Second
+
+// RunnerPollInterval is how often a runner refreshes its claims and checks
+// the queue for jobs
+const RunnerPollInterval time.Duration = 5 * time.Second
+
+// JobRunner is responsible for running jobs. Jobs are queued in Etcd so any
+// API replica's runner can claim them. At most config.Config.WorkerPoolSize
+// jobs run at once in each runner.
 type JobRunner struct {
 	// ctx is context
 	ctx context.Context
@@ -17,53 +45,120 @@ type JobRunner struct {
 	// logger prints debug information
 	logger golog.Logger
 
-	// etcdKV is an etcd key value API client
+	// etcdKV is an Etcd key value API client
 	etcdKV etcd.KeysAPI
 
-	// jobs holds all the currently running jobs. Keys are JobIDs.
+	// executor runs jobs
+	executor Executor
+
+	// id uniquely identifies the runner amongst all API replicas
+	id string
+
+	// poolSize is the maximum number of jobs which run at once
+	poolSize int
+
+	// jobs holds all the jobs the runner is currently running. Keys are
+	// JobIDs.
 	jobs map[models.JobID]*models.Job
 
-	// jobsChan accepts Jobs to run
-	jobsChan chan *models.Job
+	// submitChan wakes the runner main loop when a job is submitted
+	submitChan chan struct{}
+
+	// doneChan receives the IDs of jobs which have finished executing
+	doneChan chan models.JobID
+}
+
+// runnerClaim records which runner is running a job
+type runnerClaim struct {
+	// RunnerID is the ID of the runner
+	RunnerID string `json:"runner_id"`
+
+	// JobID is the ID of the job
+	JobID models.JobID `json:"job_id"`
+}
+
+// queueEntry is a job waiting in the queue
+type queueEntry struct {
+	// key is the Etcd key of the entry
+	key string
+
+	// jobID is the ID of the job
+	jobID models.JobID
 }
 
 // NewJobRunner creates a new JobRunner
 func NewJobRunner(ctx context.Context, logger golog.Logger,
-	etcdKV etcd.KeysAPI) *JobRunner {
+	cfg *config.Config, etcdKV etcd.KeysAPI, executor Executor,
+	id string) *JobRunner {
+
+	poolSize := cfg.WorkerPoolSize
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
 	return &JobRunner{
-		ctx:      ctx,
-		logger:   logger,
-		etcdKV:   etcdKV,
-		jobs:     map[models.JobID]*models.Job{},
-		jobsChan: make(chan *models.Job),
+		ctx:        ctx,
+		logger:     logger,
+		etcdKV:     etcdKV,
+		executor:   executor,
+		id:         id,
+		poolSize:   poolSize,
+		jobs:       map[models.JobID]*models.Job{},
+		submitChan: make(chan struct{}, 1),
+		doneChan:   make(chan models.JobID),
 	}
 }
 
-// Submit sends a job to the runner main loop for future execution
+// Submit adds a job to the queue for future execution by any runner. Jobs
+// paused for approval are resumed by submitting them again. Jobs submitted
+// while they are running are run again once the current run finishes.
 func (r *JobRunner) Submit(job *models.Job) {
-	r.jobsChan <- job
+	value, err := json.Marshal(job.ID)
+	if err != nil {
+		r.logger.Errorf("error marshalling job ID, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+		return
+	}
+
+	_, err = r.etcdKV.CreateInOrder(r.ctx, KeyDirRunnerQueue, string(value),
+		nil)
+	if err != nil {
+		r.logger.Errorf("error queueing job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+		return
+	}
+
+	// Wake main loop, unless it is already being woken
+	select {
+	case r.submitChan <- struct{}{}:
+	default:
+	}
 }
 
 // Run starts the JobRunner main logic loop
 func (r *JobRunner) Run() error {
-	// Wait for job to be submitted
+	ticker := time.NewTicker(RunnerPollInterval)
+	defer ticker.Stop()
+
+	r.claimJobs()
+
 	for true {
 		select {
-		case job := <-r.jobsChan:
-			// Check job isn't already running
-			_, ok := r.jobs[job.ID]
-			if ok {
-				// Already running
-				break
-			}
+		case <-ticker.C:
+			r.refreshClaims()
+			r.claimJobs()
 
-			// Add to jobs map
-			r.jobs[job.ID] = job
+		case <-r.submitChan:
+			r.claimJobs()
 
-			// Execute job
-			go r.executeJob(job)
+		case id := <-r.doneChan:
+			delete(r.jobs, id)
+			r.releaseClaim(id)
+
+			r.claimJobs()
 
 		case <-r.ctx.Done():
+			// Claims expire and are detected by the JobMonitor
 			r.logger.Info("Job runner stopping")
 			return nil
 		}
@@ -72,33 +167,241 @@ func (r *JobRunner) Run() error {
 	return nil
 }
 
-// executeJob runs the logic for a job. Should be started in a Go routine as
-// it will block execution until the job finishes.
-func (r *JobRunner) executeJob(job *models.Job) {
-	// Prepare
-	// ... Run
-	prepareAction := NewPrepareAction(r.ctx, r.logger, r.etcdKV)
-	prepareOK := true
+// claimJobs claims and runs queued jobs until the worker pool is full
+func (r *JobRunner) claimJobs() {
+	if len(r.jobs) >= r.poolSize {
+		return
+	}
+
+	entries, err := getQueueEntries(r.ctx, r.etcdKV)
+	if err != nil {
+		r.logger.Errorf("error retrieving job queue: %s", err.Error())
+		return
+	}
+
+	seen := map[models.JobID]bool{}
+
+	for _, entry := range entries {
+		if len(r.jobs) >= r.poolSize {
+			return
+		}
+
+		// Already running jobs are claimed once their run finishes
+		if _, ok := r.jobs[entry.jobID]; ok || seen[entry.jobID] {
+			continue
+		}
+
+		seen[entry.jobID] = true
+
+		claimed, err := r.claim(entry.jobID)
+		if err != nil {
+			r.logger.Errorf("error claiming job, Job.ID: %#v, error: %s",
+				entry.jobID, err.Error())
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		// Remove job from queue
+		for _, other := range entries {
+			if other.jobID != entry.jobID {
+				continue
+			}
+
+			_, err := r.etcdKV.Delete(r.ctx, other.key, nil)
+			if err != nil && !etcd.IsKeyNotFound(err) {
+				r.logger.Errorf("error removing job from queue, "+
+					"Job.ID: %#v, error: %s", entry.jobID,
+					err.Error())
+			}
+		}
+
+		// Run
+		job := &models.Job{
+			ID: entry.jobID,
+		}
 
-	err := prepareAction.Run(job, job.State.PrepareState)
+		err = job.Get(r.ctx, r.etcdKV)
+		if err != nil {
+			r.logger.Errorf("error retrieving claimed job, Job.ID: %#v, "+
+				"error: %s", job.ID, err.Error())
+
+			r.releaseClaim(job.ID)
+			continue
+		}
+
+		if job.State.Done() {
+			r.releaseClaim(job.ID)
+			continue
+		}
+
+		r.jobs[job.ID] = job
+
+		go r.executeJob(job)
+	}
+}
+
+// claim marks a job as being run by the runner. Returns false if another
+// runner is running the job.
+func (r *JobRunner) claim(id models.JobID) (bool, error) {
+	value, err := json.Marshal(runnerClaim{
+		RunnerID: r.id,
+		JobID:    id,
+	})
 	if err != nil {
-		r.logger.Errorf("error running prepare action, Job.ID: %#v "+
-			", error: %s", job.ID, err.Error())
+		return false, fmt.Errorf("error marshalling claim: %s",
+			err.Error())
+	}
+
+	_, err = r.etcdKV.Set(r.ctx, claimKey(id), string(value),
+		&etcd.SetOptions{
+			PrevExist: etcd.PrevNoExist,
+			TTL:       ClaimTTL,
+		})
+	if etcdErr, ok := err.(etcd.Error); ok &&
+		etcdErr.Code == etcd.ErrorCodeNodeExist {
+
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// refreshClaims resets the TTL of the claims on all the jobs the runner is
+// running
+func (r *JobRunner) refreshClaims() {
+	for id := range r.jobs {
+		_, err := r.etcdKV.Set(r.ctx, claimKey(id), "", &etcd.SetOptions{
+			PrevExist: etcd.PrevExist,
+			TTL:       ClaimTTL,
+			Refresh:   true,
+		})
+		if err != nil {
+			r.logger.Errorf("error refreshing claim on job, Job.ID: %#v, "+
+				"error: %s", id, err.Error())
+		}
+	}
+}
+
+// releaseClaim removes the runner's claim on a job so it can be run again
+func (r *JobRunner) releaseClaim(id models.JobID) {
+	_, err := r.etcdKV.Delete(r.ctx, claimKey(id), nil)
+	if err != nil && !etcd.IsKeyNotFound(err) {
+		r.logger.Errorf("error releasing claim on job, Job.ID: %#v, "+
+			"error: %s", id, err.Error())
+	}
+}
 
-		job.State.PrepareState.SetError(err.Error())
+// executeJob runs a job using the executor. Should be started in a Go routine
+// as it will block execution until the job finishes or pauses.
+func (r *JobRunner) executeJob(job *models.Job) {
+	if job.State.QueuePosition != 0 {
+		job.State.QueuePosition = 0
 
-		prepareOK = false
+		err := job.Set(r.ctx, r.etcdKV)
+		if err != nil {
+			r.logger.Errorf("error saving job queue position, Job.ID: "+
+				"%#v, error: %s", job.ID, err.Error())
+		}
 	}
 
-	// ... Save
-	err = job.Set(r.ctx, r.etcdKV)
+	err := r.executor.Execute(job)
 	if err != nil {
-		r.logger.Errorf("error saving job after prepare action, "+
-			"Job.ID: %#v, error: %s", job.ID, err.Error())
-		return
+		r.logger.Errorf("error executing job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
 	}
 
-	if !prepareOK {
-		return
+	r.doneChan <- job.ID
+}
+
+// claimKey returns the Etcd key which holds the claim on a job
+func claimKey(id models.JobID) string {
+	return fmt.Sprintf("%s/%s/%s/%d", KeyDirRunnerClaims,
+		url.PathEscape(id.RepositoryID.Owner),
+		url.PathEscape(id.RepositoryID.Name), id.ID)
+}
+
+// getQueueEntries returns the jobs waiting in the queue in order. A job is in
+// the queue once for each time it was submitted.
+func getQueueEntries(ctx context.Context,
+	etcdKV etcd.KeysAPI) ([]queueEntry, error) {
+
+	resp, err := etcdKV.Get(ctx, KeyDirRunnerQueue, &etcd.GetOptions{
+		Sort:   true,
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []queueEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []queueEntry{}
+
+	for _, node := range resp.Node.Nodes {
+		var id models.JobID
+
+		err := json.Unmarshal([]byte(node.Value), &id)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling queue entry %s: "+
+				"%s", node.Key, err.Error())
+		}
+
+		entries = append(entries, queueEntry{
+			key:   node.Key,
+			jobID: id,
+		})
+	}
+
+	return entries, nil
+}
+
+// getClaims returns the IDs of all jobs claimed by runners
+func getClaims(ctx context.Context,
+	etcdKV etcd.KeysAPI) (map[models.JobID]bool, error) {
+
+	resp, err := etcdKV.Get(ctx, KeyDirRunnerClaims, &etcd.GetOptions{
+		Recursive: true,
+		Quorum:    true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return map[models.JobID]bool{}, nil
+	} else if err != nil {
+		return nil, err
 	}
+
+	return parseClaims(resp.Node)
+}
+
+// parseClaims returns the IDs of the jobs claimed in a directory of claims
+func parseClaims(dir *etcd.Node) (map[models.JobID]bool, error) {
+	claims := map[models.JobID]bool{}
+
+	nodes := []*etcd.Node{dir}
+
+	for len(nodes) > 0 {
+		node := nodes[0]
+		nodes = nodes[1:]
+
+		if node.Dir {
+			nodes = append(nodes, node.Nodes...)
+			continue
+		}
+
+		var claim runnerClaim
+
+		err := json.Unmarshal([]byte(node.Value), &claim)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling claim %s: %s",
+				node.Key, err.Error())
+		}
+
+		claims[claim.JobID] = true
+	}
+
+	return claims, nil
 }
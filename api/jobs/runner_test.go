@@ -0,0 +1,336 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// testRunnerTimeout is how long a test waits for runners to act
+const testRunnerTimeout time.Duration = 3 * RunnerPollInterval
+
+// testRuns records the jobs test executors run
+type testRuns struct {
+	// lock protects counts
+	lock sync.Mutex
+
+	// counts holds the number of times each job was run
+	counts map[models.JobID]int
+
+	// started receives the ID of the runner each time a job starts
+	started chan string
+
+	// release is closed to let running jobs finish
+	release chan struct{}
+}
+
+// newTestRuns creates a testRuns
+func newTestRuns() *testRuns {
+	return &testRuns{
+		counts:  map[models.JobID]int{},
+		started: make(chan string, 100),
+		release: make(chan struct{}),
+	}
+}
+
+// count returns the number of times a job was run
+func (r *testRuns) count(id models.JobID) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.counts[id]
+}
+
+// testExecutor records the jobs it runs, waits until runs are released, then
+// marks the job as done
+type testExecutor struct {
+	// runnerID identifies the runner which uses the executor
+	runnerID string
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// runs records runs
+	runs *testRuns
+
+	// detached is returned by Detached
+	detached bool
+}
+
+// Execute implements Executor.Execute
+func (e testExecutor) Execute(job *models.Job) error {
+	e.runs.lock.Lock()
+	e.runs.counts[job.ID]++
+	e.runs.lock.Unlock()
+
+	e.runs.started <- e.runnerID
+
+	<-e.runs.release
+
+	markDone(&job.State)
+
+	return job.Set(context.Background(), e.etcdKV)
+}
+
+// Detached implements Executor.Detached
+func (e testExecutor) Detached() bool {
+	return e.detached
+}
+
+// startTestRunner runs a JobRunner which runs one job at a time. Returns a
+// function which stops the runner.
+func startTestRunner(etcdKV etcd.KeysAPI, id string, runs *testRuns,
+	detached bool) (*JobRunner, context.CancelFunc) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runner := NewJobRunner(ctx, golog.NewStdLogger(id), &config.Config{
+		WorkerPoolSize: 1,
+	}, etcdKV, testExecutor{
+		runnerID: id,
+		etcdKV:   etcdKV,
+		runs:     runs,
+		detached: detached,
+	}, id)
+
+	go runner.Run()
+
+	return runner, cancel
+}
+
+// testRepositoryID is the repository of test jobs
+var testRepositoryID models.RepositoryID = models.RepositoryID{
+	Owner: "owner",
+	Name:  "repo",
+}
+
+// createTestJobs saves jobs of a tracked repository in Etcd
+func createTestJobs(t *testing.T, etcdKV etcd.KeysAPI,
+	count int) []*models.Job {
+
+	err := models.Repository{
+		ID: testRepositoryID,
+	}.Set(context.Background(), etcdKV)
+	if err != nil {
+		t.Fatalf("error saving repository: %s", err.Error())
+	}
+
+	jobs := []*models.Job{}
+
+	for i := 0; i < count; i++ {
+		job := models.NewJob(testRepositoryID, models.JobTarget{
+			Branch: "master",
+			Commit: "abc",
+		})
+
+		err := job.Create(context.Background(), etcdKV)
+		if err != nil {
+			t.Fatalf("error creating job: %s", err.Error())
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// waitStarted waits for count jobs to start, returns the IDs of the runners
+// which started them
+func waitStarted(t *testing.T, runs *testRuns, count int) []string {
+	runnerIDs := []string{}
+
+	for len(runnerIDs) < count {
+		select {
+		case id := <-runs.started:
+			runnerIDs = append(runnerIDs, id)
+		case <-time.After(testRunnerTimeout):
+			t.Fatalf("timed out waiting for jobs to start, %d of %d "+
+				"started", len(runnerIDs), count)
+		}
+	}
+
+	return runnerIDs
+}
+
+func TestRunnersClaimEachJobOnce(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	runs := newTestRuns()
+
+	runners := []*JobRunner{}
+
+	for i := 0; i < 3; i++ {
+		runner, cancel := startTestRunner(etcdKV,
+			fmt.Sprintf("runner-%d", i), runs, false)
+		defer cancel()
+
+		runners = append(runners, runner)
+	}
+
+	// Jobs submitted twice are still only run once
+	jobs := createTestJobs(t, etcdKV, 3)
+
+	for _, job := range jobs {
+		runners[0].Submit(job)
+		runners[1].Submit(job)
+	}
+
+	// Each runner runs one job at a time, so each job is run by a
+	// different runner
+	runnerIDs := waitStarted(t, runs, len(jobs))
+
+	distinct := map[string]bool{}
+	for _, id := range runnerIDs {
+		distinct[id] = true
+	}
+
+	if len(distinct) != len(runners) {
+		t.Errorf("expected jobs to be run by %d different runners, "+
+			"were run by: %v", len(runners), runnerIDs)
+	}
+
+	close(runs.release)
+
+	// Wait for jobs to finish
+	deadline := time.Now().Add(testRunnerTimeout)
+
+	for {
+		entries, err := getQueueEntries(context.Background(), etcdKV)
+		if err != nil {
+			t.Fatalf("error retrieving queue: %s", err.Error())
+		}
+
+		claims, err := getClaims(context.Background(), etcdKV)
+		if err != nil {
+			t.Fatalf("error retrieving claims: %s", err.Error())
+		}
+
+		if len(entries) == 0 && len(claims) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for jobs to finish, queue: %v, "+
+				"claims: %v", entries, claims)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, job := range jobs {
+		if count := runs.count(job.ID); count != 1 {
+			t.Errorf("expected job %d to run once, ran %d times",
+				job.ID.ID, count)
+		}
+	}
+}
+
+// stopRunnerWithJob runs a job on a runner, then stops the runner and removes
+// its claim on the job as if it expired
+func stopRunnerWithJob(t *testing.T, etcdKV etcd.KeysAPI, runs *testRuns,
+	detached bool) *models.Job {
+
+	runner, cancel := startTestRunner(etcdKV, "stopped", runs, detached)
+
+	job := createTestJobs(t, etcdKV, 1)[0]
+	runner.Submit(job)
+
+	waitStarted(t, runs, 1)
+
+	cancel()
+
+	_, err := etcdKV.Delete(context.Background(), claimKey(job.ID), nil)
+	if err != nil {
+		t.Fatalf("error removing claim: %s", err.Error())
+	}
+
+	return job
+}
+
+func TestMonitorInterruptsJobOfStoppedRunner(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	runs := newTestRuns()
+	defer close(runs.release)
+
+	job := stopRunnerWithJob(t, etcdKV, runs, false)
+
+	runner, cancel := startTestRunner(etcdKV, "leader", runs, false)
+	defer cancel()
+
+	executor := testExecutor{
+		runnerID: "leader",
+		etcdKV:   etcdKV,
+		runs:     runs,
+	}
+
+	monitor := NewJobMonitor(golog.NewStdLogger("monitor"), etcdKV,
+		models.NewEtcdLogStore(etcdKV), executor, runner)
+
+	// Jobs are recovered once they are orphaned in two checks
+	monitor.check(context.Background())
+	monitor.check(context.Background())
+
+	err := job.Get(context.Background(), etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving job: %s", err.Error())
+	}
+
+	if job.State.PrepareState.Stage != models.ErrDone {
+		t.Errorf("expected job to be interrupted, state: %#v",
+			job.State.PrepareState)
+	}
+
+	if count := runs.count(job.ID); count != 1 {
+		t.Errorf("expected interrupted job to not run again, ran %d "+
+			"times", count)
+	}
+}
+
+func TestMonitorRetriesDetachedJobOnOtherRunner(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	runs := newTestRuns()
+	defer close(runs.release)
+
+	job := stopRunnerWithJob(t, etcdKV, runs, true)
+
+	runner, cancel := startTestRunner(etcdKV, "leader", runs, true)
+	defer cancel()
+
+	executor := testExecutor{
+		runnerID: "leader",
+		etcdKV:   etcdKV,
+		runs:     runs,
+		detached: true,
+	}
+
+	monitor := NewJobMonitor(golog.NewStdLogger("monitor"), etcdKV,
+		models.NewEtcdLogStore(etcdKV), executor, runner)
+
+	monitor.check(context.Background())
+	monitor.check(context.Background())
+
+	runnerIDs := waitStarted(t, runs, 1)
+
+	if runnerIDs[0] != "leader" {
+		t.Errorf("expected job to be retried by the running runner, was "+
+			"run by %s", runnerIDs[0])
+	}
+
+	if count := runs.count(job.ID); count != 2 {
+		t.Errorf("expected job to run twice, ran %d times", count)
+	}
+}
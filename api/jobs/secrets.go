@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// SecretResolver replaces references to secrets in configuration values
+type SecretResolver struct {
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// box decrypts secrets
+	box libsecret.Box
+}
+
+// NewSecretResolver creates a new SecretResolver
+func NewSecretResolver(etcdKV etcd.KeysAPI,
+	box libsecret.Box) SecretResolver {
+
+	return SecretResolver{
+		etcdKV: etcdKV,
+		box:    box,
+	}
+}
+
+// Resolve replaces references to secrets in a value. Secrets of the
+// environment are used before secrets of the whole repository. An empty
+// environment only uses secrets of the whole repository. Secret values are
+// added to the job so they are redacted from output.
+func (r SecretResolver) Resolve(ctx context.Context, job *models.Job,
+	environment, value string) (string, error) {
+
+	return models.ReplaceSecretRefs(value, func(name string) (string, error) {
+		scopes := []string{""}
+		if len(environment) > 0 {
+			scopes = []string{environment, ""}
+		}
+
+		for _, scope := range scopes {
+			secret := models.Secret{
+				RepositoryID: job.ID.RepositoryID,
+				Environment:  scope,
+				Name:         name,
+			}
+
+			secretValue, err := secret.Value(ctx, r.etcdKV, r.box)
+			if etcd.IsKeyNotFound(err) {
+				continue
+			} else if err != nil {
+				return "", fmt.Errorf("Error retrieving secret %s: %s",
+					name, err.Error())
+			}
+
+			job.AddSecret(secretValue)
+
+			return secretValue, nil
+		}
+
+		if len(environment) > 0 {
+			return "", fmt.Errorf("Secret %s is not set for the "+
+				"repository or the %s environment", name, environment)
+		}
+
+		return "", fmt.Errorf("Secret %s is not set for the repository",
+			name)
+	})
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// withTimeout derives a context which is canceled after a timeout. A timeout
+// of 0 or less never cancels the context.
+func withTimeout(ctx context.Context, timeout time.Duration) (
+	context.Context, context.CancelFunc) {
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// actionTimeout returns how long one of a unit's actions may run, including
+// retries. The unit's timeouts take precedence over the configured defaults.
+func (w *Worker) actionTimeout(unit models.UnitConfig,
+	action string) time.Duration {
+
+	if timeout, ok := unit.TimeoutFor(action); ok {
+		return timeout
+	}
+
+	switch action {
+	case "docker":
+		return w.cfg.DockerTimeout
+	case "helm":
+		return w.cfg.HelmTimeout
+	case "kubernetes":
+		return w.cfg.KubernetesTimeout
+	case "kustomize":
+		return w.cfg.KustomizeTimeout
+	case "rollback":
+		return w.cfg.RollbackTimeout
+	}
+
+	return 0
+}
+
+// timeoutError replaces the error of an action which was stopped by the job
+// deadline or the action's timeout with a message saying which fired. Other
+// errors are returned as is. Must be called before actionCtx is canceled.
+func (w *Worker) timeoutError(jobCtx, actionCtx context.Context,
+	timeout time.Duration, err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if jobCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Job timed out after %s: %s", w.cfg.JobTimeout,
+			err.Error())
+	}
+
+	if actionCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out after %s: %s", timeout, err.Error())
+	}
+
+	return err
+}
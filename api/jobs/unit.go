@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+)
+
+// UnitAction is an action which builds part of a unit
+type UnitAction interface {
+	// Run executes the action for a unit. Sets the state's Stage to Done
+	// if successful. Returns an error if the action fails.
+	Run(job *models.Job, unit models.UnitConfig,
+		state *models.ActionState) error
+}
+
+// DeployAction is an action which deploys part of a unit to an environment
+type DeployAction interface {
+	// Run executes the action for a unit in an environment. Sets the
+	// state's Stage to Done if successful. Returns an error if the action
+	// fails.
+	Run(job *models.Job, unit models.UnitConfig,
+		env models.EnvironmentConfig, state *models.ActionState) error
+}
+
+// environmentState returns the state of a unit's deployment to an
+// environment
+func environmentState(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig) *models.EnvironmentState {
+
+	return job.State.Units[unit.ID].Environments[env.ID]
+}
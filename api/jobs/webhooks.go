@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/github"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// WebHookReconcileInterval is how often the WebHookReconciler checks the
+// GitHub web hooks of tracked repositories
+const WebHookReconcileInterval time.Duration = 10 * time.Minute
+
+// WebHookReconciler makes sure every tracked repository has a GitHub web hook
+// which sends events to the public API. Hooks which were deleted are created
+// again, hooks which were disabled or whose configuration changed, ex:
+// because PUBLIC_HTTP_HOST changed, are updated. Only the leader runner
+// should run the WebHookReconciler.
+type WebHookReconciler struct {
+	// logger prints debug information
+	logger golog.Logger
+
+	// cfg is configuration
+	cfg *config.Config
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// NewWebHookReconciler creates a new WebHookReconciler
+func NewWebHookReconciler(logger golog.Logger, cfg *config.Config,
+	etcdKV etcd.KeysAPI) WebHookReconciler {
+
+	return WebHookReconciler{
+		logger: logger,
+		cfg:    cfg,
+		etcdKV: etcdKV,
+	}
+}
+
+// Run reconciles once, then every WebHookReconcileInterval until the
+// context is canceled
+func (r WebHookReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(WebHookReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		r.reconcileAll(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcileAll reconciles the web hook of every tracked repository
+func (r WebHookReconciler) reconcileAll(ctx context.Context) {
+	ghClient, err := libgh.NewClient(ctx, r.etcdKV)
+	if err == libgh.ErrNoAuth {
+		r.logger.Debug("not authenticated with GitHub, not checking web " +
+			"hooks")
+		return
+	} else if err != nil {
+		r.logger.Errorf("error creating GitHub client: %s", err.Error())
+		return
+	}
+
+	repos, err := models.GetAllRepositories(ctx, r.etcdKV)
+	if err != nil {
+		r.logger.Errorf("error retrieving repositories: %s", err.Error())
+		return
+	}
+
+	for _, repo := range repos {
+		err := r.reconcile(ctx, ghClient, repo)
+		if err != nil {
+			r.logger.Errorf("error reconciling web hook, repository: "+
+				"%#v, error: %s", repo.ID, err.Error())
+		}
+	}
+}
+
+// reconcile creates a repository's web hook if it does not exist, or
+// updates it if it is not current
+func (r WebHookReconciler) reconcile(ctx context.Context,
+	ghClient *github.Client, repo models.Repository) error {
+
+	owner := repo.ID.Owner
+	name := repo.ID.Name
+
+	hookCfg, err := libgh.WebHookConfig(r.cfg, owner, name)
+	if err != nil {
+		return err
+	}
+
+	hook, resp, err := ghClient.Repositories.GetHook(ctx, owner, name,
+		repo.WebHookID)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return r.recreate(ctx, ghClient, repo, hookCfg)
+	} else if err != nil {
+		return fmt.Errorf("error retrieving web hook %d: %s",
+			repo.WebHookID, err.Error())
+	}
+
+	if libgh.WebHookCurrent(hook, hookCfg) {
+		return nil
+	}
+
+	active := true
+
+	_, _, err = ghClient.Repositories.EditHook(ctx, owner, name,
+		repo.WebHookID, &github.Hook{
+			Config: hookCfg,
+			Active: &active,
+		})
+	if err != nil {
+		return fmt.Errorf("error updating web hook %d: %s",
+			repo.WebHookID, err.Error())
+	}
+
+	r.logger.Infof("updated web hook of repository %#v", repo.ID)
+
+	return nil
+}
+
+// recreate creates a web hook for a repository whose web hook was deleted
+// and saves its ID. If the repository stopped being tracked in the meantime
+// the new web hook is deleted.
+func (r WebHookReconciler) recreate(ctx context.Context,
+	ghClient *github.Client, repo models.Repository,
+	hookCfg map[string]interface{}) error {
+
+	owner := repo.ID.Owner
+	name := repo.ID.Name
+
+	hook, _, err := ghClient.Repositories.CreateHook(ctx, owner, name,
+		&github.Hook{
+			Config: hookCfg,
+		})
+	if err != nil {
+		return fmt.Errorf("error creating web hook: %s", err.Error())
+	}
+
+	err = repo.Update(ctx, r.etcdKV, func() error {
+		repo.WebHookID = *(hook.ID)
+		return nil
+	})
+	if etcd.IsKeyNotFound(err) {
+		_, err = ghClient.Repositories.DeleteHook(ctx, owner, name,
+			*(hook.ID))
+		if err != nil {
+			return fmt.Errorf("error deleting web hook of untracked "+
+				"repository: %s", err.Error())
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error saving web hook ID: %s", err.Error())
+	}
+
+	r.logger.Infof("created missing web hook of repository %#v", repo.ID)
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/github"
+)
+
+// testHooks is a fake GitHub API which stores the web hooks of repositories
+type testHooks struct {
+	// lock protects hooks, nextID, and requests
+	lock sync.Mutex
+
+	// hooks holds web hooks by path, ex: "/repos/owner/repo/hooks/1"
+	hooks map[string]*github.Hook
+
+	// nextID is the ID of the next created hook
+	nextID int64
+
+	// requests records the method and path of every request
+	requests []string
+}
+
+// ServeHTTP implements http.Handler
+func (h *testHooks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.requests = append(h.requests, fmt.Sprintf("%s %s", r.Method,
+		r.URL.Path))
+
+	var hook *github.Hook
+
+	switch r.Method {
+	case http.MethodGet, http.MethodPatch:
+		var ok bool
+		hook, ok = h.hooks[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`,
+				http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodPatch {
+			err := json.NewDecoder(r.Body).Decode(hook)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		hook = &github.Hook{}
+
+		err := json.NewDecoder(r.Body).Decode(hook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := h.nextID
+		h.nextID++
+
+		hook.ID = &id
+		h.hooks[fmt.Sprintf("%s/%d", r.URL.Path, id)] = hook
+	default:
+		http.Error(w, "method not allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hook)
+}
+
+func TestWebHookReconciler(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		PublicHTTPHost: "http://kgd.example.com",
+	}
+
+	// Repositories whose hooks are missing, disabled, outdated, and
+	// current
+	inactive := false
+
+	hookCfg := func(name string) map[string]interface{} {
+		hookCfg, err := libgh.WebHookConfig(cfg, "owner", name)
+		if err != nil {
+			t.Fatalf("error creating hook configuration: %s",
+				err.Error())
+		}
+
+		return hookCfg
+	}
+
+	hooks := &testHooks{
+		hooks: map[string]*github.Hook{
+			"/repos/owner/disabled/hooks/2": {
+				Config: hookCfg("disabled"),
+				Active: &inactive,
+			},
+			"/repos/owner/outdated/hooks/3": {
+				Config: map[string]interface{}{
+					"url": "http://old.example.com/api/v0/" +
+						"github/repositories/owner/outdated/" +
+						"web_hook",
+					"content_type": "json",
+					"insecure_ssl": "1",
+				},
+			},
+			"/repos/owner/current/hooks/4": {
+				Config: map[string]interface{}{
+					"url": "http://kgd.example.com/api/v0/" +
+						"github/repositories/owner/current/" +
+						"web_hook",
+					"content_type": "json",
+					"insecure_ssl": "1",
+				},
+			},
+		},
+		nextID: 10,
+	}
+
+	server := httptest.NewServer(hooks)
+	defer server.Close()
+
+	repos := map[string]int64{
+		"missing":  1,
+		"disabled": 2,
+		"outdated": 3,
+		"current":  4,
+	}
+
+	for name, hookID := range repos {
+		err := models.Repository{
+			ID: models.RepositoryID{
+				Owner: "owner",
+				Name:  name,
+			},
+			WebHookID: hookID,
+		}.Set(ctx, etcdKV)
+		if err != nil {
+			t.Fatalf("error saving repository: %s", err.Error())
+		}
+	}
+
+	// Reconcile
+	ghClient := github.NewClient(nil)
+	ghClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	reconciler := NewWebHookReconciler(golog.NewStdLogger("reconciler"),
+		cfg, etcdKV)
+
+	for name := range repos {
+		repo := models.Repository{
+			ID: models.RepositoryID{
+				Owner: "owner",
+				Name:  name,
+			},
+		}
+
+		err := repo.Get(ctx, etcdKV)
+		if err != nil {
+			t.Fatalf("error retrieving repository: %s", err.Error())
+		}
+
+		err = reconciler.reconcile(ctx, ghClient, repo)
+		if err != nil {
+			t.Fatalf("error reconciling %s: %s", name, err.Error())
+		}
+	}
+
+	// Check missing hook was created and its ID saved
+	repo := models.Repository{
+		ID: models.RepositoryID{
+			Owner: "owner",
+			Name:  "missing",
+		},
+	}
+
+	err := repo.Get(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving repository: %s", err.Error())
+	}
+
+	if repo.WebHookID != 10 {
+		t.Errorf("expected new web hook ID 10 to be saved, was %d",
+			repo.WebHookID)
+	}
+
+	// Check hooks are current
+	for path, name := range map[string]string{
+		"/repos/owner/missing/hooks/10": "missing",
+		"/repos/owner/disabled/hooks/2": "disabled",
+		"/repos/owner/outdated/hooks/3": "outdated",
+		"/repos/owner/current/hooks/4":  "current",
+	} {
+		hook, ok := hooks.hooks[path]
+		if !ok {
+			t.Errorf("expected web hook %s to exist", path)
+			continue
+		}
+
+		if !libgh.WebHookCurrent(hook, hookCfg(name)) {
+			t.Errorf("expected web hook %s to be current, was %#v",
+				path, hook)
+		}
+	}
+
+	// Check current hook was not modified
+	for _, request := range hooks.requests {
+		if request == "PATCH /repos/owner/current/hooks/4" {
+			t.Error("expected current web hook not to be updated")
+		}
+	}
+}
@@ -0,0 +1,786 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// Worker runs all the actions in a job. Saves the job's state after each
+// action so other processes can observe progress.
+type Worker struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// cfg is configuration
+	cfg *config.Config
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// logStore holds job action output
+	logStore models.LogStore
+
+	// clusters holds Kubernetes API clients. Keys are kubeconfig context
+	// names, the empty string is the default cluster. Clients are created
+	// when a unit first requires them.
+	clusters map[string]*libkube.Cluster
+
+	// clustersLock guards clusters, since jobs run concurrently
+	clustersLock sync.Mutex
+
+	// fetchers download repositories. Keys are the strategy each fetcher
+	// implements.
+	fetchers map[models.FetchStrategy]Fetcher
+
+	// secretsBox encrypts the values of Secrets in rendered manifests
+	secretsBox libsecret.Box
+
+	// secrets replaces references to secrets in unit configuration
+	secrets SecretResolver
+
+	// registries authenticates with Docker registries
+	registries RegistryAuth
+
+	// builder builds unit images
+	builder ImageBuilder
+}
+
+// NewWorker creates a new Worker
+func NewWorker(ctx context.Context, logger golog.Logger, cfg *config.Config,
+	etcdKV etcd.KeysAPI, logStore models.LogStore, secretsBox libsecret.Box,
+	builder ImageBuilder) *Worker {
+
+	return &Worker{
+		ctx:      ctx,
+		logger:   logger,
+		cfg:      cfg,
+		etcdKV:   etcdKV,
+		logStore: logStore,
+		clusters: map[string]*libkube.Cluster{},
+		fetchers: map[models.FetchStrategy]Fetcher{
+			models.FetchTarball: NewTarballFetcher(etcdKV,
+				cfg.ArchiveMaxBytes, cfg.ArchiveMaxFiles),
+			models.FetchShallow: NewGitFetcher(NewGitHubRemote(etcdKV),
+				cfg.GitMirrorDir, false),
+			models.FetchFull: NewGitFetcher(NewGitHubRemote(etcdKV),
+				cfg.GitMirrorDir, true),
+		},
+		secretsBox: secretsBox,
+		secrets:    NewSecretResolver(etcdKV, secretsBox),
+		registries: NewRegistryAuth(etcdKV, secretsBox),
+		builder:    builder,
+	}
+}
+
+// Run executes a job. Blocks until the job finishes, or until the job
+// reaches a deploy which is awaiting approval. Paused jobs are resumed by
+// running them again, actions which already finished are not re-run. Each run
+// is bounded by the job timeout, and stops if a user cancels the job.
+func (w *Worker) Run(job *models.Job) {
+	// Saves and cleanup use the worker's context so they still happen
+	// once the job times out
+	jobCtx, cancel := withTimeout(w.ctx, w.cfg.JobTimeout)
+	defer cancel()
+
+	// Cancellation
+	// ... Jobs canceled while queued or paused do not run again
+	cancellation, err := models.GetJobCancellation(w.ctx, w.etcdKV,
+		job.ID)
+	if err != nil {
+		w.logger.Errorf("error checking if job was canceled, Job.ID: "+
+			"%#v, error: %s", job.ID, err.Error())
+	} else if cancellation != nil {
+		job.State.Cancel(cancellation.Reason())
+		w.save(job, "cancellation")
+		return
+	}
+
+	// ... Running jobs are stopped
+	canceled := make(chan models.JobCancellation, 1)
+	go w.watchCancellation(jobCtx, cancel, job.ID, canceled)
+
+	// Prepare
+	// ... Run
+	prepareCtx, cancelPrepare := withTimeout(jobCtx, w.cfg.PrepareTimeout)
+	prepareAction := NewPrepareAction(prepareCtx, w.logger, w.etcdKV,
+		w.fetchers)
+	prepareOK := true
+
+	// The working directory is removed when a job pauses, so resumed
+	// jobs download the repository again
+	resuming := job.State.PrepareState.Done()
+	if resuming {
+		job.State.PrepareState.AddOutput("Resuming job")
+		job.State.CleanupState.Stage = models.Queued
+	}
+
+	prepareRetry := models.RetryConfig{
+		MaxAttempts: w.cfg.PrepareMaxAttempts,
+		Backoff:     w.cfg.PrepareBackoff.String(),
+		MaxBackoff:  w.cfg.PrepareMaxBackoff.String(),
+	}
+
+	err = runWithRetry(prepareCtx, prepareRetry, job.State.PrepareState,
+		func() {
+			w.save(job, "prepare action attempt")
+		}, func() error {
+			return prepareAction.Run(job, job.State.PrepareState)
+		})
+	err = w.timeoutError(jobCtx, prepareCtx, w.cfg.PrepareTimeout, err)
+	cancelPrepare()
+
+	if err != nil {
+		w.logger.Errorf("error running prepare action, Job.ID: %#v "+
+			", error: %s", job.ID, job.Redact(err.Error()))
+
+		job.State.PrepareState.SetError(err.Error())
+
+		prepareOK = false
+
+		if resuming {
+			job.State.Interrupt("failed to resume job")
+		}
+	}
+
+	// ... Save
+	w.save(job, "prepare action")
+
+	// Units
+	if prepareOK {
+		// Prepare already checked the environments exist
+		envs, _ := job.DeployEnvironments()
+
+		for _, id := range job.Config.UnitIDs() {
+			paused := w.runUnit(jobCtx, job, job.Config.Units[id],
+				envs)
+			if paused || jobCtx.Err() == context.Canceled {
+				break
+			}
+		}
+	}
+
+	// Cleanup
+	cleanupAction := NewCleanupAction(w.ctx, w.logger)
+
+	err = cleanupAction.Run(job, job.State.CleanupState)
+	if err != nil {
+		w.logger.Errorf("error running cleanup action, Job.ID: %#v, "+
+			"error: %s", job.ID, job.Redact(err.Error()))
+
+		job.State.CleanupState.SetError(err.Error())
+	}
+
+	// Actions which did not run because the job was canceled
+	if cancellation := canceledBy(canceled); cancellation != nil {
+		job.State.Cancel(cancellation.Reason())
+	}
+
+	w.save(job, "cleanup action")
+}
+
+// save stores a job's state. Errors are logged since there is nowhere else
+// to report them.
+func (w *Worker) save(job *models.Job, after string) {
+	err := job.Save(w.ctx, w.etcdKV, w.logStore)
+	if err != nil {
+		w.logger.Errorf("error saving job after %s, Job.ID: %#v, "+
+			"error: %s", after, job.ID, err.Error())
+	}
+}
+
+// getCluster returns the Kubernetes API clients for a kubeconfig context,
+// creating them the first time they are needed. An empty kubeContext selects
+// the default cluster.
+func (w *Worker) getCluster(kubeContext string) (*libkube.Cluster, error) {
+	w.clustersLock.Lock()
+	defer w.clustersLock.Unlock()
+
+	if cluster, ok := w.clusters[kubeContext]; ok {
+		return cluster, nil
+	}
+
+	cluster, err := libkube.NewCluster(w.cfg, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	w.clusters[kubeContext] = cluster
+
+	return cluster, nil
+}
+
+// withCluster wraps the constructor of an action which uses the Kubernetes
+// API of an environment's cluster so it can be used as a
+// deployStep.newAction
+func (w *Worker) withCluster(env models.EnvironmentConfig,
+	newAction func(ctx context.Context,
+		cluster *libkube.Cluster) DeployAction) func(
+	ctx context.Context) (DeployAction, error) {
+
+	return func(ctx context.Context) (DeployAction, error) {
+		cluster, err := w.getCluster(env.Context)
+		if err != nil {
+			return nil, fmt.Errorf("Error connecting to Kubernetes: "+
+				"%s", err.Error())
+		}
+
+		return newAction(ctx, cluster), nil
+	}
+}
+
+// deployStep is an action to run as part of a unit's deployment to an
+// environment
+type deployStep struct {
+	// name identifies the action in logs
+	name string
+
+	// state is the action's state. Nil if the unit does not contain the
+	// action.
+	state *models.ActionState
+
+	// newAction creates the action, which runs until ctx is canceled
+	newAction func(ctx context.Context) (DeployAction, error)
+}
+
+// runUnit builds a unit once, then deploys it to each environment, as
+// rendered for the environment. If the build fails nothing is deployed.
+// Returns true if the job paused to wait for a deploy to be approved.
+func (w *Worker) runUnit(ctx context.Context, job *models.Job,
+	unit models.UnitConfig, envs []models.EnvironmentConfig) bool {
+
+	unitState := job.State.Units[unit.ID]
+
+	// Docker
+	if unitState.DockerState != nil && !unitState.DockerState.Done() {
+		timeout := w.actionTimeout(unit, "docker")
+		dockerCtx, cancel := withTimeout(ctx, timeout)
+		dockerAction := NewDockerAction(dockerCtx, w.logger, w.etcdKV,
+			w.secrets, w.registries, w.builder)
+
+		err := runWithRetry(dockerCtx, unit.RetryFor("docker"),
+			unitState.DockerState, func() {
+				w.save(job, fmt.Sprintf("unit %s docker action "+
+					"attempt", unit.ID))
+			}, func() error {
+				return dockerAction.Run(job, unit,
+					unitState.DockerState)
+			})
+		err = w.timeoutError(ctx, dockerCtx, timeout, err)
+		cancel()
+
+		if err != nil {
+			w.logger.Errorf("error running docker action, Job.ID: "+
+				"%#v, unit: %s, error: %s", job.ID, unit.ID,
+				job.Redact(err.Error()))
+
+			unitState.DockerState.SetError(err.Error())
+		}
+
+		w.save(job, fmt.Sprintf("unit %s docker action", unit.ID))
+
+		if unitState.DockerState.Stage != models.Done {
+			for _, envState := range unitState.Environments {
+				skipDeploy(envState, "Skipped because the unit's "+
+					"docker action failed")
+			}
+
+			w.save(job, fmt.Sprintf("unit %s docker failure", unit.ID))
+
+			return false
+		}
+	}
+
+	// Deploy
+	for _, env := range envs {
+		if _, ok := unitState.Environments[env.ID]; !ok {
+			continue
+		}
+
+		paused := w.deployUnit(ctx, job,
+			job.Config.UnitFor(unit.ID, env.ID), env)
+		if paused {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipDeploy marks the deploy actions of an environment which have not run
+// as failed
+func skipDeploy(envState *models.EnvironmentState, reason string) {
+	for _, state := range envState.DeployStates() {
+		if !state.Done() {
+			state.SetError(reason)
+		}
+	}
+}
+
+// deployUnit runs a unit's deploy actions for an environment in order. If an
+// action fails the remaining actions are skipped and the unit's rollback
+// policy is applied. Returns true if the job paused to wait for the deploy to
+// be approved.
+func (w *Worker) deployUnit(ctx context.Context, job *models.Job,
+	unit models.UnitConfig, env models.EnvironmentConfig) bool {
+
+	envState := environmentState(job, unit, env)
+	logName := fmt.Sprintf("unit %s environment %s", unit.ID, env.ID)
+
+	// Skip if deployed before the job paused
+	finished := true
+	for _, state := range envState.DeployStates() {
+		if !state.Done() {
+			finished = false
+		}
+	}
+
+	if finished {
+		return false
+	}
+
+	// Freeze windows
+	proceed, paused := w.checkFreezes(job, env, envState)
+
+	w.save(job, fmt.Sprintf("%s freeze check", logName))
+
+	if paused {
+		return true
+	}
+
+	if !proceed {
+		skipDeploy(envState, "Skipped because deploys are frozen")
+		w.save(job, fmt.Sprintf("%s freeze failure", logName))
+
+		return false
+	}
+
+	// Approval
+	if envState.ApprovalState != nil && !envState.ApprovalState.Done() {
+		approved, paused := w.checkApproval(unit, env, envState)
+
+		w.save(job, fmt.Sprintf("%s approval", logName))
+
+		if paused {
+			return true
+		}
+
+		if !approved {
+			skipDeploy(envState, "Skipped because the deploy was not "+
+				"approved")
+			w.save(job, fmt.Sprintf("%s approval failure", logName))
+
+			return false
+		}
+	}
+
+	// Concurrency
+	lock, ok := w.joinGroup(ctx, job, unit, env, envState)
+
+	w.save(job, fmt.Sprintf("%s concurrency group", logName))
+
+	if !ok {
+		return false
+	}
+
+	defer lock.Release()
+
+	// Canceled if a newer job in the concurrency group cancels the deploy
+	lockCtx := lock.Context()
+
+	steps := []deployStep{
+		deployStep{
+			name:  "helm",
+			state: envState.HelmState,
+			newAction: w.withCluster(env, func(ctx context.Context,
+				cluster *libkube.Cluster) DeployAction {
+
+				return NewHelmAction(ctx, w.logger, cluster,
+					w.cfg.KubeConfig, w.secrets, w.registries,
+					func() {
+						w.save(job, fmt.Sprintf("%s helm "+
+							"rollout progress", logName))
+					})
+			}),
+		},
+		deployStep{
+			name:  "kubernetes",
+			state: envState.KubernetesState,
+			newAction: w.withCluster(env, func(ctx context.Context,
+				cluster *libkube.Cluster) DeployAction {
+
+				return NewKubernetesAction(ctx, w.logger, w.etcdKV,
+					cluster, w.secretsBox)
+			}),
+		},
+		deployStep{
+			name:  "kustomize",
+			state: envState.KustomizeState,
+			newAction: w.withCluster(env, func(ctx context.Context,
+				cluster *libkube.Cluster) DeployAction {
+
+				return NewKustomizeAction(ctx, w.logger, w.etcdKV,
+					cluster, w.secretsBox)
+			}),
+		},
+	}
+
+	var failedStep *deployStep
+
+	for i, step := range steps {
+		if step.state == nil {
+			continue
+		}
+
+		if failedStep != nil {
+			step.state.SetError("Skipped because a previous " +
+				"action in the unit failed")
+			continue
+		}
+
+		timeout := w.actionTimeout(unit, step.name)
+		stepCtx, cancel := withTimeout(lockCtx, timeout)
+
+		action, err := step.newAction(stepCtx)
+		if err == nil {
+			err = runWithRetry(stepCtx, unit.RetryFor(step.name),
+				step.state, func() {
+					w.save(job, fmt.Sprintf("%s %s action attempt",
+						logName, step.name))
+				}, func() error {
+					return action.Run(job, unit, env, step.state)
+				})
+		}
+
+		err = w.timeoutError(ctx, stepCtx, timeout, err)
+		cancel()
+
+		if err != nil {
+			w.logger.Errorf("error running %s action, Job.ID: %#v, "+
+				"unit: %s, environment: %s, error: %s", step.name,
+				job.ID, unit.ID, env.ID, job.Redact(err.Error()))
+
+			if lock.Lost() {
+				step.state.SetError(fmt.Sprintf("Canceled by a newer "+
+					"job: %s", err.Error()))
+			} else {
+				step.state.SetError(err.Error())
+			}
+
+			failedStep = &steps[i]
+		}
+
+		w.save(job, fmt.Sprintf("%s %s action", logName, step.name))
+	}
+
+	if failedStep == nil {
+		w.recordDeploy(job, unit, env)
+		return false
+	}
+
+	// The newer job deploys in place of a rollback
+	if lock.Lost() {
+		envState.ConcurrencyState.AddOutput("Canceled by a newer job, " +
+			"not rolling back")
+		w.save(job, fmt.Sprintf("%s cancel", logName))
+
+		return false
+	}
+
+	switch unit.RollbackPolicy() {
+	case models.RollbackAuto:
+		w.rollback(job, unit, env)
+	case models.RollbackManual:
+		failedStep.state.AddOutput("Unit rollback policy is manual, " +
+			"not rolling back")
+		w.save(job, fmt.Sprintf("%s failure", logName))
+	}
+
+	return false
+}
+
+// joinGroup waits until a deploy holds its concurrency group. The deploy's
+// position in the group's queue is saved while it waits. Returns false if the
+// deploy was superseded by a newer job or the group could not be joined, in
+// which case the deploy's actions are marked as failed.
+func (w *Worker) joinGroup(ctx context.Context, job *models.Job,
+	unit models.UnitConfig, env models.EnvironmentConfig,
+	envState *models.EnvironmentState) (*GroupLock, bool) {
+
+	if envState.ConcurrencyState == nil {
+		envState.ConcurrencyState = models.NewActionState()
+	}
+
+	state := envState.ConcurrencyState
+	state.Stage = models.Running
+
+	concurrency := job.Config.Concurrency
+	dir := concurrency.GroupKey(job.ID.RepositoryID, unit.ID, env.ID)
+
+	var lastHolderID int64 = -1
+
+	lock, err := AcquireGroupLock(ctx, w.etcdKV, dir, job.ID.ID,
+		concurrency.GetPolicy(), func(position int, holderID int64) {
+			if position == envState.QueuePosition &&
+				holderID == lastHolderID {
+				return
+			}
+
+			envState.QueuePosition = position
+			lastHolderID = holderID
+
+			state.AddOutput(fmt.Sprintf("Waiting for job %d to finish "+
+				"deploying to %s, queue position %d", holderID, env.ID,
+				position))
+			w.save(job, fmt.Sprintf("unit %s environment %s queue "+
+				"position", unit.ID, env.ID))
+		})
+
+	envState.QueuePosition = 0
+
+	if err == ErrSuperseded {
+		state.SetError("Superseded by a newer job")
+		skipDeploy(envState, "Skipped because a newer job superseded "+
+			"the deploy")
+
+		return nil, false
+	} else if err != nil {
+		err = w.timeoutError(ctx, ctx, w.cfg.JobTimeout, err)
+
+		w.logger.Errorf("error joining concurrency group, Job.ID: %#v, "+
+			"unit: %s, environment: %s, error: %s", job.ID, unit.ID,
+			env.ID, job.Redact(err.Error()))
+
+		state.SetError(err.Error())
+		skipDeploy(envState, "Skipped because the deploy's concurrency "+
+			"group could not be joined")
+
+		return nil, false
+	}
+
+	state.AddOutput(fmt.Sprintf("Holding %s concurrency group",
+		concurrency.GetGroup()))
+	state.Stage = models.Done
+
+	return lock, true
+}
+
+// checkFreezes checks if any freeze windows block a deploy. Deploys blocked
+// by a freeze window with the hold action pause the job, deploys blocked by a
+// window with the fail action fail. A job's FreezeOverride allows it to
+// deploy during freezes. Returns if the deploy can proceed, and if the job
+// paused.
+func (w *Worker) checkFreezes(job *models.Job, env models.EnvironmentConfig,
+	envState *models.EnvironmentState) (proceed bool, paused bool) {
+
+	windows, err := models.GetAllFreezeWindows(w.ctx, w.etcdKV)
+	if err != nil {
+		w.logger.Errorf("error retrieving freeze windows, Job.ID: %#v, "+
+			"error: %s", job.ID, err.Error())
+
+		envState.FreezeState = models.NewActionState()
+		envState.FreezeState.SetError(fmt.Sprintf("Error checking "+
+			"freeze windows: %s", err.Error()))
+
+		return false, false
+	}
+
+	active := models.ActiveFreezeWindows(windows, job.ID.RepositoryID,
+		env.ID, time.Now())
+
+	if len(active) == 0 {
+		if envState.FreezeState != nil &&
+			envState.FreezeState.Stage == models.Frozen {
+
+			envState.FreezeState.AddOutput("Freeze ended")
+			envState.FreezeState.Stage = models.Done
+		}
+
+		return true, false
+	}
+
+	if envState.FreezeState == nil {
+		envState.FreezeState = models.NewActionState()
+	}
+
+	state := envState.FreezeState
+
+	// Break glass
+	if job.FreezeOverride != nil {
+		for _, window := range active {
+			state.AddOutput(fmt.Sprintf("Freeze window %d (%s) "+
+				"overridden by %s: %s", window.ID, window.Reason,
+				job.FreezeOverride.User,
+				job.FreezeOverride.Reason))
+		}
+
+		state.Stage = models.Done
+
+		return true, false
+	}
+
+	// Fail
+	for _, window := range active {
+		if window.GetAction() == models.FreezeFail {
+			state.SetError(fmt.Sprintf("Deploys to %s are frozen by "+
+				"freeze window %d: %s", env.ID, window.ID,
+				window.Reason))
+
+			return false, false
+		}
+	}
+
+	// Hold
+	if state.Stage != models.Frozen {
+		for _, window := range active {
+			state.AddOutput(fmt.Sprintf("Deploys to %s are frozen by "+
+				"freeze window %d: %s", env.ID, window.ID,
+				window.Reason))
+		}
+
+		state.AddOutput("Waiting for freeze to end")
+		state.Stage = models.Frozen
+	}
+
+	return false, true
+}
+
+// checkApproval requests approval for a deploy the first time it is reached,
+// then applies the decision once one is made. Returns paused true if the
+// deploy is still awaiting a decision, otherwise returns if the deploy was
+// approved.
+func (w *Worker) checkApproval(unit models.UnitConfig,
+	env models.EnvironmentConfig,
+	envState *models.EnvironmentState) (approved bool, paused bool) {
+
+	state := envState.ApprovalState
+	now := time.Now()
+
+	// Request
+	if envState.Approval == nil {
+		timeout := w.cfg.ApprovalTimeout
+
+		approvalCfg := unit.ApprovalFor(env)
+		if approvalCfg != nil && len(approvalCfg.Timeout) > 0 {
+			// Validated when the configuration was parsed
+			timeout, _ = time.ParseDuration(approvalCfg.Timeout)
+		}
+
+		envState.Approval = models.NewApproval(now, timeout)
+
+		state.Stage = models.AwaitingApproval
+		state.AddOutput(fmt.Sprintf("Waiting for approval to deploy to "+
+			"%s, expires at %s", env.ID,
+			envState.Approval.ExpiresAt.Format(time.RFC3339)))
+
+		return false, true
+	}
+
+	// Decision
+	approval := envState.Approval
+
+	switch approval.Decision {
+	case models.ApprovalApproved:
+		state.AddOutput(fmt.Sprintf("Approved by %s: %s", approval.User,
+			approval.Comment))
+		state.Stage = models.Done
+
+		return true, false
+	case models.ApprovalRejected:
+		state.SetError(fmt.Sprintf("Rejected by %s: %s", approval.User,
+			approval.Comment))
+
+		return false, false
+	case models.ApprovalExpired:
+		// Recorded by the JobResumer, so it can not overwrite a
+		// decision made at the same time
+		state.SetError(fmt.Sprintf("Approval expired at %s",
+			approval.ExpiresAt.Format(time.RFC3339)))
+
+		return false, false
+	}
+
+	return false, true
+}
+
+// recordDeploy saves a unit which successfully deployed as the unit's last
+// successful deploy to the environment
+func (w *Worker) recordDeploy(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig) {
+
+	if unit.Helm == nil && unit.Kubernetes == nil && unit.Kustomize == nil {
+		return
+	}
+
+	envState := environmentState(job, unit, env)
+
+	deploy := models.SuccessfulDeploy{
+		RepositoryID:   job.ID.RepositoryID,
+		Environment:    env.ID,
+		Branch:         job.Target.Branch,
+		Tag:            job.Target.Tag,
+		UnitID:         unit.ID,
+		JobID:          job.ID.ID,
+		Commit:         job.Target.Commit,
+		HelmRevision:   envState.HelmRevision,
+		ManifestDigest: envState.ManifestDigest,
+	}
+
+	err := deploy.Set(w.ctx, w.etcdKV)
+	if err != nil {
+		w.logger.Errorf("error recording successful deploy, Job.ID: "+
+			"%#v, unit: %s, environment: %s, error: %s", job.ID,
+			unit.ID, env.ID, err.Error())
+	}
+}
+
+// rollback runs a RollbackAction for a unit which failed to deploy to an
+// environment
+func (w *Worker) rollback(job *models.Job, unit models.UnitConfig,
+	env models.EnvironmentConfig) {
+
+	envState := environmentState(job, unit, env)
+	envState.RollbackState = models.NewActionState()
+
+	// Rollbacks still run if the deploy failed because the job timed out
+	timeout := w.actionTimeout(unit, "rollback")
+	ctx, cancel := withTimeout(w.ctx, timeout)
+	defer cancel()
+
+	newAction := w.withCluster(env, func(ctx context.Context,
+		cluster *libkube.Cluster) DeployAction {
+
+		return NewRollbackAction(ctx, w.logger, w.etcdKV, cluster,
+			w.secretsBox, w.cfg.KubeConfig)
+	})
+
+	action, err := newAction(ctx)
+	if err == nil {
+		err = action.Run(job, unit, env, envState.RollbackState)
+	}
+
+	err = w.timeoutError(w.ctx, ctx, timeout, err)
+
+	if err != nil {
+		w.logger.Errorf("error running rollback action, Job.ID: %#v, "+
+			"unit: %s, environment: %s, error: %s", job.ID, unit.ID,
+			env.ID, job.Redact(err.Error()))
+
+		envState.RollbackState.SetError(err.Error())
+	}
+
+	w.save(job, fmt.Sprintf("unit %s environment %s rollback action",
+		unit.ID, env.ID))
+}
@@ -0,0 +1,96 @@
+// Package etcdtest runs Etcd servers for tests
+package etcdtest
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	etcd "go.etcd.io/etcd/client"
+	"go.etcd.io/etcd/embed"
+)
+
+// StartTimeout is how long to wait for an Etcd server to start
+const StartTimeout time.Duration = 30 * time.Second
+
+// Server is an embedded Etcd server with the v2 API enabled
+type Server struct {
+	// etcd is the embedded server
+	etcd *embed.Etcd
+
+	// dir holds the server's data
+	dir string
+
+	// endpoint is the URL clients connect to
+	endpoint string
+}
+
+// Start starts an Etcd server which listens on random local ports. Fails the
+// test if the server does not start.
+func Start(t *testing.T) Server {
+	dir, err := ioutil.TempDir("", "etcdtest")
+	if err != nil {
+		t.Fatalf("error creating Etcd data directory: %s", err.Error())
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.EnableV2 = true
+	cfg.LogOutput = "default"
+
+	// Port 0 picks a free port. Advertised URLs keep their defaults, they
+	// are not used by a single member cluster.
+	listen, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*listen}
+	cfg.LPUrls = []url.URL{*listen}
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error starting Etcd: %s", err.Error())
+	}
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(StartTimeout):
+		server.Close()
+		os.RemoveAll(dir)
+		t.Fatal("timed out waiting for Etcd to start")
+	}
+
+	return Server{
+		etcd:     server,
+		dir:      dir,
+		endpoint: "http://" + server.Clients[0].Addr().String(),
+	}
+}
+
+// KeysAPI creates a new client for the server
+func (s Server) KeysAPI(t *testing.T) etcd.KeysAPI {
+	client, err := etcd.New(etcd.Config{
+		Endpoints:               []string{s.endpoint},
+		Transport:               etcd.DefaultTransport,
+		HeaderTimeoutPerRequest: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("error creating Etcd client: %s", err.Error())
+	}
+
+	return etcd.NewKeysAPI(client)
+}
+
+// Stop stops the server and deletes its data
+func (s Server) Stop() {
+	s.etcd.Close()
+	os.RemoveAll(s.dir)
+}
+
+// NewKeysAPI starts a server and creates a client for it. The returned
+// function stops the server.
+func NewKeysAPI(t *testing.T) (etcd.KeysAPI, func()) {
+	server := Start(t)
+
+	return server.KeysAPI(t), server.Stop
+}
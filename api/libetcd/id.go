@@ -0,0 +1,50 @@
+package libetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// NextID finds the next unused integer ID in a directory whose keys are
+// integers. Returns 0 if the directory is empty or does not exist.
+func NextID(ctx context.Context, etcdKV etcd.KeysAPI,
+	dir string) (int64, error) {
+
+	resp, err := etcdKV.Get(ctx, dir, &etcd.GetOptions{
+		Recursive: true,
+		Sort:      true,
+		Quorum:    true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("error querying IDs: %s", err.Error())
+	}
+
+	if resp.Node == nil {
+		return 0, errors.New("while finding next ID, result node was nil")
+	}
+
+	var highestID int64 = -1
+	for _, node := range resp.Node.Nodes {
+		keyParts := strings.Split(node.Key, "/")
+		idStr := keyParts[len(keyParts)-1]
+
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing ID to int, ID: %s, "+
+				"error: %s", idStr, err.Error())
+		}
+
+		if id > highestID {
+			highestID = id
+		}
+	}
+
+	return highestID + 1, nil
+}
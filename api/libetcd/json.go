@@ -23,20 +23,23 @@ func SetJSON(ctx context.Context, etcdKV etcd.KeysAPI, key string,
 	// Store in Etcd
 	_, err = etcdKV.Set(ctx, key, string(b[:]), nil)
 	if err != nil {
-		return fmt.Errorf("error saving value to Etcd", err.Error())
+		return fmt.Errorf("error saving value to Etcd: %s", err.Error())
 	}
 
 	return nil
 }
 
 // GetJSON retrieves a key from Etcd and decodes the value as JSON into
-// a struct
+// a struct. If the key does not exist the Etcd error is returned unwrapped so
+// callers can check it with etcd.IsKeyNotFound.
 func GetJSON(ctx context.Context, etcdKV etcd.KeysAPI, key string,
 	result interface{}) error {
 
 	// Load value from Etcd
 	resp, err := etcdKV.Get(ctx, key, &etcd.GetOptions{Quorum: true})
-	if err != nil {
+	if etcd.IsKeyNotFound(err) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("error retrieving value from Etcd: %s",
 			err.Error())
 	}
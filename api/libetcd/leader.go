@@ -0,0 +1,135 @@
+package libetcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Noah-Huppert/golog"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// LeaderTTL is how long a leader stays elected without refreshing its key.
+// If a leader stops another candidate is elected after this long.
+const LeaderTTL time.Duration = 15 * time.Second
+
+// LeaderRefreshInterval is how often the leader refreshes its key, and how
+// often other candidates try to become the leader
+const LeaderRefreshInterval time.Duration = 5 * time.Second
+
+// Elector elects one leader out of a group of processes using a key in Etcd.
+// The leader runs duties which must only run in one process at a time.
+type Elector struct {
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// key holds the ID of the leader
+	key string
+
+	// id identifies the process
+	id string
+}
+
+// NewElector creates a new Elector
+func NewElector(logger golog.Logger, etcdKV etcd.KeysAPI, key,
+	id string) Elector {
+
+	return Elector{
+		logger: logger,
+		etcdKV: etcdKV,
+		key:    key,
+		id:     id,
+	}
+}
+
+// Run campaigns to become the leader until the context is canceled. While
+// the process is the leader each duty runs in its own Go routine. The context
+// passed to duties is canceled when leadership is lost, duties should return
+// once it is.
+func (e Elector) Run(ctx context.Context,
+	duties ...func(ctx context.Context)) {
+
+	ticker := time.NewTicker(LeaderRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		// Campaign
+		_, err := e.etcdKV.Set(ctx, e.key, e.id, &etcd.SetOptions{
+			PrevExist: etcd.PrevNoExist,
+			TTL:       LeaderTTL,
+		})
+		if err == nil {
+			e.lead(ctx, ticker, duties)
+		} else if etcdErr, ok := err.(etcd.Error); !ok ||
+			etcdErr.Code != etcd.ErrorCodeNodeExist {
+
+			e.logger.Errorf("error campaigning for leadership: %s",
+				err.Error())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// lead runs duties until leadership is lost or the context is canceled
+func (e Elector) lead(ctx context.Context, ticker *time.Ticker,
+	duties []func(ctx context.Context)) {
+
+	e.logger.Infof("elected leader: %s", e.id)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	for _, duty := range duties {
+		wg.Add(1)
+
+		go func(duty func(ctx context.Context)) {
+			defer wg.Done()
+
+			duty(leaderCtx)
+		}(duty)
+	}
+
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.resign()
+			return
+		}
+
+		_, err := e.etcdKV.Set(ctx, e.key, e.id, &etcd.SetOptions{
+			PrevValue: e.id,
+			TTL:       LeaderTTL,
+		})
+		if err != nil {
+			e.logger.Errorf("lost leadership: %s", err.Error())
+			return
+		}
+	}
+}
+
+// resign gives up leadership so another candidate is elected without waiting
+// for LeaderTTL
+func (e Elector) resign() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Errors are ignored since the key expires after LeaderTTL
+	e.etcdKV.Delete(ctx, e.key, &etcd.DeleteOptions{
+		PrevValue: e.id,
+	})
+}
@@ -0,0 +1,97 @@
+package libetcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// MaxUpdateAttempts is how many times UpdateJSON tries to save a value which
+// other writers keep modifying
+const MaxUpdateAttempts int = 10
+
+// ErrTooManyConflicts indicates a value was modified by other writers every
+// time UpdateJSON tried to save it
+var ErrTooManyConflicts error = errors.New("value was modified by other " +
+	"writers too many times")
+
+// IsCompareFailed indicates if an Etcd error was caused by a compare and
+// swap condition, like SetOptions.PrevIndex, not holding
+func IsCompareFailed(err error) bool {
+	if cErr, ok := err.(etcd.Error); ok {
+		return cErr.Code == etcd.ErrorCodeTestFailed
+	}
+
+	return false
+}
+
+// IsNodeExists indicates if an Etcd error was caused by a key existing when
+// SetOptions.PrevExist is etcd.PrevNoExist
+func IsNodeExists(err error) bool {
+	if cErr, ok := err.(etcd.Error); ok {
+		return cErr.Code == etcd.ErrorCodeNodeExist
+	}
+
+	return false
+}
+
+// UpdateJSON retrieves a key's JSON value into result, calls update to
+// modify result, then saves result only if the key was not modified since it
+// was retrieved. If it was, the value is retrieved again and update is called
+// again, at most MaxUpdateAttempts times. Errors returned by update, and the
+// Etcd error if the key does not exist, are returned unwrapped.
+func UpdateJSON(ctx context.Context, etcdKV etcd.KeysAPI, key string,
+	result interface{}, update func() error) error {
+
+	for attempt := 0; attempt < MaxUpdateAttempts; attempt++ {
+		// Retrieve
+		resp, err := etcdKV.Get(ctx, key, &etcd.GetOptions{Quorum: true})
+		if etcd.IsKeyNotFound(err) {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("error retrieving value from Etcd: %s",
+				err.Error())
+		}
+
+		// Clear values left by the previous attempt
+		value := reflect.ValueOf(result).Elem()
+		value.Set(reflect.Zero(value.Type()))
+
+		err = json.Unmarshal([]byte(resp.Node.Value), result)
+		if err != nil {
+			return fmt.Errorf("error unmarshalling JSON value: %s",
+				err.Error())
+		}
+
+		// Update
+		err = update()
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("error marshalling value to JSON: %s",
+				err.Error())
+		}
+
+		// Save if not modified
+		_, err = etcdKV.Set(ctx, key, string(b), &etcd.SetOptions{
+			PrevIndex: resp.Node.ModifiedIndex,
+		})
+		if IsCompareFailed(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error saving value to Etcd: %s",
+				err.Error())
+		}
+
+		return nil
+	}
+
+	return ErrTooManyConflicts
+}
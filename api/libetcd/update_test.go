@@ -0,0 +1,107 @@
+package libetcd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+)
+
+// counter is a value updated by tests
+type counter struct {
+	// Count is incremented by each update
+	Count int `json:"count"`
+
+	// Writers holds the name of each writer which updated the counter
+	Writers map[string]bool `json:"writers"`
+}
+
+func TestUpdateJSONRetriesOnConflict(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	err := libetcd.SetJSON(ctx, etcdKV, "/counter", counter{
+		Writers: map[string]bool{},
+	})
+	if err != nil {
+		t.Fatalf("error saving counter: %s", err.Error())
+	}
+
+	var value counter
+	attempts := 0
+
+	err = libetcd.UpdateJSON(ctx, etcdKV, "/counter", &value, func() error {
+		attempts++
+
+		// Another writer modifies the counter during the first attempt
+		if attempts == 1 {
+			var other counter
+
+			err := libetcd.UpdateJSON(ctx, etcdKV, "/counter", &other,
+				func() error {
+					other.Count++
+					other.Writers["other"] = true
+
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("error updating counter: %s", err.Error())
+			}
+		}
+
+		value.Count++
+		value.Writers["test"] = true
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error updating counter: %s", err.Error())
+	}
+
+	if attempts != 2 {
+		t.Errorf("expected 2 update attempts, was %d", attempts)
+	}
+
+	var saved counter
+
+	err = libetcd.GetJSON(ctx, etcdKV, "/counter", &saved)
+	if err != nil {
+		t.Fatalf("error retrieving counter: %s", err.Error())
+	}
+
+	if saved.Count != 2 || !saved.Writers["other"] || !saved.Writers["test"] {
+		t.Errorf("expected both updates to be saved, counter: %#v", saved)
+	}
+}
+
+func TestUpdateJSONTooManyConflicts(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	err := libetcd.SetJSON(ctx, etcdKV, "/counter", counter{})
+	if err != nil {
+		t.Fatalf("error saving counter: %s", err.Error())
+	}
+
+	var value counter
+
+	err = libetcd.UpdateJSON(ctx, etcdKV, "/counter", &value, func() error {
+		// Modified by another writer every attempt
+		_, err := etcdKV.Set(ctx, "/counter", "{}", nil)
+		if err != nil {
+			t.Fatalf("error saving counter: %s", err.Error())
+		}
+
+		value.Count++
+
+		return nil
+	})
+	if err != libetcd.ErrTooManyConflicts {
+		t.Errorf("expected ErrTooManyConflicts, was %v", err)
+	}
+}
@@ -17,25 +17,38 @@ var ErrNoAuth error = errors.New("not authenticated")
 
 // NewClient makes a new GitHub client with authentication
 func NewClient(ctx context.Context, etcdKV etcd.KeysAPI) (*github.Client, error) {
-	// Get GitHub auth token from Etcd
+	authToken, err := GetToken(ctx, etcdKV)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTokenClient(ctx, authToken), nil
+}
+
+// GetToken retrieves the stored GitHub auth token. Returns ErrNoAuth if no
+// user is authenticated.
+func GetToken(ctx context.Context, etcdKV etcd.KeysAPI) (string, error) {
 	resp, err := etcdKV.Get(ctx, libetcd.KeyGitHubAuthToken,
 		&etcd.GetOptions{
 			Quorum: true,
 		})
 	if etcd.IsKeyNotFound(err) {
-		return nil, ErrNoAuth
+		return "", ErrNoAuth
 	} else if err != nil {
-		return nil, fmt.Errorf("error retrieving GitHub auth token"+
+		return "", fmt.Errorf("error retrieving GitHub auth token"+
 			" from Etcd: %s", err.Error())
 	}
 
-	authToken := resp.Node.Value
+	return resp.Node.Value, nil
+}
 
-	// Create GitHub client
+// NewTokenClient makes a new GitHub client which authenticates with a
+// GitHub auth token
+func NewTokenClient(ctx context.Context, authToken string) *github.Client {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: authToken},
 	)
 	tc := oauth2.NewClient(ctx, ts)
 
-	return github.NewClient(tc), nil
+	return github.NewClient(tc)
 }
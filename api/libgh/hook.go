@@ -0,0 +1,55 @@
+package libgh
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+
+	"github.com/google/go-github/github"
+)
+
+// WebHookConfig returns the configuration of the GitHub web hook which
+// sends a repository's events to the public API
+func WebHookConfig(cfg *config.Config, owner,
+	name string) (map[string]interface{}, error) {
+
+	hookURL, err := url.Parse(cfg.PublicHTTPHost)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public HTTP host into "+
+			"URL: %s", err.Error())
+	}
+
+	noSSLVerify := 1
+	if cfg.PublicHTTPSSLEnabled {
+		hookURL.Scheme = "https"
+		noSSLVerify = 0
+	}
+
+	hookURL.Path = fmt.Sprintf("/api/v0/github/repositories/%s/%s/web_hook",
+		owner, name)
+
+	return map[string]interface{}{
+		"url":          hookURL.String(),
+		"content_type": "json",
+		"insecure_ssl": noSSLVerify,
+	}, nil
+}
+
+// WebHookCurrent indicates if a web hook is active and has the values of a
+// configuration returned by WebHookConfig. GitHub returns some numbers as
+// strings, so values are compared as strings.
+func WebHookCurrent(hook *github.Hook, hookCfg map[string]interface{}) bool {
+	if hook.Active != nil && !*hook.Active {
+		return false
+	}
+
+	for key, value := range hookCfg {
+		current, ok := hook.Config[key]
+		if !ok || fmt.Sprint(current) != fmt.Sprint(value) {
+			return false
+		}
+	}
+
+	return true
+}
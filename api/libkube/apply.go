@@ -0,0 +1,440 @@
+package libkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager is the name kube-git-deploy uses when server side applying
+// resources
+const FieldManager string = "kube-git-deploy"
+
+// LabelRepository is the label added to applied resources which identifies
+// the repository they were deployed from
+const LabelRepository string = "kube-git-deploy/repository"
+
+// LabelUnit is the label added to applied resources which identifies the
+// unit they were deployed by
+const LabelUnit string = "kube-git-deploy/unit"
+
+// LabelEnvironment is the label added to applied resources which identifies
+// the environment they were deployed to
+const LabelEnvironment string = "kube-git-deploy/environment"
+
+// DefaultPruneKinds are the resource kinds which are checked for resources
+// to prune, in addition to the kinds present in the applied manifests
+var DefaultPruneKinds []schema.GroupVersionKind = []schema.GroupVersionKind{
+	{Group: "", Version: "v1", Kind: "ConfigMap"},
+	{Group: "", Version: "v1", Kind: "Secret"},
+	{Group: "", Version: "v1", Kind: "Service"},
+	{Group: "", Version: "v1", Kind: "ServiceAccount"},
+	{Group: "", Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "batch", Version: "v1beta1", Kind: "CronJob"},
+	{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"},
+	{Group: "autoscaling", Version: "v1", Kind: "HorizontalPodAutoscaler"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+}
+
+// labelValueInvalidChars matches characters which are not allowed in label
+// values
+var labelValueInvalidChars *regexp.Regexp = regexp.MustCompile("[^A-Za-z0-9-_.]+")
+
+// LabelValue converts a string into a valid label value
+func LabelValue(s string) string {
+	s = labelValueInvalidChars.ReplaceAllString(s, "-")
+
+	// Label values can be at most 63 characters
+	if len(s) > 63 {
+		s = s[:63]
+	}
+
+	return strings.Trim(s, "-_.")
+}
+
+// ReadManifestDir decodes all the manifest files in a directory. Files ending
+// in .yaml, .yml, or .json are read in name order.
+func ReadManifestDir(dir string) ([]*unstructured.Unstructured, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing manifest directory: %s",
+			err.Error())
+	}
+
+	objs := []*unstructured.Unstructured{}
+
+	for _, fileInfo := range fileInfos {
+		ext := filepath.Ext(fileInfo.Name())
+		if fileInfo.IsDir() ||
+			(ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		path := filepath.Join(dir, fileInfo.Name())
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening manifest file %s: %s",
+				fileInfo.Name(), err.Error())
+		}
+
+		fileObjs, err := DecodeManifests(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding manifest file %s: "+
+				"%s", fileInfo.Name(), err.Error())
+		}
+
+		objs = append(objs, fileObjs...)
+	}
+
+	return objs, nil
+}
+
+// DecodeManifests decodes a stream of YAML or JSON documents into objects.
+// Empty documents are skipped.
+func DecodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	decoder := k8syaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	objs := []*unstructured.Unstructured{}
+
+	for {
+		var doc map[string]interface{}
+
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding document %d: %s",
+				len(objs), err.Error())
+		}
+
+		if len(doc) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: doc}
+
+		if len(obj.GetKind()) == 0 || len(obj.GetName()) == 0 {
+			return nil, fmt.Errorf("document %d is missing a kind "+
+				"or metadata.name", len(objs))
+		}
+
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// SubstituteImage replaces the image of every container in an object whose
+// image repository is one of names. If no names are provided the image
+// repository of image is used. Returns descriptions of the replacements made.
+func SubstituteImage(obj *unstructured.Unstructured, image string,
+	names ...string) []string {
+
+	repos := map[string]bool{}
+
+	for _, name := range names {
+		repos[models.ImageRepository(name)] = true
+	}
+
+	if len(repos) == 0 {
+		repos[models.ImageRepository(image)] = true
+	}
+
+	return substituteImage(obj.Object, repos, image)
+}
+
+// substituteImage recursively searches a value for container lists
+func substituteImage(value interface{}, repos map[string]bool,
+	image string) []string {
+
+	changes := []string{}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if key == "containers" || key == "initContainers" {
+				changes = append(changes,
+					substituteContainerImages(child, repos,
+						image)...)
+				continue
+			}
+
+			changes = append(changes, substituteImage(child, repos,
+				image)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			changes = append(changes, substituteImage(child, repos,
+				image)...)
+		}
+	}
+
+	return changes
+}
+
+// substituteContainerImages replaces images in a list of containers
+func substituteContainerImages(value interface{}, repos map[string]bool,
+	image string) []string {
+
+	changes := []string{}
+
+	containers, ok := value.([]interface{})
+	if !ok {
+		return changes
+	}
+
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		current, ok := container["image"].(string)
+		if !ok || !repos[models.ImageRepository(current)] || current == image {
+			continue
+		}
+
+		container["image"] = image
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s",
+			container["name"], current, image))
+	}
+
+	return changes
+}
+
+// ApplyResult describes the changes made by Applier.Apply
+type ApplyResult struct {
+	// Applied holds descriptions of the resources which were applied
+	Applied []string
+
+	// Pruned holds descriptions of the resources which were deleted
+	Pruned []string
+}
+
+// Applier server side applies sets of resources. Resources which were part
+// of a previously applied set, but are not part of the current set, are
+// pruned.
+type Applier struct {
+	// cluster holds the Kubernetes API clients
+	cluster *Cluster
+}
+
+// NewApplier creates a new Applier
+func NewApplier(cluster *Cluster) Applier {
+	return Applier{
+		cluster: cluster,
+	}
+}
+
+// resourceKey uniquely identifies a resource
+func resourceKey(gk schema.GroupKind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", gk.String(), namespace, name)
+}
+
+// describe returns a human readable name for a resource
+func describe(obj *unstructured.Unstructured) string {
+	if len(obj.GetNamespace()) > 0 {
+		return fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(),
+			obj.GetName())
+	}
+
+	return fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName())
+}
+
+// resourceClient returns the dynamic client for a resource. Sets the
+// namespace of namespaced objects which do not have one.
+func (a Applier) resourceClient(obj *unstructured.Unstructured,
+	namespace string) (dynamic.ResourceInterface, *meta.RESTMapping,
+	error) {
+
+	gvk := obj.GroupVersionKind()
+
+	mapping, err := a.cluster.Mapper.RESTMapping(gvk.GroupKind(),
+		gvk.Version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding API resource for "+
+			"%s: %s", gvk.String(), err.Error())
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return a.cluster.Dynamic.Resource(mapping.Resource), mapping,
+			nil
+	}
+
+	if len(obj.GetNamespace()) == 0 {
+		obj.SetNamespace(namespace)
+	}
+
+	return a.cluster.Dynamic.Resource(mapping.Resource).Namespace(
+		obj.GetNamespace()), mapping, nil
+}
+
+// Apply adds labels to objs and server side applies them. Namespaced objects
+// without a namespace are placed in namespace. Then resources in any
+// namespace with the same labels which are not in objs are deleted.
+func (a Applier) Apply(ctx context.Context, namespace string,
+	labels map[string]string,
+	objs []*unstructured.Unstructured) (ApplyResult, error) {
+
+	result := ApplyResult{
+		Applied: []string{},
+		Pruned:  []string{},
+	}
+
+	applied := map[string]bool{}
+	pruneKinds := map[schema.GroupVersionKind]bool{}
+
+	for _, gvk := range DefaultPruneKinds {
+		pruneKinds[gvk] = true
+	}
+
+	force := true
+
+	for _, obj := range objs {
+		// Add labels
+		objLabels := obj.GetLabels()
+		if objLabels == nil {
+			objLabels = map[string]string{}
+		}
+
+		for key, value := range labels {
+			objLabels[key] = value
+		}
+
+		obj.SetLabels(objLabels)
+
+		// Apply
+		client, mapping, err := a.resourceClient(obj, namespace)
+		if err != nil {
+			return result, err
+		}
+
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return result, fmt.Errorf("error marshalling %s to "+
+				"JSON: %s", describe(obj), err.Error())
+		}
+
+		_, err = client.Patch(ctx, obj.GetName(), types.ApplyPatchType,
+			data, metav1.PatchOptions{
+				FieldManager: FieldManager,
+				Force:        &force,
+			})
+		if err != nil {
+			return result, fmt.Errorf("error applying %s: %s",
+				describe(obj), err.Error())
+		}
+
+		applied[resourceKey(mapping.GroupVersionKind.GroupKind(),
+			obj.GetNamespace(), obj.GetName())] = true
+		pruneKinds[mapping.GroupVersionKind] = true
+
+		result.Applied = append(result.Applied, describe(obj))
+	}
+
+	// Prune
+	pruned, err := a.prune(ctx, labels, pruneKinds, applied)
+	result.Pruned = pruned
+	if err != nil {
+		return result, fmt.Errorf("error pruning resources: %w", err)
+	}
+
+	return result, nil
+}
+
+// prune deletes resources of the given kinds which have labels but are not
+// in applied. Namespaced resources are listed in all namespaces, since
+// objects may set their own namespace. Kinds the cluster does not serve are
+// skipped.
+func (a Applier) prune(ctx context.Context, labels map[string]string,
+	kinds map[schema.GroupVersionKind]bool,
+	applied map[string]bool) ([]string, error) {
+
+	pruned := []string{}
+	selector := k8slabels.SelectorFromSet(labels).String()
+
+	// Sort kinds so resources are pruned in a consistent order
+	sortedKinds := []schema.GroupVersionKind{}
+	for gvk := range kinds {
+		sortedKinds = append(sortedKinds, gvk)
+	}
+
+	sort.Slice(sortedKinds, func(i, j int) bool {
+		return sortedKinds[i].String() < sortedKinds[j].String()
+	})
+
+	for _, gvk := range sortedKinds {
+		mapping, err := a.cluster.Mapper.RESTMapping(gvk.GroupKind(),
+			gvk.Version)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return pruned, fmt.Errorf("error finding API resource "+
+				"for %s: %s", gvk.String(), err.Error())
+		}
+
+		resource := a.cluster.Dynamic.Resource(mapping.Resource)
+
+		list, err := resource.List(ctx, metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return pruned, fmt.Errorf("error listing %s resources: %w",
+				gvk.Kind, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+
+			if applied[resourceKey(gvk.GroupKind(), obj.GetNamespace(),
+				obj.GetName())] {
+				continue
+			}
+
+			var client dynamic.ResourceInterface = resource
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				client = resource.Namespace(obj.GetNamespace())
+			}
+
+			propagation := metav1.DeletePropagationBackground
+
+			err = client.Delete(ctx, obj.GetName(),
+				metav1.DeleteOptions{
+					PropagationPolicy: &propagation,
+				})
+			if err != nil {
+				return pruned, fmt.Errorf("error deleting %s: %s",
+					describe(obj), err.Error())
+			}
+
+			pruned = append(pruned, describe(obj))
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,258 @@
+package libkube
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+// testNamespace is the namespace objects without a namespace are applied to
+const testNamespace string = "app"
+
+// configMapGVR is the API resource of ConfigMaps
+var configMapGVR schema.GroupVersionResource = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "configmaps",
+}
+
+// testLabels are the labels of the resources a test unit applies
+var testLabels map[string]string = map[string]string{
+	LabelRepository:  "owner.repo",
+	LabelUnit:        "api",
+	LabelEnvironment: "production",
+}
+
+// applyReaction handles server side apply patches, which the fake dynamic
+// client does not support, by creating or replacing the object. Other
+// actions are handled by tracker.
+func applyReaction(tracker ktesting.ObjectTracker) ktesting.ReactionFunc {
+	objectReaction := ktesting.ObjectReaction(tracker)
+
+	return func(action ktesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(ktesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return objectReaction(action)
+		}
+
+		obj := &unstructured.Unstructured{}
+
+		err := json.Unmarshal(patch.GetPatch(), &obj.Object)
+		if err != nil {
+			return true, nil, err
+		}
+
+		_, err = tracker.Get(action.GetResource(), action.GetNamespace(),
+			patch.GetName())
+		if err == nil {
+			err = tracker.Update(action.GetResource(), obj,
+				action.GetNamespace())
+		} else {
+			err = tracker.Create(action.GetResource(), obj,
+				action.GetNamespace())
+		}
+
+		return true, obj, err
+	}
+}
+
+// newTestCluster creates a Cluster with a fake dynamic client which holds
+// objects. The cluster serves ConfigMaps.
+func newTestCluster(t *testing.T, objects ...runtime.Object) *Cluster {
+	scheme := runtime.NewScheme()
+	client := dynamicfake.NewSimpleDynamicClient(scheme)
+
+	tracker := ktesting.NewObjectTracker(scheme,
+		serializer.NewCodecFactory(scheme).UniversalDecoder())
+
+	for _, obj := range objects {
+		err := tracker.Add(obj)
+		if err != nil {
+			t.Fatalf("error adding object: %s", err.Error())
+		}
+	}
+
+	client.PrependReactor("*", "*", applyReaction(tracker))
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{
+		Version: "v1",
+		Kind:    "ConfigMap",
+	}, meta.RESTScopeNamespace)
+
+	return &Cluster{
+		Dynamic: client,
+		Mapper:  mapper,
+	}
+}
+
+// newConfigMap creates a ConfigMap object. If namespace is empty the object
+// has no namespace.
+func newConfigMap(namespace, name string,
+	labels map[string]string) *unstructured.Unstructured {
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+
+	if labels != nil {
+		obj.SetLabels(labels)
+	}
+
+	return obj
+}
+
+// configMapNames returns the namespace and name of each ConfigMap in the
+// cluster, sorted
+func configMapNames(t *testing.T, cluster *Cluster) []string {
+	list, err := cluster.Dynamic.Resource(configMapGVR).List(
+		context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error listing ConfigMaps: %s", err.Error())
+	}
+
+	names := []string{}
+	for _, item := range list.Items {
+		names = append(names, item.GetNamespace()+"/"+item.GetName())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestApplyLabelsAndNamespaces(t *testing.T) {
+	cluster := newTestCluster(t)
+
+	result, err := NewApplier(cluster).Apply(context.Background(),
+		testNamespace, testLabels, []*unstructured.Unstructured{
+			newConfigMap("", "config", map[string]string{
+				"app": "api",
+			}),
+			newConfigMap("other", "config", nil),
+		})
+	if err != nil {
+		t.Fatalf("error applying: %s", err.Error())
+	}
+
+	expectedApplied := []string{
+		"ConfigMap app/config",
+		"ConfigMap other/config",
+	}
+	if !reflect.DeepEqual(result.Applied, expectedApplied) {
+		t.Errorf("expected applied %v, was %v", expectedApplied,
+			result.Applied)
+	}
+
+	expectedNames := []string{"app/config", "other/config"}
+	if names := configMapNames(t, cluster); !reflect.DeepEqual(names,
+		expectedNames) {
+
+		t.Errorf("expected ConfigMaps %v, were %v", expectedNames, names)
+	}
+
+	obj, err := cluster.Dynamic.Resource(configMapGVR).Namespace(
+		testNamespace).Get(context.Background(), "config",
+		metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error retrieving applied ConfigMap: %s", err.Error())
+	}
+
+	for key, value := range testLabels {
+		if obj.GetLabels()[key] != value {
+			t.Errorf("expected label %s=%s, labels: %v", key, value,
+				obj.GetLabels())
+		}
+	}
+
+	if obj.GetLabels()["app"] != "api" {
+		t.Errorf("expected the object's own labels to be kept, "+
+			"labels: %v", obj.GetLabels())
+	}
+}
+
+func TestApplyPrunesInAllNamespaces(t *testing.T) {
+	otherUnitLabels := map[string]string{}
+	for key, value := range testLabels {
+		otherUnitLabels[key] = value
+	}
+	otherUnitLabels[LabelUnit] = "worker"
+
+	cluster := newTestCluster(t,
+		// Applied by the unit to the environment namespace
+		newConfigMap(testNamespace, "kept", testLabels),
+		newConfigMap(testNamespace, "removed", testLabels),
+
+		// Applied by the unit with an explicit namespace
+		newConfigMap("other", "removed-elsewhere", testLabels),
+
+		// Not applied by the unit
+		newConfigMap("other", "other-unit", otherUnitLabels),
+		newConfigMap(testNamespace, "unlabeled", nil),
+	)
+
+	result, err := NewApplier(cluster).Apply(context.Background(),
+		testNamespace, testLabels, []*unstructured.Unstructured{
+			newConfigMap("", "kept", nil),
+		})
+	if err != nil {
+		t.Fatalf("error applying: %s", err.Error())
+	}
+
+	sort.Strings(result.Pruned)
+
+	expectedPruned := []string{
+		"ConfigMap app/removed",
+		"ConfigMap other/removed-elsewhere",
+	}
+	if !reflect.DeepEqual(result.Pruned, expectedPruned) {
+		t.Errorf("expected pruned %v, was %v", expectedPruned,
+			result.Pruned)
+	}
+
+	expectedNames := []string{
+		"app/kept",
+		"app/unlabeled",
+		"other/other-unit",
+	}
+	if names := configMapNames(t, cluster); !reflect.DeepEqual(names,
+		expectedNames) {
+
+		t.Errorf("expected ConfigMaps %v, were %v", expectedNames, names)
+	}
+}
+
+func TestApplyPrunesSameNameInOtherNamespace(t *testing.T) {
+	cluster := newTestCluster(t,
+		newConfigMap("other", "config", testLabels),
+	)
+
+	// The same name in another namespace is a different resource
+	_, err := NewApplier(cluster).Apply(context.Background(),
+		testNamespace, testLabels, []*unstructured.Unstructured{
+			newConfigMap("", "config", nil),
+		})
+	if err != nil {
+		t.Fatalf("error applying: %s", err.Error())
+	}
+
+	expectedNames := []string{"app/config"}
+	if names := configMapNames(t, cluster); !reflect.DeepEqual(names,
+		expectedNames) {
+
+		t.Errorf("expected ConfigMaps %v, were %v", expectedNames, names)
+	}
+}
@@ -0,0 +1,62 @@
+package libkube
+
+import (
+	"fmt"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewRESTConfig creates a Kubernetes API client configuration. Uses the
+// kubeconfig file at config.Config.KubeConfig if set, or the default
+// kubeconfig loading rules if only kubeContext is set. kubeContext selects a
+// context in the kubeconfig file, if empty the file's current context is
+// used. If neither are set uses the service account the process is running
+// as inside Kubernetes.
+func NewRESTConfig(cfg *config.Config, kubeContext string) (*rest.Config,
+	error) {
+
+	if len(cfg.KubeConfig) == 0 && len(kubeContext) == 0 {
+		restCfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error loading in cluster "+
+				"configuration: %s", err.Error())
+		}
+
+		return restCfg, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = cfg.KubeConfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	}
+
+	restCfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig file: %s", err.Error())
+	}
+
+	return restCfg, nil
+}
+
+// NewClient creates a Kubernetes API client for the default cluster
+func NewClient(cfg *config.Config) (kubernetes.Interface, error) {
+	restCfg, err := NewRESTConfig(cfg, "")
+	if err != nil {
+		return nil, fmt.Errorf("error creating client configuration: %s",
+			err.Error())
+	}
+
+	client, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %s", err.Error())
+	}
+
+	return client, nil
+}
@@ -0,0 +1,56 @@
+package libkube
+
+import (
+	"fmt"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// Cluster holds the clients used to manage resources in a Kubernetes
+// cluster. Fields are exported so fake clients can be used in their place.
+type Cluster struct {
+	// Client is a typed Kubernetes API client
+	Client kubernetes.Interface
+
+	// Dynamic is a Kubernetes API client for arbitrary resource types
+	Dynamic dynamic.Interface
+
+	// Mapper maps resource kinds to API resources
+	Mapper meta.RESTMapper
+}
+
+// NewCluster creates a Cluster using the Kubernetes API configuration
+// returned by NewRESTConfig. kubeContext selects the kubeconfig context, if
+// empty the default cluster is used.
+func NewCluster(cfg *config.Config, kubeContext string) (*Cluster, error) {
+	restCfg, err := NewRESTConfig(cfg, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client configuration: %s",
+			err.Error())
+	}
+
+	client, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %s", err.Error())
+	}
+
+	dynClient, err := dynamic.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic client: %s", err.Error())
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(
+		memory.NewMemCacheClient(client.Discovery()))
+
+	return &Cluster{
+		Client:  client,
+		Dynamic: dynClient,
+		Mapper:  mapper,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package libkube
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+// RenderKustomization builds the kustomization in a directory. Returns the
+// rendered resources as a multi document YAML manifest.
+func RenderKustomization(dir string) ([]byte, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resMap, err := kustomizer.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, fmt.Errorf("error building kustomization: %s", err.Error())
+	}
+
+	manifest, err := resMap.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("error encoding kustomization resources "+
+			"as YAML: %s", err.Error())
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,286 @@
+package libkube
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// RolloutKinds are the kinds of workloads whose rollouts can be checked
+var RolloutKinds map[string]bool = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+}
+
+// Workload identifies a Deployment, StatefulSet, or DaemonSet
+type Workload struct {
+	// Kind is the kind of workload
+	Kind string
+
+	// Namespace is the namespace of the workload
+	Namespace string
+
+	// Name is the name of the workload
+	Name string
+}
+
+// String returns a human readable description of the workload
+func (w Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// RolloutStatus describes the progress of a workload's rollout
+type RolloutStatus struct {
+	// Done indicates the rollout finished
+	Done bool
+
+	// Failed indicates the rollout can not finish without intervention
+	Failed bool
+
+	// Message describes the progress of the rollout
+	Message string
+
+	// Selector selects the workload's pods
+	Selector *metav1.LabelSelector
+}
+
+// GetRolloutStatus retrieves a workload and checks if it has fully rolled out.
+// Follows the same rules as kubectl rollout status.
+func GetRolloutStatus(ctx context.Context, cluster *Cluster,
+	workload Workload) (RolloutStatus, error) {
+
+	apps := cluster.Client.AppsV1()
+
+	switch workload.Kind {
+	case "Deployment":
+		d, err := apps.Deployments(workload.Namespace).Get(ctx,
+			workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, fmt.Errorf("error retrieving %s: %w",
+				workload, err)
+		}
+
+		return deploymentRolloutStatus(d), nil
+	case "StatefulSet":
+		s, err := apps.StatefulSets(workload.Namespace).Get(ctx,
+			workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, fmt.Errorf("error retrieving %s: %w",
+				workload, err)
+		}
+
+		return statefulSetRolloutStatus(s), nil
+	case "DaemonSet":
+		d, err := apps.DaemonSets(workload.Namespace).Get(ctx,
+			workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return RolloutStatus{}, fmt.Errorf("error retrieving %s: %w",
+				workload, err)
+		}
+
+		return daemonSetRolloutStatus(d), nil
+	}
+
+	return RolloutStatus{}, fmt.Errorf("cannot check rollout status of "+
+		"kind %s", workload.Kind)
+}
+
+// deploymentRolloutStatus checks a Deployment's rollout
+func deploymentRolloutStatus(d *appsv1.Deployment) RolloutStatus {
+	status := RolloutStatus{
+		Selector: d.Spec.Selector,
+	}
+
+	if d.Generation > d.Status.ObservedGeneration {
+		status.Message = "waiting for spec update to be observed"
+		return status
+	}
+
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing &&
+			cond.Reason == "ProgressDeadlineExceeded" {
+
+			status.Failed = true
+			status.Message = fmt.Sprintf("exceeded progress deadline: "+
+				"%s", cond.Message)
+			return status
+		}
+	}
+
+	var replicas int32 = 1
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+
+	if d.Status.UpdatedReplicas < replicas {
+		status.Message = fmt.Sprintf("%d of %d updated replicas",
+			d.Status.UpdatedReplicas, replicas)
+	} else if d.Status.Replicas > d.Status.UpdatedReplicas {
+		status.Message = fmt.Sprintf("%d old replicas pending "+
+			"termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	} else if d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		status.Message = fmt.Sprintf("%d of %d updated replicas "+
+			"available", d.Status.AvailableReplicas,
+			d.Status.UpdatedReplicas)
+	} else {
+		status.Done = true
+		status.Message = "successfully rolled out"
+	}
+
+	return status
+}
+
+// statefulSetRolloutStatus checks a StatefulSet's rollout
+func statefulSetRolloutStatus(s *appsv1.StatefulSet) RolloutStatus {
+	status := RolloutStatus{
+		Selector: s.Spec.Selector,
+	}
+
+	if s.Generation > s.Status.ObservedGeneration {
+		status.Message = "waiting for spec update to be observed"
+		return status
+	}
+
+	var replicas int32 = 1
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+
+	if s.Status.ReadyReplicas < replicas {
+		status.Message = fmt.Sprintf("%d of %d replicas ready",
+			s.Status.ReadyReplicas, replicas)
+		return status
+	}
+
+	// Partitioned rolling updates only update pods above the partition
+	rollingUpdate := s.Spec.UpdateStrategy.RollingUpdate
+	if s.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+		rollingUpdate != nil && rollingUpdate.Partition != nil {
+
+		partitioned := replicas - *rollingUpdate.Partition
+		if s.Status.UpdatedReplicas < partitioned {
+			status.Message = fmt.Sprintf("%d of %d partitioned "+
+				"replicas updated", s.Status.UpdatedReplicas,
+				partitioned)
+			return status
+		}
+
+		status.Done = true
+		status.Message = "partitioned roll out complete"
+		return status
+	}
+
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		status.Message = fmt.Sprintf("%d of %d replicas updated",
+			s.Status.UpdatedReplicas, replicas)
+		return status
+	}
+
+	status.Done = true
+	status.Message = "successfully rolled out"
+
+	return status
+}
+
+// daemonSetRolloutStatus checks a DaemonSet's rollout
+func daemonSetRolloutStatus(d *appsv1.DaemonSet) RolloutStatus {
+	status := RolloutStatus{
+		Selector: d.Spec.Selector,
+	}
+
+	if d.Generation > d.Status.ObservedGeneration {
+		status.Message = "waiting for spec update to be observed"
+		return status
+	}
+
+	if d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled {
+		status.Message = fmt.Sprintf("%d of %d updated pods scheduled",
+			d.Status.UpdatedNumberScheduled,
+			d.Status.DesiredNumberScheduled)
+	} else if d.Status.NumberAvailable < d.Status.DesiredNumberScheduled {
+		status.Message = fmt.Sprintf("%d of %d updated pods available",
+			d.Status.NumberAvailable, d.Status.DesiredNumberScheduled)
+	} else {
+		status.Done = true
+		status.Message = "successfully rolled out"
+	}
+
+	return status
+}
+
+// PodProblems returns descriptions of why a workload's pods are unhealthy.
+// Includes waiting or crashed containers and warning events.
+func PodProblems(ctx context.Context, cluster *Cluster, namespace string,
+	selector *metav1.LabelSelector) ([]string, error) {
+
+	problems := []string{}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pod selector: %s", err.Error())
+	}
+
+	pods, err := cluster.Client.CoreV1().Pods(namespace).List(ctx,
+		metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		// Container problems
+		statuses := append([]corev1.ContainerStatus{},
+			pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+		for _, cStatus := range statuses {
+			if waiting := cStatus.State.Waiting; waiting != nil &&
+				waiting.Reason != "ContainerCreating" &&
+				waiting.Reason != "PodInitializing" {
+
+				problems = append(problems, fmt.Sprintf("Pod %s "+
+					"container %s waiting: %s: %s", pod.Name,
+					cStatus.Name, waiting.Reason,
+					waiting.Message))
+			}
+
+			if term := cStatus.LastTerminationState.Terminated; term != nil &&
+				term.ExitCode != 0 {
+
+				problems = append(problems, fmt.Sprintf("Pod %s "+
+					"container %s terminated: %s, exit code %d "+
+					"(restarts: %d)", pod.Name, cStatus.Name,
+					term.Reason, term.ExitCode,
+					cStatus.RestartCount))
+			}
+		}
+
+		// Warning events
+		events, err := cluster.Client.CoreV1().Events(namespace).List(ctx,
+			metav1.ListOptions{
+				FieldSelector: fields.Set{
+					"involvedObject.kind": "Pod",
+					"involvedObject.name": pod.Name,
+					"type":                corev1.EventTypeWarning,
+				}.String(),
+			})
+		if err != nil {
+			return nil, fmt.Errorf("error listing events for pod %s: %w",
+				pod.Name, err)
+		}
+
+		for _, event := range events.Items {
+			problems = append(problems, fmt.Sprintf("Pod %s event: %s: "+
+				"%s (x%d)", pod.Name, event.Reason, event.Message,
+				event.Count))
+		}
+	}
+
+	return problems, nil
+}
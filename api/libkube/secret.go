@@ -0,0 +1,63 @@
+package libkube
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApplyImagePullSecret creates or updates a Secret of type
+// kubernetes.io/dockerconfigjson which Pods can use as an imagePullSecret.
+// dockerConfig is the contents of a Docker config.json file.
+func ApplyImagePullSecret(ctx context.Context, cluster *Cluster, namespace,
+	name string, labels map[string]string, dockerConfig []byte) error {
+
+	secrets := cluster.Client.CoreV1().Secrets(namespace)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: dockerConfig,
+		},
+	}
+
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{
+			FieldManager: FieldManager,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating secret: %w", err)
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error retrieving secret: %w", err)
+	}
+
+	// The type of a Secret cannot be changed
+	if existing.Type != corev1.SecretTypeDockerConfigJson {
+		return fmt.Errorf("secret %s/%s already exists with type %s",
+			namespace, name, existing.Type)
+	}
+
+	existing.Labels = labels
+	existing.Data = secret.Data
+
+	_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{
+		FieldManager: FieldManager,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating secret: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package libsecret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize is the number of bytes in a Box's key
+const KeySize int = 32
+
+// ErrNoKey indicates a Box was used without a key being configured
+var ErrNoKey error = errors.New("secrets key not configured")
+
+// Box encrypts and decrypts values with AES-256-GCM. The zero value has no
+// key and returns ErrNoKey from all methods.
+type Box struct {
+	// aead seals and opens values, nil if no key was configured
+	aead cipher.AEAD
+}
+
+// NewBox creates a Box from a base64 encoded key of KeySize bytes. If key is
+// empty a Box without a key is returned.
+func NewBox(key string) (Box, error) {
+	if len(key) == 0 {
+		return Box{}, nil
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return Box{}, fmt.Errorf("error decoding key as base64: %s",
+			err.Error())
+	}
+
+	if len(keyBytes) != KeySize {
+		return Box{}, fmt.Errorf("key must be %d bytes, was %d bytes",
+			KeySize, len(keyBytes))
+	}
+
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return Box{}, fmt.Errorf("error creating cipher: %s",
+			err.Error())
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return Box{}, fmt.Errorf("error creating GCM cipher: %s",
+			err.Error())
+	}
+
+	return Box{
+		aead: aead,
+	}, nil
+}
+
+// HasKey indicates if the Box was created with a key
+func (b Box) HasKey() bool {
+	return b.aead != nil
+}
+
+// Seal encrypts a value. The result is base64 encoded and starts with a
+// random nonce. additionalData is authenticated but not encrypted, the same
+// value must be passed to Open. It binds the ciphertext to where it is
+// stored, so a ciphertext copied to another key fails to open.
+func (b Box) Seal(value, additionalData string) (string, error) {
+	if b.aead == nil {
+		return "", ErrNoKey
+	}
+
+	nonce := make([]byte, b.aead.NonceSize())
+
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", fmt.Errorf("error generating nonce: %s", err.Error())
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(value),
+		[]byte(additionalData))
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal
+func (b Box) Open(sealed, additionalData string) (string, error) {
+	if b.aead == nil {
+		return "", ErrNoKey
+	}
+
+	sealedBytes, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("error decoding sealed value as base64: %s",
+			err.Error())
+	}
+
+	if len(sealedBytes) < b.aead.NonceSize() {
+		return "", errors.New("sealed value is too short")
+	}
+
+	nonce := sealedBytes[:b.aead.NonceSize()]
+
+	value, err := b.aead.Open(nil, nonce, sealedBytes[len(nonce):],
+		[]byte(additionalData))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting sealed value: %s",
+			err.Error())
+	}
+
+	return string(value), nil
+}
@@ -0,0 +1,155 @@
+package libsecret
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+// testKey generates a random base64 encoded key
+func testKey(t *testing.T) string {
+	key := make([]byte, KeySize)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err.Error())
+	}
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// testBox creates a Box with a random key
+func testBox(t *testing.T) Box {
+	box, err := NewBox(testKey(t))
+	if err != nil {
+		t.Fatalf("error creating box: %s", err.Error())
+	}
+
+	return box
+}
+
+func TestBoxRoundTrip(t *testing.T) {
+	box := testBox(t)
+
+	for _, value := range []string{"", "password", "multi\nline\x00value"} {
+		sealed, err := box.Seal(value, "/secrets/owner/repo/password")
+		if err != nil {
+			t.Fatalf("error sealing %q: %s", value, err.Error())
+		}
+
+		if len(value) > 0 && sealed == value {
+			t.Errorf("expected %q to be encrypted", value)
+		}
+
+		opened, err := box.Open(sealed, "/secrets/owner/repo/password")
+		if err != nil {
+			t.Fatalf("error opening %q: %s", value, err.Error())
+		}
+
+		if opened != value {
+			t.Errorf("expected opened value %q, got %q", value, opened)
+		}
+	}
+
+	// Nonces are random
+	first, err := box.Seal("password", "")
+	if err != nil {
+		t.Fatalf("error sealing: %s", err.Error())
+	}
+
+	second, err := box.Seal("password", "")
+	if err != nil {
+		t.Fatalf("error sealing: %s", err.Error())
+	}
+
+	if first == second {
+		t.Error("expected sealing the same value twice to differ")
+	}
+}
+
+func TestBoxOpenModified(t *testing.T) {
+	box := testBox(t)
+
+	sealed, err := box.Seal("password", "/secrets/owner/repo/password")
+	if err != nil {
+		t.Fatalf("error sealing: %s", err.Error())
+	}
+
+	sealedBytes, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatalf("error decoding sealed value: %s", err.Error())
+	}
+
+	// Flip one bit of the nonce, ciphertext, and tag
+	for _, i := range []int{0, len(sealedBytes) / 2,
+		len(sealedBytes) - 1} {
+
+		modified := append([]byte{}, sealedBytes...)
+		modified[i] ^= 1
+
+		_, err := box.Open(base64.StdEncoding.EncodeToString(modified),
+			"/secrets/owner/repo/password")
+		if err == nil {
+			t.Errorf("expected value modified at byte %d to fail to "+
+				"open", i)
+		}
+	}
+
+	// Truncated
+	_, err = box.Open(base64.StdEncoding.EncodeToString(sealedBytes[:4]),
+		"/secrets/owner/repo/password")
+	if err == nil {
+		t.Error("expected truncated value to fail to open")
+	}
+
+	// Moved to another key
+	_, err = box.Open(sealed, "/secrets/owner/repo/token")
+	if err == nil {
+		t.Error("expected value with different additional data to fail " +
+			"to open")
+	}
+}
+
+func TestBoxOpenWrongKey(t *testing.T) {
+	sealed, err := testBox(t).Seal("password", "")
+	if err != nil {
+		t.Fatalf("error sealing: %s", err.Error())
+	}
+
+	_, err = testBox(t).Open(sealed, "")
+	if err == nil {
+		t.Error("expected value sealed with another key to fail to open")
+	}
+}
+
+func TestNewBox(t *testing.T) {
+	box, err := NewBox("")
+	if err != nil {
+		t.Fatalf("error creating box without key: %s", err.Error())
+	}
+
+	if box.HasKey() {
+		t.Error("expected box created without key to have no key")
+	}
+
+	_, err = box.Seal("password", "")
+	if err != ErrNoKey {
+		t.Errorf("expected ErrNoKey sealing without key, got: %v", err)
+	}
+
+	_, err = box.Open("c2VhbGVk", "")
+	if err != ErrNoKey {
+		t.Errorf("expected ErrNoKey opening without key, got: %v", err)
+	}
+
+	for _, key := range []string{
+		"not base64",
+		base64.StdEncoding.EncodeToString(make([]byte, KeySize-1)),
+		base64.StdEncoding.EncodeToString(make([]byte, KeySize+1)),
+	} {
+		_, err := NewBox(key)
+		if err == nil {
+			t.Errorf("expected key %q to be invalid", key)
+		}
+	}
+}
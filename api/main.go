@@ -2,10 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/config"
 	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libkube"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
 	"github.com/Noah-Huppert/kube-git-deploy/api/models"
 	"github.com/Noah-Huppert/kube-git-deploy/api/server"
 
@@ -20,6 +31,20 @@ func main() {
 	// Setup logger
 	logger := golog.NewStdLogger("api")
 
+	// Seed random numbers, used to add jitter to retries
+	rand.Seed(time.Now().UnixNano())
+
+	// Validate a configuration file, does not need the API's configuration
+	// or Etcd
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
+	// Print the configuration file JSON Schema
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(runSchema())
+	}
+
 	// Load configuration
 	cfg, err := config.NewConfig()
 	if err != nil {
@@ -54,9 +79,85 @@ func main() {
 			"repositories key: %s", err.Error())
 	}
 
+	// Create secrets box
+	secretsBox, err := libsecret.NewBox(cfg.SecretsKey)
+	if err != nil {
+		logger.Fatalf("error loading SECRETS_KEY: %s", err.Error())
+	}
+
+	// Create image builder
+	imageBuilder, err := jobs.NewImageBuilder(cfg)
+	if err != nil {
+		logger.Fatalf("error creating image builder: %s", err.Error())
+	}
+
+	// Create job log store
+	var logStore models.LogStore
+
+	switch cfg.LogStore {
+	case "etcd":
+		logStore = models.NewEtcdLogStore(etcdKV)
+	case "file":
+		logStore = models.NewFileLogStore(cfg.LogDir)
+	default:
+		logger.Fatalf("unknown log store: %s", cfg.LogStore)
+	}
+
+	// Run a single job if started in worker mode
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorker(ctx, logger.GetChild("worker"), cfg, etcdKV,
+			logStore, secretsBox, imageBuilder, os.Args[2:])
+		return
+	}
+
+	// Create job executor
+	var executor jobs.Executor
+
+	switch cfg.JobExecutor {
+	case "process":
+		executor = jobs.NewInProcessExecutor(jobs.NewWorker(ctx,
+			logger.GetChild("worker"), cfg, etcdKV, logStore,
+			secretsBox, imageBuilder))
+	case "kubernetes":
+		if len(cfg.KubeWorkerImage) == 0 {
+			logger.Fatal("KUBE_WORKER_IMAGE must be set if " +
+				"JOB_EXECUTOR is kubernetes")
+		}
+
+		// Worker pods would write logs to their own disks, where the
+		// API can not read them
+		if cfg.LogStore == "file" {
+			logger.Fatal("LOG_STORE can not be file if " +
+				"JOB_EXECUTOR is kubernetes")
+		}
+
+		kubeClient, err := libkube.NewClient(cfg)
+		if err != nil {
+			logger.Fatalf("error creating Kubernetes client: %s",
+				err.Error())
+		}
+
+		executor = jobs.NewKubeExecutor(ctx,
+			logger.GetChild("kube_executor"), cfg, etcdKV, logStore,
+			kubeClient)
+	default:
+		logger.Fatalf("unknown job executor: %s", cfg.JobExecutor)
+	}
+
 	// Create JobRunner
+	runnerID := cfg.RunnerID
+	if len(runnerID) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Fatalf("error getting hostname for runner ID: %s",
+				err.Error())
+		}
+
+		runnerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
 	jobRunner := jobs.NewJobRunner(ctx, logger.GetChild("job_runner"),
-		etcdKV)
+		cfg, etcdKV, executor, runnerID)
 
 	go func() {
 		logger.Info("Starting job runner")
@@ -64,6 +165,25 @@ func main() {
 		jobRunner.Run()
 	}()
 
+	// Run singleton duties in the leader runner
+	jobResumer := jobs.NewJobResumer(logger.GetChild("job_resumer"),
+		etcdKV, jobRunner)
+
+	jobMonitor := jobs.NewJobMonitor(logger.GetChild("job_monitor"),
+		etcdKV, logStore, executor, jobRunner)
+
+	jobCollector := jobs.NewJobCollector(logger.GetChild("job_collector"),
+		etcdKV, logStore, cfg.JobHistoryLimit)
+
+	webHookReconciler := jobs.NewWebHookReconciler(
+		logger.GetChild("web_hook_reconciler"), cfg, etcdKV)
+
+	elector := libetcd.NewElector(logger.GetChild("elector"), etcdKV,
+		jobs.KeyRunnerLeader, runnerID)
+
+	go elector.Run(ctx, jobResumer.Run, jobMonitor.Run, jobCollector.Run,
+		webHookReconciler.Run)
+
 	// Run HTTP servers
 	serverReturns := make(chan string)
 
@@ -72,7 +192,8 @@ func main() {
 		logger.Infof("Starting private HTTP server on :%d",
 			cfg.PrivateHTTPPort)
 
-		privServer := server.NewPrivateServer(ctx, logger, cfg, etcdKV)
+		privServer := server.NewPrivateServer(ctx, logger, cfg, etcdKV,
+			logStore, secretsBox, jobRunner)
 
 		err = privServer.Run()
 		if err != nil {
@@ -103,3 +224,195 @@ func main() {
 		logger.Infof("%s server stopped", <-serverReturns)
 	}
 }
+
+// runWorker runs the job identified by args to completion. Used by worker
+// Kubernetes Jobs.
+func runWorker(ctx context.Context, logger golog.Logger, cfg *config.Config,
+	etcdKV etcd.KeysAPI, logStore models.LogStore, secretsBox libsecret.Box,
+	imageBuilder jobs.ImageBuilder, args []string) {
+
+	// Parse arguments
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+
+	owner := flags.String("owner", "", "GitHub user which owns the "+
+		"repository")
+	repo := flags.String("repo", "", "Name of repository")
+	jobID := flags.Int64("job", -1, "ID of job to run")
+
+	flags.Parse(args)
+
+	if len(*owner) == 0 || len(*repo) == 0 || *jobID < 0 {
+		logger.Fatal("-owner, -repo, and -job arguments required")
+	}
+
+	// Load job
+	job := models.Job{
+		ID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: *owner,
+				Name:  *repo,
+			},
+			ID: *jobID,
+		},
+	}
+
+	err := job.Get(ctx, etcdKV)
+	if err != nil {
+		logger.Fatalf("error retrieving job: %s", err.Error())
+	}
+
+	// Run
+	logger.Infof("Running job %#v", job.ID)
+
+	jobs.NewWorker(ctx, logger, cfg, etcdKV, logStore, secretsBox,
+		imageBuilder).Run(&job)
+
+	logger.Infof("Finished job %#v", job.ID)
+}
+
+// runValidate validates a local job configuration file, and prints
+// problems to stderr. Returns the process exit code, 1 if the file has
+// errors. Used by developers and pre-commit hooks.
+func runValidate(args []string) int {
+	// Parse arguments
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+
+	owner := flags.String("owner", "", "GitHub user which owns the "+
+		"repository, used to render templates")
+	repo := flags.String("repo", "", "Name of repository, used to render "+
+		"templates")
+	branch := flags.String("branch", "", "Git branch used to render "+
+		"templates")
+	tag := flags.String("tag", "", "Git tag used to render templates")
+	commit := flags.String("commit", "", "Git sha used to render "+
+		"templates")
+	asJSON := flags.Bool("json", false, "Print problems as JSON")
+	subdirectories := flags.Bool("subdirectories", false, "Validate and "+
+		"merge the configuration files in the current directory and "+
+		"its subdirectories, like a repository with subdirectories "+
+		"config discovery")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s validate [FLAGS] "+
+			"[FILE]\n\nFILE defaults to the configuration file in "+
+			"the current directory, one of: %s\n\n", os.Args[0],
+			strings.Join(models.JobConfigFileNames, ", "))
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	// Find files
+	cfgPaths := []string{}
+
+	if *subdirectories {
+		var err error
+		cfgPaths, err = models.FindJobConfigFiles(".")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error finding configuration "+
+				"files: %s\n", err.Error())
+			return 1
+		}
+	} else if flags.NArg() > 0 {
+		cfgPaths = []string{flags.Arg(0)}
+	} else {
+		cfgPath, err := models.FindJobConfigFile(".")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error finding configuration "+
+				"file: %s\n", err.Error())
+			return 1
+		}
+
+		cfgPaths = []string{cfgPath}
+	}
+
+	// Read files. The current directory is the repository root, files
+	// outside it are validated as if they were in the root.
+	files := map[string]string{}
+	filePaths := map[string]string{}
+
+	for _, cfgPath := range cfgPaths {
+		data, err := ioutil.ReadFile(cfgPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading %s: %s\n",
+				cfgPath, err.Error())
+			return 1
+		}
+
+		repoPath := filepath.ToSlash(filepath.Clean(cfgPath))
+		if filepath.IsAbs(cfgPath) || repoPath == ".." ||
+			strings.HasPrefix(repoPath, "../") {
+
+			repoPath = filepath.Base(cfgPath)
+		}
+
+		files[repoPath] = string(data)
+		filePaths[repoPath] = cfgPath
+	}
+
+	// Validate
+	diagnostics := models.DiagnoseJobConfigFiles(files,
+		models.NewValidationTemplateVars(models.RepositoryID{
+			Owner: *owner,
+			Name:  *repo,
+		}, models.JobTarget{
+			Branch: *branch,
+			Tag:    *tag,
+			Commit: *commit,
+		}))
+
+	exitCode := 0
+
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == models.SeverityError {
+			exitCode = 1
+		}
+
+		if *asJSON {
+			continue
+		}
+
+		location := filePaths[diagnostic.File]
+		if len(location) == 0 {
+			location = "merged configuration"
+		} else if diagnostic.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location,
+				diagnostic.Line)
+		}
+
+		message := diagnostic.Message
+		if len(diagnostic.Path) > 0 {
+			message = fmt.Sprintf("%s: %s", diagnostic.Path,
+				diagnostic.Message)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", location,
+			diagnostic.Severity, message)
+	}
+
+	if *asJSON {
+		err := json.NewEncoder(os.Stdout).Encode(diagnostics)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error encoding JSON: %s\n",
+				err.Error())
+			return 1
+		}
+	}
+
+	return exitCode
+}
+
+// runSchema prints the JSON Schema of job configuration files to stdout.
+// Returns the process exit code.
+func runSchema() int {
+	out, err := json.MarshalIndent(models.JobConfigSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error encoding JSON Schema: %s\n",
+			err.Error())
+		return 1
+	}
+
+	fmt.Println(string(out))
+
+	return 0
+}
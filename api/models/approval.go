@@ -0,0 +1,127 @@
+package models
+
+import (
+	"time"
+)
+
+// ApprovalConfig holds the config for a manual approval which must be given
+// before a unit is deployed
+type ApprovalConfig struct {
+	// Approvers are the GitHub users who can approve the deploy. If empty
+	// any user with write access to the repository can approve.
+	Approvers []string `json:"approvers" toml:"approvers"`
+
+	// Timeout is how long the approval can be given for before it
+	// expires. Formatted as a Go duration, ex: "2h". Defaults to the API's
+	// APPROVAL_TIMEOUT.
+	Timeout string `json:"timeout" toml:"timeout"`
+}
+
+// Validate checks the timeout is a valid duration
+func (c ApprovalConfig) Validate() error {
+	if len(c.Timeout) > 0 {
+		_, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return configErrorf("timeout", "invalid: %s",
+				err.Error())
+		}
+	}
+
+	return nil
+}
+
+// CanApprove indicates if a GitHub user is listed as an approver. Always
+// true if no approvers are listed.
+func (c ApprovalConfig) CanApprove(user string) bool {
+	if len(c.Approvers) == 0 {
+		return true
+	}
+
+	for _, approver := range c.Approvers {
+		if approver == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApprovalFor returns the approval required to deploy a unit to an
+// environment. The unit's approval takes precedence over the environment's.
+// Nil if no approval is required.
+func (c UnitConfig) ApprovalFor(env EnvironmentConfig) *ApprovalConfig {
+	if c.Approval != nil {
+		return c.Approval
+	}
+
+	return env.Approval
+}
+
+// ApprovalDecision is the outcome of an approval
+type ApprovalDecision string
+
+const (
+	// ApprovalPending indicates no decision has been made
+	ApprovalPending ApprovalDecision = ""
+
+	// ApprovalApproved indicates a user approved the deploy
+	ApprovalApproved ApprovalDecision = "approved"
+
+	// ApprovalRejected indicates a user rejected the deploy
+	ApprovalRejected ApprovalDecision = "rejected"
+
+	// ApprovalExpired indicates no decision was made before the approval
+	// expired
+	ApprovalExpired ApprovalDecision = "expired"
+)
+
+// Approval records a request for a user to approve a deploy, and their
+// decision
+type Approval struct {
+	// RequestedAt is when the job started waiting for approval
+	RequestedAt time.Time `json:"requested_at"`
+
+	// ExpiresAt is when the approval expires if no decision is made
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Decision is the outcome of the approval
+	Decision ApprovalDecision `json:"decision"`
+
+	// User is the GitHub user who made the decision. Empty if pending or
+	// expired.
+	User string `json:"user"`
+
+	// Comment is the reason the user gave for their decision
+	Comment string `json:"comment"`
+
+	// DecidedAt is when the decision was made. Nil if pending.
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+// NewApproval creates a pending Approval which expires after timeout
+func NewApproval(now time.Time, timeout time.Duration) *Approval {
+	return &Approval{
+		RequestedAt: now,
+		ExpiresAt:   now.Add(timeout),
+		Decision:    ApprovalPending,
+	}
+}
+
+// Expired indicates if the approval is pending and past its expiry time
+func (a Approval) Expired(now time.Time) bool {
+	return a.Decision == ApprovalPending && now.After(a.ExpiresAt)
+}
+
+// Decide records a user's decision
+func (a *Approval) Decide(now time.Time, approved bool, user,
+	comment string) {
+
+	a.Decision = ApprovalRejected
+	if approved {
+		a.Decision = ApprovalApproved
+	}
+
+	a.User = user
+	a.Comment = comment
+	a.DecidedAt = &now
+}
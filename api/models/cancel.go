@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// JobCancellation records a user canceling a job. Stored apart from the job
+// since the worker running the job overwrites it each time it saves.
+type JobCancellation struct {
+	// JobID is the job which was canceled
+	JobID JobID `json:"job_id"`
+
+	// User is the GitHub user who canceled the job
+	User string `json:"user"`
+
+	// Time is when the job was canceled
+	Time time.Time `json:"time"`
+}
+
+// cancellationKey returns the Etcd key which holds a job's cancellation
+func (i JobID) cancellationKey() string {
+	return fmt.Sprintf("%s/cancellations/%d", i.RepositoryID.key(), i.ID)
+}
+
+// Reason describes the cancellation in the output of the job's actions
+func (c JobCancellation) Reason() string {
+	return fmt.Sprintf("Canceled by %s", c.User)
+}
+
+// Set stores the cancellation in Etcd
+func (c JobCancellation) Set(ctx context.Context,
+	etcdKV etcd.KeysAPI) error {
+
+	return libetcd.SetJSON(ctx, etcdKV, c.JobID.cancellationKey(), c)
+}
+
+// GetJobCancellation retrieves a job's cancellation. Returns nil if the job
+// has not been canceled.
+func GetJobCancellation(ctx context.Context, etcdKV etcd.KeysAPI,
+	jobID JobID) (*JobCancellation, error) {
+
+	var c JobCancellation
+
+	err := libetcd.GetJSON(ctx, etcdKV, jobID.cancellationKey(), &c)
+	if etcd.IsKeyNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving job cancellation: %s",
+			err.Error())
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ConcurrencyKey is the top level key in a job configuration file which
+// holds concurrency config
+const ConcurrencyKey string = "concurrency"
+
+// ConcurrencyConfig controls how deploys from different jobs in the same
+// repository are kept from running at the same time. Deploys in the same
+// concurrency group run one at a time.
+type ConcurrencyConfig struct {
+	// Group decides which deploys share a concurrency group. One of the
+	// ConcurrencyGroup values. Defaults to GroupEnvironment.
+	Group ConcurrencyGroup `json:"group" toml:"group"`
+
+	// Policy decides what happens when a deploy joins a group which is in
+	// use. One of the ConcurrencyPolicy values. Defaults to PolicyQueue.
+	Policy ConcurrencyPolicy `json:"policy" toml:"policy"`
+}
+
+// ConcurrencyGroup decides which deploys share a concurrency group
+type ConcurrencyGroup string
+
+const (
+	// GroupEnvironment indicates all deploys to an environment share a
+	// group
+	GroupEnvironment ConcurrencyGroup = "environment"
+
+	// GroupUnit indicates deploys of a unit to an environment share a
+	// group
+	GroupUnit ConcurrencyGroup = "unit"
+)
+
+// ConcurrencyPolicy decides what happens when a deploy joins a concurrency
+// group which is in use
+type ConcurrencyPolicy string
+
+const (
+	// PolicyQueue indicates the deploy waits for earlier deploys to finish
+	PolicyQueue ConcurrencyPolicy = "queue"
+
+	// PolicyCancel indicates the deploy cancels the in progress deploy and
+	// any deploys waiting before it
+	PolicyCancel ConcurrencyPolicy = "cancel"
+
+	// PolicySupersede indicates the deploy replaces any deploys waiting
+	// before it, so only the newest waiting deploy runs after the in
+	// progress deploy
+	PolicySupersede ConcurrencyPolicy = "supersede"
+)
+
+// GetGroup returns the concurrency group, or the default if not set
+func (c ConcurrencyConfig) GetGroup() ConcurrencyGroup {
+	if len(c.Group) == 0 {
+		return GroupEnvironment
+	}
+
+	return c.Group
+}
+
+// GetPolicy returns the concurrency policy, or the default if not set
+func (c ConcurrencyConfig) GetPolicy() ConcurrencyPolicy {
+	if len(c.Policy) == 0 {
+		return PolicyQueue
+	}
+
+	return c.Policy
+}
+
+// Validate checks the group and policy are known values
+func (c ConcurrencyConfig) Validate() error {
+	switch c.GetGroup() {
+	case GroupEnvironment, GroupUnit:
+	default:
+		return configErrorf("group", "must be \"%s\" or \"%s\"",
+			GroupEnvironment, GroupUnit)
+	}
+
+	switch c.GetPolicy() {
+	case PolicyQueue, PolicyCancel, PolicySupersede:
+	default:
+		return configErrorf("policy", "must be \"%s\", \"%s\", or "+
+			"\"%s\"", PolicyQueue, PolicyCancel, PolicySupersede)
+	}
+
+	return nil
+}
+
+// GroupKey returns the Etcd directory which holds the queue of deploys in the
+// concurrency group of a unit's deploy to an environment
+func (c ConcurrencyConfig) GroupKey(repoID RepositoryID, unitID,
+	envID string) string {
+
+	if c.GetGroup() == GroupUnit {
+		return fmt.Sprintf("%s/concurrency/unit/%s/%s", repoID.key(),
+			url.PathEscape(unitID), url.PathEscape(envID))
+	}
+
+	return fmt.Sprintf("%s/concurrency/environment/%s", repoID.key(),
+		url.PathEscape(envID))
+}
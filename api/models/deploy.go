@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// SuccessfulDeploy records the last job which successfully deployed a unit
+// from a Git branch or tag to an environment. Used to find what to roll back
+// to.
+type SuccessfulDeploy struct {
+	// RepositoryID is the repository the unit is in
+	RepositoryID RepositoryID `json:"repository_id"`
+
+	// Environment is the environment the unit was deployed to
+	Environment string `json:"environment"`
+
+	// Branch is the Git branch which was deployed. Empty if a tag was
+	// deployed.
+	Branch string `json:"branch"`
+
+	// Tag is the Git tag which was deployed. Empty if a branch was
+	// deployed.
+	Tag string `json:"tag"`
+
+	// UnitID is the unit which was deployed
+	UnitID string `json:"unit_id"`
+
+	// JobID is the ID of the job which deployed the unit
+	JobID int64 `json:"job_id"`
+
+	// Commit is the Git sha which was deployed
+	Commit string `json:"commit"`
+
+	// HelmRevision is the revision of the unit's Helm release. 0 if the
+	// unit does not have a Helm action.
+	HelmRevision int `json:"helm_revision"`
+
+	// ManifestDigest is the SHA256 sum of the RenderedManifest which was
+	// deployed. Empty if the unit did not render a manifest.
+	ManifestDigest string `json:"manifest_digest"`
+}
+
+// refKey returns the part of the deploy's Etcd key which identifies the
+// deployed Git branch or tag
+func (d SuccessfulDeploy) refKey() string {
+	if len(d.Tag) > 0 {
+		return fmt.Sprintf("tags/%s", url.PathEscape(d.Tag))
+	}
+
+	return fmt.Sprintf("branches/%s", url.PathEscape(d.Branch))
+}
+
+// key returns the Etcd key the deploy is stored in
+func (d SuccessfulDeploy) key() string {
+	return fmt.Sprintf("%s/deploys/%s/%s/%s", d.RepositoryID.key(),
+		url.PathEscape(d.Environment), d.refKey(),
+		url.PathEscape(d.UnitID))
+}
+
+// Set stores a deploy in Etcd
+func (d SuccessfulDeploy) Set(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	return libetcd.SetJSON(ctx, etcdKV, d.key(), d)
+}
+
+// Get retrieves a deploy from Etcd. The RepositoryID, Environment, Branch or
+// Tag, and UnitID fields must be set for this method to work properly. Returns false if no
+// deploy has been recorded.
+func (d *SuccessfulDeploy) Get(ctx context.Context,
+	etcdKV etcd.KeysAPI) (bool, error) {
+
+	err := libetcd.GetJSON(ctx, etcdKV, d.key(), d)
+	if etcd.IsKeyNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetSuccessfulDeploys retrieves the deploys recorded for every unit,
+// environment, and Git branch or tag of a repository
+func GetSuccessfulDeploys(ctx context.Context, etcdKV etcd.KeysAPI,
+	repoID RepositoryID) ([]SuccessfulDeploy, error) {
+
+	resp, err := etcdKV.Get(ctx, fmt.Sprintf("%s/deploys", repoID.key()),
+		&etcd.GetOptions{
+			Recursive: true,
+			Quorum:    true,
+		})
+	if etcd.IsKeyNotFound(err) {
+		return []SuccessfulDeploy{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying deploys: %s",
+			err.Error())
+	}
+
+	deploys := []SuccessfulDeploy{}
+
+	nodes := []*etcd.Node{resp.Node}
+
+	for len(nodes) > 0 {
+		node := nodes[0]
+		nodes = nodes[1:]
+
+		if node.Dir {
+			nodes = append(nodes, node.Nodes...)
+			continue
+		}
+
+		var deploy SuccessfulDeploy
+
+		err := json.Unmarshal([]byte(node.Value), &deploy)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling deploy, key: "+
+				"%s, error: %s", node.Key, err.Error())
+		}
+
+		deploys = append(deploys, deploy)
+	}
+
+	return deploys, nil
+}
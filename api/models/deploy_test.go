@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+)
+
+func TestSuccessfulDeployPerBranch(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	repoID := RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}
+
+	deploys := []SuccessfulDeploy{
+		SuccessfulDeploy{
+			RepositoryID: repoID,
+			Environment:  "production",
+			Branch:       "master",
+			UnitID:       "api",
+			JobID:        1,
+		},
+		SuccessfulDeploy{
+			RepositoryID: repoID,
+			Environment:  "production",
+			Branch:       "feature",
+			UnitID:       "api",
+			JobID:        2,
+		},
+		SuccessfulDeploy{
+			RepositoryID: repoID,
+			Environment:  "production",
+			Tag:          "master",
+			UnitID:       "api",
+			JobID:        3,
+		},
+	}
+
+	for _, deploy := range deploys {
+		err := deploy.Set(ctx, etcdKV)
+		if err != nil {
+			t.Fatalf("error saving deploy: %s", err.Error())
+		}
+	}
+
+	for _, deploy := range deploys {
+		retrieved := SuccessfulDeploy{
+			RepositoryID: repoID,
+			Environment:  deploy.Environment,
+			Branch:       deploy.Branch,
+			Tag:          deploy.Tag,
+			UnitID:       deploy.UnitID,
+		}
+
+		found, err := retrieved.Get(ctx, etcdKV)
+		if err != nil {
+			t.Fatalf("error retrieving deploy: %s", err.Error())
+		}
+
+		if !found || retrieved.JobID != deploy.JobID {
+			t.Errorf("expected deploy of job %d for branch %q tag %q, "+
+				"found: %t, job: %d", deploy.JobID, deploy.Branch,
+				deploy.Tag, found, retrieved.JobID)
+		}
+	}
+}
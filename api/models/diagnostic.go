@@ -0,0 +1,415 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError is a problem with a job configuration file
+type ConfigError struct {
+	// Path is the TOML key of the value with the problem, ex:
+	// "api.docker.tag". Empty if the problem is with the whole file.
+	Path string
+
+	// Line is the line of the file with the problem. 0 if not known.
+	Line int
+
+	// Message describes the problem
+	Message string
+}
+
+// configErrorf creates a ConfigError for the value at path
+func configErrorf(path, format string, args ...interface{}) ConfigError {
+	return ConfigError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// prefixConfigError returns err as a ConfigError whose path is under
+// prefix. Used by validators of tables to add the table's key to the errors
+// of their values.
+func prefixConfigError(prefix string, err error) ConfigError {
+	cfgErr, ok := err.(ConfigError)
+	if !ok {
+		return ConfigError{
+			Path:    prefix,
+			Message: err.Error(),
+		}
+	}
+
+	if len(cfgErr.Path) == 0 {
+		cfgErr.Path = prefix
+	} else {
+		cfgErr.Path = prefix + "." + cfgErr.Path
+	}
+
+	return cfgErr
+}
+
+// Error implements error
+func (e ConfigError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors are all the problems found in a job configuration file
+type ConfigErrors []ConfigError
+
+// Error implements error
+func (e ConfigErrors) Error() string {
+	msgs := []string{}
+	for _, cfgErr := range e {
+		msgs = append(msgs, cfgErr.Error())
+	}
+
+	return strings.Join(msgs, ", ")
+}
+
+// DiagnosticSeverity indicates if a problem stops a configuration file from
+// being used
+type DiagnosticSeverity string
+
+const (
+	// SeverityError indicates jobs using the file will fail to prepare
+	SeverityError DiagnosticSeverity = "error"
+
+	// SeverityWarning indicates the file can be used, but likely does not
+	// do what was intended
+	SeverityWarning DiagnosticSeverity = "warning"
+)
+
+// ConfigDiagnostic describes a problem found when validating a job
+// configuration file
+type ConfigDiagnostic struct {
+	// File is the path of the configuration file with the problem,
+	// relative to the repository root. Empty if the problem is not in one
+	// file.
+	File string `json:"file"`
+
+	// Path is the TOML key of the value with the problem. Empty if the
+	// problem is with the whole file.
+	Path string `json:"path"`
+
+	// Line is the line of the file with the problem. 0 if not known.
+	Line int `json:"line"`
+
+	// Message describes the problem
+	Message string `json:"message"`
+
+	// Severity indicates if the problem stops the file from being used
+	Severity DiagnosticSeverity `json:"severity"`
+}
+
+// DiagnoseJobConfig diagnoses a job configuration file in the repository
+// root, see DiagnoseJobConfigFiles
+func DiagnoseJobConfig(data string, format ConfigFormat,
+	vars TemplateVars) []ConfigDiagnostic {
+
+	return DiagnoseJobConfigFiles(map[string]string{
+		fmt.Sprintf("kube-git-deploy.%s", format): data,
+	}, vars)
+}
+
+// DiagnoseJobConfigFiles parses, validates, and merges job configuration
+// files in the same way a job's prepare action does, and returns every
+// problem found. Keys are the paths of the files relative to the
+// repository root, values are their contents. Files are merged with
+// MergeJobConfigs, like a repository which discovers configuration files
+// in subdirectories. Warnings are only checked if the files have no errors.
+func DiagnoseJobConfigFiles(files map[string]string,
+	vars TemplateVars) []ConfigDiagnostic {
+
+	diagnostics := []ConfigDiagnostic{}
+
+	cfgPaths := []string{}
+	for cfgPath := range files {
+		cfgPaths = append(cfgPaths, cfgPath)
+	}
+
+	sort.Strings(cfgPaths)
+
+	add := func(cfgPath string, err error, severity DiagnosticSeverity) {
+		for _, cfgErr := range configErrorList(err) {
+			file := cfgPath
+
+			if len(file) == 0 {
+				file, cfgErr.Line = locateMergedError(files,
+					cfgPaths, cfgErr)
+			} else if cfgErr.Line == 0 {
+				cfgErr.Line, _ = configKeyLine(files[file],
+					file, cfgErr.Path)
+			}
+
+			diagnostics = append(diagnostics, ConfigDiagnostic{
+				File:     file,
+				Path:     cfgErr.Path,
+				Line:     cfgErr.Line,
+				Message:  cfgErr.Message,
+				Severity: severity,
+			})
+		}
+	}
+
+	// Parse each file
+	cfgs := map[string]JobConfig{}
+
+	for _, cfgPath := range cfgPaths {
+		cfg, err := ParseJobConfigFile(cfgPath, files[cfgPath], vars)
+		if err != nil {
+			add(cfgPath, err, SeverityError)
+			continue
+		}
+
+		cfgs[path.Dir(cfgPath)] = cfg
+	}
+
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+
+	// Merge
+	merged, err := MergeJobConfigs(cfgs)
+	if err != nil {
+		add("", err, SeverityError)
+		return diagnostics
+	}
+
+	for _, warning := range merged.Warnings() {
+		add("", warning, SeverityWarning)
+	}
+
+	return diagnostics
+}
+
+// configErrorList returns the ConfigErrors in an error
+func configErrorList(err error) []ConfigError {
+	switch e := err.(type) {
+	case ConfigErrors:
+		return e
+	case ConfigError:
+		return []ConfigError{e}
+	default:
+		return []ConfigError{ConfigError{Message: err.Error()}}
+	}
+}
+
+// locateMergedError finds the file and line of a problem with merged
+// configuration files. The IDs of units in merged configuration are
+// prefixed with their directory, see UnitIDPrefix. If more than one file
+// defines the value the last is used, as MergeJobConfigs reports conflicts
+// in the later file. Returns an empty path if no file defines the value.
+func locateMergedError(files map[string]string, cfgPaths []string,
+	cfgErr ConfigError) (string, int) {
+
+	root := strings.SplitN(cfgErr.Path, ".", 2)[0]
+
+	for i := len(cfgPaths) - 1; i >= 0; i-- {
+		cfgPath := cfgPaths[i]
+		keyPath := cfgErr.Path
+
+		// Environments and concurrency keys are not prefixed
+		if root != EnvironmentsKey && root != ConcurrencyKey {
+			prefix := UnitIDPrefix(path.Dir(cfgPath))
+			if !strings.HasPrefix(keyPath, prefix) {
+				continue
+			}
+
+			keyPath = strings.TrimPrefix(keyPath, prefix)
+		}
+
+		line, exact := configKeyLine(files[cfgPath], cfgPath, keyPath)
+		if exact {
+			return cfgPath, line
+		}
+	}
+
+	return "", 0
+}
+
+// configKeyLine finds the line of a configuration file which defines the
+// value at path, see keyLine. cfgPath is the path of the file, its
+// extension is the file's format. Also returns true if the value itself was
+// found, instead of a value near it.
+func configKeyLine(data, cfgPath, keyPath string) (int, bool) {
+	format, err := ConfigFormatFor(cfgPath)
+	if err != nil {
+		return 0, false
+	}
+
+	if format == FormatTOML {
+		return keyLine(data, keyPath)
+	}
+
+	// JSON is YAML, so both are parsed as YAML
+	var doc yaml.Node
+
+	err = yaml.Unmarshal([]byte(data), &doc)
+	if err != nil || len(doc.Content) == 0 {
+		return 0, false
+	}
+
+	return nodeKeyLine(doc.Content[0], keyPath)
+}
+
+// nodeKeyLine finds the line of a YAML node which holds the value at path.
+// Keys which contain dots, ex: Helm values, are matched whole. If the value
+// is not found the line of the deepest node which contains it is returned.
+// Also returns true if the value itself was found.
+func nodeKeyLine(node *yaml.Node, keyPath string) (int, bool) {
+	if len(keyPath) == 0 {
+		return node.Line, true
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Content holds keys followed by their values. The longest
+		// key is used, in case a key contains dots.
+		best := -1
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+
+			contains := keyPath == key ||
+				strings.HasPrefix(keyPath, key+".") ||
+				strings.HasPrefix(keyPath, key+"[")
+
+			if contains && (best < 0 ||
+				len(key) > len(node.Content[best].Value)) {
+
+				best = i
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		rest := strings.TrimPrefix(strings.TrimPrefix(keyPath,
+			node.Content[best].Value), ".")
+		if len(rest) == 0 {
+			return node.Content[best].Line, true
+		}
+
+		return nodeKeyLine(node.Content[best+1], rest)
+	case yaml.SequenceNode:
+		match := pathIndexPattern.FindStringIndex(keyPath)
+		if match == nil || match[0] != 0 {
+			break
+		}
+
+		i, _ := strconv.Atoi(keyPath[1 : match[1]-1])
+		if i >= len(node.Content) {
+			break
+		}
+
+		return nodeKeyLine(node.Content[i],
+			strings.TrimPrefix(keyPath[match[1]:], "."))
+	}
+
+	return node.Line, false
+}
+
+// tomlTablePattern matches a TOML table or array of tables header
+var tomlTablePattern *regexp.Regexp = regexp.MustCompile(
+	`^\[\[?\s*([^\]]+?)\s*\]\]?\s*(#.*)?$`)
+
+// tomlKeyPattern matches the key of a TOML key value pair
+var tomlKeyPattern *regexp.Regexp = regexp.MustCompile(
+	`^("[^"]*"|'[^']*'|[A-Za-z0-9_.\-" ]+?)\s*=`)
+
+// pathIndexPattern matches array indexes in configuration paths, ex: the
+// "[0]" in "api.kustomize.images[0]"
+var pathIndexPattern *regexp.Regexp = regexp.MustCompile(`\[\d+\]`)
+
+// keyLine finds the line of a TOML file which defines the value at path. If
+// the value is not found the line of the closest table which contains it, or
+// else the first value inside it, is returned. Returns 0 if no line is
+// found. Also returns true if the value itself was found.
+func keyLine(data, path string) (int, bool) {
+	path = pathIndexPattern.ReplaceAllString(path, "")
+	if len(path) == 0 {
+		return 0, false
+	}
+
+	table := ""
+	bestLine := 0
+	bestLen := 0
+	childLine := 0
+
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+
+		key := ""
+		tableMatch := tomlTablePattern.FindStringSubmatch(line)
+		keyMatch := tomlKeyPattern.FindStringSubmatch(line)
+
+		if tableMatch != nil {
+			table = unquoteTOMLKey(tableMatch[1])
+			key = table
+		} else if keyMatch != nil {
+			key = unquoteTOMLKey(keyMatch[1])
+			if len(table) > 0 {
+				key = table + "." + key
+			}
+		} else {
+			continue
+		}
+
+		if key == path {
+			return i + 1, true
+		}
+
+		if strings.HasPrefix(path, key+".") && len(key) > bestLen {
+			bestLine = i + 1
+			bestLen = len(key)
+		}
+
+		if childLine == 0 && strings.HasPrefix(key, path+".") {
+			childLine = i + 1
+		}
+	}
+
+	if bestLine == 0 {
+		return childLine, false
+	}
+
+	return bestLine, false
+}
+
+// unquoteTOMLKey removes the quotes and spaces around each part of a dotted
+// TOML key
+func unquoteTOMLKey(key string) string {
+	key = strings.TrimSpace(key)
+
+	// A quoted key may contain dots
+	if unquoted, err := strconv.Unquote(key); err == nil {
+		return unquoted
+	}
+
+	if strings.HasPrefix(key, "'") && strings.HasSuffix(key, "'") &&
+		len(key) > 1 {
+		return key[1 : len(key)-1]
+	}
+
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if unquoted, err := strconv.Unquote(part); err == nil {
+			part = unquoted
+		}
+
+		parts[i] = part
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"testing"
+)
+
+// testDiagnosticVars renders templates in tests of diagnostics
+var testDiagnosticVars TemplateVars = NewValidationTemplateVars(
+	RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}, JobTarget{})
+
+// expectDiagnostic checks that diagnostics hold one error at a file, path,
+// and line
+func expectDiagnostic(t *testing.T, diagnostics []ConfigDiagnostic, file,
+	path string, line int) {
+
+	t.Helper()
+
+	errors := []ConfigDiagnostic{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			errors = append(errors, diagnostic)
+		}
+	}
+
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got: %#v", diagnostics)
+	}
+
+	if errors[0].File != file || errors[0].Path != path ||
+		errors[0].Line != line {
+
+		t.Errorf("expected error at %s:%d %s, got: %#v", file, line,
+			path, errors[0])
+	}
+}
+
+func TestDiagnoseJobConfigYAMLLines(t *testing.T) {
+	diagnostics := DiagnoseJobConfig(`
+api:
+  docker:
+    directory: .
+    tag: example/api
+    unknown: true
+`, FormatYAML, testDiagnosticVars)
+
+	expectDiagnostic(t, diagnostics, "kube-git-deploy.yaml",
+		"api.docker.unknown", 6)
+}
+
+func TestDiagnoseJobConfigJSONLines(t *testing.T) {
+	diagnostics := DiagnoseJobConfig(`{
+  "api": {
+    "docker": {
+      "directory": ".",
+      "tag": "example/api"
+    }
+  },
+  "environments": {
+    "prod": {
+      "branches": ["master"],
+      "unknown": true
+    }
+  }
+}`, FormatJSON, testDiagnosticVars)
+
+	expectDiagnostic(t, diagnostics, "kube-git-deploy.json",
+		"environments.prod.unknown", 11)
+}
+
+func TestDiagnoseJobConfigFilesResolvesPaths(t *testing.T) {
+	diagnostics := DiagnoseJobConfigFiles(map[string]string{
+		"web/kube-git-deploy.toml": `
+[api.docker]
+directory = "../.."
+tag = "example/api"
+`,
+	}, testDiagnosticVars)
+
+	expectDiagnostic(t, diagnostics, "web/kube-git-deploy.toml",
+		"api.docker.directory", 3)
+}
+
+func TestDiagnoseJobConfigFilesMerges(t *testing.T) {
+	diagnostics := DiagnoseJobConfigFiles(map[string]string{
+		"kube-git-deploy.toml": `
+[web-api.docker]
+directory = "."
+tag = "example/root"
+`,
+		"web/kube-git-deploy.yaml": `
+api:
+  docker:
+    directory: .
+    tag: example/web
+`,
+	}, testDiagnosticVars)
+
+	expectDiagnostic(t, diagnostics, "web/kube-git-deploy.yaml",
+		"web-api", 2)
+}
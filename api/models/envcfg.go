@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// EnvironmentsKey is the top level key in a job configuration file which
+// holds environments
+const EnvironmentsKey string = "environments"
+
+// DefaultEnvironment is the environment units are deployed to if a job
+// configuration file does not define any environments. Deploys to the API's
+// default Kubernetes cluster.
+var DefaultEnvironment EnvironmentConfig = EnvironmentConfig{
+	ID: "default",
+}
+
+// EnvironmentConfig holds the config for a place units are deployed to
+type EnvironmentConfig struct {
+	// ID holds the name of the environment
+	ID string `json:"id" toml:"-"`
+
+	// Context is the name of the kubeconfig context used to connect to
+	// the environment's cluster. If empty the API's default cluster is
+	// used.
+	Context string `json:"context" toml:"context"`
+
+	// Namespace is the namespace units are deployed to. Overrides the
+	// namespace set in a unit's actions.
+	Namespace string `json:"namespace" toml:"namespace"`
+
+	// Values are Helm values set when deploying to the environment.
+	// Values can reference secrets as ${secrets.NAME}.
+	Values map[string]string `json:"values" toml:"values"`
+
+	// Branches are glob patterns which match Git branches that deploy to
+	// the environment
+	Branches []string `json:"branches" toml:"branches"`
+
+	// Tags are glob patterns which match Git tags that deploy to the
+	// environment
+	Tags []string `json:"tags" toml:"tags"`
+
+	// Approval is a manual approval which must be given before units are
+	// deployed to the environment. Nil if not required.
+	Approval *ApprovalConfig `json:"approval" toml:"approval"`
+}
+
+// Validate checks the environment's triggers are valid glob patterns
+func (e EnvironmentConfig) Validate() error {
+	if len(e.Branches) == 0 && len(e.Tags) == 0 {
+		return errors.New("at least one branch or tag trigger must be " +
+			"defined")
+	}
+
+	triggers := []struct {
+		key      string
+		patterns []string
+	}{
+		{"branches", e.Branches},
+		{"tags", e.Tags},
+	}
+
+	for _, trigger := range triggers {
+		for i, pattern := range trigger.patterns {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return configErrorf(fmt.Sprintf("%s[%d]",
+					trigger.key, i),
+					"invalid pattern \"%s\": %s", pattern,
+					err.Error())
+			}
+		}
+	}
+
+	if e.Approval != nil {
+		err := e.Approval.Validate()
+		if err != nil {
+			return prefixConfigError("approval", err)
+		}
+	}
+
+	return nil
+}
+
+// Matches indicates if a Git target triggers a deploy to the environment
+func (e EnvironmentConfig) Matches(target JobTarget) bool {
+	if len(target.Branch) > 0 {
+		for _, pattern := range e.Branches {
+			if ok, _ := path.Match(pattern, target.Branch); ok {
+				return true
+			}
+		}
+	}
+
+	if len(target.Tag) > 0 {
+		for _, pattern := range e.Tags {
+			if ok, _ := path.Match(pattern, target.Tag); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NamespaceFor returns the namespace to deploy to in an environment. The
+// environment's namespace takes precedence over the action's namespace. If
+// neither is set "default" is returned.
+func (e EnvironmentConfig) NamespaceFor(actionNamespace string) string {
+	if len(e.Namespace) > 0 {
+		return e.Namespace
+	}
+
+	if len(actionNamespace) > 0 {
+		return actionNamespace
+	}
+
+	return "default"
+}
+
+// MatchEnvironments returns the environments which a Git target deploys to,
+// in name order. If the configuration does not define any environments
+// DefaultEnvironment is returned.
+func (c JobConfig) MatchEnvironments(target JobTarget) []EnvironmentConfig {
+	if len(c.Environments) == 0 {
+		return []EnvironmentConfig{DefaultEnvironment}
+	}
+
+	matched := []EnvironmentConfig{}
+
+	for _, env := range c.Environments {
+		if env.Matches(target) {
+			matched = append(matched, env)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+
+	return matched
+}
+
+// GetEnvironment returns the environment with an ID. DefaultEnvironment is
+// returned if the configuration does not define any environments and id is
+// DefaultEnvironment.ID. Returns false if the environment does not exist.
+func (c JobConfig) GetEnvironment(id string) (EnvironmentConfig, bool) {
+	if len(c.Environments) == 0 && id == DefaultEnvironment.ID {
+		return DefaultEnvironment, true
+	}
+
+	env, ok := c.Environments[id]
+
+	return env, ok
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+
+	"github.com/robfig/cron"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// KeyDirFreezeWindows is the key used to store freeze windows
+const KeyDirFreezeWindows string = "/freezes/windows"
+
+// KeyDirFreezeOverrides is the key used to store the audit log of freeze
+// window overrides
+const KeyDirFreezeOverrides string = "/freezes/overrides"
+
+// FreezeWindow is a period of time during which deploys are blocked. Has
+// either a date range schedule, set by Start and End, or a cron schedule,
+// set by Cron and Duration.
+type FreezeWindow struct {
+	// ID identifies the freeze window
+	ID int64 `json:"id"`
+
+	// Repository is the repository the freeze applies to. Nil if the
+	// freeze applies to all repositories.
+	Repository *RepositoryID `json:"repository"`
+
+	// Environment is the environment the freeze applies to. Empty if the
+	// freeze applies to all environments.
+	Environment string `json:"environment"`
+
+	// Reason explains why deploys are frozen. Shown in job output.
+	Reason string `json:"reason"`
+
+	// Action is what happens to jobs which try to deploy during the
+	// freeze. Defaults to FreezeHold.
+	Action FreezeAction `json:"action"`
+
+	// Start is when a date range freeze begins
+	Start *time.Time `json:"start"`
+
+	// End is when a date range freeze ends
+	End *time.Time `json:"end"`
+
+	// Cron is a standard 5 field cron expression. A freeze begins each
+	// time the expression matches. Evaluated in UTC.
+	Cron string `json:"cron"`
+
+	// Duration is how long each freeze in a cron schedule lasts. Formatted
+	// as a Go duration, ex: "48h".
+	Duration string `json:"duration"`
+}
+
+// FreezeAction is what happens to jobs which try to deploy during a freeze
+type FreezeAction string
+
+const (
+	// FreezeHold indicates deploys wait until the freeze ends
+	FreezeHold FreezeAction = "hold"
+
+	// FreezeFail indicates deploys fail
+	FreezeFail FreezeAction = "fail"
+)
+
+// key returns the Etcd key the freeze window is stored in
+func (w FreezeWindow) key() string {
+	return fmt.Sprintf("%s/%d", KeyDirFreezeWindows, w.ID)
+}
+
+// GetAction returns the freeze window's action, or the default if not set
+func (w FreezeWindow) GetAction() FreezeAction {
+	if len(w.Action) == 0 {
+		return FreezeHold
+	}
+
+	return w.Action
+}
+
+// Validate checks the freeze window has exactly one valid schedule
+func (w FreezeWindow) Validate() error {
+	switch w.GetAction() {
+	case FreezeHold, FreezeFail:
+	default:
+		return fmt.Errorf("action must be \"%s\" or \"%s\"", FreezeHold,
+			FreezeFail)
+	}
+
+	dateRange := w.Start != nil || w.End != nil
+	cronSchedule := len(w.Cron) > 0 || len(w.Duration) > 0
+
+	if dateRange == cronSchedule {
+		return errors.New("either start and end, or cron and duration " +
+			"must be set")
+	}
+
+	if dateRange {
+		if w.Start == nil || w.End == nil {
+			return errors.New("start and end must both be set")
+		}
+
+		if !w.End.After(*w.Start) {
+			return errors.New("end must be after start")
+		}
+
+		return nil
+	}
+
+	if len(w.Cron) == 0 || len(w.Duration) == 0 {
+		return errors.New("cron and duration must both be set")
+	}
+
+	schedule, err := cron.ParseStandard(w.Cron)
+	if err != nil {
+		return fmt.Errorf("cron invalid: %s", err.Error())
+	}
+
+	if schedule.Next(time.Now().UTC()).IsZero() {
+		return errors.New("cron never matches")
+	}
+
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return fmt.Errorf("duration invalid: %s", err.Error())
+	}
+
+	if duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+
+	return nil
+}
+
+// Active indicates if the freeze is in effect at a time. The freeze window
+// must be valid.
+func (w FreezeWindow) Active(now time.Time) bool {
+	if w.Start != nil && w.End != nil {
+		return !now.Before(*w.Start) && now.Before(*w.End)
+	}
+
+	schedule, err := cron.ParseStandard(w.Cron)
+	if err != nil {
+		return false
+	}
+
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return false
+	}
+
+	// Find the first freeze which began less than duration ago. Next
+	// returns a zero time if the schedule does not match in the next five
+	// years.
+	begin := schedule.Next(now.UTC().Add(-duration))
+
+	return !begin.IsZero() && !begin.After(now)
+}
+
+// AppliesTo indicates if the freeze blocks deploys from a repository to an
+// environment
+func (w FreezeWindow) AppliesTo(repoID RepositoryID, env string) bool {
+	if w.Repository != nil && *w.Repository != repoID {
+		return false
+	}
+
+	return len(w.Environment) == 0 || w.Environment == env
+}
+
+// Create stores a new freeze window. Finds the next ID and saves it in the
+// ID field. If another freeze window takes the ID first the next ID is
+// tried.
+func (w *FreezeWindow) Create(ctx context.Context,
+	etcdKV etcd.KeysAPI) error {
+
+	for attempt := 0; attempt < libetcd.MaxUpdateAttempts; attempt++ {
+		// Find next ID
+		id, err := libetcd.NextID(ctx, etcdKV, KeyDirFreezeWindows)
+		if err != nil {
+			return fmt.Errorf("error finding next freeze window ID: %s",
+				err.Error())
+		}
+
+		w.ID = id
+
+		// Save if no other freeze window has the ID
+		b, err := json.Marshal(w)
+		if err != nil {
+			return fmt.Errorf("error marshalling freeze window to "+
+				"JSON: %s", err.Error())
+		}
+
+		_, err = etcdKV.Set(ctx, w.key(), string(b), &etcd.SetOptions{
+			PrevExist: etcd.PrevNoExist,
+		})
+		if libetcd.IsNodeExists(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error setting freeze window: %s",
+				err.Error())
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("error creating freeze window: %s",
+		libetcd.ErrTooManyConflicts.Error())
+}
+
+// Delete removes a freeze window. The ID field must be set for this method
+// to work properly.
+func (w FreezeWindow) Delete(ctx context.Context,
+	etcdKV etcd.KeysAPI) error {
+
+	_, err := etcdKV.Delete(ctx, w.key(), nil)
+
+	return err
+}
+
+// GetAllFreezeWindows retrieves all freeze windows, ordered by ID
+func GetAllFreezeWindows(ctx context.Context,
+	etcdKV etcd.KeysAPI) ([]FreezeWindow, error) {
+
+	resp, err := etcdKV.Get(ctx, KeyDirFreezeWindows, &etcd.GetOptions{
+		Recursive: true,
+		Quorum:    true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []FreezeWindow{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying freeze windows: %s",
+			err.Error())
+	}
+
+	windows := []FreezeWindow{}
+
+	for _, node := range resp.Node.Nodes {
+		var window FreezeWindow
+
+		err := json.Unmarshal([]byte(node.Value), &window)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling freeze window, "+
+				"key: %s, error: %s", node.Key, err.Error())
+		}
+
+		windows = append(windows, window)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].ID < windows[j].ID
+	})
+
+	return windows, nil
+}
+
+// ActiveFreezeWindows returns the freeze windows which block deploys from a
+// repository to an environment at a time
+func ActiveFreezeWindows(windows []FreezeWindow, repoID RepositoryID,
+	env string, now time.Time) []FreezeWindow {
+
+	active := []FreezeWindow{}
+
+	for _, window := range windows {
+		if window.AppliesTo(repoID, env) && window.Active(now) {
+			active = append(active, window)
+		}
+	}
+
+	return active
+}
+
+// FreezeOverride records a user deploying during freeze windows. Set on a job
+// to make it ignore freezes. Also stored in an audit log.
+type FreezeOverride struct {
+	// JobID is the job which ignores freezes
+	JobID JobID `json:"job_id"`
+
+	// User is the GitHub user who overrode the freezes
+	User string `json:"user"`
+
+	// Reason explains why the freezes were overridden
+	Reason string `json:"reason"`
+
+	// Time is when the override was made
+	Time time.Time `json:"time"`
+
+	// FreezeWindowIDs are the freeze windows which were active for the
+	// job's repository when the override was made
+	FreezeWindowIDs []int64 `json:"freeze_window_ids"`
+}
+
+// Audit adds the override to the audit log
+func (o FreezeOverride) Audit(ctx context.Context,
+	etcdKV etcd.KeysAPI) error {
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("error marshalling freeze override to JSON: "+
+			"%s", err.Error())
+	}
+
+	_, err = etcdKV.CreateInOrder(ctx, KeyDirFreezeOverrides, string(b),
+		nil)
+	if err != nil {
+		return fmt.Errorf("error saving freeze override to Etcd: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// GetFreezeOverrides retrieves the freeze override audit log, oldest first
+func GetFreezeOverrides(ctx context.Context,
+	etcdKV etcd.KeysAPI) ([]FreezeOverride, error) {
+
+	resp, err := etcdKV.Get(ctx, KeyDirFreezeOverrides, &etcd.GetOptions{
+		Recursive: true,
+		Sort:      true,
+		Quorum:    true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []FreezeOverride{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying freeze overrides: %s",
+			err.Error())
+	}
+
+	overrides := []FreezeOverride{}
+
+	for _, node := range resp.Node.Nodes {
+		var override FreezeOverride
+
+		err := json.Unmarshal([]byte(node.Value), &override)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling freeze "+
+				"override, key: %s, error: %s", node.Key,
+				err.Error())
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
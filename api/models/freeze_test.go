@@ -0,0 +1,290 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+)
+
+// testTime parses an RFC 3339 time, panics if the time is invalid
+func testTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestFreezeWindowActiveDateRange(t *testing.T) {
+	start := testTime("2020-12-24T00:00:00Z")
+	end := testTime("2020-12-26T00:00:00Z")
+
+	window := FreezeWindow{
+		Start: &start,
+		End:   &end,
+	}
+
+	times := map[string]bool{
+		"2020-12-23T23:59:59Z":      false,
+		"2020-12-24T00:00:00Z":      true,
+		"2020-12-25T12:00:00Z":      true,
+		"2020-12-25T23:59:59Z":      true,
+		"2020-12-26T00:00:00Z":      false,
+		"2021-12-25T00:00:00Z":      false,
+		"2020-12-23T20:00:00-05:00": true,
+		"2020-12-25T20:00:00-05:00": false,
+	}
+
+	for now, active := range times {
+		if window.Active(testTime(now)) != active {
+			t.Errorf("expected active at %s to be %t", now, active)
+		}
+	}
+}
+
+func TestFreezeWindowActiveCron(t *testing.T) {
+	tests := []struct {
+		cron     string
+		duration string
+		times    map[string]bool
+	}{
+		// Fridays from 16:00 UTC until Monday
+		{
+			cron:     "0 16 * * 5",
+			duration: "56h",
+			times: map[string]bool{
+				"2020-03-06T15:59:59Z": false,
+				"2020-03-06T16:00:00Z": true,
+				"2020-03-07T12:00:00Z": true,
+				"2020-03-08T23:59:59Z": true,
+				"2020-03-09T00:00:00Z": false,
+				"2020-03-09T00:00:01Z": false,
+				"2020-03-11T12:00:00Z": false,
+
+				// Evaluated in UTC, even when the time is in a
+				// zone which observes daylight saving time
+				"2020-03-06T11:00:00-05:00": true,
+				"2020-03-06T10:59:59-05:00": false,
+				"2020-03-08T19:59:59-04:00": true,
+				"2020-03-08T20:00:00-04:00": false,
+			},
+		},
+
+		// Minute long freeze, boundaries are not rounded
+		{
+			cron:     "30 9 * * *",
+			duration: "1m",
+			times: map[string]bool{
+				"2020-06-01T09:29:59.999Z": false,
+				"2020-06-01T09:30:00Z":     true,
+				"2020-06-01T09:30:59.999Z": true,
+				"2020-06-01T09:31:00Z":     false,
+			},
+		},
+
+		// Freezes which overlap never end
+		{
+			cron:     "0 * * * *",
+			duration: "2h",
+			times: map[string]bool{
+				"2020-06-01T00:00:00Z": true,
+				"2020-06-01T00:59:59Z": true,
+			},
+		},
+
+		// Schedule which never matches
+		{
+			cron:     "0 0 30 2 *",
+			duration: "24h",
+			times: map[string]bool{
+				"2020-02-29T12:00:00Z": false,
+				"2020-03-01T00:00:00Z": false,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		window := FreezeWindow{
+			Cron:     test.cron,
+			Duration: test.duration,
+		}
+
+		for now, active := range test.times {
+			if window.Active(testTime(now)) != active {
+				t.Errorf("expected cron %s for %s active at %s to "+
+					"be %t", test.cron, test.duration, now,
+					active)
+			}
+		}
+	}
+}
+
+func TestFreezeWindowValidate(t *testing.T) {
+	start := testTime("2020-12-24T00:00:00Z")
+	end := testTime("2020-12-26T00:00:00Z")
+
+	windows := []struct {
+		window FreezeWindow
+		valid  bool
+	}{
+		{FreezeWindow{Start: &start, End: &end}, true},
+		{FreezeWindow{Cron: "0 16 * * 5", Duration: "56h"}, true},
+		{FreezeWindow{}, false},
+		{FreezeWindow{Start: &start}, false},
+		{FreezeWindow{Start: &end, End: &start}, false},
+		{FreezeWindow{Start: &start, End: &start}, false},
+		{FreezeWindow{Cron: "0 16 * * 5"}, false},
+		{FreezeWindow{Cron: "0 16 * *", Duration: "1h"}, false},
+		{FreezeWindow{Cron: "0 0 30 2 *", Duration: "1h"}, false},
+		{FreezeWindow{Cron: "0 16 * * 5", Duration: "-1h"}, false},
+		{FreezeWindow{Start: &start, End: &end, Cron: "0 16 * * 5",
+			Duration: "1h"}, false},
+		{FreezeWindow{Start: &start, End: &end, Action: "skip"}, false},
+	}
+
+	for i, test := range windows {
+		err := test.window.Validate()
+
+		if test.valid && err != nil {
+			t.Errorf("expected window %d to be valid, got: %s", i,
+				err.Error())
+		} else if !test.valid && err == nil {
+			t.Errorf("expected window %d to be invalid", i)
+		}
+	}
+}
+
+func TestActiveFreezeWindowsScope(t *testing.T) {
+	start := testTime("2020-12-24T00:00:00Z")
+	end := testTime("2020-12-26T00:00:00Z")
+
+	api := RepositoryID{
+		Owner: "owner",
+		Name:  "api",
+	}
+	web := RepositoryID{
+		Owner: "owner",
+		Name:  "web",
+	}
+
+	windows := []FreezeWindow{
+		// Global
+		{ID: 0, Start: &start, End: &end},
+
+		// Repository
+		{ID: 1, Start: &start, End: &end, Repository: &api},
+
+		// Environment
+		{ID: 2, Start: &start, End: &end, Environment: "production"},
+
+		// Repository environment
+		{ID: 3, Start: &start, End: &end, Repository: &api,
+			Environment: "production"},
+
+		// Inactive
+		{ID: 4, Start: &end, End: &end, Repository: &api},
+	}
+
+	tests := []struct {
+		repoID RepositoryID
+		env    string
+		ids    []int64
+	}{
+		{api, "production", []int64{0, 1, 2, 3}},
+		{api, "staging", []int64{0, 1}},
+		{web, "production", []int64{0, 2}},
+		{web, "staging", []int64{0}},
+	}
+
+	for _, test := range tests {
+		active := ActiveFreezeWindows(windows, test.repoID, test.env,
+			testTime("2020-12-25T00:00:00Z"))
+
+		ids := []int64{}
+		for _, window := range active {
+			ids = append(ids, window.ID)
+		}
+
+		if len(ids) != len(test.ids) {
+			t.Errorf("expected windows %v for %s/%s %s, got %v",
+				test.ids, test.repoID.Owner, test.repoID.Name,
+				test.env, ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != test.ids[i] {
+				t.Errorf("expected windows %v for %s/%s %s, got "+
+					"%v", test.ids, test.repoID.Owner,
+					test.repoID.Name, test.env, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestFreezeWindowCreateUniqueIDs(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	const creators int = 5
+
+	var wg sync.WaitGroup
+	ids := make(chan int64, creators)
+
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			window := FreezeWindow{
+				Reason:   "Weekend",
+				Cron:     "0 16 * * 5",
+				Duration: "56h",
+			}
+
+			err := window.Create(context.Background(), etcdKV)
+			if err != nil {
+				t.Errorf("error creating freeze window: %s",
+					err.Error())
+				return
+			}
+
+			ids <- window.ID
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("freeze window ID %d was created more than once",
+				id)
+		}
+
+		seen[id] = true
+	}
+
+	windows, err := GetAllFreezeWindows(context.Background(), etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving freeze windows: %s", err.Error())
+	}
+
+	if len(windows) != creators {
+		t.Errorf("expected %d freeze windows, found %d", creators,
+			len(windows))
+	}
+
+	for _, window := range windows {
+		if !seen[window.ID] {
+			t.Errorf("freeze window %d was not created", window.ID)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// BuiltImage records an image pushed by a unit's Docker action, so later
+// jobs which would build the same image can re-use it
+type BuiltImage struct {
+	// RepositoryID is the repository of the unit
+	RepositoryID RepositoryID `json:"repository_id"`
+
+	// UnitID is the unit which built the image
+	UnitID string `json:"unit_id"`
+
+	// Hash is the hex encoded SHA256 sum of the image's build context and
+	// build arguments
+	Hash string `json:"hash"`
+
+	// Tag is the image tag which was pushed
+	Tag string `json:"tag"`
+
+	// JobID is the ID of the job which built the image
+	JobID int64 `json:"job_id"`
+}
+
+// key returns the Etcd key the image is stored in
+func (i BuiltImage) key() string {
+	return fmt.Sprintf("%s/images/%s/hashes/%s", i.RepositoryID.key(),
+		i.UnitID, i.Hash)
+}
+
+// tagKey returns the Etcd key which holds the hash of the image last pushed
+// to the image's tag by the unit
+func (i BuiltImage) tagKey() string {
+	return fmt.Sprintf("%s/images/%s/tags/%s", i.RepositoryID.key(),
+		i.UnitID, url.PathEscape(i.Tag))
+}
+
+// Set stores an image in Etcd, and records it as the last image pushed to
+// its tag
+func (i BuiltImage) Set(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	err := libetcd.SetJSON(ctx, etcdKV, i.key(), i)
+	if err != nil {
+		return err
+	}
+
+	_, err = etcdKV.Set(ctx, i.tagKey(), i.Hash, nil)
+	if err != nil {
+		return fmt.Errorf("error saving image tag in Etcd: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// TagCurrent indicates if the image is still the last image the unit pushed
+// to its tag. Tags which are re-used between builds, ex: "latest", may have
+// been overwritten by a build of a different hash.
+func (i BuiltImage) TagCurrent(ctx context.Context,
+	etcdKV etcd.KeysAPI) (bool, error) {
+
+	resp, err := etcdKV.Get(ctx, i.tagKey(), &etcd.GetOptions{
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error retrieving image tag from "+
+			"Etcd: %s", err.Error())
+	}
+
+	return resp.Node.Value == i.Hash, nil
+}
+
+// Get retrieves an image from Etcd. The RepositoryID, UnitID, and Hash
+// fields must be set for this method to work properly.
+func (i *BuiltImage) Get(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	return libetcd.GetJSON(ctx, etcdKV, i.key(), i)
+}
@@ -2,10 +2,9 @@ package models
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
+	"sort"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
 
@@ -29,6 +28,30 @@ type Job struct {
 	// Config holds the job configuration. Nil if it hasn't been
 	// loaded yet.
 	Config *JobConfig `json:"config"`
+
+	// RollbackOf is the ID of the job which this job re-deploys. Nil if
+	// the job is not a rollback.
+	RollbackOf *int64 `json:"rollback_of"`
+
+	// PromotedFrom is the ID of the job whose artifacts this job deploys
+	// to a new environment. Nil if the job is not a promotion.
+	PromotedFrom *int64 `json:"promoted_from"`
+
+	// PromotedImages are the images a promotion deploys, keyed by unit ID.
+	// Each is a digest reference to the image the promoted job deployed.
+	PromotedImages map[string]string `json:"promoted_images"`
+
+	// Environments are the IDs of the environments the job deploys to. If
+	// empty the environments which match the job's Target are used.
+	Environments []string `json:"environments"`
+
+	// FreezeOverride records a user allowing the job to deploy during
+	// freeze windows. Nil if freezes apply to the job.
+	FreezeOverride *FreezeOverride `json:"freeze_override"`
+
+	// secrets are the secret values used by the job, which are redacted
+	// from action output. Longest first.
+	secrets []string
 }
 
 // NewJob creates a new Job. Intializes all JobState.Stage fields to Queued.
@@ -49,13 +72,76 @@ func NewJob(repoID RepositoryID, target JobTarget) *Job {
 	return &j
 }
 
+// NewRollbackJob creates a new Job which re-deploys the target and
+// configuration of a previous job
+func NewRollbackJob(source Job) *Job {
+	j := NewJob(source.ID.RepositoryID, source.Target)
+
+	j.Config = source.Config
+	j.Environments = source.Environments
+
+	sourceID := source.ID.ID
+	j.RollbackOf = &sourceID
+
+	return j
+}
+
+// NewPromotionJob creates a new Job which deploys the target and
+// configuration of a previous job to another environment
+func NewPromotionJob(source Job, environment string) *Job {
+	j := NewJob(source.ID.RepositoryID, source.Target)
+
+	j.Config = source.Config
+	j.Environments = []string{environment}
+
+	sourceID := source.ID.ID
+	j.PromotedFrom = &sourceID
+
+	j.PromotedImages = map[string]string{}
+	for id, unitState := range source.State.Units {
+		if image := unitState.DigestImage(); len(image) > 0 {
+			j.PromotedImages[id] = image
+		}
+	}
+
+	return j
+}
+
+// DeployEnvironments returns the environments the job deploys to. The Config
+// field must be set for this method to work properly.
+func (j Job) DeployEnvironments() ([]EnvironmentConfig, error) {
+	if len(j.Environments) == 0 {
+		return j.Config.MatchEnvironments(j.Target), nil
+	}
+
+	envs := []EnvironmentConfig{}
+
+	for _, id := range j.Environments {
+		env, ok := j.Config.GetEnvironment(id)
+		if !ok {
+			return nil, fmt.Errorf("environment %s does not exist", id)
+		}
+
+		envs = append(envs, env)
+	}
+
+	return envs, nil
+}
+
 // JobTarget identifies the Git event which triggered the job.
 type JobTarget struct {
-	// Branch is the Git branch.
+	// Branch is the Git branch. Empty if the job was triggered by a tag.
 	Branch string `json:"branch"`
 
+	// Tag is the Git tag. Empty if the job was triggered by a branch.
+	Tag string `json:"tag"`
+
 	// Commit is the Git Sha.
 	Commit string `json:"commit"`
+
+	// PullRequest is the number of the open GitHub pull request whose
+	// head is Branch. 0 if there is none.
+	PullRequest int `json:"pull_request"`
 }
 
 // JobID identifies a job.
@@ -73,51 +159,80 @@ func (i JobID) key() string {
 }
 
 // Create stores a new job. Finds the next job ID and saves it in the Job.ID
-// field. Does not work if the job has already been stored
+// field. If another job takes the ID first the next ID is tried. Does not
+// work if the job has already been stored
 func (j *Job) Create(ctx context.Context, etcdKV etcd.KeysAPI) error {
-	// Find next ID
-	jobsDir := fmt.Sprintf("%s/jobs", j.ID.RepositoryID.key())
+	for attempt := 0; attempt < libetcd.MaxUpdateAttempts; attempt++ {
+		// Find next ID
+		id, err := libetcd.NextID(ctx, etcdKV, fmt.Sprintf("%s/jobs",
+			j.ID.RepositoryID.key()))
+		if err != nil {
+			return fmt.Errorf("error finding next job ID: %s",
+				err.Error())
+		}
+
+		j.ID.ID = id
+
+		// Save if no other job has the ID
+		b, err := json.Marshal(j)
+		if err != nil {
+			return fmt.Errorf("error marshalling job to JSON: %s",
+				err.Error())
+		}
+
+		_, err = etcdKV.Set(ctx, j.ID.key(), string(b), &etcd.SetOptions{
+			PrevExist: etcd.PrevNoExist,
+		})
+		if libetcd.IsNodeExists(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error setting job: %s", err.Error())
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("error creating job: %s",
+		libetcd.ErrTooManyConflicts.Error())
+}
+
+// GetAllJobs retrieves all of a repository's jobs, ordered by ID
+func GetAllJobs(ctx context.Context, etcdKV etcd.KeysAPI,
+	repoID RepositoryID) ([]Job, error) {
+
+	jobsDir := fmt.Sprintf("%s/jobs", repoID.key())
 
 	resp, err := etcdKV.Get(ctx, jobsDir, &etcd.GetOptions{
 		Recursive: true,
 		Sort:      true,
 		Quorum:    true,
 	})
-
-	if err != nil {
-		return fmt.Errorf("error querying job IDs: %s", err.Error())
+	if etcd.IsKeyNotFound(err) {
+		return []Job{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %s", err.Error())
 	}
 
-	if resp.Node == nil {
-		return errors.New("while finding next Job ID, result node " +
-			"was nil")
-	}
+	jobs := []Job{}
 
-	var highestJobID int64 = -1
 	for _, node := range resp.Node.Nodes {
-		keyParts := strings.Split(node.Key, "/")
-		jobIDStr := keyParts[len(keyParts)-1]
+		var job Job
 
-		jobID, err := strconv.ParseInt(jobIDStr, 10, 64)
+		err := json.Unmarshal([]byte(node.Value), &job)
 		if err != nil {
-			return fmt.Errorf("error parsing Job ID to int, "+
-				"job ID: %s, error: %s", jobIDStr, err.Error())
+			return nil, fmt.Errorf("error unmarshalling job, key: %s, "+
+				"error: %s", node.Key, err.Error())
 		}
 
-		if jobID > highestJobID {
-			highestJobID = jobID
-		}
+		jobs = append(jobs, job)
 	}
 
-	j.ID.ID = highestJobID + 1
-
-	// Save
-	err = j.Set(ctx, etcdKV)
-	if err != nil {
-		return fmt.Errorf("error setting job: %s", err.Error())
-	}
+	// Etcd sorts keys as strings
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID.ID < jobs[j].ID.ID
+	})
 
-	return nil
+	return jobs, nil
 }
 
 // Set stores a job in Etcd
@@ -127,6 +242,42 @@ func (j Job) Set(ctx context.Context, etcdKV etcd.KeysAPI) error {
 
 // Get retrieves a job from Etcd. The ID, Metadata.Owner, and
 // Metadata.Name fields must be set for method to work properly.
-func (j Job) Get(ctx context.Context, etcdKV etcd.KeysAPI) error {
+func (j *Job) Get(ctx context.Context, etcdKV etcd.KeysAPI) error {
 	return libetcd.GetJSON(ctx, etcdKV, j.ID.key(), j)
 }
+
+// Delete removes a job, its action output, the manifests it deployed, and
+// its cancellation. The job is removed last, so a failed delete can be
+// retried.
+func (j Job) Delete(ctx context.Context, etcdKV etcd.KeysAPI,
+	logStore LogStore) error {
+
+	err := logStore.DeleteJob(ctx, j.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting job output: %s", err.Error())
+	}
+
+	for _, key := range []string{j.ID.manifestsKey(),
+		j.ID.cancellationKey(), j.ID.key()} {
+
+		_, err = etcdKV.Delete(ctx, key, &etcd.DeleteOptions{
+			Recursive: true,
+		})
+		if err != nil && !etcd.IsKeyNotFound(err) {
+			return fmt.Errorf("error deleting %s from Etcd: %s", key,
+				err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Update retrieves a job from Etcd, calls update to modify it, then saves
+// the job if no one else saved it in the meantime. Otherwise retries with the
+// newly saved job. Errors returned by update are returned unwrapped. The ID
+// field must be set for this method to work properly.
+func (j *Job) Update(ctx context.Context, etcdKV etcd.KeysAPI,
+	update func() error) error {
+
+	return libetcd.UpdateJSON(ctx, etcdKV, j.ID.key(), j, update)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+)
+
+func TestJobCreateUniqueIDs(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	repoID := RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}
+
+	const creators int = 5
+
+	var wg sync.WaitGroup
+	ids := make(chan int64, creators)
+
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			job := NewJob(repoID, JobTarget{
+				Branch: "master",
+			})
+
+			err := job.Create(context.Background(), etcdKV)
+			if err != nil {
+				t.Errorf("error creating job: %s", err.Error())
+				return
+			}
+
+			ids <- job.ID.ID
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("job ID %d was created more than once", id)
+		}
+
+		seen[id] = true
+	}
+
+	jobs, err := GetAllJobs(context.Background(), etcdKV, repoID)
+	if err != nil {
+		t.Fatalf("error retrieving jobs: %s", err.Error())
+	}
+
+	if len(jobs) != creators {
+		t.Errorf("expected %d jobs, found %d", creators, len(jobs))
+	}
+}
+
+func TestJobRedact(t *testing.T) {
+	job := NewJob(RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}, JobTarget{})
+
+	job.AddSecret("pass")
+	job.AddSecret("password")
+
+	redacted := job.Redact("Error running docker: password=password pass")
+	if redacted != "Error running docker: [secret]=[secret] [secret]" {
+		t.Errorf("expected secrets to be redacted, got: %s", redacted)
+	}
+}
@@ -1,49 +1,483 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
 // JobConfig holds information about the config of a job. Data
 // sourced from a file in the Git repository root.
 type JobConfig struct {
 	// Units holds the config for the units in a file. Keys are
 	// UnitConfig.ID values.
 	Units map[string]UnitConfig `json:"units"`
+
+	// Environments holds the config for the environments units are
+	// deployed to. Keys are EnvironmentConfig.ID values. If empty units
+	// are deployed to DefaultEnvironment.
+	Environments map[string]EnvironmentConfig `json:"environments"`
+
+	// Concurrency controls how deploys from different jobs are kept from
+	// running at the same time
+	Concurrency ConcurrencyConfig `json:"concurrency"`
+
+	// EnvironmentUnits holds the units rendered for each environment, as
+	// units can use the environment template variable. Keys are
+	// environment IDs, then UnitConfig.ID values. See UnitFor.
+	EnvironmentUnits map[string]map[string]UnitConfig `json:"environment_units"`
+
+	// unitTemplates holds the units before they were rendered, so
+	// EnvironmentUnits can be rendered again once configuration files are
+	// merged. Keys are UnitConfig.ID values.
+	unitTemplates map[string]unitTemplate
+
+	// vars are the variables templates were rendered with
+	vars TemplateVars
 }
 
 // NewJobConfig creates a new JobConfig
 func NewJobConfig() JobConfig {
 	return JobConfig{
-		Units: map[string]UnitConfig{},
+		Units:         map[string]UnitConfig{},
+		Environments:  map[string]EnvironmentConfig{},
+		unitTemplates: map[string]unitTemplate{},
+	}
+}
+
+// ParseJobConfig decodes, renders, and validates the contents of a job
+// configuration file. The top level "environments" key holds environments,
+// and the "concurrency" key holds concurrency config. Every other top level
+// key is a unit. Templates in string fields are rendered with vars.
+func ParseJobConfig(data string, format ConfigFormat,
+	vars TemplateVars) (JobConfig, error) {
+
+	var cfg JobConfig
+	var err error
+
+	switch format {
+	case FormatTOML:
+		cfg, err = decodeTOMLConfig(data)
+	case FormatYAML:
+		cfg, err = decodeYAMLConfig(data)
+	case FormatJSON:
+		cfg, err = decodeJSONConfig([]byte(data))
+	default:
+		return cfg, fmt.Errorf("unknown configuration format: %s",
+			format)
+	}
+
+	if err != nil {
+		return cfg, err
+	}
+
+	for id, unit := range cfg.Units {
+		unit.ID = id
+		cfg.Units[id] = unit
+	}
+
+	for id, env := range cfg.Environments {
+		env.ID = id
+		cfg.Environments[id] = env
+	}
+
+	err = cfg.Render(vars)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that all required fields are set. Returns ConfigErrors
+// with the first problem in each unit, environment, and the concurrency
+// config.
+func (c JobConfig) Validate() error {
+	cfgErrs := ConfigErrors{}
+
+	for _, id := range c.UnitIDs() {
+		for _, unit := range c.renderedUnits(id) {
+			err := unit.Validate()
+			if err != nil {
+				cfgErrs = append(cfgErrs, prefixConfigError(id, err))
+				break
+			}
+		}
+	}
+
+	for _, id := range c.environmentIDs() {
+		err := c.Environments[id].Validate()
+		if err != nil {
+			cfgErrs = append(cfgErrs, prefixConfigError(
+				fmt.Sprintf("%s.%s", EnvironmentsKey, id), err))
+		}
+	}
+
+	err := c.Concurrency.Validate()
+	if err != nil {
+		cfgErrs = append(cfgErrs, prefixConfigError(ConcurrencyKey, err))
+	}
+
+	if len(cfgErrs) > 0 {
+		return cfgErrs
 	}
+
+	return nil
+}
+
+// helmReleasePattern matches names Helm accepts for releases
+var helmReleasePattern *regexp.Regexp = regexp.MustCompile(
+	`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// HelmReleaseMaxLength is the longest name Helm accepts for a release
+const HelmReleaseMaxLength int = 53
+
+// Warnings returns problems which do not stop the configuration from being
+// used, but which likely were not intended. Only valid configurations are
+// checked.
+func (c JobConfig) Warnings() []ConfigError {
+	warnings := []ConfigError{}
+
+	if len(c.Environments) == 0 {
+		warnings = append(warnings, configErrorf(EnvironmentsKey,
+			"no environments defined, every branch and tag will "+
+				"deploy to the %s environment",
+			DefaultEnvironment.ID))
+	}
+
+	for _, id := range c.UnitIDs() {
+		for _, unit := range c.renderedUnits(id) {
+			if unit.Helm == nil {
+				continue
+			}
+
+			release := unit.HelmRelease()
+			if helmReleasePattern.MatchString(release) &&
+				len(release) <= HelmReleaseMaxLength {
+
+				continue
+			}
+
+			path := id
+			if len(unit.Helm.Release) > 0 {
+				path = id + ".helm.release"
+			}
+
+			warnings = append(warnings, configErrorf(path,
+				"\"%s\" is not a valid Helm release name, it must "+
+					"be at most %d lower case letters, numbers, "+
+					"and dashes", release, HelmReleaseMaxLength))
+			break
+		}
+	}
+
+	return warnings
+}
+
+// environmentIDs returns the IDs of all environments in alphabetical order
+func (c JobConfig) environmentIDs() []string {
+	ids := []string{}
+
+	for id := range c.Environments {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// UnitIDs returns the IDs of all units in alphabetical order
+func (c JobConfig) UnitIDs() []string {
+	ids := []string{}
+
+	for id := range c.Units {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
 }
 
 // UnitConfig holds the config for a unit
 type UnitConfig struct {
 	// ID holds the name of the unit
-	ID string `json:"id"`
+	ID string `json:"id" toml:"-"`
 
 	// Docker holds Docker unit config. Nil if not present.
-	Docker *DockerActionConfig `json:"docker"`
+	Docker *DockerActionConfig `json:"docker" toml:"docker"`
 
 	// Helm holds Helm unit config. Nil if not present.
-	Helm *HelmActionConfig `json:"helm"`
+	Helm *HelmActionConfig `json:"helm" toml:"helm"`
+
+	// Kubernetes holds Kubernetes manifest unit config. Nil if not
+	// present.
+	Kubernetes *KubernetesActionConfig `json:"kubernetes" toml:"kubernetes"`
+
+	// Kustomize holds kustomize unit config. Nil if not present.
+	Kustomize *KustomizeActionConfig `json:"kustomize" toml:"kustomize"`
+
+	// Rollback indicates what happens when a unit fails to deploy. One of
+	// the RollbackPolicy values. Defaults to RollbackAuto.
+	Rollback RollbackPolicy `json:"rollback" toml:"rollback"`
+
+	// Approval is a manual approval which must be given before the unit
+	// is deployed to any environment. Nil if not required.
+	Approval *ApprovalConfig `json:"approval" toml:"approval"`
+
+	// Retry holds the retry policies of the unit's actions. Keys are
+	// action names, see RetryActions.
+	Retry map[string]RetryConfig `json:"retry" toml:"retry"`
+
+	// Timeouts holds how long each of the unit's actions may run, as Go
+	// duration strings. Keys are action names, see TimeoutActions. Actions
+	// without a timeout use the API's configured default.
+	Timeouts map[string]string `json:"timeouts" toml:"timeouts"`
+}
+
+// RollbackPolicy indicates what happens when a unit fails to deploy
+type RollbackPolicy string
+
+const (
+	// RollbackAuto indicates the unit is rolled back to the last
+	// successful deploy of the branch
+	RollbackAuto RollbackPolicy = "auto"
+
+	// RollbackManual indicates the unit is left as is, and an operator
+	// must roll back
+	RollbackManual RollbackPolicy = "manual"
+
+	// RollbackOff indicates nothing is done
+	RollbackOff RollbackPolicy = "off"
+)
+
+// RollbackPolicy returns the unit's rollback policy, or the default if
+// not set
+func (c UnitConfig) RollbackPolicy() RollbackPolicy {
+	if len(c.Rollback) == 0 {
+		return RollbackAuto
+	}
+
+	return c.Rollback
+}
+
+// HelmRelease returns the name of the unit's Helm release
+func (c UnitConfig) HelmRelease() string {
+	if c.Helm != nil && len(c.Helm.Release) > 0 {
+		return c.Helm.Release
+	}
+
+	return c.ID
+}
+
+// Validate checks that the unit has at least one action and that each
+// action's required fields are set
+func (c UnitConfig) Validate() error {
+	if c.Docker == nil && c.Helm == nil && c.Kubernetes == nil &&
+		c.Kustomize == nil {
+		return errors.New("at least one action must be defined")
+	}
+
+	if c.Docker != nil {
+		if len(c.Docker.Directory) == 0 {
+			return configErrorf("docker.directory", "required")
+		}
+
+		if len(c.Docker.Tag) == 0 {
+			return configErrorf("docker.tag", "required")
+		}
+
+		// Build arguments are passed as environment variables
+		for name := range c.Docker.BuildArgs {
+			if !SecretNamePattern.MatchString(name) {
+				return configErrorf("docker.build_args."+name,
+					"name must only contain letters, numbers, "+
+						"and underscores")
+			}
+		}
+	}
+
+	if c.Helm != nil {
+		if len(c.Helm.Chart) == 0 {
+			return configErrorf("helm.chart", "required")
+		}
+
+		if len(c.Helm.RolloutTimeout) > 0 {
+			_, err := time.ParseDuration(c.Helm.RolloutTimeout)
+			if err != nil {
+				return configErrorf("helm.rollout_timeout",
+					"invalid: %s", err.Error())
+			}
+		}
+
+		if len(c.Helm.ImagePullSecret) > 0 && c.Docker == nil {
+			return configErrorf("helm.image_pull_secret",
+				"requires a docker action")
+		}
+
+		if len(c.Helm.ImageValue) > 0 && c.Docker == nil {
+			return configErrorf("helm.image_value",
+				"requires a docker action")
+		}
+	}
+
+	if c.Kubernetes != nil && len(c.Kubernetes.Directory) == 0 {
+		return configErrorf("kubernetes.directory", "required")
+	}
+
+	if c.Kustomize != nil && len(c.Kustomize.Directory) == 0 {
+		return configErrorf("kustomize.directory", "required")
+	}
+
+	if c.Approval != nil {
+		err := c.Approval.Validate()
+		if err != nil {
+			return prefixConfigError("approval", err)
+		}
+	}
+
+	err := c.validateRetry()
+	if err != nil {
+		return err
+	}
+
+	err = c.validateTimeouts()
+	if err != nil {
+		return err
+	}
+
+	switch c.RollbackPolicy() {
+	case RollbackAuto, RollbackManual, RollbackOff:
+	default:
+		return configErrorf("rollback", "must be \"%s\", \"%s\", or "+
+			"\"%s\"", RollbackAuto, RollbackManual, RollbackOff)
+	}
+
+	// Both actions prune resources with the unit's labels, so they would
+	// delete each other's resources
+	if c.Kubernetes != nil && c.Kustomize != nil {
+		return errors.New("kubernetes and kustomize actions cannot " +
+			"be defined in the same unit")
+	}
+
+	return nil
 }
 
 // DockerActionConfig holds the config for a Docker action.
 type DockerActionConfig struct {
 	// Directory indicates the directory where the Dockerfile to build
 	// is located.
-	Directory string `json:"directory"`
+	Directory string `json:"directory" toml:"directory"`
 
 	// Tag indicates the value of the Docker image tag to apply.
-	Tag string `json:"tag"`
+	Tag string `json:"tag" toml:"tag"`
+
+	// BuildArgs are passed to the build as --build-arg values. Values
+	// can reference repository secrets as ${secrets.NAME}.
+	BuildArgs map[string]string `json:"build_args" toml:"build_args"`
+
+	// CacheRef is the image reference build layers are cached in, when
+	// the API uses a builder which caches in the registry. Defaults to
+	// the tag's repository with the DefaultCacheTag tag.
+	CacheRef string `json:"cache_ref" toml:"cache_ref"`
+}
+
+// DefaultCacheTag is the tag of the default DockerActionConfig.CacheRef
+const DefaultCacheTag string = "buildcache"
+
+// GetCacheRef returns the build cache image reference, or the default if
+// not set
+func (c DockerActionConfig) GetCacheRef() string {
+	if len(c.CacheRef) > 0 {
+		return c.CacheRef
+	}
+
+	return fmt.Sprintf("%s:%s", ImageRepository(c.Tag), DefaultCacheTag)
+}
+
+// ImageRepository returns an image reference without its tag or digest
+func ImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+
+	// A colon after the last slash separates the tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image,
+		"/") {
+		image = image[:i]
+	}
+
+	return image
 }
 
 // HelmActionConfig holds the config for a Helm action.
 type HelmActionConfig struct {
 	// Chart is the local path to a Helm chart to deploy, or if the
 	// Repository field is set it holds the name of a Helm chart to deploy.
-	Chart string `json:"chart"`
+	Chart string `json:"chart" toml:"chart"`
 
 	// Repository is the name of the repository where the Chart is located.
 	// If empty the Chart field is treated as a local path to a Helm chart.
-	Repository string `json:"repository"`
+	Repository string `json:"repository" toml:"repository"`
+
+	// Release is the name of the Helm release. Defaults to the unit's ID.
+	Release string `json:"release" toml:"release"`
+
+	// Namespace is the namespace the Helm release is installed in.
+	// Defaults to "default".
+	Namespace string `json:"namespace" toml:"namespace"`
+
+	// RolloutTimeout is how long to wait for the release's Deployments,
+	// StatefulSets, and DaemonSets to roll out after an upgrade. Formatted
+	// as a Go duration, ex: "10m". Defaults to 5 minutes.
+	RolloutTimeout string `json:"rollout_timeout" toml:"rollout_timeout"`
+
+	// ImagePullSecret is the name of a Secret created in the release's
+	// namespace before each upgrade, with the credentials of the registry
+	// the unit's Docker action pushes to. The chart must reference the
+	// Secret. If empty no Secret is created.
+	ImagePullSecret string `json:"image_pull_secret" toml:"image_pull_secret"`
+
+	// ImageValue is the name of the chart value which is set to the image
+	// built by the unit's Docker action, ex: "image". The image may have
+	// been built by an earlier job if the build context did not change.
+	// If empty no value is set.
+	ImageValue string `json:"image_value" toml:"image_value"`
+}
+
+// KubernetesActionConfig holds the config for a Kubernetes manifest action.
+type KubernetesActionConfig struct {
+	// Directory is the local path to a directory of Kubernetes manifest
+	// files. Files ending in .yaml, .yml, or .json are applied.
+	Directory string `json:"directory" toml:"directory"`
+
+	// Namespace is the namespace resources are applied in. Defaults to
+	// "default".
+	Namespace string `json:"namespace" toml:"namespace"`
+}
+
+// KustomizeActionConfig holds the config for a kustomize action.
+type KustomizeActionConfig struct {
+	// Directory is the local path to the kustomization directory to
+	// render. Usually an overlay for one environment.
+	Directory string `json:"directory" toml:"directory"`
+
+	// Namespace is the namespace resources without a namespace are
+	// applied in. Defaults to "default".
+	Namespace string `json:"namespace" toml:"namespace"`
+
+	// Images are the names of images in the rendered resources which
+	// are replaced by the image built by the unit's Docker action. If
+	// empty, images with the same repository as the Docker action's tag
+	// are replaced.
+	Images []string `json:"images" toml:"images"`
 }
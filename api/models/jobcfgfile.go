@@ -0,0 +1,351 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+)
+
+// JobConfigFileName is the name of the TOML file in a repository's root
+// which holds job configuration
+const JobConfigFileName string = "kube-git-deploy.toml"
+
+// ConfigFormat is the syntax of a job configuration file
+type ConfigFormat string
+
+const (
+	// FormatTOML indicates a TOML file
+	FormatTOML ConfigFormat = "toml"
+
+	// FormatYAML indicates a YAML file
+	FormatYAML ConfigFormat = "yaml"
+
+	// FormatJSON indicates a JSON file
+	FormatJSON ConfigFormat = "json"
+)
+
+// ConfigFormats are all the job configuration file formats
+var ConfigFormats []ConfigFormat = []ConfigFormat{FormatTOML, FormatYAML,
+	FormatJSON}
+
+// JobConfigFileNames are the names a job configuration file in a
+// repository's root can have
+var JobConfigFileNames []string = []string{JobConfigFileName,
+	"kube-git-deploy.yaml", "kube-git-deploy.yml", "kube-git-deploy.json"}
+
+// ErrNoJobConfigFile indicates a directory does not contain a job
+// configuration file
+var ErrNoJobConfigFile error = fmt.Errorf("no %s file found",
+	strings.Join(JobConfigFileNames, ", "))
+
+// ConfigFormatFor returns the format of a job configuration file, based on
+// its extension
+func ConfigFormatFor(path string) (ConfigFormat, error) {
+	switch filepath.Ext(path) {
+	case ".toml":
+		return FormatTOML, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("%s must end in .toml, .yaml, .yml, or "+
+			".json", filepath.Base(path))
+	}
+}
+
+// FindJobConfigFile returns the path of the job configuration file in a
+// directory. Returns ErrNoJobConfigFile if there is none, or an error if
+// there is more than one.
+func FindJobConfigFile(dir string) (string, error) {
+	found := []string{}
+
+	for _, name := range JobConfigFileNames {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("error checking for %s: %s", name,
+				err.Error())
+		}
+
+		found = append(found, name)
+	}
+
+	if len(found) == 0 {
+		return "", ErrNoJobConfigFile
+	} else if len(found) > 1 {
+		return "", fmt.Errorf("only one configuration file can exist, "+
+			"found: %s", strings.Join(found, ", "))
+	}
+
+	return filepath.Join(dir, found[0]), nil
+}
+
+// decodeTOMLConfig decodes a TOML job configuration file
+func decodeTOMLConfig(data string) (JobConfig, error) {
+	cfg := NewJobConfig()
+
+	var tables map[string]toml.Primitive
+
+	md, err := toml.Decode(data, &tables)
+	if err != nil {
+		return cfg, tomlConfigError(err)
+	}
+
+	for key, table := range tables {
+		if key == EnvironmentsKey {
+			err = md.PrimitiveDecode(table, &cfg.Environments)
+		} else if key == ConcurrencyKey {
+			err = md.PrimitiveDecode(table, &cfg.Concurrency)
+		} else {
+			var unit UnitConfig
+			err = md.PrimitiveDecode(table, &unit)
+			cfg.Units[key] = unit
+		}
+
+		if err != nil {
+			return cfg, configErrorf(key, "error decoding: %s",
+				err.Error())
+		}
+	}
+
+	// Check for keys which do not match any config fields
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		cfgErrs := ConfigErrors{}
+		for _, key := range undecoded {
+			cfgErrs = append(cfgErrs, configErrorf(key.String(),
+				"unknown key"))
+		}
+
+		return cfg, cfgErrs
+	}
+
+	return cfg, nil
+}
+
+// tomlParseErrorPattern matches the errors returned by the TOML parser
+var tomlParseErrorPattern *regexp.Regexp = regexp.MustCompile(
+	`^Near line (\d+) \(last key parsed '([^']*)'\): (.*)$`)
+
+// tomlConfigError converts a TOML parse error to a ConfigError
+func tomlConfigError(err error) ConfigError {
+	match := tomlParseErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return configErrorf("", "error decoding TOML: %s", err.Error())
+	}
+
+	line, _ := strconv.Atoi(match[1])
+
+	return ConfigError{
+		Path:    match[2],
+		Line:    line,
+		Message: fmt.Sprintf("error decoding TOML: %s", match[3]),
+	}
+}
+
+// yamlErrorPattern matches the errors returned by the YAML parser
+var yamlErrorPattern *regexp.Regexp = regexp.MustCompile(
+	`yaml: line (\d+): (.*)$`)
+
+// decodeYAMLConfig decodes a YAML job configuration file. The file is
+// converted to JSON, so it is decoded with the same field names as a JSON
+// file.
+func decodeYAMLConfig(data string) (JobConfig, error) {
+	jsonData, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		match := yamlErrorPattern.FindStringSubmatch(err.Error())
+		if match == nil {
+			return NewJobConfig(), configErrorf("", "error decoding "+
+				"YAML: %s", err.Error())
+		}
+
+		line, _ := strconv.Atoi(match[1])
+
+		return NewJobConfig(), ConfigError{
+			Line:    line,
+			Message: fmt.Sprintf("error decoding YAML: %s", match[2]),
+		}
+	}
+
+	return decodeJSONConfig(jsonData)
+}
+
+// decodeJSONConfig decodes a JSON job configuration file
+func decodeJSONConfig(data []byte) (JobConfig, error) {
+	cfg := NewJobConfig()
+
+	var tables map[string]json.RawMessage
+
+	err := json.Unmarshal(data, &tables)
+	if err != nil {
+		cfgErr := configErrorf("", "error decoding JSON: %s", err.Error())
+
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			cfgErr.Line = 1 + strings.Count(
+				string(data[:syntaxErr.Offset]), "\n")
+		}
+
+		return cfg, cfgErr
+	}
+
+	keys := []string{}
+	for key := range tables {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	// Check for keys which do not match any config fields
+	cfgErrs := ConfigErrors{}
+
+	for _, key := range keys {
+		var target interface{}
+
+		if key == EnvironmentsKey {
+			target = &cfg.Environments
+		} else if key == ConcurrencyKey {
+			target = &cfg.Concurrency
+		} else {
+			target = &UnitConfig{}
+		}
+
+		var value interface{}
+
+		err = json.Unmarshal(tables[key], &value)
+		if err != nil {
+			return cfg, configErrorf(key, "error decoding: %s",
+				err.Error())
+		}
+
+		cfgErrs = append(cfgErrs, unknownKeys(value,
+			reflect.TypeOf(target), key)...)
+	}
+
+	if len(cfgErrs) > 0 {
+		return cfg, cfgErrs
+	}
+
+	// Decode
+	for _, key := range keys {
+		if key == EnvironmentsKey {
+			err = json.Unmarshal(tables[key], &cfg.Environments)
+		} else if key == ConcurrencyKey {
+			err = json.Unmarshal(tables[key], &cfg.Concurrency)
+		} else {
+			var unit UnitConfig
+			err = json.Unmarshal(tables[key], &unit)
+			cfg.Units[key] = unit
+		}
+
+		if err != nil {
+			return cfg, configErrorf(key, "error decoding: %s",
+				err.Error())
+		}
+	}
+
+	// A null environments value decodes to a nil map
+	if cfg.Environments == nil {
+		cfg.Environments = map[string]EnvironmentConfig{}
+	}
+
+	return cfg, nil
+}
+
+// configFieldKey returns the key of a configuration struct field in a
+// configuration file. Empty if the field can not be set by a file.
+func configFieldKey(field reflect.StructField) string {
+	key := field.Tag.Get("toml")
+	if key == "-" {
+		return ""
+	}
+
+	return key
+}
+
+// unknownKeys returns errors for the keys in a decoded JSON value which do
+// not match any fields of the type it will be decoded into. path is the key
+// of the value. Values with the wrong type are left for the decoder to
+// report.
+func unknownKeys(value interface{}, t reflect.Type,
+	path string) []ConfigError {
+
+	cfgErrs := []ConfigError{}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return cfgErrs
+		}
+
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			if key := configFieldKey(t.Field(i)); len(key) > 0 {
+				fields[key] = t.Field(i).Type
+			}
+		}
+
+		for _, key := range sortedObjectKeys(obj) {
+			fieldType, ok := fields[key]
+			if !ok {
+				cfgErrs = append(cfgErrs, configErrorf(
+					path+"."+key, "unknown key"))
+				continue
+			}
+
+			cfgErrs = append(cfgErrs, unknownKeys(obj[key], fieldType,
+				path+"."+key)...)
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return cfgErrs
+		}
+
+		for _, key := range sortedObjectKeys(obj) {
+			cfgErrs = append(cfgErrs, unknownKeys(obj[key], t.Elem(),
+				path+"."+key)...)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return cfgErrs
+		}
+
+		for i, item := range items {
+			cfgErrs = append(cfgErrs, unknownKeys(item, t.Elem(),
+				fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return cfgErrs
+}
+
+// sortedObjectKeys returns the keys of a decoded JSON object in
+// alphabetical order
+func sortedObjectKeys(obj map[string]interface{}) []string {
+	keys := []string{}
+	for key := range obj {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
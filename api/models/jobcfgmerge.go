@@ -0,0 +1,275 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FindJobConfigFiles returns the paths of the job configuration files in a
+// directory and all its subdirectories, relative to the directory. Hidden
+// directories, ex: .git, are skipped. Returns ErrNoJobConfigFile if there
+// are none, or an error if a directory has more than one.
+func FindJobConfigFiles(dir string) ([]string, error) {
+	found := []string{}
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if p != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		cfgPath, err := FindJobConfigFile(p)
+		if err == ErrNoJobConfigFile {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, cfgPath)
+		if err != nil {
+			return err
+		}
+
+		found = append(found, filepath.ToSlash(rel))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, ErrNoJobConfigFile
+	}
+
+	sort.Strings(found)
+
+	return found, nil
+}
+
+// resolveConfigPath returns a path from a configuration file in dir
+// relative to the repository root. Paths starting with "/" are already
+// relative to the root. Paths may not leave the repository.
+func resolveConfigPath(dir, p string) (string, error) {
+	resolved := path.Join(dir, p)
+	if path.IsAbs(p) {
+		resolved = path.Clean(strings.TrimPrefix(p, "/"))
+	}
+
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("\"%s\" is outside the repository", p)
+	}
+
+	return resolved, nil
+}
+
+// configPath is a local path in a unit's configuration
+type configPath struct {
+	// key is the path's key in the unit
+	key string
+
+	// value points to the path in the unit
+	value *string
+}
+
+// ResolvePaths changes the local paths in a configuration file in dir to be
+// relative to the repository root. dir is relative to the root, "." if the
+// file is in the root.
+func (c *JobConfig) ResolvePaths(dir string) error {
+	for _, id := range c.UnitIDs() {
+		unit := c.Units[id]
+
+		err := unit.resolvePaths(dir)
+		if err != nil {
+			return prefixConfigError(id, err)
+		}
+
+		c.Units[id] = unit
+
+		if raw, ok := c.unitTemplates[id]; ok {
+			raw.dir = dir
+			c.unitTemplates[id] = raw
+		}
+	}
+
+	// Units for environments are resolved when rendered
+	if len(c.unitTemplates) > 0 {
+		return c.renderEnvironmentUnits()
+	}
+
+	return nil
+}
+
+// resolvePaths changes the unit's local paths in a configuration file in dir
+// to be relative to the repository root
+func (c *UnitConfig) resolvePaths(dir string) error {
+	paths := []configPath{}
+
+	if c.Docker != nil {
+		paths = append(paths, configPath{"docker.directory",
+			&c.Docker.Directory})
+	}
+
+	if c.Helm != nil && len(c.Helm.Repository) == 0 {
+		paths = append(paths, configPath{"helm.chart", &c.Helm.Chart})
+	}
+
+	if c.Kubernetes != nil {
+		paths = append(paths, configPath{"kubernetes.directory",
+			&c.Kubernetes.Directory})
+	}
+
+	if c.Kustomize != nil {
+		paths = append(paths, configPath{"kustomize.directory",
+			&c.Kustomize.Directory})
+	}
+
+	for _, p := range paths {
+		resolved, err := resolveConfigPath(dir, *p.value)
+		if err != nil {
+			return configErrorf(p.key, "%s", err.Error())
+		}
+
+		*p.value = resolved
+	}
+
+	return nil
+}
+
+// ParseJobConfigFile parses a job configuration file and resolves its paths
+// relative to the repository root. cfgPath is the file's path relative to
+// the root, its extension is the file's format.
+func ParseJobConfigFile(cfgPath, data string,
+	vars TemplateVars) (JobConfig, error) {
+
+	format, err := ConfigFormatFor(cfgPath)
+	if err != nil {
+		return NewJobConfig(), err
+	}
+
+	cfg, err := ParseJobConfig(data, format, vars)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = cfg.ResolvePaths(path.Dir(cfgPath))
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// UnitIDPrefix returns the prefix added to the IDs of units in a
+// configuration file in a subdirectory, ex: "services-web-" for
+// "services/web". Empty for the repository root.
+func UnitIDPrefix(dir string) string {
+	if dir == "." || len(dir) == 0 {
+		return ""
+	}
+
+	return strings.Replace(dir, "/", "-", -1) + "-"
+}
+
+// MergeJobConfigs combines the configuration files found in a repository's
+// directories into one configuration. Keys are the directories of the
+// files, relative to the repository root. Paths must already be resolved.
+// The IDs of units are prefixed with UnitIDPrefix. Environments and
+// concurrency config can be in any file, but only defined once. Conflicts
+// are returned as ConfigErrors.
+func MergeJobConfigs(configs map[string]JobConfig) (JobConfig, error) {
+	merged := NewJobConfig()
+
+	dirs := []string{}
+	for dir := range configs {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+
+	unitDirs := map[string]string{}
+	envDirs := map[string]string{}
+	concurrencyDir := ""
+
+	cfgErrs := ConfigErrors{}
+
+	for _, dir := range dirs {
+		cfg := configs[dir]
+
+		for _, id := range cfg.UnitIDs() {
+			unit := cfg.Units[id]
+			unit.ID = UnitIDPrefix(dir) + id
+
+			if otherDir, ok := unitDirs[unit.ID]; ok {
+				cfgErrs = append(cfgErrs, configErrorf(unit.ID,
+					"unit ID from %s conflicts with a unit in %s",
+					dir, otherDir))
+				continue
+			}
+
+			unitDirs[unit.ID] = dir
+			merged.Units[unit.ID] = unit
+
+			if raw, ok := cfg.unitTemplates[id]; ok {
+				merged.unitTemplates[unit.ID] = raw
+				merged.vars = cfg.vars
+			}
+		}
+
+		for _, id := range cfg.environmentIDs() {
+			if otherDir, ok := envDirs[id]; ok {
+				cfgErrs = append(cfgErrs, configErrorf(
+					EnvironmentsKey+"."+id, "environment in %s is "+
+						"already defined in %s", dir, otherDir))
+				continue
+			}
+
+			envDirs[id] = dir
+			merged.Environments[id] = cfg.Environments[id]
+		}
+
+		if cfg.Concurrency == (ConcurrencyConfig{}) {
+			continue
+		}
+
+		if len(concurrencyDir) > 0 {
+			cfgErrs = append(cfgErrs, configErrorf(ConcurrencyKey,
+				"concurrency in %s is already defined in %s", dir,
+				concurrencyDir))
+			continue
+		}
+
+		concurrencyDir = dir
+		merged.Concurrency = cfg.Concurrency
+	}
+
+	if len(cfgErrs) > 0 {
+		return merged, cfgErrs
+	}
+
+	// Units can be deployed to environments from other files
+	err := merged.renderEnvironmentUnits()
+	if err != nil {
+		return merged, err
+	}
+
+	err = merged.Validate()
+	if err != nil {
+		return merged, err
+	}
+
+	return merged, nil
+}
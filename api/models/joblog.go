@@ -0,0 +1,489 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// LogChunkLines is the maximum number of output lines stored in a single
+// Etcd log chunk. Keeps each value well below Etcd's value size limit.
+const LogChunkLines int = 200
+
+// LogID identifies the output log of one action in a job
+type LogID struct {
+	// JobID is the job which the action belongs to
+	JobID JobID `json:"job_id"`
+
+	// Action is the name of the action. Ex: "prepare" or
+	// "units/api/docker".
+	Action string `json:"action"`
+}
+
+// errInvalidLogAction is returned when a LogID's action could be used to
+// reference a log outside of the job's logs
+var errInvalidLogAction = errors.New("action must be slash separated " +
+	"names, which are not \".\" or \"..\" and do not contain \"\\\"")
+
+// Validate ensures the action is made of slash separated names which can be
+// used as Etcd keys and file names without leaving the job's logs
+func (i LogID) Validate() error {
+	for _, name := range strings.Split(i.Action, "/") {
+		if len(name) == 0 || name == "." || name == ".." ||
+			strings.ContainsRune(name, '\\') {
+
+			return errInvalidLogAction
+		}
+	}
+
+	return nil
+}
+
+// actionNames returns the slash separated names of the action with each
+// name escaped
+func (i LogID) actionNames() []string {
+	names := strings.Split(i.Action, "/")
+	for j := range names {
+		names[j] = url.PathEscape(names[j])
+	}
+
+	return names
+}
+
+// logsKey returns the Etcd directory key which the logs of a job's actions
+// are stored under
+func (i JobID) logsKey() string {
+	return fmt.Sprintf("%s/logs/%d", i.RepositoryID.key(), i.ID)
+}
+
+// key returns the Etcd directory key which log chunks are stored under
+func (i LogID) key() string {
+	return fmt.Sprintf("%s/%s", i.JobID.logsKey(),
+		strings.Join(i.actionNames(), "/"))
+}
+
+// LogStore holds the output of job actions. Logs are append only.
+type LogStore interface {
+	// Append adds lines to the end of a log. Returns the number of lines
+	// which were stored, which is less than len(lines) if an error
+	// occurred part way.
+	Append(ctx context.Context, id LogID, lines []ActionOutput) (int,
+		error)
+
+	// Read retrieves at most limit lines from a log, starting at line
+	// offset. A limit less than 1 retrieves all lines after the offset.
+	// Also returns the total number of lines in the log.
+	Read(ctx context.Context, id LogID, offset,
+		limit int) ([]ActionOutput, int, error)
+
+	// DeleteJob removes the logs of every action in a job
+	DeleteJob(ctx context.Context, jobID JobID) error
+}
+
+// FlushOutput writes any output which actions in the job have produced since
+// the last flush to a LogStore. Secret values added with AddSecret are
+// redacted.
+func (j *Job) FlushOutput(ctx context.Context, logStore LogStore) error {
+	for action, state := range j.State.actionStates() {
+		if len(state.pending) == 0 {
+			continue
+		}
+
+		for i := range state.pending {
+			state.pending[i].Text = j.Redact(state.pending[i].Text)
+		}
+
+		state.LastError = j.Redact(state.LastError)
+
+		n, err := logStore.Append(ctx, LogID{
+			JobID:  j.ID,
+			Action: action,
+		}, state.pending)
+
+		// Only keep lines which were not stored, so they are not
+		// stored twice by the next flush
+		state.pending = state.pending[n:]
+
+		if err != nil {
+			return fmt.Errorf("error appending %s action output to "+
+				"log: %s", action, err.Error())
+		}
+
+		state.pending = nil
+	}
+
+	return nil
+}
+
+// Save flushes action output to a LogStore and then stores the job in Etcd
+func (j *Job) Save(ctx context.Context, etcdKV etcd.KeysAPI,
+	logStore LogStore) error {
+
+	err := j.FlushOutput(ctx, logStore)
+	if err != nil {
+		return fmt.Errorf("error flushing job output: %s", err.Error())
+	}
+
+	return j.Set(ctx, etcdKV)
+}
+
+// EtcdLogStore stores logs in Etcd. Lines are stored in chunks of
+// LogChunkLines lines, so a page of a log can be read without retrieving the
+// whole log. The number of lines in a log is stored in its own key, which is
+// updated after each chunk is saved.
+type EtcdLogStore struct {
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// NewEtcdLogStore creates a new EtcdLogStore
+func NewEtcdLogStore(etcdKV etcd.KeysAPI) EtcdLogStore {
+	return EtcdLogStore{
+		etcdKV: etcdKV,
+	}
+}
+
+// linesKey returns the Etcd key which holds the number of lines in a log
+func (i LogID) linesKey() string {
+	return fmt.Sprintf("%s/lines", i.key())
+}
+
+// chunkKey returns the Etcd key which holds a chunk of a log
+func (i LogID) chunkKey(chunk int) string {
+	return fmt.Sprintf("%s/chunks/%d", i.key(), chunk)
+}
+
+// lineCount retrieves the number of lines in a log
+func (s EtcdLogStore) lineCount(ctx context.Context, id LogID) (int, error) {
+	resp, err := s.etcdKV.Get(ctx, id.linesKey(), &etcd.GetOptions{
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("error retrieving log line count from "+
+			"Etcd: %s", err.Error())
+	}
+
+	total, err := strconv.Atoi(resp.Node.Value)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing log line count: %s",
+			err.Error())
+	}
+
+	return total, nil
+}
+
+// readChunk retrieves the lines stored in a chunk of a log
+func (s EtcdLogStore) readChunk(ctx context.Context, id LogID,
+	chunk int) ([]ActionOutput, error) {
+
+	lines := []ActionOutput{}
+
+	err := libetcd.GetJSON(ctx, s.etcdKV, id.chunkKey(chunk), &lines)
+	if etcd.IsKeyNotFound(err) {
+		return []ActionOutput{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving log chunk %d: %s",
+			chunk, err.Error())
+	}
+
+	return lines, nil
+}
+
+// Append implements LogStore.Append. The last chunk is filled before a new
+// chunk is started.
+func (s EtcdLogStore) Append(ctx context.Context, id LogID,
+	lines []ActionOutput) (int, error) {
+
+	total, err := s.lineCount(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	appended := 0
+
+	for appended < len(lines) {
+		chunk := total / LogChunkLines
+		stored := []ActionOutput{}
+
+		// Lines past the line count were saved by an Append which
+		// failed before updating the count, they are overwritten
+		if keep := total % LogChunkLines; keep > 0 {
+			stored, err = s.readChunk(ctx, id, chunk)
+			if err != nil {
+				return appended, err
+			}
+
+			if len(stored) < keep {
+				return appended, fmt.Errorf("log chunk %d has %d "+
+					"lines, expected at least %d", chunk,
+					len(stored), keep)
+			}
+
+			stored = stored[:keep]
+		}
+
+		n := LogChunkLines - len(stored)
+		if n > len(lines)-appended {
+			n = len(lines) - appended
+		}
+
+		stored = append(stored, lines[appended:appended+n]...)
+
+		err = libetcd.SetJSON(ctx, s.etcdKV, id.chunkKey(chunk), stored)
+		if err != nil {
+			return appended, fmt.Errorf("error saving log chunk %d: %s",
+				chunk, err.Error())
+		}
+
+		_, err = s.etcdKV.Set(ctx, id.linesKey(),
+			strconv.Itoa(total+n), nil)
+		if err != nil {
+			return appended, fmt.Errorf("error saving log line count "+
+				"in Etcd: %s", err.Error())
+		}
+
+		total += n
+		appended += n
+	}
+
+	return appended, nil
+}
+
+// Read implements LogStore.Read. Only retrieves the chunks which hold the
+// requested lines.
+func (s EtcdLogStore) Read(ctx context.Context, id LogID, offset,
+	limit int) ([]ActionOutput, int, error) {
+
+	total, err := s.lineCount(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= total {
+		return []ActionOutput{}, total, nil
+	}
+
+	end := total
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	// Retrieve chunks
+	firstChunk := offset / LogChunkLines
+	lastChunk := (end - 1) / LogChunkLines
+
+	lines := []ActionOutput{}
+
+	for chunk := firstChunk; chunk <= lastChunk; chunk++ {
+		chunkLines, err := s.readChunk(ctx, id, chunk)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		lines = append(lines, chunkLines...)
+	}
+
+	// Page
+	start := offset - (firstChunk * LogChunkLines)
+	stop := start + (end - offset)
+
+	if stop > len(lines) {
+		return nil, 0, fmt.Errorf("log chunks %d to %d have %d lines, "+
+			"expected at least %d", firstChunk, lastChunk, len(lines),
+			stop)
+	}
+
+	return lines[start:stop], total, nil
+}
+
+// DeleteJob implements LogStore.DeleteJob
+func (s EtcdLogStore) DeleteJob(ctx context.Context, jobID JobID) error {
+	_, err := s.etcdKV.Delete(ctx, jobID.logsKey(), &etcd.DeleteOptions{
+		Recursive: true,
+	})
+	if err != nil && !etcd.IsKeyNotFound(err) {
+		return fmt.Errorf("error deleting logs from Etcd: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// FileLogStore stores logs in local files. Each log is a file with one
+// JSON encoded ActionOutput per line.
+type FileLogStore struct {
+	// dir is the directory log files are stored in
+	dir string
+
+	// lock prevents concurrent writes to log files
+	lock *sync.Mutex
+}
+
+// NewFileLogStore creates a new FileLogStore
+func NewFileLogStore(dir string) FileLogStore {
+	return FileLogStore{
+		dir:  dir,
+		lock: &sync.Mutex{},
+	}
+}
+
+// jobDir returns the directory the logs of a job's actions are stored in.
+// Fails if the directory would not be inside the store's directory.
+func (s FileLogStore) jobDir(jobID JobID) (string, error) {
+	dir := filepath.Join(s.dir,
+		url.PathEscape(jobID.RepositoryID.Owner),
+		url.PathEscape(jobID.RepositoryID.Name),
+		strconv.FormatInt(jobID.ID, 10))
+
+	rel, err := filepath.Rel(s.dir, dir)
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+
+		return "", fmt.Errorf("log path %s is outside of log "+
+			"directory %s", dir, s.dir)
+	}
+
+	return dir, nil
+}
+
+// path returns the path of the file a log is stored in. Fails if the path
+// would not be inside the store's directory.
+func (s FileLogStore) path(id LogID) (string, error) {
+	if err := id.Validate(); err != nil {
+		return "", err
+	}
+
+	dir, err := s.jobDir(id.JobID)
+	if err != nil {
+		return "", err
+	}
+
+	// Validated names do not contain separators once escaped
+	parts := append([]string{dir}, id.actionNames()...)
+
+	return filepath.Join(parts...) + ".log", nil
+}
+
+// Append implements LogStore.Append
+func (s FileLogStore) Append(ctx context.Context, id LogID,
+	lines []ActionOutput) (int, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return 0, fmt.Errorf("error creating log directory: %s",
+			err.Error())
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0644)
+	if err != nil {
+		return 0, fmt.Errorf("error opening log file: %s", err.Error())
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+
+	for i, line := range lines {
+		err = encoder.Encode(line)
+		if err != nil {
+			return i, fmt.Errorf("error writing line to log file: %s",
+				err.Error())
+		}
+	}
+
+	return len(lines), nil
+}
+
+// Read implements LogStore.Read
+func (s FileLogStore) Read(ctx context.Context, id LogID, offset,
+	limit int) ([]ActionOutput, int, error) {
+
+	path, err := s.path(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []ActionOutput{}, 0, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("error opening log file: %s",
+			err.Error())
+	}
+	defer f.Close()
+
+	lines := []ActionOutput{}
+	total := 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		// Only decode lines in the requested page
+		if total >= offset && (limit < 1 || len(lines) < limit) {
+			var line ActionOutput
+
+			err = json.Unmarshal(scanner.Bytes(), &line)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error unmarshalling "+
+					"log line %d: %s", total, err.Error())
+			}
+
+			lines = append(lines, line)
+		}
+
+		total++
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error reading log file: %s",
+			err.Error())
+	}
+
+	return lines, total, nil
+}
+
+// DeleteJob implements LogStore.DeleteJob
+func (s FileLogStore) DeleteJob(ctx context.Context, jobID JobID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dir, err := s.jobDir(jobID)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return fmt.Errorf("error deleting log directory: %s",
+			err.Error())
+	}
+
+	return nil
+}
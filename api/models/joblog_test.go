@@ -0,0 +1,419 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+)
+
+// testLogID is the log used by log store tests
+var testLogID = LogID{
+	JobID: JobID{
+		RepositoryID: RepositoryID{
+			Owner: "owner",
+			Name:  "repo",
+		},
+		ID: 1,
+	},
+	Action: "units/api/docker",
+}
+
+// testLines creates n lines of output numbered from start
+func testLines(start, n int) []ActionOutput {
+	lines := []ActionOutput{}
+	for i := start; i < start+n; i++ {
+		lines = append(lines, ActionOutput{
+			Text:  fmt.Sprintf("line %d", i),
+			Error: i%2 == 1,
+		})
+	}
+
+	return lines
+}
+
+// checkLines fails the test if lines are not the n lines numbered from start
+func checkLines(t *testing.T, lines []ActionOutput, start, n int) {
+	t.Helper()
+
+	expected := testLines(start, n)
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines from line %d, got %d", n, start,
+			len(lines))
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("expected line %d to be %#v, got %#v", start+i,
+				expected[i], lines[i])
+		}
+	}
+}
+
+// testLogStore appends lines across chunk boundaries and reads pages of them
+func testLogStore(t *testing.T, store LogStore) {
+	ctx := context.Background()
+
+	// Append, first append fills part of a chunk, the others cross the
+	// chunk boundary
+	total := 0
+	for _, n := range []int{150, 100, 2 * LogChunkLines} {
+		appended, err := store.Append(ctx, testLogID, testLines(total, n))
+		if err != nil {
+			t.Fatalf("error appending %d lines: %s", n, err.Error())
+		}
+
+		if appended != n {
+			t.Fatalf("expected %d lines appended, got %d", n,
+				appended)
+		}
+
+		total += n
+	}
+
+	// Read
+	pages := []struct {
+		offset int
+		limit  int
+		start  int
+		n      int
+	}{
+		{0, 0, 0, total},
+		{0, 10, 0, 10},
+		{195, 10, 195, 10},
+		{LogChunkLines, LogChunkLines, LogChunkLines, LogChunkLines},
+		{390, 500, 390, total - 390},
+		{total - 1, 0, total - 1, 1},
+		{total, 10, total, 0},
+		{total + 10, 10, total, 0},
+		{-5, 3, 0, 3},
+	}
+
+	for _, page := range pages {
+		lines, readTotal, err := store.Read(ctx, testLogID, page.offset,
+			page.limit)
+		if err != nil {
+			t.Fatalf("error reading %d lines from line %d: %s",
+				page.limit, page.offset, err.Error())
+		}
+
+		if readTotal != total {
+			t.Errorf("expected total of %d lines, got %d", total,
+				readTotal)
+		}
+
+		checkLines(t, lines, page.start, page.n)
+	}
+
+	// Read a log which does not exist
+	lines, readTotal, err := store.Read(ctx, LogID{
+		JobID:  testLogID.JobID,
+		Action: "prepare",
+	}, 0, 0)
+	if err != nil {
+		t.Fatalf("error reading empty log: %s", err.Error())
+	}
+
+	if len(lines) != 0 || readTotal != 0 {
+		t.Errorf("expected empty log, got %d of %d lines", len(lines),
+			readTotal)
+	}
+}
+
+func TestEtcdLogStore(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	testLogStore(t, NewEtcdLogStore(etcdKV))
+}
+
+func TestEtcdLogStoreOverwritesUncountedLines(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+	store := NewEtcdLogStore(etcdKV)
+
+	_, err := store.Append(ctx, testLogID, testLines(0, 5))
+	if err != nil {
+		t.Fatalf("error appending lines: %s", err.Error())
+	}
+
+	// Save lines past the line count, like an Append which failed before
+	// updating the count
+	stale := append(testLines(0, 5), ActionOutput{Text: "stale"},
+		ActionOutput{Text: "stale"})
+
+	err = libetcd.SetJSON(ctx, etcdKV, testLogID.chunkKey(0), stale)
+	if err != nil {
+		t.Fatalf("error saving chunk: %s", err.Error())
+	}
+
+	_, err = store.Append(ctx, testLogID, testLines(5, 1))
+	if err != nil {
+		t.Fatalf("error appending lines: %s", err.Error())
+	}
+
+	lines, total, err := store.Read(ctx, testLogID, 0, 0)
+	if err != nil {
+		t.Fatalf("error reading lines: %s", err.Error())
+	}
+
+	if total != 6 {
+		t.Errorf("expected 6 lines, got %d", total)
+	}
+
+	checkLines(t, lines, 0, 6)
+}
+
+func TestEtcdLogStoreMissingLines(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+	store := NewEtcdLogStore(etcdKV)
+
+	_, err := store.Append(ctx, testLogID, testLines(0, 5))
+	if err != nil {
+		t.Fatalf("error appending lines: %s", err.Error())
+	}
+
+	// Count lines which were never saved
+	_, err = etcdKV.Set(ctx, testLogID.linesKey(), "10", nil)
+	if err != nil {
+		t.Fatalf("error saving line count: %s", err.Error())
+	}
+
+	_, _, err = store.Read(ctx, testLogID, 0, 0)
+	if err == nil {
+		t.Error("expected error reading lines which are not stored")
+	}
+
+	_, err = store.Append(ctx, testLogID, testLines(10, 1))
+	if err == nil {
+		t.Error("expected error appending after lines which are not " +
+			"stored")
+	}
+}
+
+func TestFileLogStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgd-logs")
+	if err != nil {
+		t.Fatalf("error creating log directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	testLogStore(t, NewFileLogStore(dir))
+}
+
+func TestLogIDValidate(t *testing.T) {
+	actions := map[string]bool{
+		"prepare":          true,
+		"units/api/docker": true,
+		"units/a b/helm":   true,
+		"units/a%2F/helm":  true,
+		"":                 false,
+		".":                false,
+		"..":               false,
+		"../../etc":        false,
+		"units/../..":      false,
+		"units/./docker":   false,
+		"units//docker":    false,
+		"units/api/":       false,
+		"..\\..\\etc":      false,
+		"units/a\\b":       false,
+	}
+
+	for action, valid := range actions {
+		err := LogID{
+			JobID:  testLogID.JobID,
+			Action: action,
+		}.Validate()
+
+		if valid && err != nil {
+			t.Errorf("expected action %q to be valid, got: %s",
+				action, err.Error())
+		} else if !valid && err == nil {
+			t.Errorf("expected action %q to be invalid", action)
+		}
+	}
+}
+
+func TestFileLogStoreRejectsPathTraversal(t *testing.T) {
+	parent, err := ioutil.TempDir("", "kgd-logs")
+	if err != nil {
+		t.Fatalf("error creating log directory: %s", err.Error())
+	}
+	defer os.RemoveAll(parent)
+
+	dir := filepath.Join(parent, "logs")
+	store := NewFileLogStore(dir)
+	ctx := context.Background()
+
+	for _, action := range []string{"../../../escape", "..\\escape",
+		"units/../../../../escape"} {
+
+		id := LogID{
+			JobID:  testLogID.JobID,
+			Action: action,
+		}
+
+		_, err := store.Append(ctx, id, testLines(0, 1))
+		if err == nil {
+			t.Errorf("expected error appending to action %q", action)
+		}
+
+		_, _, err = store.Read(ctx, id, 0, 0)
+		if err == nil {
+			t.Errorf("expected error reading action %q", action)
+		}
+	}
+
+	// Repository names are not validated, the path is checked instead
+	_, err = store.Append(ctx, LogID{
+		JobID: JobID{
+			RepositoryID: RepositoryID{
+				Owner: "..",
+				Name:  "..",
+			},
+			ID: 1,
+		},
+		Action: "prepare",
+	}, testLines(0, 1))
+	if err == nil {
+		t.Error("expected error appending to a repository named \"..\"")
+	}
+
+	// Escaped names are kept inside the directory
+	_, err = store.Append(ctx, LogID{
+		JobID:  testLogID.JobID,
+		Action: "units/a%2F..%2F..",
+	}, testLines(0, 1))
+	if err != nil {
+		t.Fatalf("error appending to escaped log: %s", err.Error())
+	}
+
+	err = filepath.Walk(parent, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && (rel == ".." || filepath.Dir(rel) == "..") {
+			t.Errorf("log file %s is outside of log directory", path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error listing log files: %s", err.Error())
+	}
+}
+
+// failingLogStore stores a limited number of lines, then fails
+type failingLogStore struct {
+	// space is the number of lines which can still be stored
+	space int
+
+	// lines holds stored lines
+	lines []ActionOutput
+}
+
+// Append implements LogStore.Append
+func (s *failingLogStore) Append(ctx context.Context, id LogID,
+	lines []ActionOutput) (int, error) {
+
+	n := len(lines)
+	if n > s.space {
+		n = s.space
+	}
+
+	s.lines = append(s.lines, lines[:n]...)
+	s.space -= n
+
+	if n < len(lines) {
+		return n, errors.New("log store is full")
+	}
+
+	return n, nil
+}
+
+// Read implements LogStore.Read
+func (s *failingLogStore) Read(ctx context.Context, id LogID, offset,
+	limit int) ([]ActionOutput, int, error) {
+
+	return s.lines, len(s.lines), nil
+}
+
+func TestFlushOutputKeepsUnflushedLines(t *testing.T) {
+	job := NewJob(testLogID.JobID.RepositoryID, JobTarget{})
+	job.State.PrepareState = NewActionState()
+
+	for _, line := range testLines(0, 5) {
+		job.State.PrepareState.AddOutput(line.Text)
+	}
+
+	store := &failingLogStore{
+		space: 3,
+	}
+	ctx := context.Background()
+
+	err := job.FlushOutput(ctx, store)
+	if err == nil {
+		t.Fatal("expected error flushing to a full log store")
+	}
+
+	if len(store.lines) != 3 {
+		t.Fatalf("expected 3 lines stored, got %d", len(store.lines))
+	}
+
+	// The next flush only stores lines which were not stored
+	store.space = 10
+
+	err = job.FlushOutput(ctx, store)
+	if err != nil {
+		t.Fatalf("error flushing output: %s", err.Error())
+	}
+
+	if len(store.lines) != 5 {
+		t.Fatalf("expected 5 lines stored, got %d", len(store.lines))
+	}
+
+	for i, line := range store.lines {
+		if line.Text != fmt.Sprintf("line %d", i) {
+			t.Errorf("expected line %d to be \"line %d\", got %q", i,
+				i, line.Text)
+		}
+	}
+
+	// Nothing is left to flush
+	err = job.FlushOutput(ctx, store)
+	if err != nil {
+		t.Fatalf("error flushing output: %s", err.Error())
+	}
+
+	if len(store.lines) != 5 {
+		t.Errorf("expected no more lines stored, got %d",
+			len(store.lines))
+	}
+}
+
+// DeleteJob implements LogStore.DeleteJob
+func (s *failingLogStore) DeleteJob(ctx context.Context, jobID JobID) error {
+	s.lines = nil
+
+	return nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"sort"
 )
 
 // JobState holds information about the current run status of a Job.
@@ -14,16 +15,27 @@ type JobState struct {
 
 	// Units holds unit states. Keys are UnitState.ID values.
 	Units map[string]UnitState `json:"units"`
+
+	// QueuePosition is the job's position in the queue of jobs waiting
+	// for a free worker, starting at 1. 0 once the job is running.
+	QueuePosition int `json:"queue_position"`
 }
 
 // Done indicates if the Job has finished executing
 func (s JobState) Done() bool {
-	if !(s.PrepareState.Done() && s.CleanupState.Done()) {
-		return false
+	for _, state := range s.actionStates() {
+		if !state.Done() {
+			return false
+		}
 	}
 
-	for _, v := range s.Units {
-		if !(v.DockerState.Done() && v.HelmState.Done()) {
+	return true
+}
+
+// Succeeded indicates if every action in the Job finished without an error
+func (s JobState) Succeeded() bool {
+	for _, state := range s.actionStates() {
+		if state.Stage != Done {
 			return false
 		}
 	}
@@ -31,6 +43,161 @@ func (s JobState) Done() bool {
 	return true
 }
 
+// AwaitingApproval indicates if the Job is paused until a user approves or
+// rejects a deploy
+func (s JobState) AwaitingApproval() bool {
+	for _, state := range s.actionStates() {
+		if state.Stage == AwaitingApproval {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Frozen indicates if the Job is paused until a freeze window ends
+func (s JobState) Frozen() bool {
+	for _, state := range s.actionStates() {
+		if state.Stage == Frozen {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Paused indicates if the Job stopped running until it is resumed
+func (s JobState) Paused() bool {
+	return s.AwaitingApproval() || s.Frozen()
+}
+
+// Interrupt marks every action which has not finished as failed. Used when
+// the process running a job stops before the job is done. Actions which
+// paused the job are not changed.
+func (s JobState) Interrupt(reason string) {
+	for _, state := range s.actionStates() {
+		if state.Done() || state.Paused() {
+			continue
+		}
+
+		state.SetError(fmt.Sprintf("Interrupted: %s", reason))
+	}
+}
+
+// Cancel marks every action which has not finished as failed, including
+// actions which paused the job
+func (s JobState) Cancel(reason string) {
+	for _, state := range s.actionStates() {
+		if !state.Done() {
+			state.SetError(reason)
+		}
+	}
+}
+
+// ActionNames returns the names which identify the logs of the job's
+// actions. Prepare is first, cleanup is last, and unit actions are sorted in
+// between.
+func (s JobState) ActionNames() []string {
+	names := []string{}
+	for name := range s.actionStates() {
+		if name != "prepare" && name != "cleanup" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return append(append([]string{"prepare"}, names...), "cleanup")
+}
+
+// Action returns the state of the action named name, as returned by
+// ActionNames. Nil if the job has no such action.
+func (s JobState) Action(name string) *ActionState {
+	return s.actionStates()[name]
+}
+
+// actionStates returns all the non nil action states in the job. Keys are
+// the names used to identify each action's log.
+func (s JobState) actionStates() map[string]*ActionState {
+	states := map[string]*ActionState{}
+
+	if s.PrepareState != nil {
+		states["prepare"] = s.PrepareState
+	}
+
+	if s.CleanupState != nil {
+		states["cleanup"] = s.CleanupState
+	}
+
+	for id, unit := range s.Units {
+		if unit.DockerState != nil {
+			states[fmt.Sprintf("units/%s/docker", id)] = unit.DockerState
+		}
+
+		for envID, env := range unit.Environments {
+			prefix := fmt.Sprintf("units/%s/%s", id, envID)
+
+			if env.HelmState != nil {
+				states[prefix+"/helm"] = env.HelmState
+			}
+
+			if env.KubernetesState != nil {
+				states[prefix+"/kubernetes"] = env.KubernetesState
+			}
+
+			if env.KustomizeState != nil {
+				states[prefix+"/kustomize"] = env.KustomizeState
+			}
+
+			if env.RollbackState != nil {
+				states[prefix+"/rollback"] = env.RollbackState
+			}
+
+			if env.ApprovalState != nil {
+				states[prefix+"/approval"] = env.ApprovalState
+			}
+
+			if env.FreezeState != nil {
+				states[prefix+"/freeze"] = env.FreezeState
+			}
+
+			if env.ConcurrencyState != nil {
+				states[prefix+"/concurrency"] = env.ConcurrencyState
+			}
+		}
+	}
+
+	return states
+}
+
+// EnvironmentSucceeded indicates if every unit which deploys to an
+// environment finished successfully. Returns false if no unit deployed to the
+// environment.
+func (s JobState) EnvironmentSucceeded(env string) bool {
+	deployed := false
+
+	for _, unit := range s.Units {
+		if unit.DockerState != nil && !unit.DockerState.Done() {
+			return false
+		}
+
+		envState, ok := unit.Environments[env]
+		if !ok {
+			continue
+		}
+
+		for _, state := range envState.DeployStates() {
+			if !state.Done() {
+				return false
+			}
+
+			deployed = true
+		}
+	}
+
+	return deployed
+}
+
 // UnitState holds the state of a unit.
 type UnitState struct {
 	// ID is the name of a unit
@@ -40,9 +207,144 @@ type UnitState struct {
 	// not contain a Docker action.
 	DockerState *ActionState `json:"docker_state"`
 
+	// Image is the image tag the unit's deploy actions use. Set by the
+	// Docker action to the tag it built, or to the tag of an image it
+	// re-used. Empty if the unit does not contain a Docker action.
+	Image string `json:"image"`
+
+	// Digest is the digest of Image in its registry, ex: sha256:abc. Set
+	// by the Docker action after the image is pushed or re-used. Empty if
+	// the unit does not contain a Docker action.
+	Digest string `json:"digest"`
+
+	// Environments holds the state of the unit's deployment to each
+	// environment. Keys are EnvironmentState.ID values.
+	Environments map[string]*EnvironmentState `json:"environments"`
+}
+
+// DigestImage returns a reference to the exact image the unit deployed, in
+// the format REPOSITORY@DIGEST. Empty if no digest was recorded.
+func (s UnitState) DigestImage() string {
+	if len(s.Digest) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s@%s", ImageRepository(s.Image), s.Digest)
+}
+
+// NewUnitState creates a UnitState with a queued ActionState for each action
+// in a unit's config. Deploy actions are queued once for each environment.
+func NewUnitState(cfg UnitConfig, envs []EnvironmentConfig) UnitState {
+	state := UnitState{
+		ID:           cfg.ID,
+		Environments: map[string]*EnvironmentState{},
+	}
+
+	if cfg.Docker != nil {
+		state.DockerState = NewActionState()
+	}
+
+	for _, env := range envs {
+		state.Environments[env.ID] = NewEnvironmentState(cfg, env)
+	}
+
+	return state
+}
+
+// EnvironmentState holds the state of a unit's deployment to one
+// environment.
+type EnvironmentState struct {
+	// ID is the name of the environment
+	ID string `json:"id"`
+
 	// HelmState is the state of the Helm action. Nil if the unit does not
 	// contain a Helm action.
 	HelmState *ActionState `json:"helm_state"`
+
+	// KubernetesState is the state of the Kubernetes manifest action. Nil
+	// if the unit does not contain a Kubernetes action.
+	KubernetesState *ActionState `json:"kubernetes_state"`
+
+	// KustomizeState is the state of the kustomize action. Nil if the
+	// unit does not contain a kustomize action.
+	KustomizeState *ActionState `json:"kustomize_state"`
+
+	// RollbackState is the state of the rollback action. Nil unless the
+	// deployment failed and was rolled back.
+	RollbackState *ActionState `json:"rollback_state"`
+
+	// ApprovalState is the state of the manual approval which must be
+	// given before deploying. Nil if no approval is required.
+	ApprovalState *ActionState `json:"approval_state"`
+
+	// Approval records the request for approval and its outcome. Nil
+	// until the job reaches the approval.
+	Approval *Approval `json:"approval"`
+
+	// FreezeState is the state of the check for freeze windows which
+	// block the deploy. Nil unless the deploy was frozen.
+	FreezeState *ActionState `json:"freeze_state"`
+
+	// ConcurrencyState is the state of waiting for the deploy's
+	// concurrency group. Nil until the deploy joins the group.
+	ConcurrencyState *ActionState `json:"concurrency_state"`
+
+	// QueuePosition is the deploy's position in its concurrency group's
+	// queue of waiting deploys, starting at 1. 0 if the deploy is not
+	// waiting.
+	QueuePosition int `json:"queue_position"`
+
+	// ManifestDigest is the SHA256 sum of the RenderedManifest which was
+	// deployed. Empty if no manifest has been rendered.
+	ManifestDigest string `json:"manifest_digest"`
+
+	// HelmRevision is the revision of the Helm release which was
+	// deployed. 0 if no Helm release has been deployed.
+	HelmRevision int `json:"helm_revision"`
+}
+
+// NewEnvironmentState creates an EnvironmentState with a queued ActionState
+// for each deploy action in a unit's config
+func NewEnvironmentState(cfg UnitConfig,
+	env EnvironmentConfig) *EnvironmentState {
+
+	state := &EnvironmentState{
+		ID: env.ID,
+	}
+
+	if cfg.Helm != nil {
+		state.HelmState = NewActionState()
+	}
+
+	if cfg.Kubernetes != nil {
+		state.KubernetesState = NewActionState()
+	}
+
+	if cfg.Kustomize != nil {
+		state.KustomizeState = NewActionState()
+	}
+
+	if cfg.ApprovalFor(env) != nil && len(state.DeployStates()) > 0 {
+		state.ApprovalState = NewActionState()
+	}
+
+	return state
+}
+
+// DeployStates returns the states of the deploy actions in the environment
+// which are not nil
+func (s EnvironmentState) DeployStates() []*ActionState {
+	states := []*ActionState{}
+
+	for _, state := range []*ActionState{s.HelmState, s.KubernetesState,
+		s.KustomizeState} {
+
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+
+	return states
 }
 
 // ActionState holds the state of an action.
@@ -50,8 +352,28 @@ type ActionState struct {
 	// Stage indicates how the action is currently existing
 	Stage ActionStage `json:"stage"`
 
-	// Output holds the raw action output
-	Output []ActionOutput `json:"output"`
+	// OutputLines is the number of lines of output the action has
+	// produced. The lines themselves are kept in a LogStore.
+	OutputLines int `json:"output_lines"`
+
+	// LastError holds the most recent line of error output. Empty if the
+	// action has not output any errors.
+	LastError string `json:"last_error"`
+
+	// Attempt is the number of the action's current or last attempt,
+	// starting at 1. 0 if the action has not started.
+	Attempt int `json:"attempt"`
+
+	// MaxAttempts is the maximum number of times the action runs
+	MaxAttempts int `json:"max_attempts"`
+
+	// Cached indicates the action re-used the result of an earlier job
+	// instead of running. Only set for Docker actions.
+	Cached bool `json:"cached"`
+
+	// pending holds output lines which have not been written to a
+	// LogStore yet
+	pending []ActionOutput
 }
 
 // Done indicates if a state's Stage is in a done state
@@ -59,6 +381,11 @@ func (s ActionState) Done() bool {
 	return s.Stage == Done || s.Stage == ErrDone
 }
 
+// Paused indicates if a state's Stage stopped the job until it is resumed
+func (s ActionState) Paused() bool {
+	return s.Stage == AwaitingApproval || s.Stage == Frozen
+}
+
 // NewActionState creates a new ActionState with the Stage field set to Queued
 func NewActionState() *ActionState {
 	return &ActionState{
@@ -76,6 +403,13 @@ const (
 	// Running indicates an action is running.
 	Running ActionStage = "running"
 
+	// AwaitingApproval indicates an action is paused until a user
+	// approves or rejects it.
+	AwaitingApproval ActionStage = "awaiting_approval"
+
+	// Frozen indicates an action is paused until a freeze window ends.
+	Frozen ActionStage = "frozen"
+
 	// Done indicates an action has finished running.
 	Done ActionStage = "done"
 
@@ -97,7 +431,7 @@ type ActionOutput struct {
 // SetError saves an error to in Output and sets the Stage to ErrDone
 func (s *ActionState) SetError(errStr string) {
 	s.Stage = ErrDone
-	s.Output = append(s.Output, ActionOutput{
+	s.addLine(ActionOutput{
 		Text:  errStr,
 		Error: true,
 	})
@@ -106,13 +440,46 @@ func (s *ActionState) SetError(errStr string) {
 // SetErrorf acts like SetError but it provides string formatting functionality
 // via fmt.Sprintf
 func (s *ActionState) SetErrorf(errFormat string, v ...interface{}) {
-	s.SetError(fmt.Sprintf(errFormat, v))
+	s.SetError(fmt.Sprintf(errFormat, v...))
+}
+
+// StartAttempt records the start of one of the action's attempts. Attempts
+// are noted in the output if the action can be retried, output from earlier
+// attempts is kept.
+func (s *ActionState) StartAttempt(attempt, maxAttempts int) {
+	s.Attempt = attempt
+	s.MaxAttempts = maxAttempts
+	s.Stage = Running
+
+	if maxAttempts > 1 {
+		s.AddOutput(fmt.Sprintf("Attempt %d/%d", attempt, maxAttempts))
+	}
+}
+
+// FailAttempt saves an error from an attempt which will be retried. Unlike
+// SetError the Stage is not changed.
+func (s *ActionState) FailAttempt(errStr string) {
+	s.addLine(ActionOutput{
+		Text:  errStr,
+		Error: true,
+	})
 }
 
 // AddOutput saves a line of output to the state
 func (s *ActionState) AddOutput(txt string) {
-	s.Output = append(s.Output, ActionOutput{
+	s.addLine(ActionOutput{
 		Text:  txt,
 		Error: false,
 	})
 }
+
+// addLine queues a line of output to be written to a LogStore and updates
+// the summary fields
+func (s *ActionState) addLine(line ActionOutput) {
+	s.pending = append(s.pending, line)
+	s.OutputLines++
+
+	if line.Error {
+		s.LastError = line.Text
+	}
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// ManifestChunkBytes is the maximum size of a single Etcd manifest chunk.
+// Keeps each value well below Etcd's value size limit.
+const ManifestChunkBytes int = 512 * 1024
+
+// RenderedManifest holds the Kubernetes manifest a unit deployed in a job.
+// Stored separately from the Job so the job stays small. The values of
+// Secrets are redacted in the manifest, and are kept encrypted so rollbacks
+// can restore them.
+type RenderedManifest struct {
+	// JobID identifies the job which deployed the manifest
+	JobID JobID `json:"job_id"`
+
+	// Environment is the environment the manifest was deployed to
+	Environment string `json:"environment"`
+
+	// UnitID is the unit which deployed the manifest
+	UnitID string `json:"unit_id"`
+
+	// Manifest is the multi document YAML manifest which was deployed,
+	// with Secret values replaced by SecretRedacted. Stored in chunks of
+	// ManifestChunkBytes.
+	Manifest string `json:"-"`
+
+	// Chunks is the number of chunks the manifest is stored in
+	Chunks int `json:"chunks"`
+
+	// SealedSecrets holds the encrypted values of the manifest's Secrets.
+	// Keys are Secret references returned by SecretRef. Empty if no
+	// secrets key is configured.
+	SealedSecrets map[string]string `json:"sealed_secrets"`
+}
+
+// SecretRef identifies a Secret in a RenderedManifest
+func SecretRef(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
+
+// manifestsKey returns the Etcd directory key the manifests a job deployed
+// are stored under
+func (i JobID) manifestsKey() string {
+	return fmt.Sprintf("%s/manifests/%d", i.RepositoryID.key(), i.ID)
+}
+
+// dirKey returns the Etcd directory key the manifest is stored under
+func (m RenderedManifest) dirKey() string {
+	return fmt.Sprintf("%s/%s/%s", m.JobID.manifestsKey(),
+		url.PathEscape(m.Environment), url.PathEscape(m.UnitID))
+}
+
+// key returns the Etcd key the manifest's information is stored in
+func (m RenderedManifest) key() string {
+	return fmt.Sprintf("%s/information", m.dirKey())
+}
+
+// chunkKey returns the Etcd key a chunk of the manifest is stored in
+func (m RenderedManifest) chunkKey(chunk int) string {
+	return fmt.Sprintf("%s/chunks/%d", m.dirKey(), chunk)
+}
+
+// Digest returns the hex encoded SHA256 sum of the manifest
+func (m RenderedManifest) Digest() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.Manifest)))
+}
+
+// SealSecret encrypts the values of a Secret in the manifest. The values are
+// stored when the manifest is set. The manifest's key and the Secret
+// reference are used as additional data, so values cannot be copied between
+// manifests.
+func (m *RenderedManifest) SealSecret(box libsecret.Box, ref,
+	values string) error {
+
+	sealed, err := box.Seal(values, m.key()+"#"+ref)
+	if err != nil {
+		return fmt.Errorf("error encrypting Secret %s: %s", ref,
+			err.Error())
+	}
+
+	if m.SealedSecrets == nil {
+		m.SealedSecrets = map[string]string{}
+	}
+
+	m.SealedSecrets[ref] = sealed
+
+	return nil
+}
+
+// OpenSecret decrypts the values of a Secret in the manifest. Returns false if
+// the values were not recorded.
+func (m RenderedManifest) OpenSecret(box libsecret.Box,
+	ref string) (string, bool, error) {
+
+	sealed, ok := m.SealedSecrets[ref]
+	if !ok {
+		return "", false, nil
+	}
+
+	values, err := box.Open(sealed, m.key()+"#"+ref)
+	if err != nil {
+		return "", false, fmt.Errorf("error decrypting Secret %s: %s",
+			ref, err.Error())
+	}
+
+	return values, true, nil
+}
+
+// splitChunks splits s into chunks of at most size bytes. Chunks do not split
+// UTF-8 characters.
+func splitChunks(s string, size int) []string {
+	chunks := []string{}
+
+	for len(s) > 0 {
+		end := size
+		if end >= len(s) {
+			end = len(s)
+		} else {
+			for end > 0 && !utf8.RuneStart(s[end]) {
+				end--
+			}
+		}
+
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+
+	return chunks
+}
+
+// Set stores a manifest in Etcd. Chunks are stored before the manifest's
+// information, so the manifest can not be retrieved until it is complete.
+func (m RenderedManifest) Set(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	chunks := splitChunks(m.Manifest, ManifestChunkBytes)
+
+	for i, chunk := range chunks {
+		_, err := etcdKV.Set(ctx, m.chunkKey(i), chunk, nil)
+		if err != nil {
+			return fmt.Errorf("error saving manifest chunk %d in Etcd: "+
+				"%s", i, err.Error())
+		}
+	}
+
+	m.Chunks = len(chunks)
+
+	return libetcd.SetJSON(ctx, etcdKV, m.key(), m)
+}
+
+// Get retrieves a manifest from Etcd. The JobID, Environment, and UnitID
+// fields must be set for this method to work properly. If the manifest does
+// not exist the Etcd error is returned unwrapped so callers can check it with
+// etcd.IsKeyNotFound.
+func (m *RenderedManifest) Get(ctx context.Context,
+	etcdKV etcd.KeysAPI) error {
+
+	err := libetcd.GetJSON(ctx, etcdKV, m.key(), m)
+	if err != nil {
+		return err
+	}
+
+	m.Manifest = ""
+
+	for i := 0; i < m.Chunks; i++ {
+		resp, err := etcdKV.Get(ctx, m.chunkKey(i), &etcd.GetOptions{
+			Quorum: true,
+		})
+		if err != nil {
+			return fmt.Errorf("error retrieving manifest chunk %d "+
+				"from Etcd: %s", i, err.Error())
+		}
+
+		m.Manifest += resp.Node.Value
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd/etcdtest"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+)
+
+// testSecretsKey is a base64 encoded 32 byte key
+const testSecretsKey string = "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+
+func TestSplitChunksKeepsCharacters(t *testing.T) {
+	s := strings.Repeat("a€", 10)
+
+	chunks := splitChunks(s, 4)
+
+	if strings.Join(chunks, "") != s {
+		t.Fatalf("chunks do not join to the original string: %v", chunks)
+	}
+
+	for _, chunk := range chunks {
+		if len(chunk) > 4 || !utf8.ValidString(chunk) {
+			t.Errorf("invalid chunk: %q", chunk)
+		}
+	}
+}
+
+func TestRenderedManifestSetGet(t *testing.T) {
+	etcdKV, stop := etcdtest.NewKeysAPI(t)
+	defer stop()
+
+	ctx := context.Background()
+
+	box, err := libsecret.NewBox(testSecretsKey)
+	if err != nil {
+		t.Fatalf("error creating secrets box: %s", err.Error())
+	}
+
+	id := JobID{
+		RepositoryID: RepositoryID{
+			Owner: "owner",
+			Name:  "repo",
+		},
+		ID: 1,
+	}
+
+	// Larger than a single chunk, with a unit ID which is not a single key
+	manifest := RenderedManifest{
+		JobID:       id,
+		Environment: "production",
+		UnitID:      "api/../worker",
+		Manifest: strings.Repeat("kind: ConfigMap\n---\n",
+			ManifestChunkBytes/10),
+	}
+
+	ref := SecretRef("app", "credentials")
+
+	err = manifest.SealSecret(box, ref, `{"data":{"password":"cGFzcw=="}}`)
+	if err != nil {
+		t.Fatalf("error sealing Secret: %s", err.Error())
+	}
+
+	err = manifest.Set(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error saving manifest: %s", err.Error())
+	}
+
+	retrieved := RenderedManifest{
+		JobID:       id,
+		Environment: "production",
+		UnitID:      "api/../worker",
+	}
+
+	err = retrieved.Get(ctx, etcdKV)
+	if err != nil {
+		t.Fatalf("error retrieving manifest: %s", err.Error())
+	}
+
+	if retrieved.Chunks < 2 {
+		t.Errorf("expected manifest to be stored in multiple chunks, "+
+			"stored in %d", retrieved.Chunks)
+	}
+
+	if retrieved.Manifest != manifest.Manifest {
+		t.Errorf("retrieved manifest is not the saved manifest")
+	}
+
+	if strings.Contains(retrieved.SealedSecrets[ref], "cGFzcw==") {
+		t.Errorf("Secret values were stored unencrypted")
+	}
+
+	values, ok, err := retrieved.OpenSecret(box, ref)
+	if err != nil {
+		t.Fatalf("error opening Secret: %s", err.Error())
+	}
+
+	if !ok || values != `{"data":{"password":"cGFzcw=="}}` {
+		t.Errorf("unexpected Secret values: %t %s", ok, values)
+	}
+
+	_, ok, err = retrieved.OpenSecret(box, SecretRef("app", "other"))
+	if err != nil || ok {
+		t.Errorf("expected Secret which was not sealed to not be "+
+			"found, found: %t, error: %v", ok, err)
+	}
+}
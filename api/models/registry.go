@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// KeyDirRegistries is the key used to store Docker registries
+const KeyDirRegistries string = "/registries"
+
+// DockerHubHost is the registry host of images whose tags do not include a
+// host
+const DockerHubHost string = "docker.io"
+
+// DockerHubConfigKey is the key of Docker Hub in Docker config.json files
+const DockerHubConfigKey string = "https://index.docker.io/v1/"
+
+// Registry is a Docker registry which images are pushed to. The registry's
+// credential is encrypted and stored separately, it is never returned by the
+// API.
+type Registry struct {
+	// Host is the hostname, and optionally port, of the registry. Matches
+	// the first component of image tags, ex: "registry.example.com:5000".
+	Host string `json:"host"`
+
+	// AuthType is how the registry is authenticated with. One of the
+	// RegistryAuthType values.
+	AuthType RegistryAuthType `json:"auth_type"`
+
+	// Username is the user which authenticates with the registry. Only
+	// used by AuthBasic.
+	Username string `json:"username"`
+
+	// Repositories are glob patterns which match the "OWNER/NAME" of
+	// GitHub repositories which may push to the registry. If empty every
+	// repository may.
+	Repositories []string `json:"repositories"`
+}
+
+// RegistryAuthType is how a registry is authenticated with
+type RegistryAuthType string
+
+const (
+	// AuthBasic indicates the credential is the password of Username
+	AuthBasic RegistryAuthType = "basic"
+
+	// AuthToken indicates the credential is a bearer token
+	AuthToken RegistryAuthType = "token"
+
+	// AuthDockerConfig indicates the credential is the contents of a
+	// Docker config.json file with an "auths" entry for the registry
+	AuthDockerConfig RegistryAuthType = "docker_config"
+)
+
+// key returns the Etcd directory key of the registry
+func (r Registry) key() string {
+	return fmt.Sprintf("%s/%s", KeyDirRegistries, url.PathEscape(r.Host))
+}
+
+// infoKey returns the Etcd key the registry is stored in
+func (r Registry) infoKey() string {
+	return fmt.Sprintf("%s/information", r.key())
+}
+
+// credentialKey returns the Etcd key the registry's encrypted credential is
+// stored in
+func (r Registry) credentialKey() string {
+	return fmt.Sprintf("%s/credential", r.key())
+}
+
+// dockerConfigKey returns the key of the registry in Docker config.json files
+func (r Registry) dockerConfigKey() string {
+	if r.Host == DockerHubHost {
+		return DockerHubConfigKey
+	}
+
+	return r.Host
+}
+
+// Validate checks that all required fields are set. credential is the
+// unencrypted credential.
+func (r Registry) Validate(credential string) error {
+	if len(r.Host) == 0 {
+		return errors.New("host required")
+	}
+
+	if len(credential) == 0 {
+		return errors.New("credential required")
+	}
+
+	switch r.AuthType {
+	case AuthBasic:
+		if len(r.Username) == 0 {
+			return errors.New("username required for basic auth")
+		}
+	case AuthToken:
+	case AuthDockerConfig:
+		var dockerConfig struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+
+		err := json.Unmarshal([]byte(credential), &dockerConfig)
+		if err != nil {
+			return fmt.Errorf("credential must be a Docker config JSON "+
+				"file: %s", err.Error())
+		}
+
+		if _, ok := dockerConfig.Auths[r.dockerConfigKey()]; !ok {
+			return fmt.Errorf("credential must have an auths entry "+
+				"for %s", r.dockerConfigKey())
+		}
+	default:
+		return fmt.Errorf("auth_type must be \"%s\", \"%s\", or \"%s\"",
+			AuthBasic, AuthToken, AuthDockerConfig)
+	}
+
+	for _, pattern := range r.Repositories {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("repositories pattern %s invalid: %s",
+				pattern, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Allows indicates if a GitHub repository may use the registry
+func (r Registry) Allows(repoID RepositoryID) bool {
+	if len(r.Repositories) == 0 {
+		return true
+	}
+
+	name := fmt.Sprintf("%s/%s", repoID.Owner, repoID.Name)
+
+	for _, pattern := range r.Repositories {
+		// Validated when the registry was saved
+		if match, _ := path.Match(pattern, name); match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DockerConfig returns a Docker config.json file which authenticates with
+// the registry. credential is the unencrypted credential. Token credentials
+// are only understood by the Docker CLI, not by Kubernetes.
+func (r Registry) DockerConfig(credential string) ([]byte, error) {
+	if r.AuthType == AuthDockerConfig {
+		return []byte(credential), nil
+	}
+
+	entry := map[string]string{}
+
+	if r.AuthType == AuthBasic {
+		entry["username"] = r.Username
+		entry["password"] = credential
+		entry["auth"] = base64.StdEncoding.EncodeToString([]byte(
+			r.Username + ":" + credential))
+	} else {
+		entry["registrytoken"] = credential
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			r.dockerConfigKey(): entry,
+		},
+	})
+}
+
+// Set stores a registry and its encrypted credential in Etcd
+func (r Registry) Set(ctx context.Context, etcdKV etcd.KeysAPI,
+	box libsecret.Box, credential string) error {
+
+	sealed, err := box.Seal(credential, r.credentialKey())
+	if err != nil {
+		return fmt.Errorf("error encrypting credential: %s", err.Error())
+	}
+
+	_, err = etcdKV.Set(ctx, r.credentialKey(), sealed, nil)
+	if err != nil {
+		return fmt.Errorf("error saving credential in Etcd: %s",
+			err.Error())
+	}
+
+	return libetcd.SetJSON(ctx, etcdKV, r.infoKey(), r)
+}
+
+// Get retrieves a registry from Etcd. The Host field must be set for this
+// method to work properly.
+func (r *Registry) Get(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	return libetcd.GetJSON(ctx, etcdKV, r.infoKey(), r)
+}
+
+// Credential retrieves the registry's credential from Etcd and decrypts it
+func (r Registry) Credential(ctx context.Context, etcdKV etcd.KeysAPI,
+	box libsecret.Box) (string, error) {
+
+	resp, err := etcdKV.Get(ctx, r.credentialKey(),
+		&etcd.GetOptions{Quorum: true})
+	if err != nil {
+		return "", fmt.Errorf("error retrieving credential from Etcd: %s",
+			err.Error())
+	}
+
+	credential, err := box.Open(resp.Node.Value, r.credentialKey())
+	if err != nil {
+		return "", fmt.Errorf("error decrypting credential: %s",
+			err.Error())
+	}
+
+	return credential, nil
+}
+
+// Delete removes a registry and its credential from Etcd
+func (r Registry) Delete(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	_, err := etcdKV.Delete(ctx, r.key(), &etcd.DeleteOptions{
+		Recursive: true,
+		Dir:       true,
+	})
+
+	return err
+}
+
+// GetAllRegistries retrieves all registries
+func GetAllRegistries(ctx context.Context,
+	etcdKV etcd.KeysAPI) ([]Registry, error) {
+
+	resp, err := etcdKV.Get(ctx, KeyDirRegistries, &etcd.GetOptions{
+		Sort:   true,
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []Registry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving registries from Etcd: %s",
+			err.Error())
+	}
+
+	registries := []Registry{}
+
+	for _, node := range resp.Node.Nodes {
+		host, err := url.PathUnescape(strings.TrimPrefix(node.Key,
+			KeyDirRegistries+"/"))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing registry key %s: %s",
+				node.Key, err.Error())
+		}
+
+		registry := Registry{
+			Host: host,
+		}
+
+		err = registry.Get(ctx, etcdKV)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving registry %s: %s",
+				host, err.Error())
+		}
+
+		registries = append(registries, registry)
+	}
+
+	return registries, nil
+}
+
+// ImageRegistryHost returns the registry host of an image tag. Follows the
+// Docker CLI's rules: the first component of the tag is a host if it
+// contains a "." or ":", or is "localhost". Otherwise the image is on
+// Docker Hub.
+func ImageRegistryHost(tag string) string {
+	i := strings.Index(tag, "/")
+	if i < 0 {
+		return DockerHubHost
+	}
+
+	first := tag[:i]
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return first
+	}
+
+	return DockerHubHost
+}
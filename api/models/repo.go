@@ -3,7 +3,10 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/libetcd"
@@ -21,6 +24,156 @@ type Repository struct {
 
 	// WebHookID holds the ID of the created GitHub repository web hook
 	WebHookID int64 `json:"web_hook_id"`
+
+	// FetchStrategy decides how jobs download the repository. One of the
+	// FetchStrategy values. Defaults to FetchTarball.
+	FetchStrategy FetchStrategy `json:"fetch_strategy"`
+
+	// ConfigPath is the path of the job configuration file relative to
+	// the repository root, ex: "deploy/kube-git-deploy.yaml". If empty a
+	// file named one of JobConfigFileNames is used. Can only be set if
+	// ConfigDiscovery is DiscoverRoot.
+	ConfigPath string `json:"config_path"`
+
+	// ConfigDiscovery decides where jobs look for job configuration
+	// files. One of the ConfigDiscovery values. Defaults to DiscoverRoot.
+	ConfigDiscovery ConfigDiscovery `json:"config_discovery"`
+}
+
+// FetchStrategy decides how jobs download a repository
+type FetchStrategy string
+
+const (
+	// FetchTarball indicates the repository is downloaded as a GitHub
+	// archive tarball, without git metadata or submodules
+	FetchTarball FetchStrategy = "tarball"
+
+	// FetchShallow indicates the target commit is cloned with a depth of
+	// 1, with submodules
+	FetchShallow FetchStrategy = "shallow"
+
+	// FetchFull indicates the repository's full history is cloned, with
+	// submodules
+	FetchFull FetchStrategy = "full"
+)
+
+// GetFetchStrategy returns the fetch strategy, or the default if not set
+func (r Repository) GetFetchStrategy() FetchStrategy {
+	if len(r.FetchStrategy) == 0 {
+		return FetchTarball
+	}
+
+	return r.FetchStrategy
+}
+
+// ValidFetchStrategy indicates if a fetch strategy is one of the
+// FetchStrategy values
+func ValidFetchStrategy(strategy FetchStrategy) bool {
+	switch strategy {
+	case FetchTarball, FetchShallow, FetchFull:
+		return true
+	}
+
+	return false
+}
+
+// ConfigDiscovery decides where jobs look for job configuration files
+type ConfigDiscovery string
+
+const (
+	// DiscoverRoot indicates one configuration file is used, in the
+	// repository root or at the repository's ConfigPath
+	DiscoverRoot ConfigDiscovery = "root"
+
+	// DiscoverSubdirectories indicates the configuration files in the
+	// repository root and all subdirectories are merged, see
+	// MergeJobConfigs
+	DiscoverSubdirectories ConfigDiscovery = "subdirectories"
+)
+
+// GetConfigDiscovery returns where jobs look for configuration files, or
+// the default if not set
+func (r Repository) GetConfigDiscovery() ConfigDiscovery {
+	if len(r.ConfigDiscovery) == 0 {
+		return DiscoverRoot
+	}
+
+	return r.ConfigDiscovery
+}
+
+// ValidConfigDiscovery indicates if a config discovery value is one of the
+// ConfigDiscovery values
+func ValidConfigDiscovery(discovery ConfigDiscovery) bool {
+	switch discovery {
+	case DiscoverRoot, DiscoverSubdirectories:
+		return true
+	}
+
+	return false
+}
+
+// ValidateConfigSettings checks the configuration file path is inside the
+// repository and has a known format, and is not set with subdirectory
+// discovery
+func (r Repository) ValidateConfigSettings() error {
+	if len(r.ConfigPath) == 0 {
+		return nil
+	}
+
+	if r.GetConfigDiscovery() != DiscoverRoot {
+		return fmt.Errorf("config_path can only be set if "+
+			"config_discovery is \"%s\"", DiscoverRoot)
+	}
+
+	resolved, err := resolveConfigPath(".", r.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("config_path %s", err.Error())
+	}
+
+	if resolved == "." {
+		return errors.New("config_path must be a file")
+	}
+
+	_, err = ConfigFormatFor(r.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("config_path %s", err.Error())
+	}
+
+	return nil
+}
+
+// JobConfigFiles returns the paths of the repository's job configuration
+// files in a downloaded copy of the repository, relative to dir. Uses the
+// repository's ConfigPath and ConfigDiscovery settings.
+func (r Repository) JobConfigFiles(dir string) ([]string, error) {
+	if r.GetConfigDiscovery() == DiscoverSubdirectories {
+		return FindJobConfigFiles(dir)
+	}
+
+	if len(r.ConfigPath) > 0 {
+		cfgPath, err := resolveConfigPath(".", r.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(cfgPath)))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("configuration file %s not found",
+				cfgPath)
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking for %s: %s",
+				cfgPath, err.Error())
+		}
+
+		return []string{cfgPath}, nil
+	}
+
+	cfgPath, err := FindJobConfigFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{filepath.Base(cfgPath)}, nil
 }
 
 // RepositoryID holds information required to identify a GitHub repository
@@ -182,6 +335,17 @@ func (r *Repository) Get(ctx context.Context, etcdKV etcd.KeysAPI) error {
 	return libetcd.GetJSON(ctx, etcdKV, r.key(), r)
 }
 
+// Update retrieves a repository from Etcd, calls update to modify it, then
+// saves the repository if no one else saved it in the meantime. Otherwise
+// retries with the newly saved repository. Errors returned by update are
+// returned unwrapped. The ID field must be set for this method to work
+// properly.
+func (r *Repository) Update(ctx context.Context, etcdKV etcd.KeysAPI,
+	update func() error) error {
+
+	return libetcd.UpdateJSON(ctx, etcdKV, r.key(), r, update)
+}
+
 // Delete removes a repository and all of its jobs from Etcd
 func (r Repository) Delete(ctx context.Context, etcdKV etcd.KeysAPI) error {
 	_, err := etcdKV.Delete(ctx, r.ID.key(), &etcd.DeleteOptions{
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// DefaultRetryBackoff is the delay before the first retry if a RetryConfig
+// does not specify one
+const DefaultRetryBackoff time.Duration = 5 * time.Second
+
+// DefaultRetryMaxBackoff is the longest delay between retries if a
+// RetryConfig does not specify one
+const DefaultRetryMaxBackoff time.Duration = time.Minute
+
+// RetryActions are the names of the unit actions which can have a retry
+// policy
+var RetryActions []string = []string{"docker", "helm", "kubernetes",
+	"kustomize"}
+
+// RetryConfig is the retry policy of an action. Failed attempts are retried
+// after a delay which doubles each attempt.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times the action runs,
+	// including the first attempt. Must be at least 1, 1 never retries.
+	// Actions without a retry policy run once.
+	MaxAttempts int `json:"max_attempts" toml:"max_attempts"`
+
+	// Backoff is the delay before the first retry, as a Go duration
+	// string. Defaults to DefaultRetryBackoff.
+	Backoff string `json:"backoff" toml:"backoff"`
+
+	// MaxBackoff is the longest delay between retries, as a Go duration
+	// string. Defaults to DefaultRetryMaxBackoff.
+	MaxBackoff string `json:"max_backoff" toml:"max_backoff"`
+
+	// RetryOn are the classes of errors which are retried. Defaults to
+	// ErrorNetwork and ErrorServer.
+	RetryOn []ErrorClass `json:"retry_on" toml:"retry_on"`
+}
+
+// ErrorClass groups errors by their cause
+type ErrorClass string
+
+const (
+	// ErrorNetwork are errors connecting to or communicating with a
+	// server, ex: connection refused or timeouts
+	ErrorNetwork ErrorClass = "network"
+
+	// ErrorServer are errors returned by a server which are usually
+	// temporary, ex: HTTP 502 or 429 responses
+	ErrorServer ErrorClass = "server"
+
+	// ErrorAny is every error
+	ErrorAny ErrorClass = "any"
+)
+
+// GetMaxAttempts returns the maximum number of attempts, or the default if
+// not set
+func (c RetryConfig) GetMaxAttempts() int {
+	if c.MaxAttempts < 1 {
+		return 1
+	}
+
+	return c.MaxAttempts
+}
+
+// GetRetryOn returns the classes of errors which are retried, or the default
+// if not set
+func (c RetryConfig) GetRetryOn() []ErrorClass {
+	if len(c.RetryOn) == 0 {
+		return []ErrorClass{ErrorNetwork, ErrorServer}
+	}
+
+	return c.RetryOn
+}
+
+// Validate checks durations can be parsed and error classes are known
+func (c RetryConfig) Validate() error {
+	if c.MaxAttempts < 1 {
+		return configErrorf("max_attempts", "must be at least 1")
+	}
+
+	if len(c.Backoff) > 0 {
+		_, err := time.ParseDuration(c.Backoff)
+		if err != nil {
+			return configErrorf("backoff", "invalid: %s", err.Error())
+		}
+	}
+
+	if len(c.MaxBackoff) > 0 {
+		_, err := time.ParseDuration(c.MaxBackoff)
+		if err != nil {
+			return configErrorf("max_backoff", "invalid: %s",
+				err.Error())
+		}
+	}
+
+	for _, class := range c.RetryOn {
+		switch class {
+		case ErrorNetwork, ErrorServer, ErrorAny:
+		default:
+			return configErrorf("retry_on", "values must be \"%s\", "+
+				"\"%s\", or \"%s\"", ErrorNetwork, ErrorServer,
+				ErrorAny)
+		}
+	}
+
+	return nil
+}
+
+// Retries indicates if errors of a class are retried. Errors whose class is
+// not known, the empty ErrorClass, are only retried by ErrorAny.
+func (c RetryConfig) Retries(class ErrorClass) bool {
+	for _, retryClass := range c.GetRetryOn() {
+		if retryClass == ErrorAny ||
+			(len(class) > 0 && retryClass == class) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delay returns how long to wait before retrying after an attempt failed.
+// Attempts start at 1. The delay doubles each attempt up to MaxBackoff, then
+// a random jitter of up to half the delay is subtracted so retries from
+// different jobs are spread out.
+func (c RetryConfig) Delay(attempt int) time.Duration {
+	// Validated when the configuration was parsed
+	backoff := DefaultRetryBackoff
+	if len(c.Backoff) > 0 {
+		backoff, _ = time.ParseDuration(c.Backoff)
+	}
+
+	maxBackoff := DefaultRetryMaxBackoff
+	if len(c.MaxBackoff) > 0 {
+		maxBackoff, _ = time.ParseDuration(c.MaxBackoff)
+	}
+
+	delay := backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	return delay - jitter
+}
+
+// RetryFor returns the retry policy of one of the unit's actions. Actions
+// without a policy are not retried.
+func (c UnitConfig) RetryFor(action string) RetryConfig {
+	if retry, ok := c.Retry[action]; ok {
+		return retry
+	}
+
+	return RetryConfig{}
+}
+
+// validateRetry checks the unit's retry policies are for known actions and
+// are valid
+func (c UnitConfig) validateRetry() error {
+	for action, retry := range c.Retry {
+		known := false
+		for _, name := range RetryActions {
+			if name == action {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return configErrorf("retry."+action, "action must be "+
+				"one of: %s", strings.Join(RetryActions, ", "))
+		}
+
+		err := retry.Validate()
+		if err != nil {
+			return prefixConfigError("retry."+action, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"reflect"
+)
+
+// JSONSchemaDraft is the JSON Schema version of JobConfigSchema
+const JSONSchemaDraft string = "http://json-schema.org/draft-07/schema#"
+
+// schemaEnums are the allowed values of configuration types which only
+// accept some strings
+var schemaEnums map[reflect.Type][]interface{} = map[reflect.Type][]interface{}{
+	reflect.TypeOf(RollbackPolicy("")): []interface{}{RollbackAuto,
+		RollbackManual, RollbackOff},
+	reflect.TypeOf(ErrorClass("")): []interface{}{ErrorNetwork,
+		ErrorServer, ErrorAny},
+	reflect.TypeOf(ConcurrencyGroup("")): []interface{}{GroupEnvironment,
+		GroupUnit},
+	reflect.TypeOf(ConcurrencyPolicy("")): []interface{}{PolicyQueue,
+		PolicyCancel, PolicySupersede},
+}
+
+// JobConfigSchema returns a JSON Schema which describes job configuration
+// files. Generated from the configuration types so it always matches what
+// ParseJobConfig accepts, except for rules checked by JobConfig.Validate.
+// Editors use it to check and autocomplete YAML and JSON files.
+func JobConfigSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema": JSONSchemaDraft,
+		"title":   "Kube Git Deploy job configuration",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			EnvironmentsKey: map[string]interface{}{
+				"type": "object",
+				"additionalProperties": typeSchema(
+					reflect.TypeOf(EnvironmentConfig{})),
+			},
+			ConcurrencyKey: typeSchema(
+				reflect.TypeOf(ConcurrencyConfig{})),
+		},
+		"additionalProperties": typeSchema(reflect.TypeOf(UnitConfig{})),
+	}
+}
+
+// typeSchema returns the JSON Schema of a configuration type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema := map[string]interface{}{
+			"type": "string",
+		}
+
+		if enum, ok := schemaEnums[t]; ok {
+			schema["enum"] = enum
+		}
+
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{
+			"type": "boolean",
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{
+			"type": "integer",
+		}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{
+			"type": "number",
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+
+		for i := 0; i < t.NumField(); i++ {
+			key := configFieldKey(t.Field(i))
+			if len(key) == 0 {
+				continue
+			}
+
+			properties[key] = typeSchema(t.Field(i).Type)
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// SecretRedacted replaces secret values in action output
+const SecretRedacted string = "[secret]"
+
+// SecretNamePattern matches valid secret names
+var SecretNamePattern *regexp.Regexp = regexp.MustCompile(
+	"^[A-Za-z_][A-Za-z0-9_]*$")
+
+// secretRefPattern matches references to secrets in configuration values,
+// ex: ${secrets.API_KEY}
+var secretRefPattern *regexp.Regexp = regexp.MustCompile(
+	"\\$\\{secrets\\.([A-Za-z_][A-Za-z0-9_]*)\\}")
+
+// Secret is a value which units reference in their configuration but which
+// is not stored in the repository. Secrets are encrypted in Etcd and are
+// never returned by the API once set.
+type Secret struct {
+	// RepositoryID is the repository which can use the secret
+	RepositoryID RepositoryID `json:"repository_id"`
+
+	// Environment is the ID of the environment which can use the secret.
+	// If empty the secret is used by every environment which does not
+	// have its own secret with the same name, and by Docker builds.
+	Environment string `json:"environment"`
+
+	// Name is referenced in configuration as ${secrets.NAME}
+	Name string `json:"name"`
+}
+
+// dirKey returns the Etcd directory key of the secret's scope
+func (s Secret) dirKey() string {
+	if len(s.Environment) == 0 {
+		return fmt.Sprintf("%s/secrets/repository",
+			s.RepositoryID.key())
+	}
+
+	return fmt.Sprintf("%s/secrets/environments/%s",
+		s.RepositoryID.key(), url.PathEscape(s.Environment))
+}
+
+// key returns the Etcd key the secret's encrypted value is stored in
+func (s Secret) key() string {
+	return fmt.Sprintf("%s/%s", s.dirKey(), s.Name)
+}
+
+// Validate checks the secret's name
+func (s Secret) Validate() error {
+	if !SecretNamePattern.MatchString(s.Name) {
+		return errors.New("name must only contain letters, numbers, " +
+			"and underscores, and must not start with a number")
+	}
+
+	return nil
+}
+
+// Set encrypts a value and stores it in Etcd. The secret's key is used as
+// additional data, so values cannot be copied between secrets.
+func (s Secret) Set(ctx context.Context, etcdKV etcd.KeysAPI,
+	box libsecret.Box, value string) error {
+
+	sealed, err := box.Seal(value, s.key())
+	if err != nil {
+		return fmt.Errorf("error encrypting secret: %s", err.Error())
+	}
+
+	_, err = etcdKV.Set(ctx, s.key(), sealed, nil)
+	if err != nil {
+		return fmt.Errorf("error saving secret in Etcd: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Value retrieves a secret from Etcd and decrypts it. If the secret does not
+// exist the Etcd error is returned unwrapped so callers can check it with
+// etcd.IsKeyNotFound.
+func (s Secret) Value(ctx context.Context, etcdKV etcd.KeysAPI,
+	box libsecret.Box) (string, error) {
+
+	resp, err := etcdKV.Get(ctx, s.key(), &etcd.GetOptions{Quorum: true})
+	if etcd.IsKeyNotFound(err) {
+		return "", err
+	} else if err != nil {
+		return "", fmt.Errorf("error retrieving secret from Etcd: %s",
+			err.Error())
+	}
+
+	value, err := box.Open(resp.Node.Value, s.key())
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret: %s", err.Error())
+	}
+
+	return value, nil
+}
+
+// Delete removes a secret from Etcd
+func (s Secret) Delete(ctx context.Context, etcdKV etcd.KeysAPI) error {
+	_, err := etcdKV.Delete(ctx, s.key(), nil)
+	return err
+}
+
+// GetSecretNames returns the names of the secrets in a repository and
+// environment scope in alphabetical order. An empty environment selects the
+// secrets used by every environment.
+func GetSecretNames(ctx context.Context, etcdKV etcd.KeysAPI,
+	repoID RepositoryID, environment string) ([]string, error) {
+
+	scope := Secret{
+		RepositoryID: repoID,
+		Environment:  environment,
+	}
+
+	resp, err := etcdKV.Get(ctx, scope.dirKey(), &etcd.GetOptions{
+		Quorum: true,
+	})
+	if etcd.IsKeyNotFound(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving secrets from Etcd: %s",
+			err.Error())
+	}
+
+	names := []string{}
+
+	for _, node := range resp.Node.Nodes {
+		names = append(names, strings.TrimPrefix(node.Key,
+			scope.dirKey()+"/"))
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// SecretRefs returns the names of the secrets referenced in a configuration
+// value
+func SecretRefs(value string) []string {
+	names := []string{}
+
+	for _, match := range secretRefPattern.FindAllStringSubmatch(value,
+		-1) {
+
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// ReplaceSecretRefs replaces references to secrets in a configuration value
+// with the values returned by lookup
+func ReplaceSecretRefs(value string,
+	lookup func(name string) (string, error)) (string, error) {
+
+	var lookupErr error
+
+	replaced := secretRefPattern.ReplaceAllStringFunc(value,
+		func(ref string) string {
+			if lookupErr != nil {
+				return ref
+			}
+
+			name := secretRefPattern.FindStringSubmatch(ref)[1]
+
+			secret, err := lookup(name)
+			if err != nil {
+				lookupErr = err
+				return ref
+			}
+
+			return secret
+		})
+
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+
+	return replaced, nil
+}
+
+// AddSecret records a secret value used by the job. The value is replaced
+// with SecretRedacted in action output written by FlushOutput.
+func (j *Job) AddSecret(value string) {
+	if len(value) == 0 {
+		return
+	}
+
+	for _, secret := range j.secrets {
+		if secret == value {
+			return
+		}
+	}
+
+	j.secrets = append(j.secrets, value)
+
+	// Replace longer values first, in case one secret contains another
+	sort.Slice(j.secrets, func(a, b int) bool {
+		return len(j.secrets[a]) > len(j.secrets[b])
+	})
+}
+
+// Redact replaces the job's secret values in text. Used for action output
+// and for errors which are logged.
+func (j Job) Redact(text string) string {
+	for _, secret := range j.secrets {
+		text = strings.Replace(text, secret, SecretRedacted, -1)
+	}
+
+	return text
+}
@@ -0,0 +1,494 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// ShortCommitLength is the number of characters in a short Git sha
+const ShortCommitLength int = 7
+
+// TemplateVars is the data available to templates in job configuration
+// string fields. Keys are nested maps, ex: {{ .git.sha }}.
+type TemplateVars map[string]interface{}
+
+// NewTemplateVars creates the template data for a job. now is the time
+// templates are rendered, job configuration is only rendered once so all
+// fields see the same time.
+func NewTemplateVars(job Job, now time.Time) TemplateVars {
+	shortCommit := job.Target.Commit
+	if len(shortCommit) > ShortCommitLength {
+		shortCommit = shortCommit[:ShortCommitLength]
+	}
+
+	ref := job.Target.Branch
+	if len(job.Target.Tag) > 0 {
+		ref = job.Target.Tag
+	}
+
+	now = now.UTC()
+
+	return TemplateVars{
+		"git": map[string]interface{}{
+			"branch":    job.Target.Branch,
+			"tag":       job.Target.Tag,
+			"ref":       ref,
+			"sha":       job.Target.Commit,
+			"short_sha": shortCommit,
+			"pr":        job.Target.PullRequest,
+		},
+		"repository": map[string]interface{}{
+			"owner": job.ID.RepositoryID.Owner,
+			"name":  job.ID.RepositoryID.Name,
+		},
+		"job": map[string]interface{}{
+			"id": job.ID.ID,
+		},
+		"time": map[string]interface{}{
+			"unix":      now.Unix(),
+			"date":      now.Format("20060102"),
+			"timestamp": now.Format("20060102150405"),
+		},
+	}
+}
+
+// PlaceholderBranch is the Git branch templates are rendered with when a
+// configuration file is validated outside of a job, and no branch or tag
+// is given
+const PlaceholderBranch string = "master"
+
+// PlaceholderCommit is the Git sha templates are rendered with when a
+// configuration file is validated outside of a job, and no commit is given
+const PlaceholderCommit string = "0000000000000000000000000000000000000000"
+
+// NewValidationTemplateVars creates template data for validating a
+// configuration file outside of a job. Empty target fields are set to
+// placeholder values, the job ID is 0.
+func NewValidationTemplateVars(repoID RepositoryID,
+	target JobTarget) TemplateVars {
+
+	if len(target.Branch) == 0 && len(target.Tag) == 0 {
+		target.Branch = PlaceholderBranch
+	}
+
+	if len(target.Commit) == 0 {
+		target.Commit = PlaceholderCommit
+	}
+
+	return NewTemplateVars(*NewJob(repoID, target), time.Now())
+}
+
+// withEnvironment returns a copy of the variables with the environment
+// variable set
+func (v TemplateVars) withEnvironment(env string) TemplateVars {
+	vars := TemplateVars{}
+	for key, value := range v {
+		vars[key] = value
+	}
+
+	vars["environment"] = env
+
+	return vars
+}
+
+// slugInvalidPattern matches runs of characters which are not allowed in a
+// DNS label
+var slugInvalidPattern *regexp.Regexp = regexp.MustCompile("[^a-z0-9]+")
+
+// templateFuncs are the only functions templates can call besides Go's
+// built in template functions
+var templateFuncs template.FuncMap = template.FuncMap{
+	"slug": func(s string) string {
+		return strings.Trim(slugInvalidPattern.ReplaceAllString(
+			strings.ToLower(s), "-"), "-")
+	},
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if n >= 0 && len(runes) > n {
+			return string(runes[:n])
+		}
+
+		return s
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// errNeedsEnvironment indicates a template uses the environment variable,
+// but was rendered without one
+var errNeedsEnvironment error = errors.New("the environment variable is " +
+	"not available in docker values, images are built once for all " +
+	"environments")
+
+// usesEnvironment indicates if a checked template node uses the environment
+// variable
+func usesEnvironment(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			if usesEnvironment(child) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesEnvironment(n.Pipe)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if usesEnvironment(arg) {
+					return true
+				}
+			}
+		}
+	case *parse.FieldNode:
+		return n.Ident[0] == "environment"
+	case *parse.VariableNode:
+		return len(n.Ident) > 1 && n.Ident[1] == "environment"
+	}
+
+	return false
+}
+
+// checkTemplateNode returns an error if a template uses anything other than
+// variables, literals, and templateFuncs. Go's control structures and built
+// in functions, ex: range or call, are not allowed, so templates can only
+// output values.
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			err := checkTemplateNode(child)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkTemplateNode(n.Pipe)
+	case *parse.PipeNode:
+		if len(n.Decl) > 0 {
+			return fmt.Errorf("declaring variables is not allowed")
+		}
+
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				err := checkTemplateNode(arg)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.IdentifierNode:
+		if _, ok := templateFuncs[n.Ident]; !ok {
+			return fmt.Errorf("function %s is not allowed", n.Ident)
+		}
+	case *parse.TextNode, *parse.FieldNode, *parse.VariableNode,
+		*parse.DotNode, *parse.StringNode, *parse.NumberNode,
+		*parse.BoolNode:
+	case *parse.IfNode:
+		return fmt.Errorf("if is not allowed")
+	case *parse.RangeNode:
+		return fmt.Errorf("range is not allowed")
+	case *parse.WithNode:
+		return fmt.Errorf("with is not allowed")
+	case *parse.TemplateNode:
+		return fmt.Errorf("template is not allowed")
+	default:
+		return fmt.Errorf("%s is not allowed", node)
+	}
+
+	return nil
+}
+
+// renderTemplate renders one string field. name identifies the field in
+// errors.
+func renderTemplate(name, text string, vars TemplateVars) (string, error) {
+	// Most fields are not templates
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).
+		Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	// Defined templates are parsed into their own trees
+	if len(tmpl.Templates()) > 1 {
+		return "", fmt.Errorf("defining templates is not allowed")
+	}
+
+	err = checkTemplateNode(tmpl.Tree.Root)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := vars["environment"]; !ok &&
+		usesEnvironment(tmpl.Tree.Root) {
+
+		return text, errNeedsEnvironment
+	}
+
+	var out strings.Builder
+
+	err = tmpl.Execute(&out, map[string]interface{}(vars))
+	if err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// unitTemplate is a unit before it was rendered
+type unitTemplate struct {
+	// unit is the unit as written in its configuration file
+	unit UnitConfig
+
+	// dir is the directory of the unit's configuration file, relative to
+	// the repository root. Empty if paths have not been resolved, see
+	// JobConfig.ResolvePaths.
+	dir string
+}
+
+// copyUnit returns a deep copy of a unit
+func copyUnit(unit UnitConfig) (UnitConfig, error) {
+	var unitCopy UnitConfig
+
+	b, err := json.Marshal(unit)
+	if err != nil {
+		return unitCopy, err
+	}
+
+	err = json.Unmarshal(b, &unitCopy)
+
+	return unitCopy, err
+}
+
+// Render replaces the templates in the configuration's string fields with
+// their values. Units are rendered once for each environment into
+// EnvironmentUnits. In Units fields which use the environment variable are
+// left as templates. Docker fields can not use the environment variable, as
+// images are built once for all environments. Returns a ConfigError for the
+// first field which fails to render.
+func (c *JobConfig) Render(vars TemplateVars) error {
+	c.vars = vars
+	c.unitTemplates = map[string]unitTemplate{}
+
+	for _, id := range c.UnitIDs() {
+		unit := c.Units[id]
+
+		raw, err := copyUnit(unit)
+		if err != nil {
+			return configErrorf(id, "error copying unit: %s",
+				err.Error())
+		}
+
+		c.unitTemplates[id] = unitTemplate{
+			unit: raw,
+		}
+
+		if unit.Docker != nil {
+			// Rendered in a copy as the unit is rendered below
+			docker, err := copyUnit(UnitConfig{
+				Docker: unit.Docker,
+			})
+			if err != nil {
+				return configErrorf(id, "error copying unit: %s",
+					err.Error())
+			}
+
+			err = renderFields(reflect.ValueOf(docker.Docker).Elem(),
+				id+".docker", vars, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = renderFields(reflect.ValueOf(&unit).Elem(), id, vars, true)
+		if err != nil {
+			return err
+		}
+
+		c.Units[id] = unit
+	}
+
+	for _, id := range c.environmentIDs() {
+		env := c.Environments[id]
+
+		err := renderFields(reflect.ValueOf(&env).Elem(),
+			fmt.Sprintf("%s.%s", EnvironmentsKey, id),
+			vars.withEnvironment(id), false)
+		if err != nil {
+			return err
+		}
+
+		c.Environments[id] = env
+	}
+
+	return c.renderEnvironmentUnits()
+}
+
+// renderEnvironmentUnits renders each unit for every environment, or for
+// DefaultEnvironment if there are none, into EnvironmentUnits. Local paths
+// are resolved after rendering, if the unit's directory is known.
+func (c *JobConfig) renderEnvironmentUnits() error {
+	envIDs := c.environmentIDs()
+	if len(envIDs) == 0 {
+		envIDs = []string{DefaultEnvironment.ID}
+	}
+
+	c.EnvironmentUnits = map[string]map[string]UnitConfig{}
+
+	for _, envID := range envIDs {
+		units := map[string]UnitConfig{}
+
+		for _, id := range c.UnitIDs() {
+			raw, ok := c.unitTemplates[id]
+			if !ok {
+				units[id] = c.Units[id]
+				continue
+			}
+
+			unit, err := copyUnit(raw.unit)
+			if err != nil {
+				return configErrorf(id, "error copying unit: %s",
+					err.Error())
+			}
+
+			unit.ID = id
+
+			err = renderFields(reflect.ValueOf(&unit).Elem(), id,
+				c.vars.withEnvironment(envID), false)
+			if err != nil {
+				return err
+			}
+
+			if len(raw.dir) > 0 {
+				err = unit.resolvePaths(raw.dir)
+				if err != nil {
+					return prefixConfigError(id, err)
+				}
+			}
+
+			units[id] = unit
+		}
+
+		c.EnvironmentUnits[envID] = units
+	}
+
+	return nil
+}
+
+// UnitFor returns a unit as rendered for an environment. Units is used for
+// configurations which were not rendered for each environment.
+func (c JobConfig) UnitFor(id, envID string) UnitConfig {
+	if unit, ok := c.EnvironmentUnits[envID][id]; ok {
+		return unit
+	}
+
+	return c.Units[id]
+}
+
+// renderedUnits returns a unit as rendered for each environment, in
+// environment ID order
+func (c JobConfig) renderedUnits(id string) []UnitConfig {
+	envIDs := []string{}
+	for envID := range c.EnvironmentUnits {
+		envIDs = append(envIDs, envID)
+	}
+
+	sort.Strings(envIDs)
+
+	units := []UnitConfig{}
+
+	for _, envID := range envIDs {
+		if unit, ok := c.EnvironmentUnits[envID][id]; ok {
+			units = append(units, unit)
+		}
+	}
+
+	if len(units) == 0 {
+		units = append(units, c.Units[id])
+	}
+
+	return units
+}
+
+// renderFields renders every string in a settable value. path is the TOML
+// key of the value. If deferEnvironment is true strings which use the
+// environment variable, when vars has none, are left as templates.
+func renderFields(v reflect.Value, path string, vars TemplateVars,
+	deferEnvironment bool) error {
+
+	switch v.Kind() {
+	case reflect.String:
+		rendered, err := renderTemplate(path, v.String(), vars)
+		if err == errNeedsEnvironment && deferEnvironment {
+			return nil
+		} else if err != nil {
+			return configErrorf(path, "error rendering template: %s",
+				err.Error())
+		}
+
+		v.SetString(rendered)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return renderFields(v.Elem(), path, vars, deferEnvironment)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			key := configFieldKey(v.Type().Field(i))
+			if len(key) == 0 {
+				continue
+			}
+
+			err := renderFields(v.Field(i), path+"."+key, vars,
+				deferEnvironment)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			err := renderFields(v.Index(i), fmt.Sprintf("%s[%d]",
+				path, i), vars, deferEnvironment)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Sorted so the first error is the same each run
+		keys := []string{}
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			// Map values can not be set in place
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(reflect.ValueOf(key)))
+
+			err := renderFields(value, path+"."+key, vars,
+				deferEnvironment)
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(reflect.ValueOf(key), value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	job := NewJob(RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}, JobTarget{
+		Branch:      "feature/Über-Cool",
+		Commit:      "0123456789abcdef",
+		PullRequest: 42,
+	})
+
+	vars := NewTemplateVars(*job, time.Now())
+
+	tests := []struct {
+		text     string
+		rendered string
+	}{
+		{
+			text:     "api-{{ .git.branch | slug }}",
+			rendered: "api-feature-ber-cool",
+		},
+		{
+			text:     "{{ .git.branch | truncate 10 }}",
+			rendered: "feature/Üb",
+		},
+		{
+			text:     "pr-{{ .git.pr }}-{{ .git.short_sha }}",
+			rendered: "pr-42-0123456",
+		},
+		{
+			text:     "{{ $.repository.owner | upper }}",
+			rendered: "OWNER",
+		},
+	}
+
+	for _, test := range tests {
+		rendered, err := renderTemplate("field", test.text, vars)
+		if err != nil {
+			t.Errorf("error rendering %q: %s", test.text,
+				err.Error())
+		} else if rendered != test.rendered {
+			t.Errorf("expected %q to render %q, got %q", test.text,
+				test.rendered, rendered)
+		}
+	}
+}
+
+func TestRenderTemplateOnlyOutputsValues(t *testing.T) {
+	for _, text := range []string{
+		"{{ range .git }}{{ . }}{{ end }}",
+		"{{ if .git.tag }}tag{{ end }}",
+		"{{ with .git }}{{ .sha }}{{ end }}",
+		"{{ define \"x\" }}x{{ end }}",
+		"{{ template \"field\" }}",
+		"{{ $sha := .git.sha }}{{ $sha }}",
+		"{{ printf \"%s\" .git.sha }}",
+		"{{ .git.sha | len }}",
+		"{{ .git.missing }}",
+	} {
+		_, err := renderTemplate("field", text, TemplateVars{
+			"git": map[string]interface{}{
+				"sha": "abc",
+				"tag": "",
+			},
+		})
+		if err == nil {
+			t.Errorf("expected %q to be an error", text)
+		}
+	}
+}
+
+// testTemplateVars renders templates in tests of job configurations
+func testTemplateVars() TemplateVars {
+	return NewTemplateVars(*NewJob(RepositoryID{
+		Owner: "owner",
+		Name:  "repo",
+	}, JobTarget{
+		Branch: "master",
+		Commit: "0123456789abcdef",
+	}), time.Now())
+}
+
+func TestJobConfigRenderUnitsForEnvironments(t *testing.T) {
+	cfg, err := ParseJobConfigFile("kube-git-deploy.toml", `
+[api.docker]
+directory = "."
+tag = "example/api:{{ .git.short_sha }}"
+
+[api.helm]
+chart = "./deploy/{{ .environment }}"
+release = "api-{{ .environment }}"
+namespace = "{{ .environment | upper | lower }}-{{ .git.branch }}"
+
+[environments.production]
+branches = ["master"]
+values = { "env" = "{{ .environment }}" }
+
+[environments.staging]
+branches = ["master"]
+`, testTemplateVars())
+	if err != nil {
+		t.Fatalf("error parsing configuration: %s", err.Error())
+	}
+
+	for _, env := range []string{"production", "staging"} {
+		unit := cfg.UnitFor("api", env)
+
+		if unit.ID != "api" {
+			t.Errorf("expected %s unit ID api, got %s", env, unit.ID)
+		}
+
+		if unit.Docker.Tag != "example/api:0123456" {
+			t.Errorf("expected %s docker tag to be rendered, got %s",
+				env, unit.Docker.Tag)
+		}
+
+		expected := HelmActionConfig{
+			Chart:     "deploy/" + env,
+			Release:   "api-" + env,
+			Namespace: env + "-master",
+		}
+
+		if *unit.Helm != expected {
+			t.Errorf("expected %s helm config %#v, got %#v", env,
+				expected, *unit.Helm)
+		}
+	}
+
+	// Fields which use the environment are left as templates, the rest
+	// is rendered once
+	unit := cfg.Units["api"]
+
+	if unit.Docker.Tag != "example/api:0123456" {
+		t.Errorf("expected docker tag to be rendered, got %s",
+			unit.Docker.Tag)
+	}
+
+	if unit.Helm.Release != "api-{{ .environment }}" {
+		t.Errorf("expected helm release to be a template, got %s",
+			unit.Helm.Release)
+	}
+
+	if cfg.Environments["production"].Values["env"] != "production" {
+		t.Errorf("expected environment value to be rendered, got %s",
+			cfg.Environments["production"].Values["env"])
+	}
+}
+
+func TestJobConfigRenderUnitsWithoutEnvironments(t *testing.T) {
+	cfg, err := ParseJobConfigFile("kube-git-deploy.toml", `
+[api.helm]
+chart = "./deploy"
+release = "api-{{ .environment }}"
+`, testTemplateVars())
+	if err != nil {
+		t.Fatalf("error parsing configuration: %s", err.Error())
+	}
+
+	release := cfg.UnitFor("api", DefaultEnvironment.ID).Helm.Release
+	if release != "api-"+DefaultEnvironment.ID {
+		t.Errorf("expected release api-%s, got %s",
+			DefaultEnvironment.ID, release)
+	}
+}
+
+func TestJobConfigRenderUnitsErrors(t *testing.T) {
+	tests := []struct {
+		cfg  string
+		path string
+	}{
+		// Images are built once for all environments
+		{`
+[api.docker]
+directory = "."
+tag = "example/api:{{ .environment }}"
+`, "api.docker.tag"},
+
+		// Errors in fields which use the environment are found when
+		// parsing
+		{`
+[api.helm]
+chart = "./deploy"
+release = "{{ .environment }}-{{ .git.missing }}"
+`, "api.helm.release"},
+
+		// Fields are validated once rendered
+		{`
+[api.helm]
+chart = "./deploy"
+rollout_timeout = "{{ .environment }}"
+
+[environments.production]
+branches = ["master"]
+`, "api.helm.rollout_timeout"},
+
+		// Rendered paths can not leave the repository
+		{`
+[api.kubernetes]
+directory = "../{{ .environment }}"
+`, "api.kubernetes.directory"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseJobConfigFile("kube-git-deploy.toml", test.cfg,
+			testTemplateVars())
+
+		errs := configErrorList(err)
+		if len(errs) != 1 || errs[0].Path != test.path {
+			t.Errorf("expected error at %s for %s, got: %v", test.path,
+				test.cfg, err)
+		}
+	}
+}
+
+func TestMergeJobConfigsRendersUnitsForEnvironments(t *testing.T) {
+	vars := testTemplateVars()
+	cfgs := map[string]JobConfig{}
+
+	for dir, data := range map[string]string{
+		".": `
+[environments.production]
+branches = ["master"]
+`,
+		"services/web": `
+[app.kustomize]
+directory = "./overlays/{{ .environment }}"
+`,
+	} {
+		cfg, err := ParseJobConfigFile(dir+"/kube-git-deploy.toml", data,
+			vars)
+		if err != nil {
+			t.Fatalf("error parsing %s configuration: %s", dir,
+				err.Error())
+		}
+
+		cfgs[dir] = cfg
+	}
+
+	merged, err := MergeJobConfigs(cfgs)
+	if err != nil {
+		t.Fatalf("error merging configurations: %s", err.Error())
+	}
+
+	unit := merged.UnitFor("services-web-app", "production")
+
+	if unit.ID != "services-web-app" {
+		t.Errorf("expected unit ID services-web-app, got %s", unit.ID)
+	}
+
+	if unit.Kustomize == nil ||
+		unit.Kustomize.Directory != "services/web/overlays/production" {
+
+		t.Errorf("expected kustomize directory rendered for production "+
+			"and resolved, got %#v", unit.Kustomize)
+	}
+}
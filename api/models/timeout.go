@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// TimeoutActions are the names of the unit actions which can have a timeout
+var TimeoutActions []string = []string{"docker", "helm", "kubernetes",
+	"kustomize", "rollback"}
+
+// TimeoutFor returns the unit's timeout for one of its actions. Returns false
+// if the unit does not set a timeout for the action.
+func (c UnitConfig) TimeoutFor(action string) (time.Duration, bool) {
+	timeoutStr, ok := c.Timeouts[action]
+	if !ok {
+		return 0, false
+	}
+
+	// Validated when the configuration was parsed
+	timeout, _ := time.ParseDuration(timeoutStr)
+
+	return timeout, true
+}
+
+// validateTimeouts checks the unit's timeouts are for known actions and can
+// be parsed
+func (c UnitConfig) validateTimeouts() error {
+	for action, timeoutStr := range c.Timeouts {
+		known := false
+		for _, name := range TimeoutActions {
+			if name == action {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return configErrorf("timeouts."+action, "action must "+
+				"be one of: %s", strings.Join(TimeoutActions, ", "))
+		}
+
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return configErrorf("timeouts."+action, "invalid: %s",
+				err.Error())
+		}
+
+		if timeout <= 0 {
+			return configErrorf("timeouts."+action,
+				"must be positive")
+		}
+	}
+
+	return nil
+}
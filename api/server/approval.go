@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// ApproveDeployHandler records a user's decision on a deploy which is
+// awaiting approval, then resumes the job
+type ApproveDeployHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to resume jobs
+	jobRunner *jobs.JobRunner
+}
+
+// ApproveDeployRequest is the body of an approval request
+type ApproveDeployRequest struct {
+	// Approved indicates if the deploy is approved or rejected
+	Approved bool `json:"approved"`
+
+	// Comment is the reason for the decision
+	Comment string `json:"comment"`
+}
+
+// ServeHTTP implements http.Handler
+func (h ApproveDeployHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	repoID := models.RepositoryID{
+		Owner: vars["user"],
+		Name:  vars["repo"],
+	}
+
+	// JSON decode body
+	var req ApproveDeployRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": "body must be a JSON object with " +
+					"\"approved\" and \"comment\" fields",
+			})
+		return
+	}
+
+	// Identify user
+	user, err := requestGitHubUser(h.ctx, r)
+	if err != nil {
+		responder.Respond(http.StatusUnauthorized,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	// Get job
+	job := models.Job{
+		ID: models.JobID{
+			RepositoryID: repoID,
+			ID:           jobID,
+		},
+	}
+
+	err = job.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	// Find approval
+	now := time.Now()
+
+	_, err = pendingApproval(&job, vars["unit"], vars["env"], now)
+	if err != nil {
+		responder.Respond(http.StatusConflict, map[string]interface{}{
+			"ok":    false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Check user can approve
+	unit := job.Config.UnitFor(vars["unit"], vars["env"])
+	env, _ := job.Config.GetEnvironment(vars["env"])
+
+	authorized, err := h.canApprove(repoID, unit.ApprovalFor(env), user)
+	if err != nil {
+		h.logger.Errorf("error checking if user can approve, user: %s, "+
+			"error: %s", user, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to check permissions",
+			})
+		return
+	}
+
+	if !authorized {
+		responder.Respond(http.StatusForbidden, map[string]interface{}{
+			"ok":    false,
+			"error": "user not allowed to approve deploy",
+		})
+		return
+	}
+
+	// Record decision, unless the approval expired or was decided since
+	// the job was retrieved
+	var decision models.ApprovalDecision
+
+	err = job.Update(h.ctx, h.etcdKV, func() error {
+		envState, err := pendingApproval(&job, vars["unit"], vars["env"],
+			now)
+		if err != nil {
+			return err
+		}
+
+		envState.Approval.Decide(now, req.Approved, user, req.Comment)
+		decision = envState.Approval.Decision
+
+		return nil
+	})
+	if _, ok := err.(approvalError); ok {
+		responder.Respond(http.StatusConflict, map[string]interface{}{
+			"ok":    false,
+			"error": err.Error(),
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error saving Job in Etcd: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job in Etcd",
+			})
+		return
+	}
+
+	// Resume job
+	h.jobRunner.Submit(&job)
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"decision": decision,
+	})
+}
+
+// approvalError explains why a deploy can not be approved
+type approvalError string
+
+// Error implements error.Error
+func (e approvalError) Error() string {
+	return string(e)
+}
+
+// pendingApproval returns the state of a unit's deploy to an environment if
+// it is awaiting an approval decision. Otherwise returns an approvalError.
+func pendingApproval(job *models.Job, unitID, envID string,
+	now time.Time) (*models.EnvironmentState, error) {
+
+	var envState *models.EnvironmentState
+
+	if unitState, ok := job.State.Units[unitID]; ok {
+		envState = unitState.Environments[envID]
+	}
+
+	if envState == nil || envState.ApprovalState == nil ||
+		envState.ApprovalState.Stage != models.AwaitingApproval ||
+		envState.Approval == nil {
+
+		return nil, approvalError("deploy is not awaiting approval")
+	}
+
+	if envState.Approval.Decision == models.ApprovalExpired ||
+		envState.Approval.Expired(now) {
+
+		return nil, approvalError("approval has expired")
+	}
+
+	if envState.Approval.Decision != models.ApprovalPending {
+		return nil, approvalError("deploy is not awaiting approval")
+	}
+
+	// The worker saves the job one last time while it pauses
+	if !job.State.CleanupState.Done() {
+		return nil, approvalError("job is still pausing, try again")
+	}
+
+	return envState, nil
+}
+
+// canApprove checks if a GitHub user is allowed to make a decision on an
+// approval. If the approval lists approvers the user must be one of them.
+// Otherwise the user must have write access to the repository.
+func (h ApproveDeployHandler) canApprove(repoID models.RepositoryID,
+	approvalCfg *models.ApprovalConfig, user string) (bool, error) {
+
+	if approvalCfg != nil && len(approvalCfg.Approvers) > 0 {
+		return approvalCfg.CanApprove(user), nil
+	}
+
+	return hasWriteAccess(h.ctx, h.etcdKV, repoID, user)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// CancelJobHandler stops a job which has not finished. Running jobs stop
+// within jobs.CancellationPollInterval. The user must have write access to
+// the repository.
+type CancelJobHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to run jobs
+	jobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h CancelJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	repoID := models.RepositoryID{
+		Owner: vars["user"],
+		Name:  vars["repo"],
+	}
+
+	// Identify user
+	user, err := requestGitHubUser(h.ctx, r)
+	if err != nil {
+		responder.Respond(http.StatusUnauthorized,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	authorized, err := hasWriteAccess(h.ctx, h.etcdKV, repoID, user)
+	if err != nil {
+		h.logger.Errorf("error checking if user has write access, user: "+
+			"%s, error: %s", user, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to check permissions",
+			})
+		return
+	}
+
+	if !authorized {
+		responder.Respond(http.StatusForbidden, map[string]interface{}{
+			"ok":    false,
+			"error": "user not allowed to cancel jobs",
+		})
+		return
+	}
+
+	// Get job
+	job := models.Job{
+		ID: models.JobID{
+			RepositoryID: repoID,
+			ID:           jobID,
+		},
+	}
+
+	err = job.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	if job.State.Done() {
+		responder.Respond(http.StatusConflict, map[string]interface{}{
+			"ok":    false,
+			"error": "job already finished",
+		})
+		return
+	}
+
+	// Record cancellation
+	cancellation := models.JobCancellation{
+		JobID: job.ID,
+		User:  user,
+		Time:  time.Now(),
+	}
+
+	err = cancellation.Set(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving job cancellation, Job.ID: %#v, "+
+			"error: %s", job.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job cancellation in Etcd",
+			})
+		return
+	}
+
+	h.logger.Infof("job %#v canceled by %s", job.ID, user)
+
+	// Paused jobs are not running, so run them again to stop them. Queued
+	// and running jobs check for the cancellation themselves.
+	if job.State.Paused() && job.State.CleanupState.Done() {
+		h.jobRunner.Submit(&job)
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/github"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// errRefNotFound indicates a Git ref does not exist in a repository
+var errRefNotFound error = errors.New("ref not found")
+
+// DeployHandler creates a job for a branch or tag, as if it was pushed
+type DeployHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to run jobs
+	jobRunner *jobs.JobRunner
+}
+
+// DeployRequest is the body of a deploy request
+type DeployRequest struct {
+	// Ref is the branch or tag to deploy. Either a name, which is looked
+	// up as a branch then as a tag, or a full "refs/heads/<branch>" or
+	// "refs/tags/<tag>" ref.
+	Ref string `json:"ref"`
+}
+
+// ServeHTTP implements http.Handler
+func (h DeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	repo := models.Repository{
+		ID: models.RepositoryID{
+			Owner: vars["user"],
+			Name:  vars["repo"],
+		},
+	}
+
+	// JSON decode body
+	var req DeployRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.Ref) == 0 {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "body must be a JSON object with a \"ref\" field",
+			})
+		return
+	}
+
+	// Check repository is tracked
+	err = repo.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "repository not tracked",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving repository, ID: %#v, error: %s",
+			repo.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve repository",
+			})
+		return
+	}
+
+	// Find commit
+	ghClient, err := libgh.NewClient(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error creating GitHub client: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to create GitHub client",
+			})
+		return
+	}
+
+	target, err := resolveRef(h.ctx, ghClient, repo.ID, req.Ref)
+	if err == errRefNotFound {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok": false,
+			"error": fmt.Sprintf("no branch or tag named %s",
+				req.Ref),
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error resolving Git ref, ref: %s, error: %s",
+			req.Ref, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to find ref's commit on GitHub",
+			})
+		return
+	}
+
+	// Create job
+	job := models.NewJob(repo.ID, target)
+
+	err = job.Create(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving Job in Etcd: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job in Etcd",
+			})
+		return
+	}
+
+	// Run job
+	h.jobRunner.Submit(job)
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":     true,
+		"job_id": job.ID.ID,
+		"target": job.Target,
+	})
+}
+
+// resolveRef finds the commit a branch or tag points to. Names which are
+// both a branch and a tag resolve to the branch. Returns errRefNotFound if
+// there is no such branch or tag.
+func resolveRef(ctx context.Context, ghClient *github.Client,
+	repoID models.RepositoryID, ref string) (models.JobTarget, error) {
+
+	refs := []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	if strings.HasPrefix(ref, "refs/heads/") ||
+		strings.HasPrefix(ref, "refs/tags/") {
+
+		refs = []string{ref}
+	}
+
+	for _, fullRef := range refs {
+		commit, resp, err := ghClient.Repositories.GetCommitSHA1(ctx,
+			repoID.Owner, repoID.Name, fullRef, "")
+		if resp != nil && (resp.StatusCode == http.StatusNotFound ||
+			resp.StatusCode == http.StatusUnprocessableEntity) {
+			continue
+		} else if err != nil {
+			return models.JobTarget{}, err
+		}
+
+		target := models.JobTarget{
+			Commit: commit,
+		}
+
+		if name := strings.TrimPrefix(fullRef,
+			"refs/tags/"); name != fullRef {
+
+			target.Tag = name
+		} else {
+			target.Branch = strings.TrimPrefix(fullRef, "refs/heads/")
+
+			target.PullRequest, err = findPullRequest(ctx, ghClient,
+				repoID, target.Branch)
+			if err != nil {
+				return models.JobTarget{}, err
+			}
+		}
+
+		return target, nil
+	}
+
+	return models.JobTarget{}, errRefNotFound
+}
+
+// findPullRequest finds the open pull request whose head is a branch of the
+// repository. Returns 0 if there is none.
+func findPullRequest(ctx context.Context, ghClient *github.Client,
+	repoID models.RepositoryID, branch string) (int, error) {
+
+	pulls, _, err := ghClient.PullRequests.List(ctx, repoID.Owner,
+		repoID.Name, &github.PullRequestListOptions{
+			State: "open",
+			Head:  fmt.Sprintf("%s:%s", repoID.Owner, branch),
+		})
+	if err != nil {
+		return 0, fmt.Errorf("error listing pull requests: %s", err.Error())
+	}
+
+	if len(pulls) == 0 {
+		return 0, nil
+	}
+
+	return pulls[0].GetNumber(), nil
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GetFreezeWindowsHandler returns a list of freeze windows
+type GetFreezeWindowsHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetFreezeWindowsHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get freeze windows
+	windows, err := models.GetAllFreezeWindows(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error getting freeze windows from Etcd: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve freeze windows from Etcd",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":             true,
+		"freeze_windows": windows,
+	})
+}
+
+// CreateFreezeWindowHandler creates a freeze window
+type CreateFreezeWindowHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h CreateFreezeWindowHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// JSON decode body
+	var window models.FreezeWindow
+
+	err := json.NewDecoder(r.Body).Decode(&window)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "body must be a freeze window JSON object",
+			})
+		return
+	}
+
+	err = window.Validate()
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": fmt.Sprintf("invalid freeze window: %s",
+					err.Error()),
+			})
+		return
+	}
+
+	// Save
+	err = window.Create(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving freeze window in Etcd: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save freeze window in Etcd",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":            true,
+		"freeze_window": window,
+	})
+}
+
+// DeleteFreezeWindowHandler deletes a freeze window
+type DeleteFreezeWindowHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h DeleteFreezeWindowHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "freeze window ID must be an integer",
+			})
+		return
+	}
+
+	// Delete
+	window := models.FreezeWindow{
+		ID: id,
+	}
+
+	err = window.Delete(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "freeze window not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error deleting freeze window, ID: %d, error: %s",
+			id, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to delete freeze window",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
+
+// GetFreezeOverridesHandler returns the audit log of freeze overrides
+type GetFreezeOverridesHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetFreezeOverridesHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get overrides
+	overrides, err := models.GetFreezeOverrides(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error getting freeze overrides from Etcd: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok": false,
+				"error": "failed to retrieve freeze overrides from " +
+					"Etcd",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":        true,
+		"overrides": overrides,
+	})
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	etcd "go.etcd.io/etcd/client"
+)
+
+// errNoAuthHeader indicates a request did not include a GitHub auth token
+var errNoAuthHeader error = errors.New("Authorization header with a " +
+	"GitHub auth token required")
+
+// requestGitHubUser returns the login of the GitHub user whose auth token is
+// in a request's Authorization header, formatted as "token TOKEN"
+func requestGitHubUser(ctx context.Context, r *http.Request) (string,
+	error) {
+
+	authToken := strings.TrimPrefix(r.Header.Get("Authorization"),
+		"token ")
+	if len(authToken) == 0 {
+		return "", errNoAuthHeader
+	}
+
+	ghUser, _, err := libgh.NewTokenClient(ctx, authToken).Users.Get(ctx,
+		"")
+	if err != nil {
+		return "", errors.New("invalid GitHub auth token")
+	}
+
+	return ghUser.GetLogin(), nil
+}
+
+// hasWriteAccess indicates if a GitHub user has write access to a repository
+func hasWriteAccess(ctx context.Context, etcdKV etcd.KeysAPI,
+	repoID models.RepositoryID, user string) (bool, error) {
+
+	ghClient, err := libgh.NewClient(ctx, etcdKV)
+	if err != nil {
+		return false, err
+	}
+
+	level, _, err := ghClient.Repositories.GetPermissionLevel(ctx,
+		repoID.Owner, repoID.Name, user)
+	if err != nil {
+		return false, err
+	}
+
+	permission := level.GetPermission()
+
+	return permission == "admin" || permission == "write", nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GetJobsHandler returns a repository's jobs, newest first
+type GetJobsHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetJobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	repoID := models.RepositoryID{
+		Owner: vars["user"],
+		Name:  vars["repo"],
+	}
+
+	limit := 0
+
+	if limitStr := r.URL.Query().Get("limit"); len(limitStr) > 0 {
+		var err error
+
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			responder.Respond(http.StatusBadRequest,
+				map[string]interface{}{
+					"ok": false,
+					"error": "\"limit\" URL query parameter " +
+						"must be an integer greater than 0",
+				})
+			return
+		}
+	}
+
+	// Get jobs
+	jobs, err := models.GetAllJobs(h.ctx, h.etcdKV, repoID)
+	if err != nil {
+		h.logger.Errorf("error retrieving jobs, RepositoryID: %#v, "+
+			"error: %s", repoID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve jobs",
+			})
+		return
+	}
+
+	// Newest first
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":   true,
+		"jobs": jobs,
+	})
+}
+
+// GetJobHandler returns one job
+type GetJobHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	// Get job
+	job := models.Job{
+		ID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: vars["user"],
+				Name:  vars["repo"],
+			},
+			ID: jobID,
+		},
+	}
+
+	err = job.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"job":     job,
+		"actions": job.State.ActionNames(),
+	})
+}
@@ -53,6 +53,7 @@ func (h GHLoginURLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Return login URL
 	responder.Respond(http.StatusOK, map[string]interface{}{
 		"login_url": u.String(),
+		"client_id": h.cfg.GitHubClientID,
 		"ok":        true,
 	})
 }
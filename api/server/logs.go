@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+)
+
+// DefaultLogLimit is the number of log lines returned if the limit query
+// parameter is not provided
+const DefaultLogLimit int = 500
+
+// GetJobLogsHandler returns a page of an action's output
+type GetJobLogsHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// logStore holds job action output
+	logStore models.LogStore
+}
+
+// ServeHTTP implements http.Handler
+func (h GetJobLogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	query := r.URL.Query()
+
+	action := query.Get("action")
+	if len(action) == 0 {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "\"action\" URL query parameter required",
+			})
+		return
+	}
+
+	offset := 0
+	limit := DefaultLogLimit
+
+	if offsetStr := query.Get("offset"); len(offsetStr) > 0 {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			responder.Respond(http.StatusBadRequest,
+				map[string]interface{}{
+					"ok": false,
+					"error": "\"offset\" URL query parameter " +
+						"must be a positive integer",
+				})
+			return
+		}
+	}
+
+	if limitStr := query.Get("limit"); len(limitStr) > 0 {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			responder.Respond(http.StatusBadRequest,
+				map[string]interface{}{
+					"ok": false,
+					"error": "\"limit\" URL query parameter " +
+						"must be an integer greater than 0",
+				})
+			return
+		}
+	}
+
+	// Read log
+	logID := models.LogID{
+		JobID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: vars["user"],
+				Name:  vars["repo"],
+			},
+			ID: jobID,
+		},
+		Action: action,
+	}
+
+	if err = logID.Validate(); err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": "\"action\" URL query parameter " +
+					"invalid: " + err.Error(),
+			})
+		return
+	}
+
+	lines, total, err := h.logStore.Read(h.ctx, logID, offset, limit)
+	if err != nil {
+		h.logger.Errorf("error reading job log, LogID: %#v, error: %s",
+			logID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to read job log",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":     true,
+		"lines":  lines,
+		"offset": offset,
+		"total":  total,
+	})
+}
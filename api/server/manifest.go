@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GetRenderedManifestHandler returns the manifest a unit deployed to an
+// environment in a job
+type GetRenderedManifestHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetRenderedManifestHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	// Get manifest
+	manifest := models.RenderedManifest{
+		JobID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: vars["user"],
+				Name:  vars["repo"],
+			},
+			ID: jobID,
+		},
+		Environment: vars["env"],
+		UnitID:      vars["unit"],
+	}
+
+	err = manifest.Get(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error retrieving rendered manifest, JobID: "+
+			"%#v, environment: %s, unit: %s, error: %s",
+			manifest.JobID, manifest.Environment, manifest.UnitID,
+			err.Error())
+
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "rendered manifest not found",
+		})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"manifest": manifest.Manifest,
+		"digest":   manifest.Digest(),
+	})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// OverrideFreezeHandler lets a job held by freeze windows deploy anyway. The
+// override is recorded in the job and in the freeze override audit log.
+type OverrideFreezeHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to resume jobs
+	jobRunner *jobs.JobRunner
+}
+
+// OverrideFreezeRequest is the body of a freeze override request
+type OverrideFreezeRequest struct {
+	// BreakGlass must be true, so overrides are never made by accident
+	BreakGlass bool `json:"break_glass"`
+
+	// Reason explains why the freeze is being overridden
+	Reason string `json:"reason"`
+}
+
+// ServeHTTP implements http.Handler
+func (h OverrideFreezeHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	repoID := models.RepositoryID{
+		Owner: vars["user"],
+		Name:  vars["repo"],
+	}
+
+	// JSON decode body
+	var req OverrideFreezeRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || !req.BreakGlass || len(req.Reason) == 0 {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": "body must be a JSON object with " +
+					"\"break_glass\" set to true and a \"reason\"",
+			})
+		return
+	}
+
+	// Identify user
+	user, err := requestGitHubUser(h.ctx, r)
+	if err != nil {
+		responder.Respond(http.StatusUnauthorized,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	authorized, err := hasWriteAccess(h.ctx, h.etcdKV, repoID, user)
+	if err != nil {
+		h.logger.Errorf("error checking if user has write access, user: "+
+			"%s, error: %s", user, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to check permissions",
+			})
+		return
+	}
+
+	if !authorized {
+		responder.Respond(http.StatusForbidden, map[string]interface{}{
+			"ok":    false,
+			"error": "user not allowed to override freezes",
+		})
+		return
+	}
+
+	// Get job
+	job := models.Job{
+		ID: models.JobID{
+			RepositoryID: repoID,
+			ID:           jobID,
+		},
+	}
+
+	err = job.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			job.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	// The worker saves the job one last time while it pauses
+	if !job.State.Frozen() || !job.State.CleanupState.Done() {
+		responder.Respond(http.StatusConflict, map[string]interface{}{
+			"ok":    false,
+			"error": "job is not held by a freeze",
+		})
+		return
+	}
+
+	// Record override
+	windows, err := models.GetAllFreezeWindows(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error retrieving freeze windows: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve freeze windows",
+			})
+		return
+	}
+
+	now := time.Now()
+
+	override := models.FreezeOverride{
+		JobID:           job.ID,
+		User:            user,
+		Reason:          req.Reason,
+		Time:            now,
+		FreezeWindowIDs: []int64{},
+	}
+
+	for _, window := range windows {
+		if window.Active(now) && window.AppliesTo(repoID,
+			window.Environment) {
+
+			override.FreezeWindowIDs = append(override.FreezeWindowIDs,
+				window.ID)
+		}
+	}
+
+	err = override.Audit(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error auditing freeze override: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to audit freeze override",
+			})
+		return
+	}
+
+	h.logger.Infof("freeze override for job %#v by %s: %s", job.ID, user,
+		req.Reason)
+
+	job.FreezeOverride = &override
+
+	err = job.Set(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving Job in Etcd: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job in Etcd",
+			})
+		return
+	}
+
+	// Resume job
+	h.jobRunner.Submit(&job)
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
@@ -5,6 +5,9 @@ import (
 	"net/http"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/config"
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
 
 	"github.com/Noah-Huppert/golog"
 	"github.com/gorilla/mux"
@@ -13,7 +16,8 @@ import (
 
 // NewPrivateServer creates a new server for private API endpoints
 func NewPrivateServer(ctx context.Context, logger golog.Logger,
-	cfg *config.Config, etcdKV etcd.KeysAPI) Server {
+	cfg *config.Config, etcdKV etcd.KeysAPI, logStore models.LogStore,
+	secretsBox libsecret.Box, jobRunner *jobs.JobRunner) Server {
 	logger = logger.GetChild("http.private")
 
 	// Setup routes
@@ -61,6 +65,189 @@ func NewPrivateServer(ctx context.Context, logger golog.Logger,
 			etcdKV: etcdKV,
 		}).Methods("DELETE")
 
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/settings",
+		UpdateRepositorySettingsHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("github.settings"),
+			etcdKV: etcdKV,
+		}).Methods("PATCH")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/config/validate",
+		ValidateConfigHandler{
+			logger: logger.GetChild("github.config.validate"),
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/secrets",
+		GetSecretsHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("github.secrets.get"),
+			etcdKV: etcdKV,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/secrets/{name}",
+		SetSecretHandler{
+			ctx:        ctx,
+			logger:     logger.GetChild("github.secrets.set"),
+			etcdKV:     etcdKV,
+			secretsBox: secretsBox,
+		}).Methods("PUT")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/secrets/{name}",
+		DeleteSecretHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("github.secrets.delete"),
+			etcdKV: etcdKV,
+		}).Methods("DELETE")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/environments/{env}/secrets",
+		GetSecretsHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("github.environment_secrets.get"),
+			etcdKV: etcdKV,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/environments/{env}/secrets/{name}",
+		SetSecretHandler{
+			ctx:        ctx,
+			logger:     logger.GetChild("github.environment_secrets.set"),
+			etcdKV:     etcdKV,
+			secretsBox: secretsBox,
+		}).Methods("PUT")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/environments/{env}/secrets/{name}",
+		DeleteSecretHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("github.environment_secrets.delete"),
+			etcdKV: etcdKV,
+		}).Methods("DELETE")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs",
+		GetJobsHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("jobs.list"),
+			etcdKV: etcdKV,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs",
+		DeployHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.deploy"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}",
+		GetJobHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("jobs.get"),
+			etcdKV: etcdKV,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/cancel",
+		CancelJobHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.cancel"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/rerun",
+		RerunJobHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.rerun"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/logs",
+		GetJobLogsHandler{
+			ctx:      ctx,
+			logger:   logger.GetChild("jobs.logs"),
+			logStore: logStore,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/environments/{env}/units/{unit}/manifest",
+		GetRenderedManifestHandler{
+			ctx:    ctx,
+			logger: logger.GetChild("jobs.manifest"),
+			etcdKV: etcdKV,
+		}).Methods("GET")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/rollback",
+		RollbackJobHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.rollback"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/units/{unit}/environments/{env}/approval",
+		ApproveDeployHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.approval"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/promote",
+		PromoteJobHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.promote"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/github/repositories/{user}/{repo}/jobs/{id}/freeze_override",
+		OverrideFreezeHandler{
+			ctx:       ctx,
+			logger:    logger.GetChild("jobs.freeze_override"),
+			etcdKV:    etcdKV,
+			jobRunner: jobRunner,
+		}).Methods("POST")
+
+	router.Handle("/api/v0/freezes", GetFreezeWindowsHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("freezes.get"),
+		etcdKV: etcdKV,
+	}).Methods("GET")
+
+	router.Handle("/api/v0/freezes", CreateFreezeWindowHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("freezes.create"),
+		etcdKV: etcdKV,
+	}).Methods("POST")
+
+	router.Handle("/api/v0/freezes/overrides", GetFreezeOverridesHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("freezes.overrides"),
+		etcdKV: etcdKV,
+	}).Methods("GET")
+
+	router.Handle("/api/v0/freezes/{id}", DeleteFreezeWindowHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("freezes.delete"),
+		etcdKV: etcdKV,
+	}).Methods("DELETE")
+
+	router.Handle("/api/v0/registries", GetRegistriesHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("registries.get"),
+		etcdKV: etcdKV,
+	}).Methods("GET")
+
+	router.Handle("/api/v0/registries/{host}", SetRegistryHandler{
+		ctx:        ctx,
+		logger:     logger.GetChild("registries.set"),
+		etcdKV:     etcdKV,
+		secretsBox: secretsBox,
+	}).Methods("PUT")
+
+	router.Handle("/api/v0/registries/{host}", DeleteRegistryHandler{
+		ctx:    ctx,
+		logger: logger.GetChild("registries.delete"),
+		etcdKV: etcdKV,
+	}).Methods("DELETE")
+
 	router.PathPrefix("/").Handler(http.FileServer(
 		http.Dir("../frontend/dist")))
 
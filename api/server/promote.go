@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// PromoteJobHandler creates a new job which deploys the artifacts a previous
+// job successfully deployed to one environment to another environment.
+// Images are not rebuilt.
+type PromoteJobHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to run jobs
+	jobRunner *jobs.JobRunner
+}
+
+// PromoteJobRequest is the body of a promotion request
+type PromoteJobRequest struct {
+	// From is the environment the source job successfully deployed to
+	From string `json:"from"`
+
+	// To is the environment to deploy to
+	To string `json:"to"`
+}
+
+// ServeHTTP implements http.Handler
+func (h PromoteJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	// JSON decode body
+	var req PromoteJobRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.From) == 0 || len(req.To) == 0 {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": "body must be a JSON object with \"from\" " +
+					"and \"to\" fields",
+			})
+		return
+	}
+
+	// Get job to promote
+	source := models.Job{
+		ID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: vars["user"],
+				Name:  vars["repo"],
+			},
+			ID: jobID,
+		},
+	}
+
+	err = source.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			source.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	if source.Config == nil ||
+		!source.State.EnvironmentSucceeded(req.From) {
+
+		responder.Respond(http.StatusConflict, map[string]interface{}{
+			"ok": false,
+			"error": fmt.Sprintf("job did not successfully deploy to "+
+				"environment %s", req.From),
+		})
+		return
+	}
+
+	if _, ok := source.Config.GetEnvironment(req.To); !ok {
+		responder.Respond(http.StatusBadRequest, map[string]interface{}{
+			"ok": false,
+			"error": fmt.Sprintf("environment %s does not exist",
+				req.To),
+		})
+		return
+	}
+
+	// Create promotion job
+	job := models.NewPromotionJob(source, req.To)
+
+	for id, unit := range source.Config.Units {
+		if _, ok := job.PromotedImages[id]; unit.Docker != nil && !ok {
+			responder.Respond(http.StatusConflict,
+				map[string]interface{}{
+					"ok": false,
+					"error": fmt.Sprintf("job did not record the "+
+						"digest of unit %s's image", id),
+				})
+			return
+		}
+	}
+
+	err = job.Create(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving Job in Etcd: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job in Etcd",
+			})
+		return
+	}
+
+	// Run job
+	h.jobRunner.Submit(job)
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":     true,
+		"job_id": job.ID.ID,
+	})
+}
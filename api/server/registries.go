@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// GetRegistriesHandler lists Docker registries. Credentials are never
+// returned.
+type GetRegistriesHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetRegistriesHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get registries
+	registries, err := models.GetAllRegistries(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error retrieving registries: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve registries",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"registries": registries,
+	})
+}
+
+// SetRegistryHandler creates or replaces a Docker registry
+type SetRegistryHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// secretsBox encrypts registry credentials
+	secretsBox libsecret.Box
+}
+
+// SetRegistryRequest is the body of a set registry request
+type SetRegistryRequest struct {
+	// AuthType is how the registry is authenticated with
+	AuthType models.RegistryAuthType `json:"auth_type"`
+
+	// Username is the user which authenticates with the registry
+	Username string `json:"username"`
+
+	// Repositories are glob patterns which match the GitHub repositories
+	// which may use the registry
+	Repositories []string `json:"repositories"`
+
+	// Credential is the password, token, or Docker config JSON file
+	Credential string `json:"credential"`
+}
+
+// ServeHTTP implements http.Handler
+func (h SetRegistryHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	if !h.secretsBox.HasKey() {
+		responder.Respond(http.StatusServiceUnavailable,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "SECRETS_KEY not configured",
+			})
+		return
+	}
+
+	// JSON decode body
+	var req SetRegistryRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "body must be a JSON object",
+			})
+		return
+	}
+
+	registry := models.Registry{
+		Host:         mux.Vars(r)["host"],
+		AuthType:     req.AuthType,
+		Username:     req.Username,
+		Repositories: req.Repositories,
+	}
+
+	err = registry.Validate(req.Credential)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	// Save
+	err = registry.Set(h.ctx, h.etcdKV, h.secretsBox, req.Credential)
+	if err != nil {
+		h.logger.Errorf("error saving registry %s: %s", registry.Host,
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save registry",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"registry": registry,
+	})
+}
+
+// DeleteRegistryHandler removes a Docker registry
+type DeleteRegistryHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h DeleteRegistryHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	registry := models.Registry{
+		Host: mux.Vars(r)["host"],
+	}
+
+	// Delete
+	err := registry.Delete(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "registry not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error deleting registry %s: %s", registry.Host,
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to delete registry",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
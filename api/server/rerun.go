@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// RerunJobHandler creates a new job for the same Git event as a previous
+// job. Unlike a rollback the configuration file is read again, and images
+// are rebuilt if their build context changed.
+type RerunJobHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// jobRunner is used to run jobs
+	jobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h RerunJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	jobID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "job ID must be an integer",
+			})
+		return
+	}
+
+	// Get job to re-run
+	source := models.Job{
+		ID: models.JobID{
+			RepositoryID: models.RepositoryID{
+				Owner: vars["user"],
+				Name:  vars["repo"],
+			},
+			ID: jobID,
+		},
+	}
+
+	err = source.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "job not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving job, Job.ID: %#v, error: %s",
+			source.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve job",
+			})
+		return
+	}
+
+	// Create job
+	job := models.NewJob(source.ID.RepositoryID, source.Target)
+	job.Environments = source.Environments
+
+	err = job.Create(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving Job in Etcd: %s", err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save job in Etcd",
+			})
+		return
+	}
+
+	// Run job
+	h.jobRunner.Submit(job)
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":     true,
+		"job_id": job.ID.ID,
+	})
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/libsecret"
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// secretFromVars creates a secret model from URL parameters. The env
+// parameter is only present in environment secret routes.
+func secretFromVars(vars map[string]string) models.Secret {
+	return models.Secret{
+		RepositoryID: models.RepositoryID{
+			Owner: vars["user"],
+			Name:  vars["repo"],
+		},
+		Environment: vars["env"],
+		Name:        vars["name"],
+	}
+}
+
+// GetSecretsHandler lists the names of a repository's secrets. Values are
+// never returned.
+type GetSecretsHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h GetSecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	scope := secretFromVars(mux.Vars(r))
+
+	// Get names
+	names, err := models.GetSecretNames(h.ctx, h.etcdKV,
+		scope.RepositoryID, scope.Environment)
+	if err != nil {
+		h.logger.Errorf("error retrieving secret names, repository: "+
+			"%#v, environment: %s, error: %s", scope.RepositoryID,
+			scope.Environment, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve secrets",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"secrets": names,
+	})
+}
+
+// SetSecretHandler encrypts and stores a repository secret
+type SetSecretHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+
+	// secretsBox encrypts secrets
+	secretsBox libsecret.Box
+}
+
+// SetSecretRequest is the body of a set secret request
+type SetSecretRequest struct {
+	// Value is the secret's value
+	Value string `json:"value"`
+}
+
+// ServeHTTP implements http.Handler
+func (h SetSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	if !h.secretsBox.HasKey() {
+		responder.Respond(http.StatusServiceUnavailable,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "SECRETS_KEY not configured",
+			})
+		return
+	}
+
+	// Get URL parameters
+	secret := secretFromVars(mux.Vars(r))
+
+	err := secret.Validate()
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	// JSON decode body
+	var req SetSecretRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "body must be a JSON object",
+			})
+		return
+	}
+
+	// Check repository is tracked
+	repo := models.Repository{
+		ID: secret.RepositoryID,
+	}
+
+	found, err := repo.Exists(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error determining if repository exists: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve repository",
+			})
+		return
+	} else if !found {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "repository not tracked",
+		})
+		return
+	}
+
+	// Save
+	err = secret.Set(h.ctx, h.etcdKV, h.secretsBox, req.Value)
+	if err != nil {
+		h.logger.Errorf("error saving secret, repository: %#v, "+
+			"environment: %s, name: %s, error: %s",
+			secret.RepositoryID, secret.Environment, secret.Name,
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save secret",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
+
+// DeleteSecretHandler removes a repository secret
+type DeleteSecretHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// ServeHTTP implements http.Handler
+func (h DeleteSecretHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	secret := secretFromVars(mux.Vars(r))
+
+	// Delete
+	err := secret.Delete(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "secret not found",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error deleting secret, repository: %#v, "+
+			"environment: %s, name: %s, error: %s",
+			secret.RepositoryID, secret.Environment, secret.Name,
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to delete secret",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok": true,
+	})
+}
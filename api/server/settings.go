@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	etcd "go.etcd.io/etcd/client"
+)
+
+// UpdateRepositorySettingsHandler changes the settings of a tracked
+// repository
+type UpdateRepositorySettingsHandler struct {
+	// ctx is context
+	ctx context.Context
+
+	// logger prints debug information
+	logger golog.Logger
+
+	// etcdKV is an Etcd key value API client
+	etcdKV etcd.KeysAPI
+}
+
+// UpdateRepositorySettingsRequest is the body of a repository settings
+// request. Fields which are not set are not changed.
+type UpdateRepositorySettingsRequest struct {
+	// FetchStrategy decides how jobs download the repository
+	FetchStrategy *models.FetchStrategy `json:"fetch_strategy"`
+
+	// ConfigPath is the path of the job configuration file. An empty
+	// string resets it to the default.
+	ConfigPath *string `json:"config_path"`
+
+	// ConfigDiscovery decides where jobs look for configuration files
+	ConfigDiscovery *models.ConfigDiscovery `json:"config_discovery"`
+}
+
+// ServeHTTP implements http.Handler
+func (h UpdateRepositorySettingsHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Get URL parameters
+	vars := mux.Vars(r)
+
+	repo := models.Repository{
+		ID: models.RepositoryID{
+			Owner: vars["user"],
+			Name:  vars["repo"],
+		},
+	}
+
+	// JSON decode body
+	var req UpdateRepositorySettingsRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "body must be a JSON object",
+			})
+		return
+	}
+
+	if req.FetchStrategy != nil &&
+		!models.ValidFetchStrategy(*req.FetchStrategy) {
+
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": fmt.Sprintf("fetch_strategy must be "+
+					"\"%s\", \"%s\", or \"%s\"", models.FetchTarball,
+					models.FetchShallow, models.FetchFull),
+			})
+		return
+	}
+
+	if req.ConfigDiscovery != nil &&
+		!models.ValidConfigDiscovery(*req.ConfigDiscovery) {
+
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": fmt.Sprintf("config_discovery must be "+
+					"\"%s\" or \"%s\"", models.DiscoverRoot,
+					models.DiscoverSubdirectories),
+			})
+		return
+	}
+
+	// Get repository
+	err = repo.Get(h.ctx, h.etcdKV)
+	if etcd.IsKeyNotFound(err) {
+		responder.Respond(http.StatusNotFound, map[string]interface{}{
+			"ok":    false,
+			"error": "repository not tracked",
+		})
+		return
+	} else if err != nil {
+		h.logger.Errorf("error retrieving repository, ID: %#v, error: %s",
+			repo.ID, err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to retrieve repository",
+			})
+		return
+	}
+
+	// Update
+	if req.FetchStrategy != nil {
+		repo.FetchStrategy = *req.FetchStrategy
+	}
+
+	if req.ConfigPath != nil {
+		repo.ConfigPath = *req.ConfigPath
+	}
+
+	if req.ConfigDiscovery != nil {
+		repo.ConfigDiscovery = *req.ConfigDiscovery
+	}
+
+	// Checked after updating, as the settings depend on each other
+	err = repo.ValidateConfigSettings()
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": err.Error(),
+			})
+		return
+	}
+
+	err = repo.Set(h.ctx, h.etcdKV)
+	if err != nil {
+		h.logger.Errorf("error saving repository in Etcd: %s",
+			err.Error())
+
+		responder.Respond(http.StatusInternalServerError,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to save repository in Etcd",
+			})
+		return
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"repository": repo,
+	})
+}
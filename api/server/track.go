@@ -2,9 +2,7 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"net/url"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/config"
 	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
@@ -95,10 +93,10 @@ func (h TrackGHRepoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ... Construct hook URL
-	hookURL, err := url.Parse(h.cfg.PublicHTTPHost)
+	// ... Construct hook configuration
+	hookCfg, err := libgh.WebHookConfig(h.cfg, user, name)
 	if err != nil {
-		h.logger.Errorf("error parsing public HTTP host into URL: %s",
+		h.logger.Errorf("error constructing web hook configuration: %s",
 			err.Error())
 
 		responder.Respond(http.StatusInternalServerError,
@@ -109,23 +107,10 @@ func (h TrackGHRepoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	noSSLVerify := 1
-	if h.cfg.PublicHTTPSSLEnabled {
-		hookURL.Scheme = "https"
-		noSSLVerify = 0
-	}
-
-	hookURL.Path = fmt.Sprintf("/api/v0/github/repositories/%s/%s/web_hook",
-		user, name)
-
 	// ... Call GitHub hook API
 	hook, _, err := ghClient.Repositories.CreateHook(h.ctx, user, name,
 		&github.Hook{
-			Config: map[string]interface{}{
-				"url":          hookURL.String(),
-				"content_type": "json",
-				"insecure_ssl": noSSLVerify,
-			},
+			Config: hookCfg,
 		})
 
 	if err != nil {
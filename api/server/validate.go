@@ -0,0 +1,107 @@
+package server
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Noah-Huppert/kube-git-deploy/api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+)
+
+// MaxValidateConfigBytes is the largest configuration file which can be
+// validated
+const MaxValidateConfigBytes int64 = 1048576
+
+// ValidateConfigHandler validates a job configuration file in the same way a
+// job's prepare action does. The format URL query parameter selects the file
+// format, defaults to TOML. Templates are rendered with the repository in
+// the URL, and the branch, tag, and commit URL query parameters.
+type ValidateConfigHandler struct {
+	// logger prints debug information
+	logger golog.Logger
+}
+
+// ServeHTTP implements http.Handler
+func (h ValidateConfigHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	// Create responder
+	responder := NewJSONResponder(h.logger, w)
+
+	// Read body
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body,
+		MaxValidateConfigBytes+1))
+	if err != nil {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "failed to read body",
+			})
+		return
+	}
+
+	if int64(len(data)) > MaxValidateConfigBytes {
+		responder.Respond(http.StatusRequestEntityTooLarge,
+			map[string]interface{}{
+				"ok":    false,
+				"error": "configuration file too large",
+			})
+		return
+	}
+
+	// Get format
+	query := r.URL.Query()
+
+	format := models.FormatTOML
+	if formatStr := query.Get("format"); len(formatStr) > 0 {
+		format = models.ConfigFormat(formatStr)
+	}
+
+	knownFormat := false
+	for _, f := range models.ConfigFormats {
+		if f == format {
+			knownFormat = true
+		}
+	}
+
+	if !knownFormat {
+		responder.Respond(http.StatusBadRequest,
+			map[string]interface{}{
+				"ok": false,
+				"error": "\"format\" URL query parameter must be " +
+					"\"toml\", \"yaml\", or \"json\"",
+			})
+		return
+	}
+
+	// Validate
+	vars := mux.Vars(r)
+
+	templateVars := models.NewValidationTemplateVars(models.RepositoryID{
+		Owner: vars["user"],
+		Name:  vars["repo"],
+	}, models.JobTarget{
+		Branch: query.Get("branch"),
+		Tag:    query.Get("tag"),
+		Commit: query.Get("commit"),
+	})
+
+	diagnostics := models.DiagnoseJobConfig(string(data), format,
+		templateVars)
+
+	valid := true
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == models.SeverityError {
+			valid = false
+		}
+	}
+
+	responder.Respond(http.StatusOK, map[string]interface{}{
+		"ok":          true,
+		"valid":       valid,
+		"diagnostics": diagnostics,
+	})
+}
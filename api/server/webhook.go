@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/Noah-Huppert/kube-git-deploy/api/jobs"
+	"github.com/Noah-Huppert/kube-git-deploy/api/libgh"
 	"github.com/Noah-Huppert/kube-git-deploy/api/models"
 
 	"github.com/Noah-Huppert/golog"
@@ -81,9 +83,11 @@ func (h WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// ... Parse branch
 	refParts := strings.Split(*(event.Ref), "/")
 
-	if len(refParts) != 3 {
-		h.logger.Errorf("error, ref not in \"refs/head/<branch>\" "+
-			"format, ref: %s", *(event.Ref))
+	if len(refParts) < 3 || refParts[0] != "refs" ||
+		(refParts[1] != "heads" && refParts[1] != "tags") {
+
+		h.logger.Errorf("error, ref not in \"refs/heads/<branch>\" "+
+			"or \"refs/tags/<tag>\" format, ref: %s", *(event.Ref))
 
 		responder.Respond(http.StatusBadRequest,
 			map[string]interface{}{
@@ -92,19 +96,38 @@ func (h WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			})
 		return
 	}
-	branch := refParts[2]
+	refName := strings.Join(refParts[2:], "/")
 
 	// ... Make struct
 	jobTarget := models.JobTarget{
-		Branch: branch,
 		Commit: *(event.After),
 	}
 
-	// Save job in Etcd
-	job := models.NewJob(models.RepositoryID{
+	repoID := models.RepositoryID{
 		Owner: user,
 		Name:  repo,
-	}, jobTarget)
+	}
+
+	if refParts[1] == "tags" {
+		jobTarget.Tag = refName
+	} else {
+		jobTarget.Branch = refName
+	}
+
+	// ... Find pull request. The job still runs if it can not be found,
+	//     without a pull request number.
+	if len(jobTarget.Branch) > 0 {
+		jobTarget.PullRequest, err = h.findPullRequest(repoID,
+			jobTarget.Branch)
+		if err != nil {
+			h.logger.Errorf("error finding pull request of branch, "+
+				"repository: %#v, branch: %s, error: %s", repoID,
+				jobTarget.Branch, err.Error())
+		}
+	}
+
+	// Save job in Etcd
+	job := models.NewJob(repoID, jobTarget)
 
 	err = job.Create(h.ctx, h.etcdKV)
 	if err != nil {
@@ -127,3 +150,16 @@ func (h WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"ok": true,
 	})
 }
+
+// findPullRequest finds the open pull request of a branch with the stored
+// GitHub auth token. Returns 0 if there is none.
+func (h WebHookHandler) findPullRequest(repoID models.RepositoryID,
+	branch string) (int, error) {
+
+	ghClient, err := libgh.NewClient(h.ctx, h.etcdKV)
+	if err != nil {
+		return 0, fmt.Errorf("error creating GitHub client: %s", err.Error())
+	}
+
+	return findPullRequest(h.ctx, ghClient, repoID, branch)
+}